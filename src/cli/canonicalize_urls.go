@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/omnsight/omnibasement/src/services"
+	"github.com/omnsight/omniscent-library/src/clients"
+)
+
+// RunCanonicalizeURLs rewrites the URLs of the existing websites and sources in
+// their canonical form, and prints the number of documents updated. It is run
+// after upgrades changing how URLs are canonicalized.
+//
+//	omnibasement canonicalize-urls
+func RunCanonicalizeURLs(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("canonicalize-urls", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("canonicalize-urls takes no arguments")
+	}
+
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		return fmt.Errorf("failed to establish ArangoDB client: %v", err)
+	}
+
+	changes, err := services.NewChangeLog(client)
+	if err != nil {
+		return err
+	}
+
+	// The command creates no documents, so it needs no idempotency keys
+	websiteService, err := services.NewWebsiteService(client, nil, changes)
+	if err != nil {
+		return err
+	}
+	sourceService, err := services.NewSourceService(client, nil, changes)
+	if err != nil {
+		return err
+	}
+
+	websites, err := websiteService.CanonicalizeURLs(ctx)
+	if err != nil {
+		return err
+	}
+	sources, err := sourceService.CanonicalizeURLs(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Canonicalized the URLs of %d websites and %d sources\n", websites, sources)
+	return nil
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// commands lists the subcommands that run instead of the server.
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"import":            RunImport,
+	"export":            RunExport,
+	"link-websites":     RunLinkWebsites,
+	"normalize-names":   RunNormalizeNames,
+	"canonicalize-urls": RunCanonicalizeURLs,
+	"grade-sources":     RunGradeSources,
+}
+
+// Run executes the subcommand named by the first argument.
+func Run(ctx context.Context, args []string) error {
+	command, ok := commands[args[0]]
+	if !ok {
+		var names []string
+		for name := range commands {
+			names = append(names, name)
+		}
+		return fmt.Errorf("unknown command %q, expected one of: %s", args[0], strings.Join(names, ", "))
+	}
+
+	return command(ctx, args[1:])
+}
+
+// mappingFlag collects repeated key=value flags.
+type mappingFlag map[string]string
+
+func (m mappingFlag) String() string {
+	var pairs []string
+	for key, value := range m {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m mappingFlag) Set(value string) error {
+	key, field, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected column=field, got %q", value)
+	}
+	m[key] = field
+	return nil
+}
+
+// listFlag collects repeated flags.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
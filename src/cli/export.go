@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omnibasement/src/services"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+)
+
+// RunExport writes the graph as JSONL or a STIX 2.1 bundle that the import
+// command can read back, or as GraphML or GEXF for graph tools.
+//
+//	omnibasement export [-format jsonl|stix|graphml|gexf] [-collection NAME]... [-tag TAG]... [-max-sensitivity CONFIDENTIAL] [-start T] [-end T] [-seed ID] [-hops N] [-o FILE]
+func RunExport(ctx context.Context, args []string) error {
+	var tags, collections listFlag
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "jsonl", "file format, jsonl, stix, graphml or gexf")
+	flags.Var(&collections, "collection", "only export entities of this collection (repeatable)")
+	flags.Var(&tags, "tag", "only export entities with this tag (repeatable)")
+	maxSensitivity := flags.String("max-sensitivity", "", "only export documents at or below this sensitivity, e.g. COMMERCIAL")
+	start := flags.Int64("start", 0, "only export entities at or after this time")
+	end := flags.Int64("end", 0, "only export entities at or before this time")
+	seed := flags.String("seed", "", "only export entities around this entity ID")
+	hops := flags.Int("hops", 1, "radius around the seed entity")
+	output := flags.String("o", "", "output file (default: stdout)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	req := &base.ExportRequest{
+		Tags:        tags,
+		StartTime:   *start,
+		EndTime:     *end,
+		SeedId:      *seed,
+		Hops:        int32(*hops),
+		Collections: collections,
+	}
+	if *maxSensitivity != "" {
+		name := strings.ToUpper(*maxSensitivity)
+		if !strings.HasPrefix(name, "SENSITIVITY_") {
+			name = "SENSITIVITY_" + name
+		}
+		value, ok := model.Sensitivity_value[name]
+		if !ok {
+			return fmt.Errorf("unknown sensitivity %q", *maxSensitivity)
+		}
+		sensitivity := model.Sensitivity(value)
+		req.MaxSensitivity = &sensitivity
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		return fmt.Errorf("failed to establish ArangoDB client: %v", err)
+	}
+
+	service, err := services.NewExportService(client)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(w)
+	switch *format {
+	case "jsonl":
+		err = service.ExportTo(ctx, req, writer)
+	case "stix":
+		err = service.ExportStixTo(ctx, req, writer)
+	case "graphml":
+		err = service.ExportGraphTo(ctx, &base.ExportGraphRequest{Selection: req, Format: base.GraphFormat_GRAPH_FORMAT_GRAPHML}, writer)
+	case "gexf":
+		err = service.ExportGraphTo(ctx, &base.ExportGraphRequest{Selection: req, Format: base.GraphFormat_GRAPH_FORMAT_GEXF}, writer)
+	default:
+		err = fmt.Errorf("unsupported format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+	return writer.Flush()
+}
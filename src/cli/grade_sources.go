@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/omnsight/omnibasement/src/services"
+	"github.com/omnsight/omniscent-library/src/clients"
+)
+
+// RunGradeSources moves the reliabilities that are not Admiralty grades to the
+// legacy_reliability field of their sources, and prints the number of sources
+// updated. Reliabilities from 0 to 6 are kept and read as the grade with that
+// number, so sources graded on another scale within that range must be
+// regraded by hand. It is run once after upgrading to graded sources.
+//
+//	omnibasement grade-sources
+func RunGradeSources(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("grade-sources", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("grade-sources takes no arguments")
+	}
+
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		return fmt.Errorf("failed to establish ArangoDB client: %v", err)
+	}
+
+	changes, err := services.NewChangeLog(client)
+	if err != nil {
+		return err
+	}
+
+	// The command creates no sources, so it needs no idempotency keys
+	sourceService, err := services.NewSourceService(client, nil, changes)
+	if err != nil {
+		return err
+	}
+
+	sources, err := sourceService.GradeLegacySources(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Moved the legacy reliability of %d sources\n", sources)
+	fmt.Println("Reliabilities from 0 to 6 were kept and are now read as Admiralty grades (0 ungraded, 1 A to 6 F); regrade sources that used another scale by hand")
+	return nil
+}
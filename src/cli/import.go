@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omnibasement/src/services"
+	"github.com/omnsight/omniscent-library/src/clients"
+)
+
+// RunImport imports a JSONL, CSV or STIX 2.1 file into the database and prints the report.
+//
+//	omnibasement import [-format jsonl|csv|stix] [-type persons] [-map column=field]... [-dry-run] FILE
+func RunImport(ctx context.Context, args []string) error {
+	mapping := mappingFlag{}
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "", "file format, jsonl, csv or stix (default: from the file extension)")
+	defaultType := flags.String("type", "", "type of rows without a _type field")
+	dryRun := flags.Bool("dry-run", false, "validate the file and report changes without writing")
+	flags.Var(mapping, "map", "map a CSV column to a document field, e.g. \"Full Name=name\" (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected exactly one file to import")
+	}
+
+	path := flags.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	options := &base.ImportOptions{
+		DefaultType:   *defaultType,
+		ColumnMapping: mapping,
+		DryRun:        *dryRun,
+	}
+	stix := false
+	switch strings.ToLower(*format) {
+	case "jsonl", "ndjson":
+		options.Format = base.ImportFormat_IMPORT_FORMAT_JSONL
+	case "csv":
+		options.Format = base.ImportFormat_IMPORT_FORMAT_CSV
+	case "stix":
+		stix = true
+	default:
+		return fmt.Errorf("unsupported format %q", *format)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		return fmt.Errorf("failed to establish ArangoDB client: %v", err)
+	}
+
+	changes, err := services.NewChangeLog(client)
+	if err != nil {
+		return err
+	}
+
+	service, err := services.NewImportService(client, changes)
+	if err != nil {
+		return err
+	}
+
+	var report *base.ImportResponse
+	if stix {
+		report, err = service.ImportStixReader(ctx, options.DryRun, file)
+	} else {
+		report, err = service.ImportReader(ctx, options, file)
+	}
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
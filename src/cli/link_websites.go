@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/omnsight/omnibasement/src/services"
+	"github.com/omnsight/omniscent-library/src/clients"
+)
+
+// RunLinkWebsites links the existing sources to the websites hosting them,
+// creating the missing websites, and prints the number of links created.
+//
+//	omnibasement link-websites
+func RunLinkWebsites(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("link-websites", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("link-websites takes no arguments")
+	}
+
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		return fmt.Errorf("failed to establish ArangoDB client: %v", err)
+	}
+
+	changes, err := services.NewChangeLog(client)
+	if err != nil {
+		return err
+	}
+
+	// The command creates no sources, so it needs no idempotency keys
+	service, err := services.NewSourceService(client, nil, changes)
+	if err != nil {
+		return err
+	}
+
+	linked, err := service.LinkWebsites(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Linked %d sources to their websites\n", linked)
+	return nil
+}
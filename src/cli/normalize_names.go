@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/omnsight/omnibasement/src/services"
+	"github.com/omnsight/omniscent-library/src/clients"
+)
+
+// RunNormalizeNames stores the search keys of the names of all persons and the
+// normalized names and search keys of all organizations, and prints the number
+// of entities updated. It is run after upgrades changing how names are keyed.
+//
+//	omnibasement normalize-names
+func RunNormalizeNames(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("normalize-names", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("normalize-names takes no arguments")
+	}
+
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		return fmt.Errorf("failed to establish ArangoDB client: %v", err)
+	}
+
+	changes, err := services.NewChangeLog(client)
+	if err != nil {
+		return err
+	}
+
+	// The command creates no entities, so it needs no idempotency keys
+	personService, err := services.NewPersonService(client, nil, changes)
+	if err != nil {
+		return err
+	}
+	organizationService, err := services.NewOrganizationService(client, nil, changes)
+	if err != nil {
+		return err
+	}
+
+	persons, err := personService.NormalizeNames(ctx)
+	if err != nil {
+		return err
+	}
+	organizations, err := organizationService.NormalizeNames(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Normalized the names of %d persons and %d organizations\n", persons, organizations)
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -14,6 +15,7 @@ import (
 
 	gwRuntime "github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omnibasement/src/cli"
 	"github.com/omnsight/omnibasement/src/services"
 	"github.com/omnsight/omniscent-library/src/clients"
 	"github.com/omnsight/omniscent-library/src/constants"
@@ -22,6 +24,16 @@ import (
 )
 
 func main() {
+	// Run a command line tool instead of the server when a command is given
+	if len(os.Args) > 1 {
+		if err := cli.Run(context.Background(), os.Args[1:]); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Fatalf("%s failed", os.Args[1])
+		}
+		return
+	}
+
 	// ---- 1. Start the gRPC Server (your logic) ----
 	// Get gRPC address from environment variable or use default
 	grpcPort := os.Getenv(constants.GrpcPort)
@@ -52,8 +64,24 @@ func main() {
 		}).Fatal("failed to establish ArangoDB client")
 	}
 
+	// The change log and the idempotency keys of the Create RPCs are shared by
+	// the services
+	changes, err := services.NewChangeLog(client)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to create ChangeLog")
+	}
+
+	idempotency, err := services.NewIdempotencyStore(client)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to create IdempotencyStore")
+	}
+
 	// Register your business logic implementation with the gRPC server
-	eventService, err := services.NewEventService(client)
+	eventService, err := services.NewEventService(client, idempotency, changes)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": err,
@@ -61,7 +89,7 @@ func main() {
 	}
 	base.RegisterEventServiceServer(gRPCServer, eventService)
 
-	personService, err := services.NewPersonService(client)
+	personService, err := services.NewPersonService(client, idempotency, changes)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": err,
@@ -69,7 +97,7 @@ func main() {
 	}
 	base.RegisterPersonServiceServer(gRPCServer, personService)
 
-	organizationService, err := services.NewOrganizationService(client)
+	organizationService, err := services.NewOrganizationService(client, idempotency, changes)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": err,
@@ -77,7 +105,7 @@ func main() {
 	}
 	base.RegisterOrganizationServiceServer(gRPCServer, organizationService)
 
-	sourceService, err := services.NewSourceService(client)
+	sourceService, err := services.NewSourceService(client, idempotency, changes)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": err,
@@ -85,7 +113,7 @@ func main() {
 	}
 	base.RegisterSourceServiceServer(gRPCServer, sourceService)
 
-	websiteService, err := services.NewWebsiteService(client)
+	websiteService, err := services.NewWebsiteService(client, idempotency, changes)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": err,
@@ -93,7 +121,7 @@ func main() {
 	}
 	base.RegisterWebsiteServiceServer(gRPCServer, websiteService)
 
-	relationshipService, err := services.NewRelationshipService(client)
+	relationshipService, err := services.NewRelationshipService(client, idempotency, changes)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": err,
@@ -101,6 +129,130 @@ func main() {
 	}
 	base.RegisterRelationshipServiceServer(gRPCServer, relationshipService)
 
+	adminService, err := services.NewAdminService(client)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to create AdminService")
+	}
+	base.RegisterAdminServiceServer(gRPCServer, adminService)
+
+	importService, err := services.NewImportService(client, changes)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to create ImportService")
+	}
+	base.RegisterImportServiceServer(gRPCServer, importService)
+
+	exportService, err := services.NewExportService(client)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to create ExportService")
+	}
+	base.RegisterExportServiceServer(gRPCServer, exportService)
+
+	tileService, err := services.NewTileService(client)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to create TileService")
+	}
+	base.RegisterTileServiceServer(gRPCServer, tileService)
+
+	changeService, err := services.NewChangeService(client, changes)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to create ChangeService")
+	}
+	base.RegisterChangeServiceServer(gRPCServer, changeService)
+
+	webhookService, err := services.NewWebhookService(client, changes)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to create WebhookService")
+	}
+	base.RegisterWebhookServiceServer(gRPCServer, webhookService)
+
+	// Deliver webhooks in the background
+	go webhookService.Run(context.Background())
+
+	mergeService, err := services.NewMergeService(client, changes)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to create MergeService")
+	}
+	base.RegisterMergeServiceServer(gRPCServer, mergeService)
+
+	// Scan persons for duplicates in the background
+	go mergeService.RunDuplicateScan(context.Background())
+
+	searchService, err := services.NewSearchService(client)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to create SearchService")
+	}
+	base.RegisterSearchServiceServer(gRPCServer, searchService)
+
+	provenanceService, err := services.NewProvenanceService(client, changes)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to create ProvenanceService")
+	}
+	base.RegisterProvenanceServiceServer(gRPCServer, provenanceService)
+
+	// The source monitor and the feed ingester share the requests to each domain
+	limiter, err := services.NewSourceDomainLimiter()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to create domain limiter")
+	}
+
+	sourceMonitor, err := services.NewSourceMonitor(client, changes, limiter)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to create SourceMonitor")
+	}
+
+	// Check monitored sources for changes in the background
+	go sourceMonitor.Run(context.Background())
+
+	feedService, err := services.NewFeedService(client, changes, limiter)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to create FeedService")
+	}
+	base.RegisterFeedServiceServer(gRPCServer, feedService)
+
+	// Ingest the feeds of sources in the background
+	go feedService.Run(context.Background())
+
+	// Publish the outbox in the background when a publisher is configured
+	publisher, err := services.NewPublisher()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to create outbox publisher")
+	}
+	if publisher != nil {
+		relay, err := services.NewOutboxRelay(client, publisher)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Fatal("failed to create OutboxRelay")
+		}
+		go relay.Run(context.Background())
+	}
+
 	// Enable reflection for debugging
 	reflection.Register(gRPCServer)
 
@@ -128,7 +280,25 @@ func main() {
 
 	// Create the gRPC-Gateway's multiplexer (router)
 	// This mux knows how to translate HTTP routes (from proto definitions) to gRPC calls
-	gwmux := gwRuntime.NewServeMux()
+	gwmux := gwRuntime.NewServeMux(
+		gwRuntime.WithIncomingHeaderMatcher(func(key string) (string, bool) {
+			// Forward idempotency keys of retried requests to the Create RPCs
+			if strings.EqualFold(key, services.IdempotencyKeyHeader) {
+				return strings.ToLower(key), true
+			}
+			return gwRuntime.DefaultHeaderMatcher(key)
+		}),
+		gwRuntime.WithOutgoingHeaderMatcher(func(key string) (string, bool) {
+			// Name the files of download endpoints and let clients cache tiles
+			switch key {
+			case "content-disposition":
+				return "Content-Disposition", true
+			case "cache-control":
+				return "Cache-Control", true
+			}
+			return gwRuntime.MetadataHeaderPrefix + key, true
+		}),
+	)
 
 	// Register all service handlers with the gateway's router
 	if err := base.RegisterEventServiceHandler(ctx, gwmux, conn); err != nil {
@@ -167,6 +337,66 @@ func main() {
 		}).Fatal("failed to register RelationshipService handler")
 	}
 
+	if err := base.RegisterAdminServiceHandler(ctx, gwmux, conn); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to register AdminService handler")
+	}
+
+	if err := base.RegisterImportServiceHandler(ctx, gwmux, conn); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to register ImportService handler")
+	}
+
+	if err := base.RegisterExportServiceHandler(ctx, gwmux, conn); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to register ExportService handler")
+	}
+
+	if err := base.RegisterTileServiceHandler(ctx, gwmux, conn); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to register TileService handler")
+	}
+
+	if err := base.RegisterChangeServiceHandler(ctx, gwmux, conn); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to register ChangeService handler")
+	}
+
+	if err := base.RegisterWebhookServiceHandler(ctx, gwmux, conn); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to register WebhookService handler")
+	}
+
+	if err := base.RegisterMergeServiceHandler(ctx, gwmux, conn); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to register MergeService handler")
+	}
+
+	if err := base.RegisterSearchServiceHandler(ctx, gwmux, conn); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to register SearchService handler")
+	}
+
+	if err := base.RegisterProvenanceServiceHandler(ctx, gwmux, conn); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to register ProvenanceService handler")
+	}
+
+	if err := base.RegisterFeedServiceHandler(ctx, gwmux, conn); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("failed to register FeedService handler")
+	}
+
 	// ---- 3. Start the Gin Server (the HTTP entrypoint) ----
 	// Create a Gin router
 	r := gin.Default()
@@ -180,6 +410,9 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
+	// Server-Sent Events cannot be served through the gateway
+	r.GET("/stream/changes", changeService.ServeEvents)
+
 	// Run the Gin server
 	r.Run(":" + serverPort)
 }
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// indexFiguresAction lists the indexes of a collection with their figures, as
+// the arangosh indexes(true) does. The HTTP API behind it is not exposed by the
+// driver, so it runs as a read-only JavaScript transaction.
+const indexFiguresAction = `function (params) {
+	var db = require("@arangodb").db;
+	return db._collection(params[0]).indexes(true).map(function (index) {
+		return { name: index.name, figures: index.figures || {}, selectivityEstimate: index.selectivityEstimate || 0 };
+	});
+}`
+
+// indexFigures are the statistics of an index reported by the server.
+type indexFigures struct {
+	Name    string `json:"name"`
+	Figures struct {
+		Memory               int64   `json:"memory"`
+		CacheInUse           bool    `json:"cacheInUse"`
+		CacheSize            int64   `json:"cacheSize"`
+		CacheUsage           int64   `json:"cacheUsage"`
+		CacheLifeTimeHitRate float64 `json:"cacheLifeTimeHitRate"`
+		CacheWindowedHitRate float64 `json:"cacheWindowedHitRate"`
+	} `json:"figures"`
+	SelectivityEstimate float64 `json:"selectivityEstimate"`
+}
+
+type AdminService struct {
+	base.UnimplementedAdminServiceServer
+
+	DBClient *clients.ArangoDBClient
+}
+
+func NewAdminService(client *clients.ArangoDBClient) (*AdminService, error) {
+	service := &AdminService{
+		DBClient: client,
+	}
+
+	return service, nil
+}
+
+func (s *AdminService) ListIndexes(ctx context.Context, req *base.ListIndexesRequest) (*base.ListIndexesResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Listing indexes")
+
+	names := make([]string, 0, len(CollectionIndexes))
+	for name := range CollectionIndexes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	if req.GetCollection() != "" {
+		if _, ok := CollectionIndexes[req.GetCollection()]; !ok {
+			logger.WithFields(logrus.Fields{
+				"collection": req.GetCollection(),
+			}).Info("collection has no index configuration")
+			return nil, status.Errorf(codes.NotFound, "Collection not found")
+		}
+		names = []string{req.GetCollection()}
+	}
+
+	response := &base.ListIndexesResponse{}
+	for _, name := range names {
+		info, err := s.collectionIndexInfo(ctx, name)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":      err,
+				"collection": name,
+			}).Error("failed to read collection indexes")
+			return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		response.Collections = append(response.Collections, info)
+	}
+
+	return response, nil
+}
+
+func (s *AdminService) collectionIndexInfo(ctx context.Context, name string) (*base.CollectionIndexInfo, error) {
+	collection, err := s.DBClient.DB.Collection(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	statistics, err := collection.Statistics(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes, err := collection.Indexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Figures are an addition to the listing, which goes on without them
+	figures, err := s.indexFigures(ctx, name)
+	if err != nil {
+		logging.GetLogger(ctx).WithFields(logrus.Fields{
+			"error":      err,
+			"collection": name,
+		}).Warn("failed to read index figures")
+	}
+
+	drifts := map[string]string{}
+	for _, drift := range diffIndexes(CollectionIndexes[name], indexes) {
+		drifts[drift.Name] = drift.Reason
+	}
+
+	declared := map[string]bool{}
+	for _, spec := range CollectionIndexes[name] {
+		declared[spec.Name] = true
+	}
+
+	info := &base.CollectionIndexInfo{
+		Collection:    name,
+		DocumentCount: statistics.Count,
+		IndexCount:    statistics.Figures.Indexes.Count,
+		IndexSize:     statistics.Figures.Indexes.Size,
+	}
+	for _, index := range indexes {
+		info.Indexes = append(info.Indexes, &base.IndexInfo{
+			Name:        index.UserName(),
+			Type:        string(index.Type()),
+			Fields:      indexFields(index),
+			Unique:      index.Unique(),
+			Sparse:      index.Sparse(),
+			ExpireAfter: int32(index.ExpireAfter()),
+			Declared:    declared[index.UserName()],
+			Drift:       drifts[index.UserName()],
+			Figures:     figures[index.UserName()],
+		})
+	}
+
+	// Declared indexes that do not exist are listed from their declaration
+	for _, spec := range CollectionIndexes[name] {
+		if drifts[spec.Name] != DriftMissing {
+			continue
+		}
+		info.Indexes = append(info.Indexes, &base.IndexInfo{
+			Name:        spec.Name,
+			Type:        string(spec.Type),
+			Fields:      spec.Fields,
+			Unique:      spec.Unique,
+			Sparse:      spec.Sparse,
+			ExpireAfter: int32(spec.ExpireAfter),
+			Declared:    true,
+			Drift:       DriftMissing,
+		})
+	}
+
+	return info, nil
+}
+
+// indexFigures returns the figures of the indexes of a collection by name.
+func (s *AdminService) indexFigures(ctx context.Context, name string) (map[string]*base.IndexFigures, error) {
+	result, err := s.DBClient.DB.Transaction(ctx, indexFiguresAction, &driver.TransactionOptions{
+		ReadCollections: []string{name},
+		Params:          []interface{}{name},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The result is decoded from JSON into plain values
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []indexFigures
+	if err := json.Unmarshal(data, &indexes); err != nil {
+		return nil, err
+	}
+
+	figures := make(map[string]*base.IndexFigures, len(indexes))
+	for _, index := range indexes {
+		figures[index.Name] = &base.IndexFigures{
+			Memory:               index.Figures.Memory,
+			CacheInUse:           index.Figures.CacheInUse,
+			CacheSize:            index.Figures.CacheSize,
+			CacheUsage:           index.Figures.CacheUsage,
+			CacheLifetimeHitRate: index.Figures.CacheLifeTimeHitRate,
+			CacheWindowedHitRate: index.Figures.CacheWindowedHitRate,
+			SelectivityEstimate:  index.SelectivityEstimate,
+		}
+	}
+	return figures, nil
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdminService(t *testing.T) {
+	// Skip test if ArangoDB is not available
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	// Create ArangoDB client
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
+	// Create EventService so the events collection and its indexes exist
+	_, err = NewEventService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create EventService: %v", err)
+	}
+
+	// Create AdminService
+	service, err := NewAdminService(client)
+	if err != nil {
+		t.Fatalf("Failed to create AdminService: %v", err)
+	}
+
+	if service == nil {
+		t.Error("Expected service to be created")
+	}
+
+	t.Run("List Indexes", func(t *testing.T) {
+		resp, err := service.ListIndexes(context.Background(), &base.ListIndexesRequest{
+			Collection: "events",
+		})
+		if err != nil {
+			t.Fatalf("Failed to list indexes: %v", err)
+		}
+
+		if len(resp.Collections) != 1 {
+			t.Fatalf("Expected 1 collection, got %d", len(resp.Collections))
+		}
+
+		found := map[string]*base.IndexInfo{}
+		for _, index := range resp.Collections[0].Indexes {
+			found[index.Name] = index
+		}
+
+		for _, spec := range CollectionIndexes["events"] {
+			index, ok := found[spec.Name]
+			if !ok {
+				t.Errorf("Expected index %s to be listed", spec.Name)
+				continue
+			}
+
+			if !index.Declared {
+				t.Errorf("Expected index %s to be declared", spec.Name)
+			}
+
+			if index.Drift != "" {
+				t.Errorf("Expected index %s to have no drift, got '%s'", spec.Name, index.Drift)
+			}
+
+			if index.Figures == nil {
+				t.Errorf("Expected index %s to have figures", spec.Name)
+			}
+		}
+	})
+
+	t.Run("Unnamed Index", func(t *testing.T) {
+		ctx := context.Background()
+		collection, err := client.DB.Collection(ctx, "events")
+		if err != nil {
+			t.Fatalf("Failed to open events collection: %v", err)
+		}
+
+		// Databases created before indexes were declared have an unnamed index
+		index, err := collection.Index(ctx, "idx_events_happened_at")
+		if err != nil {
+			t.Fatalf("Failed to read index: %v", err)
+		}
+		if err := index.Remove(ctx); err != nil {
+			t.Fatalf("Failed to remove index: %v", err)
+		}
+		_, _, err = collection.EnsurePersistentIndex(ctx, []string{"happened_at"}, &driver.EnsurePersistentIndexOptions{InBackground: true})
+		if err != nil {
+			t.Fatalf("Failed to create unnamed index: %v", err)
+		}
+
+		if err := EnsureIndexes(ctx, collection); err != nil {
+			t.Fatalf("Failed to ensure indexes: %v", err)
+		}
+		drifts, err := CheckIndexDrift(ctx, collection)
+		if err != nil {
+			t.Fatalf("Failed to check index drift: %v", err)
+		}
+		if len(drifts) != 0 {
+			t.Errorf("Expected the unnamed index to be recreated as declared, got drift %v", drifts)
+		}
+	})
+
+	t.Run("Unknown Collection", func(t *testing.T) {
+		_, err := service.ListIndexes(context.Background(), &base.ListIndexesRequest{
+			Collection: "unknown",
+		})
+		if err == nil {
+			t.Error("Expected error when listing indexes of an unknown collection")
+		} else {
+			if status.Code(err) != codes.NotFound {
+				t.Errorf("Expected NotFound error, got %v", status.Code(err))
+			}
+		}
+	})
+}
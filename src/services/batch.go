@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaxBatchSize is the largest number of items accepted by a batch RPC.
+const MaxBatchSize = 1000
+
+var (
+	errMissingKey = status.Error(codes.InvalidArgument, "Missing key")
+	errRolledBack = status.Error(codes.Aborted, "Rolled back because another item of the batch failed")
+)
+
+func checkBatchSize(size int) error {
+	if size == 0 || size > MaxBatchSize {
+		return status.Errorf(codes.InvalidArgument, "Batch must contain between 1 and %d items", MaxBatchSize)
+	}
+	return nil
+}
+
+// runBatch calls write, which records the outcome of every item in errs. When
+// allOrNothing is set the write runs inside a stream transaction over the given
+// collections that is only committed if no item failed, and the items that did
+// succeed are reported as rolled back otherwise.
+func runBatch(ctx context.Context, db driver.Database, collections []string, allOrNothing bool, errs []error, write func(ctx context.Context) error) error {
+	if !allOrNothing {
+		return write(ctx)
+	}
+
+	if driver.ErrorSlice(errs).FirstNonNil() != nil {
+		markRolledBack(errs)
+		return nil
+	}
+
+	// Changes are recorded in the transaction of the writes
+	tid, err := db.BeginTransaction(ctx, changeTransaction(driver.TransactionCollections{Write: collections}), nil)
+	if err != nil {
+		return err
+	}
+
+	err = write(withTransaction(ctx, tid))
+	if err == nil && driver.ErrorSlice(errs).FirstNonNil() == nil {
+		if err := db.CommitTransaction(ctx, tid, nil); err != nil {
+			return err
+		}
+		changeSignal.notify()
+		return nil
+	}
+
+	if abortErr := db.AbortTransaction(ctx, tid, nil); abortErr != nil {
+		logrus.WithFields(logrus.Fields{
+			"error":       abortErr,
+			"transaction": tid,
+		}).Warn("failed to abort batch transaction")
+	}
+	if err != nil {
+		return err
+	}
+
+	markRolledBack(errs)
+	return nil
+}
+
+// transactionKey marks the contexts of the stream transactions started by this
+// package, which nested writes join instead of starting their own.
+type transactionKey struct{}
+
+func withTransaction(ctx context.Context, tid driver.TransactionID) context.Context {
+	return context.WithValue(driver.WithTransactionID(ctx, tid), transactionKey{}, tid)
+}
+
+func inTransaction(ctx context.Context) bool {
+	return ctx.Value(transactionKey{}) != nil
+}
+
+func markRolledBack(errs []error) {
+	for i := range errs {
+		if errs[i] == nil {
+			errs[i] = errRolledBack
+		}
+	}
+}
+
+// batchError converts the error of a batch item to its response representation.
+func batchError(err error) *base.BatchError {
+	if err == nil {
+		return nil
+	}
+
+	if st, ok := status.FromError(err); ok {
+		return &base.BatchError{Code: int32(st.Code()), Message: st.Message()}
+	}
+
+	switch {
+	case driver.IsNotFoundGeneral(err):
+		return &base.BatchError{Code: int32(codes.NotFound), Message: "Document not found"}
+	case driver.IsConflict(err):
+		return &base.BatchError{Code: int32(codes.AlreadyExists), Message: "Document already exists"}
+	case driver.IsPreconditionFailed(err):
+		return &base.BatchError{Code: int32(codes.FailedPrecondition), Message: "Document revision mismatch"}
+	case driver.IsInvalidArgument(err):
+		return &base.BatchError{Code: int32(codes.InvalidArgument), Message: "Bad parameter"}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("batch item failed")
+	return &base.BatchError{Code: int32(codes.Internal), Message: "Internal service error. Please try again later."}
+}
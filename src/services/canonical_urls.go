@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// storedURLs holds the URL fields of a stored website or source.
+type storedURLs struct {
+	Key               string `json:"_key"`
+	Url               string `json:"url"`
+	Domain            string `json:"domain"`
+	RootUrl           string `json:"root_url"`
+	RegistrableDomain string `json:"registrable_domain"`
+}
+
+// CanonicalizeURLs rewrites the URL and domains of the websites stored before
+// URLs were canonicalized on write, or canonicalized differently, and returns
+// the number of websites updated. Websites whose URL cannot be parsed, or whose
+// canonical URL is taken by another website, are logged and left as they are.
+func (s *WebsiteService) CanonicalizeURLs(ctx context.Context) (int, error) {
+	return canonicalizeURLs(ctx, s.DBClient.DB, s.Collection, func(stored *storedURLs) (map[string]interface{}, error) {
+		doc, err := newWebsiteDocument(&model.Website{Url: stored.Url, Domain: stored.Domain}, "website")
+		if err != nil {
+			return nil, err
+		}
+		return canonicalFields(stored, map[string]string{
+			"url":                doc.Url,
+			"domain":             doc.Domain,
+			"registrable_domain": doc.RegistrableDomain,
+		}), nil
+	})
+}
+
+// CanonicalizeURLs rewrites the URL, root URL and registrable domain of the
+// sources stored before URLs were canonicalized on write, or canonicalized
+// differently, and returns the number of sources updated. Sources whose URL
+// cannot be parsed, or whose canonical URL is taken by another source, are
+// logged and left as they are.
+func (s *SourceService) CanonicalizeURLs(ctx context.Context) (int, error) {
+	return canonicalizeURLs(ctx, s.DBClient.DB, s.Collection, func(stored *storedURLs) (map[string]interface{}, error) {
+		doc, err := newSourceDocument(&model.Source{Url: stored.Url, RootUrl: stored.RootUrl}, "source")
+		if err != nil {
+			return nil, err
+		}
+		return canonicalFields(stored, map[string]string{
+			"url":                doc.Url,
+			"root_url":           doc.RootUrl,
+			"registrable_domain": doc.RegistrableDomain,
+		}), nil
+	})
+}
+
+// canonicalizeURLs updates the documents of collection with the fields
+// canonicalize returns for their stored URLs, through collection so that the
+// updates are recorded as changes.
+func canonicalizeURLs(ctx context.Context, db driver.Database, collection driver.Collection, canonicalize func(stored *storedURLs) (map[string]interface{}, error)) (int, error) {
+	query := `
+		FOR d IN @@collection
+			FILTER d._key > @after
+			SORT d._key
+			LIMIT @limit
+			RETURN KEEP(d, "_key", "url", "domain", "root_url", "registrable_domain")`
+
+	total := 0
+	after := ""
+	for {
+		documents, err := queryAll[storedURLs](ctx, db, query, map[string]interface{}{
+			"@collection": collection.Name(),
+			"after":       after,
+			"limit":       MaxBatchSize,
+		})
+		if err != nil {
+			return total, err
+		}
+		if len(documents) == 0 {
+			break
+		}
+
+		for _, stored := range documents {
+			update, err := canonicalize(stored)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error":      err,
+					"collection": collection.Name(),
+					"key":        stored.Key,
+				}).Warn("stored url cannot be canonicalized")
+				continue
+			}
+			if len(update) == 0 {
+				continue
+			}
+
+			if _, err := collection.UpdateDocument(ctx, stored.Key, update); err != nil {
+				if driver.IsConflict(err) {
+					logrus.WithFields(logrus.Fields{
+						"collection": collection.Name(),
+						"key":        stored.Key,
+						"url":        update["url"],
+					}).Warn("canonical url belongs to another document, merge them")
+					continue
+				}
+				return total, err
+			}
+			total++
+		}
+		after = documents[len(documents)-1].Key
+	}
+
+	if total > 0 {
+		logrus.Infof("✅ Canonicalized the URLs of %d %s", total, collection.Name())
+	}
+	return total, nil
+}
+
+// canonicalFields returns the canonical fields that differ from the stored
+// ones. Empty fields are left out, as they are derived from missing URLs.
+func canonicalFields(stored *storedURLs, canonical map[string]string) map[string]interface{} {
+	current := map[string]string{
+		"url":                stored.Url,
+		"domain":             stored.Domain,
+		"root_url":           stored.RootUrl,
+		"registrable_domain": stored.RegistrableDomain,
+	}
+	update := map[string]interface{}{}
+	for field, value := range canonical {
+		if value != "" && value != current[field] {
+			update[field] = value
+		}
+	}
+	return update
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gwRuntime "github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// Changes recorded by other processes are picked up by polling
+	changePollInterval = time.Second
+	changeBatchSize    = 100
+	sseHeartbeat       = 15 * time.Second
+)
+
+var changeOperations = map[string]base.ChangeOperation{
+	ChangeCreate: base.ChangeOperation_CHANGE_OPERATION_CREATE,
+	ChangeUpdate: base.ChangeOperation_CHANGE_OPERATION_UPDATE,
+	ChangeDelete: base.ChangeOperation_CHANGE_OPERATION_DELETE,
+}
+
+type ChangeService struct {
+	base.UnimplementedChangeServiceServer
+
+	DBClient *clients.ArangoDBClient
+	Changes  *ChangeLog
+}
+
+func NewChangeService(client *clients.ArangoDBClient, changes *ChangeLog) (*ChangeService, error) {
+	service := &ChangeService{
+		DBClient: client,
+		Changes:  changes,
+	}
+	return service, nil
+}
+
+// changeWatch is a validated watch request with the position to continue from.
+type changeWatch struct {
+	query    string
+	bindVars map[string]interface{}
+	cursor   string
+	window   *changeWindow
+}
+
+func (s *ChangeService) WatchChanges(req *base.WatchChangesRequest, stream base.ChangeService_WatchChangesServer) error {
+	ctx := stream.Context()
+
+	watch, err := s.newWatch(ctx, req)
+	if err != nil {
+		return err
+	}
+	return s.watch(ctx, watch, stream.Send)
+}
+
+// ServeEvents streams changes as Server-Sent Events. It takes the filters of
+// WatchChanges as the query parameters "collections", "operations" (create,
+// update or delete) and "tags", and resumes after the Last-Event-ID header or
+// the "cursor" parameter.
+func (s *ChangeService) ServeEvents(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	req := &base.WatchChangesRequest{
+		Collections: c.QueryArray("collections"),
+		Tags:        c.QueryArray("tags"),
+		Cursor:      c.Query("cursor"),
+	}
+	if id := c.GetHeader("Last-Event-ID"); id != "" {
+		req.Cursor = id
+	}
+	for _, name := range c.QueryArray("operations") {
+		operation, ok := changeOperations[name]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown operation " + name})
+			return
+		}
+		req.Operations = append(req.Operations, operation)
+	}
+
+	watch, err := s.newWatch(ctx, req)
+	if err != nil {
+		c.JSON(gwRuntime.HTTPStatusFromCode(status.Code(err)), gin.H{"error": status.Convert(err).Message()})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	// Events and heartbeats are written from different goroutines
+	var mu sync.Mutex
+	write := func(format string, args ...interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := fmt.Fprintf(c.Writer, format, args...); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(sseHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if write(": heartbeat\n\n") != nil {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	if err := write(": watching changes\n\n"); err != nil {
+		return
+	}
+	s.watch(ctx, watch, func(change *base.Change) error {
+		data, err := protojson.Marshal(change)
+		if err != nil {
+			return err
+		}
+		return write("id: %s\nevent: %s\ndata: %s\n\n", change.GetCursor(), changeOperationName(change.GetOperation()), data)
+	})
+}
+
+// newWatch validates req and resolves the cursor to continue from.
+func (s *ChangeService) newWatch(ctx context.Context, req *base.WatchChangesRequest) (*changeWatch, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Watching changes with filters: %v", req)
+
+	query := "FOR c IN @@collection\n\tFILTER " + changeWindowFilter + "\n"
+	bindVars := map[string]interface{}{
+		"@collection": s.Changes.Collection.Name(),
+		"limit":       changeBatchSize,
+	}
+
+	if len(req.GetCollections()) > 0 {
+		query += "\tFILTER c.collection IN @collections\n"
+		bindVars["collections"] = req.GetCollections()
+	}
+	if len(req.GetOperations()) > 0 {
+		var operations []string
+		for _, operation := range req.GetOperations() {
+			name := changeOperationName(operation)
+			if name == "" {
+				return nil, status.Errorf(codes.InvalidArgument, "Unknown operation")
+			}
+			operations = append(operations, name)
+		}
+		query += "\tFILTER c.operation IN @operations\n"
+		bindVars["operations"] = operations
+	}
+	if len(req.GetTags()) > 0 {
+		query += "\tFILTER @tags ANY IN c.document.tags\n"
+		bindVars["tags"] = req.GetTags()
+	}
+	query += "\tSORT c._key\n\tLIMIT @limit\n\tRETURN c"
+
+	watch := &changeWatch{query: query, bindVars: bindVars, cursor: req.GetCursor()}
+	if watch.cursor == "" {
+		latest, err := queryAll[string](ctx, s.DBClient.DB, "FOR c IN @@collection SORT c._key DESC LIMIT 1 RETURN c._key", map[string]interface{}{
+			"@collection": s.Changes.Collection.Name(),
+		})
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("failed to read latest change")
+			return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		if len(latest) > 0 {
+			watch.cursor = *latest[0]
+		}
+		return s.startWatch(ctx, watch)
+	}
+
+	// Changes older than the retention are gone and cannot be replayed
+	exists, err := s.Changes.Collection.DocumentExists(ctx, watch.cursor)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error":  err,
+			"cursor": watch.cursor,
+		}).Error("failed to look up change cursor")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	if !exists {
+		logger.WithFields(logrus.Fields{
+			"cursor": watch.cursor,
+		}).Info("change cursor expired")
+		return nil, status.Errorf(codes.OutOfRange, "Cursor expired")
+	}
+	return s.startWatch(ctx, watch)
+}
+
+// startWatch opens the change window of watch at its cursor.
+func (s *ChangeService) startWatch(ctx context.Context, watch *changeWatch) (*changeWatch, error) {
+	window, err := s.Changes.newChangeWindow(ctx, watch.cursor)
+	if err != nil {
+		logging.GetLogger(ctx).WithFields(logrus.Fields{
+			"error":  err,
+			"cursor": watch.cursor,
+		}).Error("failed to read recent changes")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	watch.window = window
+	return watch, nil
+}
+
+// watch sends the changes after the cursor of w, and those committing late
+// behind it, until ctx is done or send fails.
+func (s *ChangeService) watch(ctx context.Context, w *changeWatch, send func(*base.Change) error) error {
+	logger := logging.GetLogger(ctx)
+
+	ticker := time.NewTicker(changePollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Wait for notifications sent from now on, while reading
+		wake := changeSignal.wait()
+
+		w.window.bind(w.bindVars)
+		records, err := queryAll[changeRecord](ctx, s.DBClient.DB, w.query, w.bindVars)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			logger.WithFields(logrus.Fields{
+				"error":  err,
+				"cursor": w.window.cursor,
+			}).Error("failed to read changes")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+
+		for _, record := range records {
+			change, err := record.toChange()
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":  err,
+					"cursor": record.Key,
+				}).Error("failed to convert change")
+				return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+			}
+			if err := send(change); err != nil {
+				return err
+			}
+			w.window.read(record)
+		}
+
+		if len(records) == changeBatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *changeRecord) toChange() (*base.Change, error) {
+	change := &base.Change{
+		Cursor:     r.Key,
+		Operation:  changeOperations[r.Operation],
+		Collection: r.Collection,
+		Key:        r.DocumentKey,
+		Id:         r.DocumentID,
+		Rev:        r.Rev,
+		ChangedAt:  r.ChangedAt,
+	}
+	if r.Document != nil {
+		document, err := structpb.NewStruct(r.Document)
+		if err != nil {
+			return nil, err
+		}
+		change.Document = document
+	}
+	return change, nil
+}
+
+func changeOperationName(operation base.ChangeOperation) string {
+	for name, value := range changeOperations {
+		if value == operation {
+			return name
+		}
+	}
+	return ""
+}
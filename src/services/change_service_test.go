@@ -0,0 +1,251 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/gin-gonic/gin"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestChangeService(t *testing.T) {
+	// Skip test if ArangoDB is not available
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	// Create ArangoDB client
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
+	// Create ChangeService
+	service, err := NewChangeService(client, changes)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeService: %v", err)
+	}
+
+	eventService, err := NewEventService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create EventService: %v", err)
+	}
+
+	tag := fmt.Sprintf("changes-%d", time.Now().UnixNano())
+
+	t.Run("Watch And Resume", func(t *testing.T) {
+		req := &base.WatchChangesRequest{Collections: []string{"events"}, Tags: []string{tag}}
+		watch, err := service.newWatch(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Failed to start watching changes: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		changes := make(chan *base.Change, 10)
+		go service.watch(ctx, watch, func(change *base.Change) error {
+			changes <- change
+			return nil
+		})
+
+		created, err := eventService.CreateEvent(context.Background(), &base.CreateEventRequest{
+			Event: &model.Event{Title: "Watched Event", Tags: []string{tag}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create event: %v", err)
+		}
+		_, err = eventService.UpdateEvent(context.Background(), &base.UpdateEventRequest{
+			Key:   created.Event.Key,
+			Event: &model.Event{Key: created.Event.Key, Title: "Watched Event Updated", Tags: []string{tag}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to update event: %v", err)
+		}
+		_, err = eventService.DeleteEvent(context.Background(), &base.DeleteEventRequest{Key: created.Event.Key})
+		if err != nil {
+			t.Fatalf("Failed to delete event: %v", err)
+		}
+
+		expected := []base.ChangeOperation{
+			base.ChangeOperation_CHANGE_OPERATION_CREATE,
+			base.ChangeOperation_CHANGE_OPERATION_UPDATE,
+			base.ChangeOperation_CHANGE_OPERATION_DELETE,
+		}
+		var received []*base.Change
+		for range expected {
+			select {
+			case change := <-changes:
+				received = append(received, change)
+			case <-ctx.Done():
+				t.Fatalf("Expected %d changes, got %d", len(expected), len(received))
+			}
+		}
+		cancel()
+
+		for i, change := range received {
+			if change.Operation != expected[i] {
+				t.Errorf("Expected change %d to be %v, got %v", i, expected[i], change.Operation)
+			}
+			if change.Key != created.Event.Key {
+				t.Errorf("Expected change of '%s', got '%s'", created.Event.Key, change.Key)
+			}
+		}
+		if title := received[2].GetDocument().GetFields()["title"].GetStringValue(); title != "Watched Event Updated" {
+			t.Errorf("Expected the deleted document to be included, got title '%s'", title)
+		}
+
+		// Resuming after the first change replays the others
+		resumed, err := service.newWatch(context.Background(), &base.WatchChangesRequest{
+			Collections: []string{"events"},
+			Tags:        []string{tag},
+			Cursor:      received[0].Cursor,
+		})
+		if err != nil {
+			t.Fatalf("Failed to resume watching changes: %v", err)
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		var replayed []*base.Change
+		service.watch(ctx, resumed, func(change *base.Change) error {
+			replayed = append(replayed, change)
+			if len(replayed) == 2 {
+				cancel()
+			}
+			return nil
+		})
+		if len(replayed) != 2 || replayed[0].Cursor != received[1].Cursor {
+			t.Errorf("Expected the update and delete to be replayed, got %d changes", len(replayed))
+		}
+	})
+
+	t.Run("Expired Cursor", func(t *testing.T) {
+		_, err := service.newWatch(context.Background(), &base.WatchChangesRequest{Cursor: "0"})
+		if status.Code(err) != codes.OutOfRange {
+			t.Errorf("Expected OutOfRange error, got %v", err)
+		}
+	})
+
+	t.Run("Late Commit", func(t *testing.T) {
+		lateTag := tag + "-late"
+		watch, err := service.newWatch(context.Background(), &base.WatchChangesRequest{Tags: []string{lateTag}})
+		if err != nil {
+			t.Fatalf("Failed to start watching changes: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		received := make(chan *base.Change, 10)
+		go service.watch(ctx, watch, func(change *base.Change) error {
+			received <- change
+			return nil
+		})
+
+		// The first change is recorded before the second but commits after it
+		db := changes.Collection.Database()
+		tid, err := db.BeginTransaction(context.Background(), changeTransaction(driver.TransactionCollections{Write: []string{"events"}}), nil)
+		if err != nil {
+			t.Fatalf("Failed to begin transaction: %v", err)
+		}
+		_, err = eventService.CreateEvent(withTransaction(context.Background(), tid), &base.CreateEventRequest{
+			Event: &model.Event{Title: "Late Event", Tags: []string{lateTag}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create late event: %v", err)
+		}
+		_, err = eventService.CreateEvent(context.Background(), &base.CreateEventRequest{
+			Event: &model.Event{Title: "Early Event", Tags: []string{lateTag}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create early event: %v", err)
+		}
+
+		var titles []string
+		next := func() {
+			select {
+			case change := <-received:
+				titles = append(titles, change.GetDocument().GetFields()["title"].GetStringValue())
+			case <-ctx.Done():
+				t.Fatalf("Expected another change after %v", titles)
+			}
+		}
+		next()
+		if err := db.CommitTransaction(context.Background(), tid, nil); err != nil {
+			t.Fatalf("Failed to commit transaction: %v", err)
+		}
+		changeSignal.notify()
+		next()
+
+		if len(titles) != 2 || titles[0] != "Early Event" || titles[1] != "Late Event" {
+			t.Errorf("Expected the late change after the early one, got %v", titles)
+		}
+	})
+
+	t.Run("Server-Sent Events", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.GET("/stream/changes", service.ServeEvents)
+		server := httptest.NewServer(router)
+		defer server.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpReq, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/stream/changes?operations=create&tags="+tag, nil)
+		resp, err := http.DefaultClient.Do(httpReq)
+		if err != nil {
+			t.Fatalf("Failed to open event stream: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+			t.Errorf("Expected an event stream, got %s", resp.Header.Get("Content-Type"))
+		}
+
+		created, err := eventService.CreateEvent(context.Background(), &base.CreateEventRequest{
+			Event: &model.Event{Title: "Streamed Event", Tags: []string{tag}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create event: %v", err)
+		}
+		defer eventService.DeleteEvent(context.Background(), &base.DeleteEventRequest{Key: created.Event.Key})
+
+		scanner := bufio.NewScanner(resp.Body)
+		var event, data string
+		for scanner.Scan() && data == "" {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "event: ") {
+				event = strings.TrimPrefix(line, "event: ")
+			} else if strings.HasPrefix(line, "data: ") {
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+
+		if event != ChangeCreate {
+			t.Errorf("Expected a create event, got '%s'", event)
+		}
+		if !strings.Contains(data, created.Event.Key) {
+			t.Errorf("Expected the event data to contain '%s', got %s", created.Event.Key, data)
+		}
+	})
+}
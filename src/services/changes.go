@@ -0,0 +1,435 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ChangesCollection holds the change log read by change feeds.
+	ChangesCollection = "changes"
+	// ChangeRetention is the environment variable overriding how long changes can be replayed.
+	ChangeRetention = "CHANGE_RETENTION"
+
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+
+	defaultChangeRetention = 7 * 24 * time.Hour
+	// Padded keys are generated in ascending lexicographical order, which
+	// makes them usable as cursors, see changeWindow for why readers cannot
+	// rely on them alone
+	changeKeyGenerator = driver.KeyGeneratorType("padded")
+	// changeOverlap is how long before the newest change read readers of the
+	// change log look for changes that committed late. A transaction
+	// committing more than changeOverlap after recording a change can still
+	// have it skipped by the readers running at the time.
+	changeOverlap = time.Minute
+)
+
+// ChangeLog records the creates, updates and deletes of entities and
+// relationships with a snapshot of the document.
+type ChangeLog struct {
+	Collection driver.Collection
+	Retention  time.Duration
+	// Outbox receives a copy of every change while Publishing is set, for the
+	// outbox relay to publish
+	Outbox     driver.Collection
+	Publishing bool
+}
+
+type changeRecord struct {
+	Key         string                 `json:"_key,omitempty"`
+	Operation   string                 `json:"operation"`
+	Collection  string                 `json:"collection"`
+	DocumentKey string                 `json:"document_key"`
+	DocumentID  string                 `json:"document_id"`
+	Rev         string                 `json:"rev,omitempty"`
+	Document    map[string]interface{} `json:"document,omitempty"`
+	ChangedAt   int64                  `json:"changed_at"`
+	ExpiresAt   int64                  `json:"expires_at"`
+}
+
+// NewChangeLog creates the change log. One change log is shared by the
+// services writing watched collections.
+func NewChangeLog(client *clients.ArangoDBClient) (*ChangeLog, error) {
+	retention := defaultChangeRetention
+	if value := os.Getenv(ChangeRetention); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %v", ChangeRetention, value, err)
+		}
+		retention = parsed
+	}
+
+	ctx := context.Background()
+	collection, err := getCreateDocumentCollection(ctx, client, ChangesCollection, &driver.CreateCollectionOptions{
+		KeyOptions: &driver.CollectionKeyOptions{Type: changeKeyGenerator},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get or create %s collection: %v", ChangesCollection, err)
+	}
+
+	if err := EnsureIndexes(ctx, collection); err != nil {
+		return nil, err
+	}
+
+	// The outbox always exists since it is part of every change transaction
+	outbox, err := GetCreateDocumentCollection(ctx, client, OutboxCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get or create %s collection: %v", OutboxCollection, err)
+	}
+
+	return &ChangeLog{
+		Collection: collection,
+		Retention:  retention,
+		Outbox:     outbox,
+		Publishing: os.Getenv(OutboxPublisher) != "",
+	}, nil
+}
+
+// Record writes changes to the log, and to the outbox when publishing is
+// enabled. Creates and updates are recorded with the document as it is after
+// the write, in the transaction of ctx if any.
+func (l *ChangeLog) Record(ctx context.Context, changes []*changeRecord) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for _, change := range changes {
+		change.ChangedAt = now.Unix()
+		change.ExpiresAt = now.Add(l.Retention).Unix()
+	}
+
+	query := `
+		FOR change IN @changes
+			INSERT MERGE(change, {
+				document: change.operation == @delete ? change.document : DOCUMENT(change.document_id)
+			}) INTO @@collection
+	`
+	bindVars := map[string]interface{}{
+		"changes":     changes,
+		"delete":      ChangeDelete,
+		"@collection": l.Collection.Name(),
+	}
+	if l.Publishing {
+		// Outbox records share the key of the change so that consumers can
+		// drop the duplicates of at-least-once delivery
+		query += `
+			INSERT UNSET(NEW, "_id", "_rev", "expires_at") INTO @@outbox
+		`
+		bindVars["@outbox"] = l.Outbox.Name()
+	}
+
+	cursor, err := l.Collection.Database().Query(ctx, query, bindVars)
+	if err != nil {
+		return err
+	}
+	cursor.Close()
+	return nil
+}
+
+// Watch returns collection recording every document written through it.
+func (l *ChangeLog) Watch(collection driver.Collection) driver.Collection {
+	return &watchedCollection{Collection: collection, changes: l}
+}
+
+// transact calls write in a stream transaction over collections, the change
+// log and the outbox, unless ctx already carries a transaction of this package.
+// The transaction is committed if write succeeds and aborted otherwise.
+func (l *ChangeLog) transact(ctx context.Context, collections driver.TransactionCollections, write func(ctx context.Context) error) error {
+	if inTransaction(ctx) {
+		return write(ctx)
+	}
+
+	db := l.Collection.Database()
+	tid, err := db.BeginTransaction(ctx, changeTransaction(collections), nil)
+	if err != nil {
+		return err
+	}
+
+	if err := write(withTransaction(ctx, tid)); err != nil {
+		if abortErr := db.AbortTransaction(ctx, tid, nil); abortErr != nil {
+			logrus.WithFields(logrus.Fields{
+				"error":       abortErr,
+				"transaction": tid,
+			}).Warn("failed to abort change transaction")
+		}
+		return err
+	}
+
+	if err := db.CommitTransaction(ctx, tid, nil); err != nil {
+		return err
+	}
+	changeSignal.notify()
+	return nil
+}
+
+// changeTransaction adds the change log and the outbox to the collections of a
+// transaction recording changes. Transactions recording changes run
+// concurrently, so their changes can commit out of key order.
+func changeTransaction(collections driver.TransactionCollections) driver.TransactionCollections {
+	collections.Write = append(slices.Clone(collections.Write), ChangesCollection, OutboxCollection)
+	return collections
+}
+
+// changeWindowFilter matches the changes a changeWindow has not read yet.
+const changeWindowFilter = "c._key > @cursor OR (c.changed_at >= @since AND c._key NOT IN @seen)"
+
+// changeWindow is the position of a reader of the change log. Change keys are
+// generated when a change is recorded rather than when its transaction
+// commits, so a change can become visible after changes with greater keys
+// were read. Besides the changes after the cursor, readers re-read the
+// changes recorded within changeOverlap before the newest change read and
+// skip the ones they already read.
+type changeWindow struct {
+	cursor string
+	newest int64
+	seen   map[string]int64
+}
+
+// newChangeWindow returns the window of a reader resuming after cursor. The
+// changes up to the cursor within the overlap count as read.
+func (l *ChangeLog) newChangeWindow(ctx context.Context, cursor string) (*changeWindow, error) {
+	w := &changeWindow{cursor: cursor, newest: time.Now().Unix(), seen: map[string]int64{}}
+	if cursor == "" {
+		return w, nil
+	}
+
+	query := `
+		LET at = DOCUMENT(@@collection, @cursor).changed_at
+		FOR c IN @@collection
+			FILTER at != null AND c.changed_at >= at - @overlap AND c._key <= @cursor
+			RETURN { _key: c._key, changed_at: c.changed_at }
+	`
+	read, err := queryAll[changeRecord](ctx, l.Collection.Database(), query, map[string]interface{}{
+		"cursor":      cursor,
+		"overlap":     int64(changeOverlap / time.Second),
+		"@collection": l.Collection.Name(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range read {
+		w.seen[record.Key] = record.ChangedAt
+		w.newest = max(w.newest, record.ChangedAt)
+	}
+	return w, nil
+}
+
+// bind sets the bind variables of changeWindowFilter and forgets the changes
+// recorded before the overlap.
+func (w *changeWindow) bind(bindVars map[string]interface{}) {
+	since := w.newest - int64(changeOverlap/time.Second)
+	seen := make([]string, 0, len(w.seen))
+	for key, changedAt := range w.seen {
+		if changedAt < since {
+			delete(w.seen, key)
+			continue
+		}
+		seen = append(seen, key)
+	}
+
+	bindVars["cursor"] = w.cursor
+	bindVars["since"] = since
+	bindVars["seen"] = seen
+}
+
+// read marks record as read.
+func (w *changeWindow) read(record *changeRecord) {
+	w.seen[record.Key] = record.ChangedAt
+	w.cursor = max(w.cursor, record.Key)
+	w.newest = max(w.newest, record.ChangedAt)
+}
+
+// recordWrite records a document written with AQL in the transaction of ctx.
+// old is the document removed by a delete.
+func (l *ChangeLog) recordWrite(ctx context.Context, collection, operation string, meta driver.DocumentMeta, old map[string]interface{}) error {
+	changes := writeChanges(collection, []driver.DocumentMeta{meta}, nil, operation)
+	for _, change := range changes {
+		change.Document = old
+	}
+	return l.Record(ctx, changes)
+}
+
+// writeChanges returns the changes of the documents a write succeeded for.
+func writeChanges(collection string, metas []driver.DocumentMeta, errs []error, operation string) []*changeRecord {
+	var changes []*changeRecord
+	for i, meta := range metas {
+		if (errs != nil && errs[i] != nil) || meta.Key == "" {
+			continue
+		}
+
+		change := &changeRecord{
+			Operation:   operation,
+			Collection:  collection,
+			DocumentKey: meta.Key,
+			DocumentID:  meta.ID.String(),
+			Rev:         meta.Rev,
+		}
+		// Creates that overwrite an existing document are updates
+		if operation == ChangeCreate && meta.OldRev != "" {
+			change.Operation = ChangeUpdate
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// changeEventType names a change after its collection, or "relationships"
+// for edge collections, and its operation.
+func changeEventType(change *changeRecord) string {
+	kind := RelationshipsType
+	if slices.Contains(EntityCollections, change.Collection) {
+		kind = change.Collection
+	}
+	return kind + "." + change.Operation
+}
+
+// watchedCollection records the documents written through a collection in
+// the change log, in the transaction of the write. A write fails and is
+// rolled back if its changes cannot be recorded.
+type watchedCollection struct {
+	driver.Collection
+	changes *ChangeLog
+}
+
+// write runs a write of the collection and records its changes in one
+// transaction.
+func (c *watchedCollection) write(ctx context.Context, write func(ctx context.Context) ([]*changeRecord, error)) error {
+	return c.changes.transact(ctx, driver.TransactionCollections{Write: []string{c.Name()}}, func(ctx context.Context) error {
+		changes, err := write(ctx)
+		if err != nil {
+			return err
+		}
+		return c.changes.Record(ctx, changes)
+	})
+}
+
+func (c *watchedCollection) CreateDocument(ctx context.Context, document interface{}) (meta driver.DocumentMeta, err error) {
+	err = c.write(ctx, func(ctx context.Context) ([]*changeRecord, error) {
+		meta, err = c.Collection.CreateDocument(ctx, document)
+		return writeChanges(c.Name(), []driver.DocumentMeta{meta}, nil, ChangeCreate), err
+	})
+	return meta, err
+}
+
+func (c *watchedCollection) CreateDocuments(ctx context.Context, documents interface{}) (metas driver.DocumentMetaSlice, errs driver.ErrorSlice, err error) {
+	err = c.write(ctx, func(ctx context.Context) ([]*changeRecord, error) {
+		metas, errs, err = c.Collection.CreateDocuments(ctx, documents)
+		return writeChanges(c.Name(), metas, errs, ChangeCreate), err
+	})
+	return metas, errs, err
+}
+
+func (c *watchedCollection) UpdateDocument(ctx context.Context, key string, update interface{}) (meta driver.DocumentMeta, err error) {
+	err = c.write(ctx, func(ctx context.Context) ([]*changeRecord, error) {
+		meta, err = c.Collection.UpdateDocument(ctx, key, update)
+		return writeChanges(c.Name(), []driver.DocumentMeta{meta}, nil, ChangeUpdate), err
+	})
+	return meta, err
+}
+
+func (c *watchedCollection) UpdateDocuments(ctx context.Context, keys []string, updates interface{}) (metas driver.DocumentMetaSlice, errs driver.ErrorSlice, err error) {
+	err = c.write(ctx, func(ctx context.Context) ([]*changeRecord, error) {
+		metas, errs, err = c.Collection.UpdateDocuments(ctx, keys, updates)
+		return writeChanges(c.Name(), metas, errs, ChangeUpdate), err
+	})
+	return metas, errs, err
+}
+
+func (c *watchedCollection) ReplaceDocument(ctx context.Context, key string, document interface{}) (meta driver.DocumentMeta, err error) {
+	err = c.write(ctx, func(ctx context.Context) ([]*changeRecord, error) {
+		meta, err = c.Collection.ReplaceDocument(ctx, key, document)
+		return writeChanges(c.Name(), []driver.DocumentMeta{meta}, nil, ChangeUpdate), err
+	})
+	return meta, err
+}
+
+func (c *watchedCollection) ReplaceDocuments(ctx context.Context, keys []string, documents interface{}) (metas driver.DocumentMetaSlice, errs driver.ErrorSlice, err error) {
+	err = c.write(ctx, func(ctx context.Context) ([]*changeRecord, error) {
+		metas, errs, err = c.Collection.ReplaceDocuments(ctx, keys, documents)
+		return writeChanges(c.Name(), metas, errs, ChangeUpdate), err
+	})
+	return metas, errs, err
+}
+
+func (c *watchedCollection) RemoveDocument(ctx context.Context, key string) (meta driver.DocumentMeta, err error) {
+	err = c.write(ctx, func(ctx context.Context) ([]*changeRecord, error) {
+		var old map[string]interface{}
+		meta, err = c.Collection.RemoveDocument(driver.WithReturnOld(ctx, &old), key)
+		if err != nil {
+			return nil, err
+		}
+		changes := writeChanges(c.Name(), []driver.DocumentMeta{meta}, nil, ChangeDelete)
+		changes[0].Document = old
+		return changes, nil
+	})
+	return meta, err
+}
+
+func (c *watchedCollection) RemoveDocuments(ctx context.Context, keys []string) (metas driver.DocumentMetaSlice, errs driver.ErrorSlice, err error) {
+	err = c.write(ctx, func(ctx context.Context) ([]*changeRecord, error) {
+		old := make([]map[string]interface{}, len(keys))
+		metas, errs, err = c.Collection.RemoveDocuments(driver.WithReturnOld(ctx, old), keys)
+		if err != nil {
+			return nil, err
+		}
+		var changes []*changeRecord
+		for i := range metas {
+			if removed := writeChanges(c.Name(), metas[i:i+1], errs[i:i+1], ChangeDelete); len(removed) > 0 {
+				removed[0].Document = old[i]
+				changes = append(changes, removed...)
+			}
+		}
+		return changes, nil
+	})
+	return metas, errs, err
+}
+
+// broadcast wakes up every goroutine waiting for the next notification.
+type broadcast struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// changeSignal is notified whenever this process commits changes.
+var changeSignal = &broadcast{ch: make(chan struct{})}
+
+func (b *broadcast) wait() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.ch
+}
+
+func (b *broadcast) notify() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	close(b.ch)
+	b.ch = make(chan struct{})
+}
+
+// changeError returns the status errors of a change transaction as they are,
+// and logs and hides any other error.
+func changeError(ctx context.Context, err error, message string) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	logging.GetLogger(ctx).WithFields(logrus.Fields{
+		"error": err,
+	}).Error(message)
+	return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+}
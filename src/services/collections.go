@@ -0,0 +1,32 @@
+package services
+
+import (
+	"context"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omniscent-library/src/clients"
+)
+
+// GetCreateDocumentCollection opens a document collection that is not part of
+// the OSINT graph, creating it when it does not exist yet.
+func GetCreateDocumentCollection(ctx context.Context, client *clients.ArangoDBClient, name string) (driver.Collection, error) {
+	return getCreateDocumentCollection(ctx, client, name, &driver.CreateCollectionOptions{})
+}
+
+func getCreateDocumentCollection(ctx context.Context, client *clients.ArangoDBClient, name string, options *driver.CreateCollectionOptions) (driver.Collection, error) {
+	exists, err := client.DB.CollectionExists(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		return client.DB.Collection(ctx, name)
+	}
+
+	collection, err := client.DB.CreateCollection(ctx, name, options)
+	if driver.IsConflict(err) {
+		// Another service created the collection concurrently
+		return client.DB.Collection(ctx, name)
+	}
+	return collection, err
+}
@@ -0,0 +1,542 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DuplicateCandidatesCollection holds the scored pairs of likely duplicate persons.
+	DuplicateCandidatesCollection = "duplicate_candidates"
+	// DuplicateScanInterval is the environment variable overriding how often all persons are scanned for duplicates.
+	DuplicateScanInterval = "DUPLICATE_SCAN_INTERVAL"
+
+	candidatePending  = "pending"
+	candidateAccepted = "accepted"
+	candidateRejected = "rejected"
+
+	defaultDuplicateScanInterval = 6 * time.Hour
+	// Pairs with weaker name signals are not scored further
+	minNameScore     = 0.8
+	minPhoneticScore = 0.5
+	// duplicateThreshold is the lowest score kept as a candidate
+	duplicateThreshold = 0.75
+	// Blocking keys shared by more persons are too common to tell duplicates
+	maxBlockSize = 500
+
+	defaultCandidateLimit = 100
+	maxCandidateLimit     = 1000
+)
+
+var candidateStatuses = map[string]base.CandidateStatus{
+	candidatePending:  base.CandidateStatus_CANDIDATE_STATUS_PENDING,
+	candidateAccepted: base.CandidateStatus_CANDIDATE_STATUS_ACCEPTED,
+	candidateRejected: base.CandidateStatus_CANDIDATE_STATUS_REJECTED,
+}
+
+type candidateRecord struct {
+	Key        string          `json:"_key,omitempty"`
+	PersonA    string          `json:"person_a"`
+	PersonB    string          `json:"person_b"`
+	Score      float64         `json:"score"`
+	Scores     duplicateScores `json:"scores"`
+	Status     string          `json:"status"`
+	CreatedAt  int64           `json:"created_at"`
+	UpdatedAt  int64           `json:"updated_at"`
+	ReviewedAt int64           `json:"reviewed_at"`
+	ScannedAt  int64           `json:"scanned_at"`
+}
+
+// RunDuplicateScan scans all persons for duplicates every scan interval until
+// ctx is done.
+func (s *MergeService) RunDuplicateScan(ctx context.Context) {
+	ticker := time.NewTicker(s.ScanInterval)
+	defer ticker.Stop()
+
+	for {
+		found, err := s.ScanDuplicates(ctx)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("failed to scan persons for duplicates")
+		} else {
+			logrus.Infof("Found %d duplicate candidates", found)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ScanDuplicates scores all pairs of similar persons, stores the likely
+// duplicates as pending candidates and returns how many it found. Pending
+// candidates that are no longer found are removed, while reviewed candidates
+// are kept as they are.
+func (s *MergeService) ScanDuplicates(ctx context.Context) (int, error) {
+	scannedAt := time.Now().Unix()
+	profiles, err := s.personProfiles(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	candidates, err := s.findCandidates(ctx, profiles, profiles)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.storeCandidates(ctx, candidates, scannedAt); err != nil {
+		return 0, err
+	}
+
+	query := `
+		FOR c IN @@collection
+			FILTER c.status == @pending AND c.scanned_at < @scannedAt
+			REMOVE c IN @@collection
+	`
+	cursor, err := s.DBClient.DB.Query(ctx, query, map[string]interface{}{
+		"pending":     candidatePending,
+		"scannedAt":   scannedAt,
+		"@collection": s.Candidates.Name(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	cursor.Close()
+
+	return len(candidates), nil
+}
+
+func (s *MergeService) FindDuplicateCandidates(ctx context.Context, req *base.FindDuplicateCandidatesRequest) (*base.FindDuplicateCandidatesResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Finding duplicate candidates with filters: %v", req)
+
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = defaultCandidateLimit
+	}
+	if limit < 0 || limit > maxCandidateLimit || req.GetMinScore() < 0 || req.GetMinScore() > 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "Bad parameter")
+	}
+
+	statusName := candidatePending
+	if req.GetStatus() != base.CandidateStatus_CANDIDATE_STATUS_UNSPECIFIED {
+		statusName = candidateStatusName(req.GetStatus())
+		if statusName == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "Unknown status")
+		}
+	}
+
+	query := "FOR c IN @@collection\n\tFILTER c.status == @status AND c.score >= @minScore\n"
+	bindVars := map[string]interface{}{
+		"status":      statusName,
+		"minScore":    req.GetMinScore(),
+		"limit":       limit,
+		"@collection": s.Candidates.Name(),
+	}
+
+	if req.GetPersonId() != "" {
+		// Candidates of a merged person are those of the survivor
+		person, err := s.Redirects.Follow(ctx, req.GetPersonId())
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"id":    req.GetPersonId(),
+			}).Error("failed to resolve merged person")
+			return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		if err := s.scanPerson(ctx, person); err != nil {
+			return nil, err
+		}
+		query += "\tFILTER c.person_a == @person OR c.person_b == @person\n"
+		bindVars["person"] = person
+	}
+	query += "\tSORT c.score DESC, c._key\n\tLIMIT @limit\n\tRETURN c"
+
+	records, err := queryAll[candidateRecord](ctx, s.DBClient.DB, query, bindVars)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to list duplicate candidates")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	response := &base.FindDuplicateCandidatesResponse{}
+	for _, record := range records {
+		response.Candidates = append(response.Candidates, record.toCandidate())
+	}
+	return response, nil
+}
+
+func (s *MergeService) AcceptDuplicateCandidate(ctx context.Context, req *base.AcceptDuplicateCandidateRequest) (*base.AcceptDuplicateCandidateResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Accepting duplicate candidate with key: %s", req.GetKey())
+
+	candidate, err := s.readCandidate(ctx, req.GetKey())
+	if err != nil {
+		return nil, err
+	}
+	if candidate.Status != candidatePending {
+		return nil, status.Errorf(codes.FailedPrecondition, "Candidate is already %s", candidate.Status)
+	}
+
+	primary, duplicate := candidate.PersonA, candidate.PersonB
+	switch req.GetPrimaryId() {
+	case "", candidate.PersonA:
+	case candidate.PersonB:
+		primary, duplicate = candidate.PersonB, candidate.PersonA
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Primary person must be a person of the candidate")
+	}
+
+	// The candidate is accepted in the transaction of the merge
+	merge, err := s.mergeEntities(ctx, &base.MergeEntitiesRequest{
+		PrimaryId:     primary,
+		DuplicateIds:  []string{duplicate},
+		FieldStrategy: req.GetFieldStrategy(),
+	}, func(ctx context.Context) error {
+		candidate, err = s.reviewCandidate(ctx, req.GetKey(), candidateAccepted)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &base.AcceptDuplicateCandidateResponse{Candidate: candidate.toCandidate(), Merge: merge}, nil
+}
+
+func (s *MergeService) RejectDuplicateCandidate(ctx context.Context, req *base.RejectDuplicateCandidateRequest) (*base.RejectDuplicateCandidateResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Rejecting duplicate candidate with key: %s", req.GetKey())
+
+	candidate, err := s.readCandidate(ctx, req.GetKey())
+	if err != nil {
+		return nil, err
+	}
+	if candidate.Status == candidateAccepted {
+		return nil, status.Errorf(codes.FailedPrecondition, "Candidate is already %s", candidate.Status)
+	}
+
+	candidate, err = s.reviewCandidate(ctx, req.GetKey(), candidateRejected)
+	if err != nil {
+		return nil, err
+	}
+	return &base.RejectDuplicateCandidateResponse{Candidate: candidate.toCandidate()}, nil
+}
+
+// scanPerson scores a person against the persons sharing a blocking key with
+// it and stores its candidates.
+func (s *MergeService) scanPerson(ctx context.Context, id string) error {
+	logger := logging.GetLogger(ctx)
+
+	if name, _, err := s.DBClient.ParseDocID(id); err != nil || name != "persons" {
+		return status.Errorf(codes.InvalidArgument, "Duplicates can only be found for persons")
+	}
+
+	targets, err := queryAll[personProfile](ctx, s.DBClient.DB, "FOR p IN [DOCUMENT(@id)] FILTER p != null "+personProfileFields, map[string]interface{}{
+		"id": id,
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"id":    id,
+		}).Error("failed to read person")
+		return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	if len(targets) == 0 {
+		return status.Errorf(codes.NotFound, "Person not found")
+	}
+	target := targets[0]
+	target.prepare()
+
+	profiles, err := s.blockProfiles(ctx, target.codes)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"id":    id,
+		}).Error("failed to read persons sharing a blocking key")
+		return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	candidates, err := s.findCandidates(ctx, []*personProfile{target}, profiles)
+	if err == nil {
+		err = s.storeCandidates(ctx, candidates, time.Now().Unix())
+	}
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"id":    id,
+		}).Error("failed to score duplicates of person")
+		return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	return nil
+}
+
+// personProfileFields returns the fields of a person p compared to find
+// duplicates.
+const personProfileFields = `RETURN KEEP(p, "_id", "name", "aliases", "birth_date", "nationality")`
+
+// blockProfiles reads the persons sharing one of the blocking keys through
+// the indexed search keys of their names, leaving out blocks too common to
+// tell duplicates.
+func (s *MergeService) blockProfiles(ctx context.Context, keys []string) ([]*personProfile, error) {
+	query := `
+		FOR key IN @keys
+			LET block = UNION_DISTINCT(
+				(FOR p IN @@collection FILTER key IN p.name_keys.phonetic[*] LIMIT @limit RETURN p._id),
+				(FOR p IN @@collection FILTER key IN p.alias_keys.phonetic[*] LIMIT @limit RETURN p._id),
+				(FOR p IN @@collection FILTER key IN p.name_keys.tokens[*] LIMIT @limit RETURN p._id),
+				(FOR p IN @@collection FILTER key IN p.alias_keys.tokens[*] LIMIT @limit RETURN p._id)
+			)
+			FILTER LENGTH(block) <= @maxBlockSize
+			FOR id IN block
+				COLLECT person = id
+				LET p = DOCUMENT(person)
+				` + personProfileFields
+	profiles, err := queryAll[personProfile](ctx, s.DBClient.DB, query, map[string]interface{}{
+		"keys":         keys,
+		"limit":        maxBlockSize + 1,
+		"maxBlockSize": maxBlockSize,
+		"@collection":  s.Collections["persons"].Name(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, profile := range profiles {
+		profile.prepare()
+	}
+	return profiles, nil
+}
+
+// personProfiles reads the fields of all persons compared to find duplicates.
+func (s *MergeService) personProfiles(ctx context.Context) ([]*personProfile, error) {
+	profiles, err := queryAll[personProfile](ctx, s.DBClient.DB, "FOR p IN @@collection "+personProfileFields, map[string]interface{}{
+		"@collection": s.Collections["persons"].Name(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, profile := range profiles {
+		profile.prepare()
+	}
+	return profiles, nil
+}
+
+// findCandidates scores the targets against the profiles sharing a phonetic
+// code with them and returns the pairs scoring above the threshold.
+func (s *MergeService) findCandidates(ctx context.Context, targets, profiles []*personProfile) ([]*candidateRecord, error) {
+	blocks := map[string][]*personProfile{}
+	for _, profile := range profiles {
+		for _, code := range profile.codes {
+			blocks[code] = append(blocks[code], profile)
+		}
+	}
+
+	neighbors := map[string][]string{}
+	neighborsOf := func(id string) ([]string, error) {
+		if ids, ok := neighbors[id]; ok {
+			return ids, nil
+		}
+		ids, err := queryAll[string](ctx, s.DBClient.DB, "FOR v IN 1..1 ANY @id GRAPH @graph RETURN DISTINCT v._id", map[string]interface{}{
+			"id":    id,
+			"graph": s.DBClient.OsintGraph.Name(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		neighbors[id] = make([]string, len(ids))
+		for i, v := range ids {
+			neighbors[id][i] = *v
+		}
+		return neighbors[id], nil
+	}
+
+	var candidates []*candidateRecord
+	scored := map[string]bool{}
+	for _, target := range targets {
+		for _, code := range target.codes {
+			block := blocks[code]
+			if len(block) > maxBlockSize {
+				continue
+			}
+
+			for _, other := range block {
+				a, b := target, other
+				if a.ID == b.ID {
+					continue
+				}
+				if a.ID > b.ID {
+					a, b = b, a
+				}
+				key := candidateKey(a.ID, b.ID)
+				if scored[key] {
+					continue
+				}
+				scored[key] = true
+
+				scores := scoreNames(a, b)
+				if scores.Name < minNameScore && scores.Phonetic < minPhoneticScore {
+					continue
+				}
+
+				neighborsA, err := neighborsOf(a.ID)
+				if err != nil {
+					return nil, err
+				}
+				neighborsB, err := neighborsOf(b.ID)
+				if err != nil {
+					return nil, err
+				}
+				scores = scorePersons(a, b, scores, neighborsA, neighborsB)
+
+				if score := scores.total(); score >= duplicateThreshold {
+					candidates = append(candidates, &candidateRecord{
+						Key:     key,
+						PersonA: a.ID,
+						PersonB: b.ID,
+						Score:   score,
+						Scores:  scores,
+						Status:  candidatePending,
+					})
+				}
+			}
+		}
+	}
+	return candidates, nil
+}
+
+// storeCandidates adds new candidates and updates the scores of pending
+// candidates. Reviewed candidates are left as they are, so rejected pairs do
+// not come back.
+func (s *MergeService) storeCandidates(ctx context.Context, candidates []*candidateRecord, scannedAt int64) error {
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	for _, candidate := range candidates {
+		candidate.CreatedAt = now
+		candidate.UpdatedAt = now
+		candidate.ScannedAt = scannedAt
+	}
+
+	query := `
+		FOR c IN @candidates
+			UPSERT { _key: c._key }
+			INSERT c
+			UPDATE OLD.status == @pending ? { score: c.score, scores: c.scores, updated_at: c.updated_at, scanned_at: c.scanned_at } : {}
+			IN @@collection
+	`
+	cursor, err := s.DBClient.DB.Query(ctx, query, map[string]interface{}{
+		"candidates":  candidates,
+		"pending":     candidatePending,
+		"@collection": s.Candidates.Name(),
+	})
+	if err != nil {
+		return err
+	}
+	cursor.Close()
+	return nil
+}
+
+func (s *MergeService) readCandidate(ctx context.Context, key string) (*candidateRecord, error) {
+	logger := logging.GetLogger(ctx)
+
+	var candidate candidateRecord
+	if _, err := s.Candidates.ReadDocument(ctx, key, &candidate); err != nil {
+		if driver.IsNotFoundGeneral(err) {
+			logger.WithFields(logrus.Fields{
+				"key": key,
+			}).Info("duplicate candidate not found")
+			return nil, status.Errorf(codes.NotFound, "Candidate not found")
+		}
+
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"key":   key,
+		}).Error("failed to read duplicate candidate")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	return &candidate, nil
+}
+
+func (s *MergeService) reviewCandidate(ctx context.Context, key, review string) (*candidateRecord, error) {
+	var candidate candidateRecord
+	_, err := s.Candidates.UpdateDocument(driver.WithReturnNew(ctx, &candidate), key, map[string]interface{}{
+		"status":      review,
+		"reviewed_at": time.Now().Unix(),
+	})
+	if err != nil {
+		logging.GetLogger(ctx).WithFields(logrus.Fields{
+			"error": err,
+			"key":   key,
+		}).Error("failed to review duplicate candidate")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	return &candidate, nil
+}
+
+// closeCandidates removes the pending candidates of merged persons in the
+// transaction of ctx. The pairs of the survivor are found by the next scan.
+func (s *MergeService) closeCandidates(ctx context.Context, merged []string) error {
+	query := `
+		FOR c IN @@collection
+			FILTER c.status == @pending AND (c.person_a IN @merged OR c.person_b IN @merged)
+			REMOVE c IN @@collection
+	`
+	cursor, err := s.DBClient.DB.Query(ctx, query, map[string]interface{}{
+		"pending":     candidatePending,
+		"merged":      merged,
+		"@collection": s.Candidates.Name(),
+	})
+	if err != nil {
+		return err
+	}
+	cursor.Close()
+	return nil
+}
+
+func (c *candidateRecord) toCandidate() *base.DuplicateCandidate {
+	return &base.DuplicateCandidate{
+		Key:     c.Key,
+		PersonA: c.PersonA,
+		PersonB: c.PersonB,
+		Score:   c.Score,
+		Scores: &base.DuplicateScores{
+			Name:        c.Scores.Name,
+			Phonetic:    c.Scores.Phonetic,
+			BirthDate:   c.Scores.BirthDate,
+			Nationality: c.Scores.Nationality,
+			Neighbors:   c.Scores.Neighbors,
+		},
+		Status:     candidateStatuses[c.Status],
+		CreatedAt:  c.CreatedAt,
+		UpdatedAt:  c.UpdatedAt,
+		ReviewedAt: c.ReviewedAt,
+	}
+}
+
+// candidateKey returns the key of the candidate of two persons, ordered by ID.
+func candidateKey(a, b string) string {
+	return fmt.Sprintf("%s:%s", strings.TrimPrefix(a, "persons/"), strings.TrimPrefix(b, "persons/"))
+}
+
+func candidateStatusName(value base.CandidateStatus) string {
+	for name, s := range candidateStatuses {
+		if s == value {
+			return name
+		}
+	}
+	return ""
+}
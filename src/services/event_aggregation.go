@@ -0,0 +1,293 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultGridPrecision = 5
+	maxGeohashPrecision  = 12
+	maxHexPrecision      = 15
+	defaultGroupLimit    = 100
+	maxGroupLimit        = 10000
+
+	geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+	// hexCellSize is the distance in degrees from the center of a hexagonal
+	// cell of precision 0 to its corners
+	hexCellSize = 30.0
+)
+
+// histogramBuckets truncates happened_at, in Unix seconds, to the start of
+// its bucket as an ISO date.
+var histogramBuckets = map[base.HistogramInterval]string{
+	base.HistogramInterval_HISTOGRAM_INTERVAL_HOUR:  `DATE_TRUNC(doc.happened_at * 1000, "hour")`,
+	base.HistogramInterval_HISTOGRAM_INTERVAL_DAY:   `DATE_TRUNC(doc.happened_at * 1000, "day")`,
+	base.HistogramInterval_HISTOGRAM_INTERVAL_WEEK:  `DATE_SUBTRACT(DATE_TRUNC(doc.happened_at * 1000, "day"), (DATE_DAYOFWEEK(doc.happened_at * 1000) + 6) % 7, "day")`,
+	base.HistogramInterval_HISTOGRAM_INTERVAL_MONTH: `DATE_TRUNC(doc.happened_at * 1000, "month")`,
+}
+
+// groupByValues lists the values of an event a group counts.
+var groupByValues = map[base.GroupByField]string{
+	base.GroupByField_GROUP_BY_FIELD_COUNTRY_CODE:        "[doc.location.country_code]",
+	base.GroupByField_GROUP_BY_FIELD_ADMINISTRATIVE_AREA: "[doc.location.administrative_area]",
+	base.GroupByField_GROUP_BY_FIELD_TAGS:                "IS_ARRAY(doc.tags) ? doc.tags : []",
+}
+
+func (s *EventService) AggregateEvents(ctx context.Context, req *base.AggregateEventsRequest) (*base.AggregateEventsResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Aggregating events with filters: %v", req)
+
+	filters, bindVars, err := eventFilters(req.GetStartTime(), req.GetEndTime(), req.GetBbox(), req.GetTags())
+	if err != nil {
+		return nil, err
+	}
+	filters = append(filters, gradedEventFilters(s.DBClient.OsintGraph.Name(), req.MinReliability, req.MinCredibility, bindVars)...)
+	bindVars["@collection"] = s.Collection.Name()
+
+	histogram, ok := histogramBuckets[req.GetHistogramInterval()]
+	if !ok && req.GetHistogramInterval() != base.HistogramInterval_HISTOGRAM_INTERVAL_UNSPECIFIED {
+		return nil, status.Errorf(codes.InvalidArgument, "Unknown histogram interval")
+	}
+
+	precision := int(req.GetGridPrecision())
+	if precision == 0 {
+		precision = defaultGridPrecision
+	}
+	switch req.GetGrid() {
+	case base.SpatialGrid_SPATIAL_GRID_UNSPECIFIED:
+	case base.SpatialGrid_SPATIAL_GRID_GEOHASH:
+		if precision < 1 || precision > maxGeohashPrecision {
+			return nil, status.Errorf(codes.InvalidArgument, "Geohash precision must be between 1 and %d", maxGeohashPrecision)
+		}
+	case base.SpatialGrid_SPATIAL_GRID_HEX:
+		if precision < 0 || precision > maxHexPrecision {
+			return nil, status.Errorf(codes.InvalidArgument, "Hex precision must be between 0 and %d", maxHexPrecision)
+		}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Unknown spatial grid")
+	}
+
+	limit := int(req.GetGroupLimit())
+	if limit == 0 {
+		limit = defaultGroupLimit
+	}
+	if limit < 0 || limit > maxGroupLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "Group limit must be between 1 and %d", maxGroupLimit)
+	}
+	for _, field := range req.GetGroupBy() {
+		if _, ok := groupByValues[field]; !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "Unknown group by field")
+		}
+	}
+
+	query := "FOR doc IN @@collection\n"
+	for _, filter := range filters {
+		query += "\tFILTER " + filter + "\n"
+	}
+
+	resp, err := s.aggregateEvents(ctx, query, bindVars, req, histogram, precision, limit)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to aggregate events")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	logger.Infof("Aggregated %d events", resp.Total)
+	return resp, nil
+}
+
+// aggregateEvents runs the aggregations requested over the events selected by
+// query, a FOR loop over doc with its filters.
+func (s *EventService) aggregateEvents(ctx context.Context, query string, bindVars map[string]interface{}, req *base.AggregateEventsRequest, histogram string, precision, limit int) (*base.AggregateEventsResponse, error) {
+	resp := &base.AggregateEventsResponse{}
+
+	totals, err := queryAll[int64](ctx, s.DBClient.DB, query+"\tCOLLECT WITH COUNT INTO total\n\tRETURN total", bindVars)
+	if err != nil {
+		return nil, err
+	}
+	if len(totals) > 0 {
+		resp.Total = *totals[0]
+	}
+
+	if histogram != "" {
+		resp.Histogram, err = queryAll[base.HistogramBucket](ctx, s.DBClient.DB, query+
+			"\tFILTER doc.happened_at > 0\n"+
+			"\tCOLLECT bucket = "+histogram+" WITH COUNT INTO count\n"+
+			"\tSORT bucket\n"+
+			"\tRETURN { start_time: DATE_TIMESTAMP(bucket) / 1000, count }", bindVars)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if req.GetGrid() != base.SpatialGrid_SPATIAL_GRID_UNSPECIFIED {
+		resp.Grid, err = s.aggregateGrid(ctx, query+
+			"\tFILTER "+eventLocatedFilter+"\n"+
+			"\tRETURN [doc.location.latitude || 0, doc.location.longitude || 0]", bindVars, req.GetGrid(), precision)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, field := range req.GetGroupBy() {
+		groupVars := map[string]interface{}{"limit": limit}
+		for name, value := range bindVars {
+			groupVars[name] = value
+		}
+
+		buckets, err := queryAll[base.GroupBucket](ctx, s.DBClient.DB, query+
+			"\tFOR value IN "+groupByValues[field]+"\n"+
+			"\t\tFILTER IS_STRING(value) AND value != \"\"\n"+
+			"\t\tCOLLECT v = value WITH COUNT INTO count\n"+
+			"\t\tSORT count DESC, v\n"+
+			"\t\tLIMIT @limit\n"+
+			"\t\tRETURN { value: v, count }", groupVars)
+		if err != nil {
+			return nil, err
+		}
+		resp.Groups = append(resp.Groups, &base.GroupCounts{Field: field, Buckets: buckets})
+	}
+	return resp, nil
+}
+
+// queryAll reads every result of query.
+func queryAll[T any](ctx context.Context, db driver.Database, query string, bindVars map[string]interface{}) ([]*T, error) {
+	cursor, err := db.Query(ctx, query, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	var results []*T
+	for {
+		result := new(T)
+		if _, err := cursor.ReadDocument(ctx, result); driver.IsNoMoreDocuments(err) {
+			return results, nil
+		} else if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+}
+
+// aggregateGrid counts the coordinates returned by query per grid cell.
+func (s *EventService) aggregateGrid(ctx context.Context, query string, bindVars map[string]interface{}, grid base.SpatialGrid, precision int) ([]*base.GridCell, error) {
+	cursor, err := s.DBClient.DB.Query(ctx, query, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	cells := map[string]*base.GridCell{}
+	for {
+		var point [2]float64
+		if _, err := cursor.ReadDocument(ctx, &point); driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		var cell *base.GridCell
+		if grid == base.SpatialGrid_SPATIAL_GRID_HEX {
+			cell = hexCell(point[0], point[1], precision)
+		} else {
+			cell = geohashCell(point[0], point[1], precision)
+		}
+		if existing, ok := cells[cell.Cell]; ok {
+			cell = existing
+		} else {
+			cells[cell.Cell] = cell
+		}
+		cell.Count++
+	}
+
+	result := make([]*base.GridCell, 0, len(cells))
+	for _, cell := range cells {
+		result = append(result, cell)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Cell < result[j].Cell
+	})
+	return result, nil
+}
+
+// geohashCell returns the geohash cell of the given precision containing a
+// point.
+func geohashCell(latitude, longitude float64, precision int) *base.GridCell {
+	minLat, maxLat := -90.0, 90.0
+	minLon, maxLon := -180.0, 180.0
+
+	var hash strings.Builder
+	even := true
+	for hash.Len() < precision {
+		index := 0
+		for bit := 4; bit >= 0; bit-- {
+			if even {
+				mid := (minLon + maxLon) / 2
+				if longitude >= mid {
+					index |= 1 << bit
+					minLon = mid
+				} else {
+					maxLon = mid
+				}
+			} else {
+				mid := (minLat + maxLat) / 2
+				if latitude >= mid {
+					index |= 1 << bit
+					minLat = mid
+				} else {
+					maxLat = mid
+				}
+			}
+			even = !even
+		}
+		hash.WriteByte(geohashAlphabet[index])
+	}
+
+	return &base.GridCell{
+		Cell:      hash.String(),
+		Latitude:  (minLat + maxLat) / 2,
+		Longitude: (minLon + maxLon) / 2,
+	}
+}
+
+// hexCell returns the pointy-top hexagonal cell of the given precision
+// containing a point, treating longitude and latitude as plane coordinates.
+// Cells are named "hex:<precision>:<q>:<r>" after their axial coordinates.
+func hexCell(latitude, longitude float64, precision int) *base.GridCell {
+	size := hexCellSize / math.Exp2(float64(precision))
+	q := (math.Sqrt(3)/3*longitude - latitude/3) / size
+	r := (2.0 / 3 * latitude) / size
+
+	// Round the fractional cube coordinates to the nearest cell
+	x, z := q, r
+	y := -x - z
+	rx, ry, rz := math.Round(x), math.Round(y), math.Round(z)
+	dx, dy, dz := math.Abs(rx-x), math.Abs(ry-y), math.Abs(rz-z)
+	if dx > dy && dx > dz {
+		rx = -ry - rz
+	} else if dy <= dz {
+		rz = -rx - ry
+	}
+
+	return &base.GridCell{
+		Cell:      fmt.Sprintf("hex:%d:%d:%d", precision, int64(rx), int64(rz)),
+		Latitude:  size * 1.5 * rz,
+		Longitude: size * math.Sqrt(3) * (rx + rz/2),
+	}
+}
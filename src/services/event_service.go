@@ -17,11 +17,13 @@ import (
 type EventService struct {
 	base.UnimplementedEventServiceServer
 
-	DBClient   *clients.ArangoDBClient
-	Collection driver.Collection
+	DBClient    *clients.ArangoDBClient
+	Collection  driver.Collection
+	Idempotency *IdempotencyStore
+	Changes     *ChangeLog
 }
 
-func NewEventService(client *clients.ArangoDBClient) (*EventService, error) {
+func NewEventService(client *clients.ArangoDBClient, idempotency *IdempotencyStore, changes *ChangeLog) (*EventService, error) {
 	// Create events collection
 	ctx := context.Background()
 	collection, err := client.GetCreateCollection(ctx, "events", driver.CreateVertexCollectionOptions{})
@@ -30,13 +32,20 @@ func NewEventService(client *clients.ArangoDBClient) (*EventService, error) {
 	}
 	logrus.Infof("✅ Initialized collection %s", collection.Name())
 
-	collection.EnsurePersistentIndex(ctx, []string{"happened_at"}, &driver.EnsurePersistentIndexOptions{
-		InBackground: true,
-	})
+	if err := EnsureIndexes(ctx, collection); err != nil {
+		return nil, err
+	}
+
+	// Deletes remove the citations of the deleted documents
+	if _, err := getCreateProvenanceCollection(ctx, client); err != nil {
+		return nil, fmt.Errorf("failed to get or create %s collection: %v", ProvenanceCollection, err)
+	}
 
 	service := &EventService{
-		DBClient:   client,
-		Collection: collection,
+		DBClient:    client,
+		Collection:  changes.Watch(collection),
+		Idempotency: idempotency,
+		Changes:     changes,
 	}
 	return service, nil
 }
@@ -66,10 +75,30 @@ func (s *EventService) GetEvent(ctx context.Context, req *base.GetEventRequest)
 	event.Id = meta.ID.String()
 	event.Key = meta.Key
 	event.Rev = meta.Rev
-	return &base.GetEventResponse{Event: &event}, nil
+	response := &base.GetEventResponse{Event: &event}
+	if req.GetIncludeCitations() {
+		citations, err := listCitations(ctx, s.DBClient.DB, event.Id)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"key":   req.GetKey(),
+			}).Error("failed to list event citations")
+			return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		response.Citations = citations
+	}
+	return response, nil
 }
 
 func (s *EventService) CreateEvent(ctx context.Context, req *base.CreateEventRequest) (*base.CreateEventResponse, error) {
+	return WithIdempotency(ctx, s.Idempotency, "CreateEvent", req, func(resp *base.CreateEventResponse) string {
+		return resp.GetEvent().GetId()
+	}, func() (*base.CreateEventResponse, error) {
+		return s.createEvent(ctx, req)
+	})
+}
+
+func (s *EventService) createEvent(ctx context.Context, req *base.CreateEventRequest) (*base.CreateEventResponse, error) {
 	logger := logging.GetLogger(ctx)
 	logger.Infof("Creating event")
 
@@ -123,8 +152,14 @@ func (s *EventService) DeleteEvent(ctx context.Context, req *base.DeleteEventReq
 	logger := logging.GetLogger(ctx)
 	logger.Infof("Deleting event with Key: %s", req.GetKey())
 
-	// Remove document from collection
-	_, err := s.Collection.RemoveDocument(ctx, req.GetKey())
+	// Remove document from collection with its citations
+	err := s.Changes.transact(ctx, driver.TransactionCollections{Write: []string{s.Collection.Name(), ProvenanceCollection}}, func(ctx context.Context) error {
+		meta, err := s.Collection.RemoveDocument(ctx, req.GetKey())
+		if err != nil {
+			return err
+		}
+		return removeCitations(ctx, s.DBClient.DB, s.Changes, []string{meta.ID.String()})
+	})
 	if err != nil {
 		if driver.IsNotFoundGeneral(err) {
 			logger.WithFields(logrus.Fields{
@@ -142,3 +177,220 @@ func (s *EventService) DeleteEvent(ctx context.Context, req *base.DeleteEventReq
 
 	return &base.DeleteEventResponse{}, nil
 }
+
+func (s *EventService) BatchCreateEvents(ctx context.Context, req *base.BatchCreateEventsRequest) (*base.BatchCreateEventsResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch creating %d events", len(req.GetEvents()))
+
+	if err := checkBatchSize(len(req.GetEvents())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetEvents()))
+		return nil, err
+	}
+
+	// Create documents in collection
+	events := make([]model.Event, len(req.GetEvents()))
+	metas := make(driver.DocumentMetaSlice, len(req.GetEvents()))
+	errs := make([]error, len(req.GetEvents()))
+	err := runBatch(ctx, s.DBClient.DB, []string{s.Collection.Name()}, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		created, itemErrs, err := s.Collection.CreateDocuments(driver.WithReturnNew(ctx, events), req.GetEvents())
+		copy(metas, created)
+		copy(errs, itemErrs)
+		return err
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to create event documents")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	response := &base.BatchCreateEventsResponse{}
+	for i := range events {
+		result := &base.BatchEventResult{Error: batchError(errs[i])}
+		if errs[i] == nil {
+			events[i].Id = metas[i].ID.String()
+			events[i].Key = metas[i].Key
+			events[i].Rev = metas[i].Rev
+			result.Event = &events[i]
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+func (s *EventService) BatchUpdateEvents(ctx context.Context, req *base.BatchUpdateEventsRequest) (*base.BatchUpdateEventsResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch updating %d events", len(req.GetEvents()))
+
+	if err := checkBatchSize(len(req.GetEvents())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetEvents()))
+		return nil, err
+	}
+
+	// Items without a key never reach the database
+	errs := make([]error, len(req.GetEvents()))
+	var keys []string
+	var patches []*model.Event
+	var positions []int
+	for i, event := range req.GetEvents() {
+		if event.GetKey() == "" {
+			errs[i] = errMissingKey
+			continue
+		}
+		keys = append(keys, event.GetKey())
+		patches = append(patches, event)
+		positions = append(positions, i)
+	}
+
+	// Update documents in collection
+	updated := make([]model.Event, len(keys))
+	err := runBatch(ctx, s.DBClient.DB, []string{s.Collection.Name()}, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		if len(keys) == 0 {
+			return nil
+		}
+
+		metas, itemErrs, err := s.Collection.UpdateDocuments(driver.WithReturnNew(ctx, updated), keys, patches)
+		if err != nil {
+			return err
+		}
+
+		for j, position := range positions {
+			errs[position] = itemErrs[j]
+			if itemErrs[j] == nil {
+				updated[j].Id = metas[j].ID.String()
+				updated[j].Key = metas[j].Key
+				updated[j].Rev = metas[j].Rev
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to update event documents")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	events := make([]*model.Event, len(req.GetEvents()))
+	for j, position := range positions {
+		events[position] = &updated[j]
+	}
+
+	response := &base.BatchUpdateEventsResponse{}
+	for i := range events {
+		result := &base.BatchEventResult{Error: batchError(errs[i])}
+		if errs[i] == nil {
+			result.Event = events[i]
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+func (s *EventService) BatchDeleteEvents(ctx context.Context, req *base.BatchDeleteEventsRequest) (*base.BatchDeleteEventsResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch deleting %d events", len(req.GetKeys()))
+
+	if err := checkBatchSize(len(req.GetKeys())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetKeys()))
+		return nil, err
+	}
+
+	// Items without a key never reach the database
+	errs := make([]error, len(req.GetKeys()))
+	var keys []string
+	var positions []int
+	for i, key := range req.GetKeys() {
+		if key == "" {
+			errs[i] = errMissingKey
+			continue
+		}
+		keys = append(keys, key)
+		positions = append(positions, i)
+	}
+
+	// Remove documents from collection with their citations
+	collections := []string{s.Collection.Name(), ProvenanceCollection}
+	err := runBatch(ctx, s.DBClient.DB, collections, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		if len(keys) == 0 {
+			return nil
+		}
+
+		return s.Changes.transact(ctx, driver.TransactionCollections{Write: collections}, func(ctx context.Context) error {
+			metas, itemErrs, err := s.Collection.RemoveDocuments(ctx, keys)
+			if err != nil {
+				return err
+			}
+
+			var ids []string
+			for j, position := range positions {
+				errs[position] = itemErrs[j]
+				if itemErrs[j] == nil {
+					ids = append(ids, metas[j].ID.String())
+				}
+			}
+			return removeCitations(ctx, s.DBClient.DB, s.Changes, ids)
+		})
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to delete event documents")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	response := &base.BatchDeleteEventsResponse{}
+	for i, key := range req.GetKeys() {
+		response.Results = append(response.Results, &base.BatchDeleteResult{
+			Key:   key,
+			Error: batchError(errs[i]),
+		})
+	}
+	return response, nil
+}
+
+// eventLocatedFilter keeps the events with coordinates.
+const eventLocatedFilter = "IS_NUMBER(doc.location.latitude) OR IS_NUMBER(doc.location.longitude)"
+
+// eventFilters returns the AQL filters on doc and their bind variables
+// selecting events by time range, bounding box and tags.
+func eventFilters(startTime, endTime int64, bbox *base.BoundingBox, tags []string) ([]string, map[string]interface{}, error) {
+	var filters []string
+	bindVars := map[string]interface{}{}
+
+	if endTime != 0 && startTime > endTime {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "Start time must not be after end time")
+	}
+	if startTime != 0 {
+		filters = append(filters, "doc.happened_at >= @startTime")
+		bindVars["startTime"] = startTime
+	}
+	if endTime != 0 {
+		filters = append(filters, "doc.happened_at <= @endTime")
+		bindVars["endTime"] = endTime
+	}
+
+	if bbox != nil {
+		if bbox.GetMinLatitude() < -90 || bbox.GetMaxLatitude() > 90 || bbox.GetMinLatitude() > bbox.GetMaxLatitude() ||
+			bbox.GetMinLongitude() < -180 || bbox.GetMaxLongitude() > 180 {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "Invalid bounding box")
+		}
+
+		filters = append(filters, "(doc.location.latitude || 0) >= @minLatitude AND (doc.location.latitude || 0) <= @maxLatitude")
+		if bbox.GetMinLongitude() <= bbox.GetMaxLongitude() {
+			filters = append(filters, "(doc.location.longitude || 0) >= @minLongitude AND (doc.location.longitude || 0) <= @maxLongitude")
+		} else {
+			filters = append(filters, "((doc.location.longitude || 0) >= @minLongitude OR (doc.location.longitude || 0) <= @maxLongitude)")
+		}
+		bindVars["minLatitude"] = bbox.GetMinLatitude()
+		bindVars["maxLatitude"] = bbox.GetMaxLatitude()
+		bindVars["minLongitude"] = bbox.GetMinLongitude()
+		bindVars["maxLongitude"] = bbox.GetMaxLongitude()
+	}
+
+	if len(tags) > 0 {
+		filters = append(filters, "@tags ANY IN doc.tags")
+		bindVars["tags"] = tags
+	}
+	return filters, bindVars, nil
+}
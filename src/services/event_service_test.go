@@ -2,11 +2,16 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/omnsight/omnibasement/gen/base/v1"
 	"github.com/omnsight/omniscent-library/gen/model/v1"
 	"github.com/omnsight/omniscent-library/src/clients"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func TestEventService(t *testing.T) {
@@ -21,8 +26,18 @@ func TestEventService(t *testing.T) {
 		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
 	}
 
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
 	// Create EventService
-	service, err := NewEventService(client)
+	service, err := NewEventService(client, idempotency, changes)
 	if err != nil {
 		t.Fatalf("Failed to create EventService: %v", err)
 	}
@@ -32,19 +47,19 @@ func TestEventService(t *testing.T) {
 	}
 
 	// Create PersonService
-	personService, err := NewPersonService(client)
+	personService, err := NewPersonService(client, idempotency, changes)
 	if err != nil {
 		t.Fatalf("Failed to create PersonService: %v", err)
 	}
 
 	// Create OrganizationService
-	orgService, err := NewOrganizationService(client)
+	orgService, err := NewOrganizationService(client, idempotency, changes)
 	if err != nil {
 		t.Fatalf("Failed to create OrganizationService: %v", err)
 	}
 
 	// Create RelationshipService
-	relationshipService, err := NewRelationshipService(client)
+	relationshipService, err := NewRelationshipService(client, idempotency, changes)
 	if err != nil {
 		t.Fatalf("Failed to create RelationshipService: %v", err)
 	}
@@ -269,4 +284,135 @@ func TestEventService(t *testing.T) {
 			t.Fatalf("Failed to delete event 2: %v", err)
 		}
 	})
+
+	t.Run("Idempotency", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			IdempotencyKeyHeader, fmt.Sprintf("test-%d", time.Now().UnixNano()),
+		))
+
+		createReq := &base.CreateEventRequest{
+			Event: &model.Event{
+				Title:      "Idempotent Event",
+				HappenedAt: 3000,
+			},
+		}
+
+		firstResp, err := service.CreateEvent(ctx, createReq)
+		if err != nil {
+			t.Fatalf("Failed to create event: %v", err)
+		}
+
+		// Retrying with the same key should replay the original response
+		secondResp, err := service.CreateEvent(ctx, createReq)
+		if err != nil {
+			t.Fatalf("Failed to retry event creation: %v", err)
+		}
+
+		if secondResp.Event.Key != firstResp.Event.Key {
+			t.Errorf("Expected key to be '%s', got '%s'", firstResp.Event.Key, secondResp.Event.Key)
+		}
+
+		// Reusing the key with a different request should conflict
+		_, err = service.CreateEvent(ctx, &base.CreateEventRequest{
+			Event: &model.Event{
+				Title:      "Another Event",
+				HappenedAt: 4000,
+			},
+		})
+		if err == nil {
+			t.Error("Expected error when reusing idempotency key with a different request")
+		} else {
+			if status.Code(err) != codes.Aborted {
+				t.Errorf("Expected Aborted error, got %v", status.Code(err))
+			}
+		}
+
+		_, err = service.DeleteEvent(context.Background(), &base.DeleteEventRequest{
+			Key: firstResp.Event.Key,
+		})
+		if err != nil {
+			t.Fatalf("Failed to delete event: %v", err)
+		}
+	})
+
+	t.Run("Aggregation", func(t *testing.T) {
+		tag := fmt.Sprintf("aggregate-%d", time.Now().UnixNano())
+		day := int64(1700006400) // 2023-11-15T00:00:00Z
+		events := []*model.Event{
+			{Title: "Berlin Morning", HappenedAt: day + 3600, Tags: []string{tag, "protest"},
+				Location: &model.LocationData{Latitude: 52.52, Longitude: 13.40, CountryCode: "DE", AdministrativeArea: "Berlin"}},
+			{Title: "Berlin Evening", HappenedAt: day + 20*3600, Tags: []string{tag},
+				Location: &model.LocationData{Latitude: 52.51, Longitude: 13.39, CountryCode: "DE", AdministrativeArea: "Berlin"}},
+			{Title: "Paris Next Day", HappenedAt: day + 30*3600, Tags: []string{tag},
+				Location: &model.LocationData{Latitude: 48.85, Longitude: 2.35, CountryCode: "FR"}},
+		}
+
+		var keys []string
+		for _, event := range events {
+			resp, err := service.CreateEvent(context.Background(), &base.CreateEventRequest{Event: event})
+			if err != nil {
+				t.Fatalf("Failed to create event: %v", err)
+			}
+			keys = append(keys, resp.Event.Key)
+		}
+
+		resp, err := service.AggregateEvents(context.Background(), &base.AggregateEventsRequest{
+			Tags:              []string{tag},
+			HistogramInterval: base.HistogramInterval_HISTOGRAM_INTERVAL_DAY,
+			Grid:              base.SpatialGrid_SPATIAL_GRID_GEOHASH,
+			GridPrecision:     3,
+			GroupBy: []base.GroupByField{
+				base.GroupByField_GROUP_BY_FIELD_COUNTRY_CODE,
+				base.GroupByField_GROUP_BY_FIELD_TAGS,
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to aggregate events: %v", err)
+		}
+
+		if resp.Total != 3 {
+			t.Errorf("Expected 3 events, got %d", resp.Total)
+		}
+
+		if len(resp.Histogram) != 2 {
+			t.Fatalf("Expected 2 histogram buckets, got %d", len(resp.Histogram))
+		}
+		if resp.Histogram[0].StartTime != day || resp.Histogram[0].Count != 2 {
+			t.Errorf("Expected 2 events on %d, got %d on %d", day, resp.Histogram[0].Count, resp.Histogram[0].StartTime)
+		}
+
+		if len(resp.Grid) != 2 {
+			t.Fatalf("Expected 2 grid cells, got %d", len(resp.Grid))
+		}
+		if resp.Grid[0].Cell != "u33" || resp.Grid[0].Count != 2 {
+			t.Errorf("Expected 2 events in cell u33, got %d in %s", resp.Grid[0].Count, resp.Grid[0].Cell)
+		}
+
+		if len(resp.Groups) != 2 {
+			t.Fatalf("Expected 2 groups, got %d", len(resp.Groups))
+		}
+		countries := resp.Groups[0].Buckets
+		if len(countries) != 2 || countries[0].Value != "DE" || countries[0].Count != 2 {
+			t.Errorf("Expected DE to be counted twice, got %v", countries)
+		}
+		tags := resp.Groups[1].Buckets
+		if len(tags) != 2 || tags[0].Value != tag || tags[0].Count != 3 {
+			t.Errorf("Expected %s to be counted three times, got %v", tag, tags)
+		}
+
+		// Invalid precision should be rejected
+		_, err = service.AggregateEvents(context.Background(), &base.AggregateEventsRequest{
+			Grid:          base.SpatialGrid_SPATIAL_GRID_GEOHASH,
+			GridPrecision: 13,
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument error, got %v", err)
+		}
+
+		for _, key := range keys {
+			if _, err := service.DeleteEvent(context.Background(), &base.DeleteEventRequest{Key: key}); err != nil {
+				t.Fatalf("Failed to delete event: %v", err)
+			}
+		}
+	})
 }
@@ -0,0 +1,368 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// MaxExportHops limits the radius around the seed entity of an export.
+	MaxExportHops = 5
+
+	exportChunkSize   = 64 * 1024
+	exportContentType = "application/x-ndjson"
+)
+
+// exportTimeFields names the field the time range of an export applies to.
+var exportTimeFields = map[string]string{
+	"events":        "happened_at",
+	"persons":       "updated_at",
+	"organizations": "discovered_at",
+	"websites":      "discovered_at",
+	"sources":       "updated_at",
+}
+
+type ExportService struct {
+	base.UnimplementedExportServiceServer
+
+	DBClient    *clients.ArangoDBClient
+	Collections map[string]driver.Collection
+	Redirects   *RedirectStore
+}
+
+func NewExportService(client *clients.ArangoDBClient) (*ExportService, error) {
+	ctx := context.Background()
+	collections := map[string]driver.Collection{}
+	for _, name := range EntityCollections {
+		collection, err := client.GetCreateCollection(ctx, name, driver.CreateVertexCollectionOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get or create %s collection: %v", name, err)
+		}
+		collections[name] = collection
+	}
+
+	redirects, err := NewRedirectStore(client)
+	if err != nil {
+		return nil, err
+	}
+
+	service := &ExportService{
+		DBClient:    client,
+		Collections: collections,
+		Redirects:   redirects,
+	}
+	return service, nil
+}
+
+func (s *ExportService) Export(req *base.ExportRequest, stream base.ExportService_ExportServer) error {
+	ctx := stream.Context()
+	logger := logging.GetLogger(ctx)
+
+	stream.SetHeader(downloadHeader("export.jsonl"))
+	writer := bufio.NewWriterSize(&exportStreamWriter{stream: stream, contentType: exportContentType}, exportChunkSize)
+	if err := s.ExportTo(ctx, req, writer); err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to send export")
+		return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	return nil
+}
+
+// exportStreamWriter sends everything written to it as chunks of a download.
+type exportStreamWriter struct {
+	stream interface {
+		Send(*httpbody.HttpBody) error
+	}
+	contentType string
+}
+
+// downloadHeader names the file the gateway offers for download.
+func downloadHeader(filename string) metadata.MD {
+	return metadata.Pairs("content-disposition", fmt.Sprintf("attachment; filename=%q", filename))
+}
+
+func (w *exportStreamWriter) Write(p []byte) (int, error) {
+	data := make([]byte, len(p))
+	copy(data, p)
+	if err := w.stream.Send(&httpbody.HttpBody{ContentType: w.contentType, Data: data}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ExportTo writes the entities and relationships matching the request to w,
+// one JSON document per line with the "_type" field read by the importer.
+func (s *ExportService) ExportTo(ctx context.Context, req *base.ExportRequest, w io.Writer) error {
+	return s.walk(ctx, req, func(kind string, doc map[string]interface{}) error {
+		doc[ImportTypeField] = kind
+		line, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(append(line, '\n'))
+		return err
+	})
+}
+
+// walk visits the entities matching the request and then the relationships
+// between them. Relationships are only visited when both of their ends are.
+func (s *ExportService) walk(ctx context.Context, req *base.ExportRequest, visit func(kind string, doc map[string]interface{}) error) error {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Exporting graph with filters: %v", req)
+
+	if req.GetHops() < 0 || req.GetHops() > MaxExportHops {
+		return status.Errorf(codes.InvalidArgument, "Hops must be between 0 and %d", MaxExportHops)
+	}
+	if req.GetEndTime() != 0 && req.GetStartTime() > req.GetEndTime() {
+		return status.Errorf(codes.InvalidArgument, "Start time must not be after end time")
+	}
+
+	for _, name := range req.GetCollections() {
+		if _, ok := exportTimeFields[name]; !ok {
+			return status.Errorf(codes.InvalidArgument, "Unknown collection %s", name)
+		}
+	}
+
+	var seeded []string
+	if req.GetSeedId() != "" {
+		ids, err := s.neighborhood(ctx, req.GetSeedId(), req.GetHops())
+		if err != nil {
+			return err
+		}
+		seeded = ids
+	}
+
+	filtered := len(req.GetTags()) > 0 || req.MaxSensitivity != nil || req.GetStartTime() != 0 ||
+		req.GetEndTime() != 0 || req.GetSeedId() != "" || len(req.GetCollections()) > 0 || req.MinReliability != nil
+
+	// IDs of the exported entities, only tracked when relationships need filtering
+	exported := map[string]bool{}
+	var count int
+
+	for _, name := range EntityCollections {
+		if len(req.GetCollections()) > 0 && !slices.Contains(req.GetCollections(), name) {
+			continue
+		}
+
+		var filters []string
+		bindVars := map[string]interface{}{
+			"@collection": name,
+		}
+
+		if len(req.GetTags()) > 0 {
+			filters = append(filters, "@tags ANY IN doc.tags")
+			bindVars["tags"] = req.GetTags()
+		}
+		if req.MaxSensitivity != nil {
+			filters = append(filters, "(doc.sensitivity || 0) <= @maxSensitivity")
+			bindVars["maxSensitivity"] = int32(req.GetMaxSensitivity())
+		}
+		if req.GetStartTime() != 0 {
+			filters = append(filters, "doc[@timeField] >= @startTime")
+			bindVars["startTime"] = req.GetStartTime()
+		}
+		if req.GetEndTime() != 0 {
+			filters = append(filters, "doc[@timeField] <= @endTime")
+			bindVars["endTime"] = req.GetEndTime()
+		}
+		if req.GetStartTime() != 0 || req.GetEndTime() != 0 {
+			bindVars["timeField"] = exportTimeFields[name]
+		}
+		if req.GetSeedId() != "" {
+			filters = append(filters, "doc._id IN @ids")
+			bindVars["ids"] = seeded
+		}
+		if req.MinReliability != nil && name == "sources" {
+			// Ungraded sources cannot be judged
+			filters = append(filters, "(doc.reliability || @ungradable) <= @minReliability")
+			bindVars["minReliability"] = int32(req.GetMinReliability())
+			bindVars["ungradable"] = ungradable
+		}
+
+		n, err := s.exportQuery(ctx, filters, bindVars, func(id string, doc map[string]interface{}) error {
+			if filtered {
+				exported[id] = true
+			}
+			return visit(name, doc)
+		})
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":      err,
+				"collection": name,
+			}).Error("failed to export entities")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		count += n
+	}
+
+	// Read the edge definitions from the database as relationships add them at runtime
+	graph, err := s.DBClient.DB.Graph(ctx, s.DBClient.OsintGraph.Name())
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to read graph")
+		return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	for _, definition := range graph.EdgeDefinitions() {
+		var filters []string
+		bindVars := map[string]interface{}{
+			"@collection": definition.Collection,
+		}
+
+		if req.MaxSensitivity != nil {
+			filters = append(filters, "(doc.sensitivity || 0) <= @maxSensitivity")
+			bindVars["maxSensitivity"] = int32(req.GetMaxSensitivity())
+		}
+		filters = append(filters, relationGradeFilters("doc", req.MinReliability, req.MinCredibility, bindVars)...)
+		if filtered {
+			ids := make([]string, 0, len(exported))
+			for id := range exported {
+				ids = append(ids, id)
+			}
+			filters = append(filters, "doc._from IN @ids", "doc._to IN @ids")
+			bindVars["ids"] = ids
+		}
+
+		n, err := s.exportQuery(ctx, filters, bindVars, func(id string, doc map[string]interface{}) error {
+			return visit(RelationshipsType, doc)
+		})
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":      err,
+				"collection": definition.Collection,
+			}).Error("failed to export relationships")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		count += n
+	}
+
+	logger.Infof("Exported %d documents", count)
+	return nil
+}
+
+// exportQuery visits the documents of a collection passing the filters.
+func (s *ExportService) exportQuery(ctx context.Context, filters []string, bindVars map[string]interface{}, visit func(id string, doc map[string]interface{}) error) (int, error) {
+	query := "FOR doc IN @@collection\n"
+	for _, filter := range filters {
+		query += "\tFILTER " + filter + "\n"
+	}
+
+	// Derived fields are computed again on import
+	if derived := DerivedFields[bindVars["@collection"].(string)]; len(derived) > 0 {
+		query += "\tRETURN UNSET(doc, @derivedFields)"
+		bindVars["derivedFields"] = derived
+	} else {
+		query += "\tRETURN doc"
+	}
+
+	cursor, err := s.DBClient.DB.Query(ctx, query, bindVars)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close()
+
+	var count int
+	for {
+		var doc map[string]interface{}
+		meta, err := cursor.ReadDocument(ctx, &doc)
+		if driver.IsNoMoreDocuments(err) {
+			return count, nil
+		} else if err != nil {
+			return count, err
+		}
+
+		if err := visit(meta.ID.String(), doc); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+// neighborhood returns the IDs of the entities within hops relationships of
+// the seed, including the seed itself.
+func (s *ExportService) neighborhood(ctx context.Context, seed string, hops int32) ([]string, error) {
+	logger := logging.GetLogger(ctx)
+
+	if _, _, err := s.DBClient.ParseDocID(seed); err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"id":    seed,
+		}).Error("failed to parse seed id")
+		return nil, status.Errorf(codes.InvalidArgument, "Bad parameter")
+	}
+	if hops == 0 {
+		hops = 1
+	}
+
+	// A merged seed is exported as the entity it was merged into
+	seed, err := s.Redirects.Follow(ctx, seed)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"seed":  seed,
+		}).Error("failed to resolve merged seed")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	query := `
+		FOR v IN 0..@hops ANY @seed GRAPH @graph
+			OPTIONS { order: "bfs", uniqueVertices: "global" }
+			RETURN v._id
+	`
+
+	cursor, err := s.DBClient.DB.Query(ctx, query, map[string]interface{}{
+		"hops":  hops,
+		"seed":  seed,
+		"graph": s.DBClient.OsintGraph.Name(),
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"seed":  seed,
+		}).Error("failed to traverse graph")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	defer cursor.Close()
+
+	var ids []string
+	for {
+		var id string
+		if _, err := cursor.ReadDocument(ctx, &id); driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"seed":  seed,
+			}).Error("failed to read traversal")
+			return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		ids = append(ids, id)
+	}
+
+	// The traversal is empty when the seed does not exist
+	if len(ids) == 0 {
+		return nil, status.Errorf(codes.NotFound, "Seed entity not found")
+	}
+	return ids, nil
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+)
+
+func TestExportService(t *testing.T) {
+	// Skip test if ArangoDB is not available
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	// Create ArangoDB client
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	// Create ExportService and ImportService
+	service, err := NewExportService(client)
+	if err != nil {
+		t.Fatalf("Failed to create ExportService: %v", err)
+	}
+
+	importService, err := NewImportService(client, changes)
+	if err != nil {
+		t.Fatalf("Failed to create ImportService: %v", err)
+	}
+
+	// Import a small tagged graph to export
+	tag := fmt.Sprintf("export-%d", time.Now().UnixNano())
+	jsonl := strings.Join([]string{
+		fmt.Sprintf(`{"_type": "persons", "_tmp_id": "p1", "name": "Export Person", "tags": [%q]}`, tag),
+		fmt.Sprintf(`{"_type": "organizations", "_tmp_id": "o1", "name": "Export Organization", "tags": [%q]}`, tag),
+		`{"_type": "relationships", "_from": "p1", "_to": "o1", "name": "works_for"}`,
+	}, "\n")
+
+	imported, err := importService.ImportReader(context.Background(), &base.ImportOptions{
+		Format: base.ImportFormat_IMPORT_FORMAT_JSONL,
+	}, strings.NewReader(jsonl))
+	if err != nil || imported.Created != 3 {
+		t.Fatalf("Failed to import test graph: %v, %v", imported, err)
+	}
+
+	t.Run("Export Round Trip", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := service.ExportTo(context.Background(), &base.ExportRequest{
+			Tags: []string{tag},
+		}, &buf)
+		if err != nil {
+			t.Fatalf("Failed to export: %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("Expected 3 exported lines, got %d: %s", len(lines), buf.String())
+		}
+
+		// Importing the export again updates the same documents
+		resp, err := importService.ImportReader(context.Background(), &base.ImportOptions{
+			Format: base.ImportFormat_IMPORT_FORMAT_JSONL,
+		}, &buf)
+		if err != nil {
+			t.Fatalf("Failed to import export: %v", err)
+		}
+
+		if resp.Updated != 3 || resp.Created != 0 || resp.Rejected != 0 {
+			t.Errorf("Expected 3 updated documents, got %d created, %d updated and %d rejected: %v",
+				resp.Created, resp.Updated, resp.Rejected, resp.Errors)
+		}
+	})
+
+	t.Run("Export Around Seed", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := service.ExportTo(context.Background(), &base.ExportRequest{
+			SeedId: imported.TempIds["p1"],
+			Hops:   1,
+		}, &buf)
+		if err != nil {
+			t.Fatalf("Failed to export: %v", err)
+		}
+
+		for _, id := range []string{imported.TempIds["p1"], imported.TempIds["o1"]} {
+			if !strings.Contains(buf.String(), id) {
+				t.Errorf("Expected export to contain %s", id)
+			}
+		}
+	})
+
+	t.Run("STIX Round Trip", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := service.ExportStixTo(context.Background(), &base.ExportRequest{
+			Tags: []string{tag},
+		}, &buf)
+		if err != nil {
+			t.Fatalf("Failed to export STIX bundle: %v", err)
+		}
+
+		for _, expected := range []string{`"identity_class":"individual"`, `"identity_class":"organization"`, `"relationship_type":"works-for"`, `"x_omnibasement_name":"works_for"`} {
+			if !strings.Contains(buf.String(), expected) {
+				t.Errorf("Expected bundle to contain %s: %s", expected, buf.String())
+			}
+		}
+
+		// Importing the bundle again updates the same documents
+		resp, err := importService.ImportStixReader(context.Background(), false, &buf)
+		if err != nil {
+			t.Fatalf("Failed to import STIX bundle: %v", err)
+		}
+
+		if resp.Updated != 3 || resp.Created != 0 || resp.Rejected != 0 {
+			t.Errorf("Expected 3 updated documents, got %d created, %d updated and %d rejected: %v",
+				resp.Created, resp.Updated, resp.Rejected, resp.Errors)
+		}
+	})
+
+	t.Run("Graph Export", func(t *testing.T) {
+		for format, root := range map[base.GraphFormat]string{
+			base.GraphFormat_GRAPH_FORMAT_GRAPHML: "<graphml",
+			base.GraphFormat_GRAPH_FORMAT_GEXF:    "<gexf",
+		} {
+			var buf bytes.Buffer
+			err := service.ExportGraphTo(context.Background(), &base.ExportGraphRequest{
+				Selection: &base.ExportRequest{Tags: []string{tag}},
+				Format:    format,
+			}, &buf)
+			if err != nil {
+				t.Fatalf("Failed to export %s: %v", format, err)
+			}
+
+			// The document must be well formed XML
+			decoder := xml.NewDecoder(&buf)
+			var elements []string
+			nodes := 0
+			for {
+				token, err := decoder.Token()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("Invalid %s document: %v", format, err)
+				}
+				if start, ok := token.(xml.StartElement); ok {
+					elements = append(elements, start.Name.Local)
+					if start.Name.Local == "node" {
+						nodes++
+					}
+				}
+			}
+
+			if len(elements) == 0 || "<"+elements[0] != root {
+				t.Errorf("Expected %s document, got elements %v", root, elements)
+			}
+			if nodes != 2 {
+				t.Errorf("Expected 2 nodes in %s, got %d", format, nodes)
+			}
+		}
+	})
+
+	t.Run("Event Map Export", func(t *testing.T) {
+		event := fmt.Sprintf(`{"_type": "events", "title": "Map Event", "happened_at": 5000, "tags": [%q], `+
+			`"location": {"latitude": 48.85, "longitude": 2.35, "locality": "Paris", "country_code": "FR"}}`, tag)
+		_, err := importService.ImportReader(context.Background(), &base.ImportOptions{
+			Format: base.ImportFormat_IMPORT_FORMAT_JSONL,
+		}, strings.NewReader(event))
+		if err != nil {
+			t.Fatalf("Failed to import event: %v", err)
+		}
+
+		var buf bytes.Buffer
+		err = service.ExportEventsTo(context.Background(), &base.ExportEventsRequest{
+			Tags: []string{tag},
+			Bbox: &base.BoundingBox{MinLatitude: 48, MinLongitude: 2, MaxLatitude: 49, MaxLongitude: 3},
+		}, &buf)
+		if err != nil {
+			t.Fatalf("Failed to export GeoJSON: %v", err)
+		}
+
+		var collection struct {
+			Features []struct {
+				Geometry struct {
+					Coordinates []float64 `json:"coordinates"`
+				} `json:"geometry"`
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"features"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &collection); err != nil {
+			t.Fatalf("Invalid GeoJSON: %v", err)
+		}
+
+		if len(collection.Features) != 1 {
+			t.Fatalf("Expected 1 feature, got %d", len(collection.Features))
+		}
+		if collection.Features[0].Properties["locality"] != "Paris" {
+			t.Errorf("Expected locality Paris, got %v", collection.Features[0].Properties["locality"])
+		}
+
+		// Events outside the box are left out
+		buf.Reset()
+		err = service.ExportEventsTo(context.Background(), &base.ExportEventsRequest{
+			Format: base.MapFormat_MAP_FORMAT_KML,
+			Tags:   []string{tag},
+			Bbox:   &base.BoundingBox{MinLatitude: 0, MinLongitude: 0, MaxLatitude: 1, MaxLongitude: 1},
+		}, &buf)
+		if err != nil {
+			t.Fatalf("Failed to export KML: %v", err)
+		}
+		if strings.Contains(buf.String(), "<Placemark") {
+			t.Errorf("Expected no placemarks outside the bounding box: %s", buf.String())
+		}
+
+		// Events without a graded relationship are left out
+		buf.Reset()
+		credibility := base.InformationCredibility_INFORMATION_CREDIBILITY_PROBABLY_TRUE
+		err = service.ExportEventsTo(context.Background(), &base.ExportEventsRequest{
+			Format:         base.MapFormat_MAP_FORMAT_KML,
+			Tags:           []string{tag},
+			MinCredibility: &credibility,
+		}, &buf)
+		if err != nil {
+			t.Fatalf("Failed to export KML: %v", err)
+		}
+		if strings.Contains(buf.String(), "<Placemark") {
+			t.Errorf("Expected no placemarks without graded relationships: %s", buf.String())
+		}
+	})
+
+	t.Run("STIX Observed Data", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := service.ExportStixTo(context.Background(), &base.ExportRequest{
+			Tags:        []string{tag},
+			Collections: []string{"events"},
+		}, &buf)
+		if err != nil {
+			t.Fatalf("Failed to export STIX bundle: %v", err)
+		}
+
+		var bundle stixBundle
+		if err := json.Unmarshal(buf.Bytes(), &bundle); err != nil {
+			t.Fatalf("Invalid STIX bundle: %v", err)
+		}
+		observables := map[string]bool{}
+		var observed []stixObject
+		for _, raw := range bundle.Objects {
+			var object stixObject
+			if err := json.Unmarshal(raw, &object); err != nil {
+				t.Fatalf("Invalid STIX object: %v", err)
+			}
+			if object.Type == "observed-data" {
+				observed = append(observed, object)
+			} else {
+				observables[object.ID] = true
+			}
+		}
+
+		if len(observed) != 1 {
+			t.Fatalf("Expected 1 observed-data object, got %d", len(observed))
+		}
+		if len(observed[0].ObjectRefs) == 0 || !observables[observed[0].ObjectRefs[0]] {
+			t.Errorf("Expected observed-data to refer to an observable of the bundle, got %v", observed[0].ObjectRefs)
+		}
+
+		// Event observables import as nothing
+		resp, err := importService.ImportStixReader(context.Background(), true, &buf)
+		if err != nil {
+			t.Fatalf("Failed to import STIX bundle: %v", err)
+		}
+		if resp.Rejected != 0 {
+			t.Errorf("Expected no rejected objects, got %v", resp.Errors)
+		}
+	})
+}
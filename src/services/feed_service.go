@@ -0,0 +1,555 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// SourceFeedsCollection holds the feeds of sources, keyed by source.
+	SourceFeedsCollection = "source_feeds"
+	// FeedEntriesCollection holds the ingested feed entries, which are not
+	// ingested again.
+	FeedEntriesCollection = "feed_entries"
+	// FeedEventsCollection holds the relationships from the events of feed
+	// entries to the sources reporting them.
+	FeedEventsCollection = "events_reported_by_sources"
+	// FeedIngestInterval is the environment variable overriding how often the feeds of sources are ingested.
+	FeedIngestInterval = "FEED_INGEST_INTERVAL"
+
+	feedRelation              = "reported by"
+	defaultFeedIngestInterval = 15 * time.Minute
+	feedTimeout               = 30 * time.Second
+	maxFeedSize               = 10 << 20
+	feedAccept                = "application/rss+xml, application/atom+xml, application/xml;q=0.9, text/xml;q=0.9, */*;q=0.5"
+)
+
+// errEntryIngested reports an entry ingested by a concurrent ingestion.
+var errEntryIngested = errors.New("feed entry already ingested")
+
+type feedRecord struct {
+	Key        string `json:"_key,omitempty"`
+	SourceID   string `json:"source_id"`
+	FeedUrl    string `json:"feed_url"`
+	IngestedAt int64  `json:"ingested_at"`
+	Error      string `json:"error"`
+	CreatedAt  int64  `json:"created_at"`
+	UpdatedAt  int64  `json:"updated_at"`
+}
+
+// feedEntryRecord is an ingested entry, keyed by its source and ID.
+type feedEntryRecord struct {
+	Key        string `json:"_key"`
+	SourceID   string `json:"source_id"`
+	EntryID    string `json:"entry_id"`
+	Link       string `json:"link,omitempty"`
+	EventID    string `json:"event_id"`
+	IngestedAt int64  `json:"ingested_at"`
+}
+
+type FeedService struct {
+	base.UnimplementedFeedServiceServer
+
+	DBClient   *clients.ArangoDBClient
+	Collection driver.Collection
+	Entries    driver.Collection
+	Sources    driver.Collection
+	Events     driver.Collection
+	ReportedBy driver.Collection
+	Changes    *ChangeLog
+	HTTPClient *http.Client
+
+	// IngestInterval is the time between two ingestions of all feeds
+	IngestInterval time.Duration
+
+	limiter *DomainLimiter
+}
+
+// NewFeedService returns a feed ingester spacing its requests to each domain
+// with limiter, which it shares with the source monitor.
+func NewFeedService(client *clients.ArangoDBClient, changes *ChangeLog, limiter *DomainLimiter) (*FeedService, error) {
+	interval := defaultFeedIngestInterval
+	if value := os.Getenv(FeedIngestInterval); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %v", FeedIngestInterval, value, err)
+		}
+		if parsed <= 0 {
+			return nil, fmt.Errorf("invalid %s value %q: must be positive", FeedIngestInterval, value)
+		}
+		interval = parsed
+	}
+
+	ctx := context.Background()
+	collections := map[string]driver.Collection{}
+	for _, name := range []string{SourceFeedsCollection, FeedEntriesCollection} {
+		collection, err := GetCreateDocumentCollection(ctx, client, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get or create %s collection: %v", name, err)
+		}
+		collections[name] = collection
+	}
+	if err := EnsureIndexes(ctx, collections[FeedEntriesCollection]); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"sources", "events"} {
+		collection, err := client.GetCreateCollection(ctx, name, driver.CreateVertexCollectionOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get or create %s collection: %v", name, err)
+		}
+		collections[name] = collection
+	}
+
+	reportedBy, err := client.GetCreateEdgeCollection(ctx, FeedEventsCollection, driver.VertexConstraints{
+		From: []string{"events"},
+		To:   []string{"sources"},
+	}, driver.CreateEdgeCollectionOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get or create %s collection: %v", FeedEventsCollection, err)
+	}
+	client.OsintGraph.CreateVertexCollectionWithOptions(ctx, reportedBy.Name(), driver.CreateVertexCollectionOptions{})
+
+	service := &FeedService{
+		DBClient:       client,
+		Collection:     collections[SourceFeedsCollection],
+		Entries:        collections[FeedEntriesCollection],
+		Sources:        collections["sources"],
+		Events:         changes.Watch(collections["events"]),
+		ReportedBy:     changes.Watch(reportedBy),
+		Changes:        changes,
+		HTTPClient:     &http.Client{Timeout: feedTimeout},
+		IngestInterval: interval,
+		limiter:        limiter,
+	}
+	return service, nil
+}
+
+func (s *FeedService) SetSourceFeed(ctx context.Context, req *base.SetSourceFeedRequest) (*base.SetSourceFeedResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Setting feed of source %s to %s", req.GetSourceKey(), req.GetFeedUrl())
+
+	feedURL, err := canonicalURL(req.GetFeedUrl())
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Info("invalid feed url")
+		return nil, fieldError("feed_url", err)
+	}
+
+	exists, err := s.Sources.DocumentExists(ctx, req.GetSourceKey())
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"key":   req.GetSourceKey(),
+		}).Error("failed to check source document")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	if !exists {
+		logger.WithFields(logrus.Fields{
+			"key": req.GetSourceKey(),
+		}).Info("source not found for feed")
+		return nil, status.Errorf(codes.NotFound, "Source not found")
+	}
+
+	// Using AQL query to set the feed, which is ingested anew when it changes
+	query := `
+		UPSERT { _key: @key }
+		INSERT { _key: @key, source_id: @sourceId, feed_url: @url, ingested_at: 0, error: "", created_at: @now, updated_at: @now }
+		UPDATE { feed_url: @url, error: OLD.feed_url == @url ? OLD.error : "", updated_at: @now }
+		IN @@collection
+		RETURN NEW
+	`
+	records, err := queryAll[feedRecord](ctx, s.DBClient.DB, query, map[string]interface{}{
+		"key":         req.GetSourceKey(),
+		"sourceId":    s.Sources.Name() + "/" + req.GetSourceKey(),
+		"url":         feedURL.String(),
+		"now":         time.Now().Unix(),
+		"@collection": s.Collection.Name(),
+	})
+	if err != nil || len(records) == 0 {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"key":   req.GetSourceKey(),
+		}).Error("failed to set source feed")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	return &base.SetSourceFeedResponse{Feed: records[0].toSourceFeed()}, nil
+}
+
+func (s *FeedService) GetSourceFeed(ctx context.Context, req *base.GetSourceFeedRequest) (*base.GetSourceFeedResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Getting feed of source %s", req.GetSourceKey())
+
+	record, err := s.readFeed(ctx, req.GetSourceKey())
+	if err != nil {
+		return nil, err
+	}
+	return &base.GetSourceFeedResponse{Feed: record.toSourceFeed()}, nil
+}
+
+func (s *FeedService) DeleteSourceFeed(ctx context.Context, req *base.DeleteSourceFeedRequest) (*base.DeleteSourceFeedResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Deleting feed of source %s", req.GetSourceKey())
+
+	if _, err := s.Collection.RemoveDocument(ctx, req.GetSourceKey()); err != nil {
+		if driver.IsNotFoundGeneral(err) {
+			logger.WithFields(logrus.Fields{
+				"key": req.GetSourceKey(),
+			}).Info("feed not found for deletion")
+			return nil, status.Errorf(codes.NotFound, "Feed not found")
+		}
+
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"key":   req.GetSourceKey(),
+		}).Error("failed to delete feed document")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	return &base.DeleteSourceFeedResponse{}, nil
+}
+
+func (s *FeedService) IngestFeed(ctx context.Context, req *base.IngestFeedRequest) (*base.IngestFeedResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Ingesting feed of source %s", req.GetSourceKey())
+
+	record, err := s.readFeed(ctx, req.GetSourceKey())
+	if err != nil {
+		return nil, err
+	}
+
+	events, skipped, err := s.ingest(ctx, record)
+	if err != nil {
+		var fetchErr *feedFetchError
+		if errors.As(err, &fetchErr) {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"url":   record.FeedUrl,
+			}).Info("failed to fetch feed")
+			return nil, status.Errorf(codes.FailedPrecondition, "Feed could not be ingested: %v", fetchErr.err)
+		}
+
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"key":   req.GetSourceKey(),
+		}).Error("failed to ingest feed")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	return &base.IngestFeedResponse{Events: events, Skipped: int32(skipped)}, nil
+}
+
+func (s *FeedService) readFeed(ctx context.Context, sourceKey string) (*feedRecord, error) {
+	logger := logging.GetLogger(ctx)
+
+	var record feedRecord
+	if _, err := s.Collection.ReadDocument(ctx, sourceKey, &record); err != nil {
+		if driver.IsNotFoundGeneral(err) {
+			logger.WithFields(logrus.Fields{
+				"key": sourceKey,
+			}).Info("feed not found")
+			return nil, status.Errorf(codes.NotFound, "Feed not found")
+		}
+
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"key":   sourceKey,
+		}).Error("failed to read feed document")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	return &record, nil
+}
+
+// Run ingests all feeds every ingest interval until ctx is done.
+func (s *FeedService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.IngestInterval)
+	defer ticker.Stop()
+
+	for {
+		created, err := s.IngestAll(ctx)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("failed to ingest feeds")
+		} else if created > 0 {
+			logrus.Infof("Created %d events from feeds", created)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// IngestAll ingests the feed of every source and returns the number of events
+// created. Feeds that fail are left for the next ingestion.
+func (s *FeedService) IngestAll(ctx context.Context) (int, error) {
+	query := `
+		FOR f IN @@collection
+			FILTER f._key > @after
+			SORT f._key
+			LIMIT @limit
+			RETURN f`
+
+	total := 0
+	after := ""
+	for {
+		records, err := queryAll[feedRecord](ctx, s.DBClient.DB, query, map[string]interface{}{
+			"@collection": s.Collection.Name(),
+			"after":       after,
+			"limit":       MaxBatchSize,
+		})
+		if err != nil {
+			return total, err
+		}
+		if len(records) == 0 {
+			break
+		}
+
+		for _, record := range records {
+			events, _, err := s.ingest(ctx, record)
+			if err != nil {
+				if ctx.Err() != nil {
+					return total, ctx.Err()
+				}
+				logrus.WithFields(logrus.Fields{
+					"error": err,
+					"id":    record.SourceID,
+				}).Error("failed to ingest feed")
+			}
+			total += len(events)
+		}
+		after = records[len(records)-1].Key
+	}
+	return total, nil
+}
+
+// feedFetchError reports a feed that could not be fetched or parsed.
+type feedFetchError struct {
+	err error
+}
+
+func (e *feedFetchError) Error() string {
+	return fmt.Sprintf("failed to fetch feed: %v", e.err)
+}
+
+// ingest fetches a feed and creates an event reported by its source for each
+// entry that was not ingested before. It returns the created events and the
+// number of entries skipped, and stores the time and error of the ingestion
+// on the feed.
+func (s *FeedService) ingest(ctx context.Context, record *feedRecord) ([]*model.Event, int, error) {
+	events, skipped, err := s.ingestEntries(ctx, record)
+
+	ingestErr := ""
+	if err != nil {
+		ingestErr = err.Error()
+	}
+	if _, updateErr := s.Collection.UpdateDocument(ctx, record.Key, map[string]interface{}{
+		"ingested_at": time.Now().Unix(),
+		"error":       ingestErr,
+	}); updateErr != nil && err == nil {
+		err = updateErr
+	}
+	return events, skipped, err
+}
+
+func (s *FeedService) ingestEntries(ctx context.Context, record *feedRecord) ([]*model.Event, int, error) {
+	var source model.Source
+	if _, err := s.Sources.ReadDocument(ctx, record.Key, &source); err != nil {
+		return nil, 0, err
+	}
+	entries, err := s.fetch(ctx, record.FeedUrl)
+	if err != nil {
+		return nil, 0, &feedFetchError{err: err}
+	}
+
+	keys := make([]string, 0, len(entries))
+	var links []string
+	for _, entry := range entries {
+		keys = append(keys, feedEntryKey(record.SourceID, entry.ID))
+		if entry.Link != "" {
+			links = append(links, entry.Link)
+		}
+	}
+
+	// Entries are ingested once by ID, and by link as feeds change the IDs of
+	// republished entries
+	query := `
+		FOR e IN @@collection
+			FILTER e._key IN @keys
+			RETURN e._key`
+	ingested, err := queryAll[string](ctx, s.DBClient.DB, query, map[string]interface{}{
+		"@collection": s.Entries.Name(),
+		"keys":        keys,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	query = `
+		FOR e IN @@collection
+			FILTER e.source_id == @sourceID AND e.link IN @links
+			RETURN e.link`
+	ingestedLinks, err := queryAll[string](ctx, s.DBClient.DB, query, map[string]interface{}{
+		"@collection": s.Entries.Name(),
+		"sourceID":    record.SourceID,
+		"links":       links,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	known := map[string]bool{}
+	for _, key := range ingested {
+		known[*key] = true
+	}
+	knownLinks := map[string]bool{}
+	for _, link := range ingestedLinks {
+		knownLinks[*link] = true
+	}
+
+	var events []*model.Event
+	skipped := 0
+	for i, entry := range entries {
+		if entry.ID == "" || (entry.Title == "" && entry.Description == "") {
+			// Entries that cannot be told apart or carry nothing
+			skipped++
+			continue
+		}
+		if known[keys[i]] || (entry.Link != "" && knownLinks[entry.Link]) {
+			skipped++
+			continue
+		}
+		// Entries repeated within the feed are created once
+		known[keys[i]] = true
+		if entry.Link != "" {
+			knownLinks[entry.Link] = true
+		}
+
+		event, err := s.createEntryEvent(ctx, &source, entry, keys[i])
+		if errors.Is(err, errEntryIngested) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			return events, skipped, err
+		}
+		events = append(events, event)
+	}
+	return events, skipped, nil
+}
+
+// fetch requests a feed and parses its entries.
+func (s *FeedService) fetch(ctx context.Context, feedURL string) ([]*feedEntry, error) {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.limiter.wait(ctx, registrableDomain(u.Hostname())); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", sourceUserAgent)
+	req.Header.Set("Accept", feedAccept)
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return parseFeed(io.LimitReader(resp.Body, maxFeedSize))
+}
+
+// createEntryEvent creates the event of a feed entry, its relationship to
+// source and the record of the entry in one transaction.
+func (s *FeedService) createEntryEvent(ctx context.Context, source *model.Source, entry *feedEntry, key string) (*model.Event, error) {
+	happenedAt := entry.PublishedAt
+	if happenedAt == 0 {
+		happenedAt = time.Now().Unix()
+	}
+	event := &model.Event{
+		Sensitivity: source.GetSensitivity(),
+		Title:       entry.Title,
+		Description: entry.Description,
+		HappenedAt:  happenedAt,
+	}
+
+	var created model.Event
+	collections := driver.TransactionCollections{Write: []string{s.Events.Name(), s.ReportedBy.Name(), s.Entries.Name()}}
+	err := s.Changes.transact(ctx, collections, func(ctx context.Context) error {
+		meta, err := s.Events.CreateDocument(driver.WithReturnNew(ctx, &created), event)
+		if err != nil {
+			return err
+		}
+		created.Id = meta.ID.String()
+		created.Key = meta.Key
+		created.Rev = meta.Rev
+
+		relationship := &relationDocument{
+			Relation:        &model.Relation{From: created.Id, To: source.GetId(), Name: feedRelation},
+			relationGrading: relationGrading{SourceId: source.GetId()},
+		}
+		if _, err := s.ReportedBy.CreateDocument(ctx, relationship); err != nil {
+			return err
+		}
+
+		_, err = s.Entries.CreateDocument(ctx, &feedEntryRecord{
+			Key:        key,
+			SourceID:   source.GetId(),
+			EntryID:    entry.ID,
+			Link:       entry.Link,
+			EventID:    created.Id,
+			IngestedAt: time.Now().Unix(),
+		})
+		if driver.IsConflict(err) {
+			// Rolls back the event
+			return errEntryIngested
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// feedEntryKey returns the key of the record of an entry of the feed of a
+// source.
+func feedEntryKey(sourceID, entryID string) string {
+	sum := sha256.Sum256([]byte(sourceID + "\n" + entryID))
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *feedRecord) toSourceFeed() *base.SourceFeed {
+	return &base.SourceFeed{
+		SourceId:   r.SourceID,
+		FeedUrl:    r.FeedUrl,
+		IngestedAt: r.IngestedAt,
+		Error:      r.Error,
+	}
+}
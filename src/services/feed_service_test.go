@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testRSSFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+  <channel>
+    <title>Test News</title>
+    <atom:link href="https://news.example.com/feed" rel="self"/>
+    <item>
+      <title>Port closed after &amp; storm</title>
+      <link>https://news.example.com/port-closed</link>
+      <description><![CDATA[<p>The port was <b>closed</b>.</p><p>Ships wait offshore.</p>]]></description>
+      <guid isPermaLink="false">news-1</guid>
+      <pubDate>Tue, 10 Jun 2025 04:00:00 GMT</pubDate>
+    </item>
+    <item>
+      <title>Bridge reopened</title>
+      <link>https://news.example.com/bridge-reopened</link>
+      <pubDate>Wed, 11 Jun 2025 09:30:00 +0200</pubDate>
+    </item>
+  </channel>
+</rss>`
+
+const testAtomFeed = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Test Updates</title>
+  <entry>
+    <title type="html">&lt;em&gt;Election&lt;/em&gt; results</title>
+    <link rel="self" href="https://updates.example.com/entries/1.atom"/>
+    <link rel="alternate" href="https://updates.example.com/entries/1"/>
+    <id>urn:uuid:60a76c80-d399-11d9-b93c-0003939e0af6</id>
+    <updated>2025-06-12T18:30:02Z</updated>
+    <content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Turnout was <i>high</i>.</p></div></content>
+  </entry>
+  <entry>
+    <title>Cabinet named</title>
+    <link href="https://updates.example.com/entries/2"/>
+    <published>2025-06-13T10:00:00+01:00</published>
+    <summary>The cabinet was named.</summary>
+  </entry>
+</feed>`
+
+func TestParseFeed(t *testing.T) {
+	t.Run("RSS", func(t *testing.T) {
+		entries, err := parseFeed(strings.NewReader(testRSSFeed))
+		if err != nil {
+			t.Fatalf("Failed to parse RSS feed: %v", err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("Expected 2 entries, got %d", len(entries))
+		}
+
+		first := entries[0]
+		if first.ID != "news-1" || first.Link != "https://news.example.com/port-closed" {
+			t.Errorf("Expected the GUID and link of the item, got %q and %q", first.ID, first.Link)
+		}
+		if first.Title != "Port closed after & storm" {
+			t.Errorf("Expected an unescaped title, got %q", first.Title)
+		}
+		if first.Description != "The port was closed. Ships wait offshore." {
+			t.Errorf("Expected the text of the description, got %q", first.Description)
+		}
+		if first.PublishedAt != 1749528000 {
+			t.Errorf("Expected the publication date, got %d", first.PublishedAt)
+		}
+
+		// Items without a GUID are identified by their link
+		if entries[1].ID != "https://news.example.com/bridge-reopened" || entries[1].PublishedAt != 1749627000 {
+			t.Errorf("Expected the item to be identified by its link, got %+v", entries[1])
+		}
+	})
+
+	t.Run("Atom", func(t *testing.T) {
+		entries, err := parseFeed(strings.NewReader(testAtomFeed))
+		if err != nil {
+			t.Fatalf("Failed to parse Atom feed: %v", err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("Expected 2 entries, got %d", len(entries))
+		}
+
+		first := entries[0]
+		if first.ID != "urn:uuid:60a76c80-d399-11d9-b93c-0003939e0af6" || first.Link != "https://updates.example.com/entries/1" {
+			t.Errorf("Expected the ID and alternate link of the entry, got %q and %q", first.ID, first.Link)
+		}
+		if first.Title != "Election results" || first.Description != "Turnout was high." {
+			t.Errorf("Expected the text of the title and content, got %q and %q", first.Title, first.Description)
+		}
+		// Entries without a publication date fall back to their update date
+		if first.PublishedAt != 1749753002 {
+			t.Errorf("Expected the update date, got %d", first.PublishedAt)
+		}
+
+		if entries[1].ID != "https://updates.example.com/entries/2" || entries[1].Description != "The cabinet was named." || entries[1].PublishedAt != 1749805200 {
+			t.Errorf("Unexpected second entry %+v", entries[1])
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, document := range []string{"<html><body>Not a feed</body></html>", "not xml at all"} {
+			if _, err := parseFeed(strings.NewReader(document)); err == nil {
+				t.Errorf("Expected an error for %q", document)
+			}
+		}
+	})
+}
+
+func TestFeedService(t *testing.T) {
+	// Skip test if ArangoDB is not available
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	// Create ArangoDB client
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
+	t.Setenv(SourceMonitorDomainInterval, "1ms")
+	limiter, err := NewSourceDomainLimiter()
+	if err != nil {
+		t.Fatalf("Failed to create DomainLimiter: %v", err)
+	}
+	service, err := NewFeedService(client, changes, limiter)
+	if err != nil {
+		t.Fatalf("Failed to create FeedService: %v", err)
+	}
+	sourceService, err := NewSourceService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create SourceService: %v", err)
+	}
+
+	// A local news site serving its feed
+	var mu sync.Mutex
+	feed := testRSSFeed
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(feed))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	created, err := sourceService.CreateSource(ctx, &base.CreateSourceRequest{
+		Source: &model.Source{Name: "Feed Test News", Url: server.URL, Sensitivity: model.Sensitivity(1)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create source: %v", err)
+	}
+	source := created.Source
+	defer sourceService.DeleteSource(ctx, &base.DeleteSourceRequest{Key: source.Key})
+
+	var events []*model.Event
+	defer func() {
+		for _, event := range events {
+			service.Events.RemoveDocument(ctx, event.Key)
+		}
+		client.DB.Query(ctx, "FOR e IN @@collection FILTER e._to == @source REMOVE e IN @@collection", map[string]interface{}{
+			"@collection": FeedEventsCollection,
+			"source":      source.Id,
+		})
+		client.DB.Query(ctx, "FOR e IN @@collection FILTER e.source_id == @source REMOVE e IN @@collection", map[string]interface{}{
+			"@collection": FeedEntriesCollection,
+			"source":      source.Id,
+		})
+	}()
+
+	t.Run("SetSourceFeed", func(t *testing.T) {
+		_, err := service.SetSourceFeed(ctx, &base.SetSourceFeedRequest{SourceKey: source.Key, FeedUrl: "ftp://example.com/feed"})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for a feed URL that is not http, got %v", err)
+		}
+
+		_, err = service.SetSourceFeed(ctx, &base.SetSourceFeedRequest{SourceKey: "missing-feed-source", FeedUrl: server.URL + "/feed"})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("Expected NotFound for a missing source, got %v", err)
+		}
+
+		resp, err := service.SetSourceFeed(ctx, &base.SetSourceFeedRequest{SourceKey: source.Key, FeedUrl: server.URL + "/feed?utm_source=test"})
+		if err != nil {
+			t.Fatalf("Failed to set source feed: %v", err)
+		}
+		if resp.Feed.FeedUrl != server.URL+"/feed" || resp.Feed.SourceId != source.Id {
+			t.Errorf("Expected the canonical feed URL of the source, got %v", resp.Feed)
+		}
+	})
+	defer service.DeleteSourceFeed(ctx, &base.DeleteSourceFeedRequest{SourceKey: source.Key})
+
+	t.Run("IngestFeed", func(t *testing.T) {
+		resp, err := service.IngestFeed(ctx, &base.IngestFeedRequest{SourceKey: source.Key})
+		if err != nil {
+			t.Fatalf("Failed to ingest feed: %v", err)
+		}
+		events = append(events, resp.Events...)
+		if len(resp.Events) != 2 || resp.Skipped != 0 {
+			t.Fatalf("Expected 2 events and no skipped entries, got %d and %d", len(resp.Events), resp.Skipped)
+		}
+
+		event := resp.Events[0]
+		if event.Title != "Port closed after & storm" || event.HappenedAt != 1749528000 || event.Sensitivity != source.Sensitivity {
+			t.Errorf("Expected the event of the first entry, got %v", event)
+		}
+
+		// Each event is reported by the source
+		ids, err := queryAll[string](ctx, client.DB, "FOR s IN OUTBOUND @event @@edges RETURN s._id", map[string]interface{}{
+			"event":  event.Id,
+			"@edges": FeedEventsCollection,
+		})
+		if err != nil || len(ids) != 1 || *ids[0] != source.Id {
+			t.Errorf("Expected the event to be linked to its source, got %v, %v", ids, err)
+		}
+
+		got, err := service.GetSourceFeed(ctx, &base.GetSourceFeedRequest{SourceKey: source.Key})
+		if err != nil {
+			t.Fatalf("Failed to get source feed: %v", err)
+		}
+		if got.Feed.IngestedAt == 0 || got.Feed.Error != "" {
+			t.Errorf("Expected the feed to be ingested without error, got %v", got.Feed)
+		}
+	})
+
+	t.Run("Deduplicate", func(t *testing.T) {
+		mu.Lock()
+		feed = strings.Replace(testRSSFeed, "<item>", `<item>
+      <title>Airport reopened</title>
+      <link>https://news.example.com/airport-reopened</link>
+      <guid>news-3</guid>
+    </item>
+    <item>
+      <title>Port closed after storm</title>
+      <link>https://news.example.com/port-closed</link>
+      <guid>news-1-republished</guid>
+    </item>
+    <item>
+      <title>Untitled entry without a link</title>
+    </item>
+    <item>`, 1)
+		mu.Unlock()
+
+		// Entries ingested under another ID and entries without an ID are skipped
+		resp, err := service.IngestFeed(ctx, &base.IngestFeedRequest{SourceKey: source.Key})
+		if err != nil {
+			t.Fatalf("Failed to ingest feed: %v", err)
+		}
+		events = append(events, resp.Events...)
+		if len(resp.Events) != 1 || resp.Skipped != 4 {
+			t.Fatalf("Expected only the new entry to be created, got %d events and %d skipped", len(resp.Events), resp.Skipped)
+		}
+		if resp.Events[0].Title != "Airport reopened" {
+			t.Errorf("Expected the event of the new entry, got %v", resp.Events[0])
+		}
+	})
+
+	t.Run("Interval", func(t *testing.T) {
+		t.Setenv(FeedIngestInterval, "0s")
+		if _, err := NewFeedService(client, changes, limiter); err == nil {
+			t.Error("Expected an error for a feed ingest interval that is not positive")
+		}
+	})
+
+	t.Run("InvalidFeed", func(t *testing.T) {
+		mu.Lock()
+		feed = "<html><body>Moved</body></html>"
+		mu.Unlock()
+
+		_, err := service.IngestFeed(ctx, &base.IngestFeedRequest{SourceKey: source.Key})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("Expected FailedPrecondition for a page that is not a feed, got %v", err)
+		}
+
+		got, err := service.GetSourceFeed(ctx, &base.GetSourceFeedRequest{SourceKey: source.Key})
+		if err != nil {
+			t.Fatalf("Failed to get source feed: %v", err)
+		}
+		if got.Feed.Error == "" {
+			t.Error("Expected the feed to keep the error of the ingestion")
+		}
+	})
+}
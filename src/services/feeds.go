@@ -0,0 +1,230 @@
+package services
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// feedEntry is an entry of an RSS or Atom feed.
+type feedEntry struct {
+	// GUID of an RSS item or ID of an Atom entry, or else its link
+	ID          string
+	Link        string
+	Title       string
+	Description string
+	// Unix time the entry was published, or 0 if the feed does not tell
+	PublishedAt int64
+}
+
+// feedDateLayouts are the date formats found in feeds, RFC 822 with its
+// variants first as RSS requires it.
+var feedDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 02 Jan 2006 15:04 -0700",
+	"Mon, 02 Jan 2006 15:04 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+type rssFeed struct {
+	Items []rssItem `xml:"channel>item"`
+}
+
+type rssItem struct {
+	Title       string    `xml:"title"`
+	Links       []xmlLink `xml:"link"`
+	Description string    `xml:"description"`
+	GUID        string    `xml:"guid"`
+	PubDate     string    `xml:"pubDate"`
+	// Dublin Core date of feeds without pubDate
+	Date string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type atomFeed struct {
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID        string    `xml:"id"`
+	Title     atomText  `xml:"title"`
+	Links     []xmlLink `xml:"link"`
+	Summary   atomText  `xml:"summary"`
+	Content   atomText  `xml:"content"`
+	Published string    `xml:"published"`
+	Updated   string    `xml:"updated"`
+}
+
+// atomText is an Atom text construct, holding text, escaped HTML, or XHTML
+// elements.
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+// html returns the text construct as HTML.
+func (t atomText) html() string {
+	if t.Type == "xhtml" {
+		return t.Inner
+	}
+	return t.Text
+}
+
+// xmlLink is an RSS link, holding its URL as text, or an Atom link, holding
+// it as href.
+type xmlLink struct {
+	XMLName xml.Name
+	Href    string `xml:"href,attr"`
+	Rel     string `xml:"rel,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// parseFeed parses an RSS 2.0 or Atom feed and returns its entries in feed
+// order.
+func parseFeed(r io.Reader) ([]*feedEntry, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+	// Feeds in the wild use HTML entities and unclosed tags
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, errors.New("no feed element")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed feed: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "rss":
+			var feed rssFeed
+			if err := decoder.DecodeElement(&feed, &start); err != nil {
+				return nil, fmt.Errorf("malformed RSS feed: %v", err)
+			}
+			return feed.entries(), nil
+		case "feed":
+			var feed atomFeed
+			if err := decoder.DecodeElement(&feed, &start); err != nil {
+				return nil, fmt.Errorf("malformed Atom feed: %v", err)
+			}
+			return feed.entries(), nil
+		default:
+			return nil, fmt.Errorf("unsupported feed element %q", start.Name.Local)
+		}
+	}
+}
+
+func (f *rssFeed) entries() []*feedEntry {
+	entries := make([]*feedEntry, 0, len(f.Items))
+	for _, item := range f.Items {
+		entry := &feedEntry{
+			Title:       htmlText(item.Title),
+			Description: htmlText(item.Description),
+		}
+		for _, link := range item.Links {
+			// Skip the atom:link elements of the item
+			if link.XMLName.Space == "" && strings.TrimSpace(link.Text) != "" {
+				entry.Link = strings.TrimSpace(link.Text)
+				break
+			}
+		}
+		entry.ID = strings.TrimSpace(item.GUID)
+		if entry.ID == "" {
+			entry.ID = entry.Link
+		}
+		entry.PublishedAt = parseFeedDate(item.PubDate)
+		if entry.PublishedAt == 0 {
+			entry.PublishedAt = parseFeedDate(item.Date)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (f *atomFeed) entries() []*feedEntry {
+	entries := make([]*feedEntry, 0, len(f.Entries))
+	for _, item := range f.Entries {
+		entry := &feedEntry{
+			ID:          strings.TrimSpace(item.ID),
+			Title:       htmlText(item.Title.html()),
+			Description: htmlText(item.Summary.html()),
+		}
+		if entry.Description == "" {
+			entry.Description = htmlText(item.Content.html())
+		}
+		for _, link := range item.Links {
+			if link.Rel == "" || link.Rel == "alternate" {
+				entry.Link = strings.TrimSpace(link.Href)
+				break
+			}
+		}
+		if entry.ID == "" {
+			entry.ID = entry.Link
+		}
+		entry.PublishedAt = parseFeedDate(item.Published)
+		if entry.PublishedAt == 0 {
+			entry.PublishedAt = parseFeedDate(item.Updated)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// parseFeedDate returns the Unix time of a feed date, or 0 if it has none or
+// an unknown format.
+func parseFeedDate(value string) int64 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Unix()
+		}
+	}
+	return 0
+}
+
+// blockTags are the HTML tags separating words.
+var blockTags = map[string]bool{
+	"br": true, "p": true, "div": true, "li": true, "ul": true, "ol": true, "tr": true, "td": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "blockquote": true, "hr": true,
+}
+
+// htmlText returns the text of an HTML fragment, such as the description of
+// an entry, with its whitespace collapsed.
+func htmlText(fragment string) string {
+	var text strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(fragment))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(text.String()), " ")
+		case html.TextToken:
+			text.Write(tokenizer.Text())
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			if name, _ := tokenizer.TagName(); blockTags[string(name)] {
+				text.WriteByte(' ')
+			}
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Letters of the source reliability grades, A to F
+	reliabilityLetters = "ABCDEF"
+	// Highest grade number, which means the grade cannot be judged
+	ungradable = 6
+)
+
+// gradeWeights are the weights of the grades 1 (A) to 6 (F) in the combined
+// confidence. Grades that cannot be judged, or are not given, weigh as a coin
+// toss.
+var gradeWeights = [...]float64{0.5, 1.0, 0.8, 0.6, 0.4, 0.2, 0.5}
+
+// relationGrading is the grading stored on relationship edges.
+type relationGrading struct {
+	Credibility int32  `json:"credibility,omitempty"`
+	SourceId    string `json:"source_id,omitempty"`
+}
+
+// relationDocument is a relationship stored with its grading.
+type relationDocument struct {
+	*model.Relation
+	relationGrading
+}
+
+// newRelationGrading returns the stored form of grading. field names the
+// grading in errors.
+func newRelationGrading(grading *base.Grading, field string) (relationGrading, error) {
+	stored := relationGrading{Credibility: int32(grading.GetCredibility()), SourceId: grading.GetSourceId()}
+	if err := checkRelationGrading(stored); err != nil {
+		return relationGrading{}, fieldError(field, err)
+	}
+	return stored, nil
+}
+
+func checkRelationGrading(grading relationGrading) error {
+	if grading.Credibility < 0 || grading.Credibility > ungradable {
+		return errors.New("credibility must be between 1 and 6")
+	}
+	if grading.SourceId != "" {
+		collection, key, _ := strings.Cut(grading.SourceId, "/")
+		if collection != "sources" || key == "" {
+			return errors.New("source_id must be the ID of a source")
+		}
+	}
+	return nil
+}
+
+// checkReliability validates the reliability grade of a source.
+func checkReliability(reliability int32) error {
+	if reliability < 0 || reliability > ungradable {
+		return errors.New("reliability must be between 1 (A) and 6 (F)")
+	}
+	return nil
+}
+
+// relationGradeFilters returns the filters keeping the relationships e graded
+// at least minReliability and minCredibility, when set, and adds their bind
+// variables. Ungraded relationships and sources cannot be judged.
+func relationGradeFilters(e string, minReliability *base.SourceReliability, minCredibility *base.InformationCredibility, bindVars map[string]interface{}) []string {
+	var filters []string
+	if minReliability != nil {
+		filters = append(filters, fmt.Sprintf("((%[1]s.source_id ? DOCUMENT(%[1]s.source_id).reliability : null) || @ungradable) <= @minReliability", e))
+		bindVars["minReliability"] = int32(*minReliability)
+		bindVars["ungradable"] = ungradable
+	}
+	if minCredibility != nil {
+		filters = append(filters, fmt.Sprintf("(%s.credibility || @ungradable) <= @minCredibility", e))
+		bindVars["minCredibility"] = int32(*minCredibility)
+		bindVars["ungradable"] = ungradable
+	}
+	return filters
+}
+
+// gradedEventFilters returns the filters keeping the events doc with a
+// relationship of graph graded at least minReliability and minCredibility,
+// when set, and adds their bind variables.
+func gradedEventFilters(graph string, minReliability *base.SourceReliability, minCredibility *base.InformationCredibility, bindVars map[string]interface{}) []string {
+	edgeFilters := relationGradeFilters("e", minReliability, minCredibility, bindVars)
+	if len(edgeFilters) == 0 {
+		return nil
+	}
+	bindVars["graph"] = graph
+	return []string{"LENGTH(FOR v, e IN 1..1 ANY doc GRAPH @graph FILTER " + strings.Join(edgeFilters, " AND ") + " LIMIT 1 RETURN 1) > 0"}
+}
+
+// popRelationGrading removes the grading fields from the fields of an
+// imported relationship and returns them.
+func popRelationGrading(fields map[string]interface{}) (relationGrading, error) {
+	var grading relationGrading
+	data, err := json.Marshal(map[string]interface{}{
+		"credibility": fields["credibility"],
+		"source_id":   fields["source_id"],
+	})
+	if err != nil {
+		return grading, err
+	}
+	if err := json.Unmarshal(data, &grading); err != nil {
+		return grading, err
+	}
+	delete(fields, "credibility")
+	delete(fields, "source_id")
+	return grading, checkRelationGrading(grading)
+}
+
+// newGrading returns the grading of a relationship with its Admiralty code and
+// combined confidence.
+func newGrading(reliability, credibility int32, sourceID string) *base.Grading {
+	reliabilityGrade, credibilityGrade := reliability, credibility
+	if reliabilityGrade < 1 || reliabilityGrade > ungradable {
+		reliabilityGrade = ungradable
+	}
+	if credibilityGrade < 1 || credibilityGrade > ungradable {
+		credibilityGrade = ungradable
+	}
+
+	return &base.Grading{
+		Credibility: base.InformationCredibility(credibility),
+		SourceId:    sourceID,
+		Reliability: base.SourceReliability(reliability),
+		Code:        string(reliabilityLetters[reliabilityGrade-1]) + string(rune('0'+credibilityGrade)),
+		Confidence:  gradeWeights[reliabilityGrade] * gradeWeights[credibilityGrade],
+	}
+}
+
+// gradeRelationships returns the gradings of the relationships with the given
+// IDs, computed from their credibility and the reliability of their source.
+func gradeRelationships(ctx context.Context, db driver.Database, ids []string) (map[string]*base.Grading, error) {
+	query := `
+		FOR id IN @ids
+			LET doc = DOCUMENT(id)
+			FILTER doc != null
+			RETURN {
+				id: id,
+				credibility: doc.credibility,
+				source_id: doc.source_id,
+				reliability: doc.source_id ? DOCUMENT(doc.source_id).reliability : null
+			}`
+	type storedGrading struct {
+		ID          string `json:"id"`
+		Credibility int32  `json:"credibility"`
+		SourceID    string `json:"source_id"`
+		Reliability int32  `json:"reliability"`
+	}
+	rows, err := queryAll[storedGrading](ctx, db, query, map[string]interface{}{
+		"ids": ids,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	gradings := map[string]*base.Grading{}
+	for _, row := range rows {
+		gradings[row.ID] = newGrading(row.Reliability, row.Credibility, row.SourceID)
+	}
+	return gradings, nil
+}
+
+// GradeLegacySources moves the reliabilities that are not Admiralty grades to
+// legacy_reliability, grades those sources as cannot be judged, and returns
+// the number of sources updated. Legacy values have no defined meaning, so they
+// are kept for analysts to regrade the sources by hand. Legacy integers from 0
+// to 6 cannot be told apart from grades and are left in place, to be read as
+// the grade with that number.
+func (s *SourceService) GradeLegacySources(ctx context.Context) (int, error) {
+	// null sorts before numbers in AQL, so ungraded sources are excluded first
+	query := `
+		FOR s IN @@collection
+			FILTER s._key > @after AND s.reliability != null
+			FILTER NOT IS_NUMBER(s.reliability) OR s.reliability < 0 OR s.reliability > @ungradable OR s.reliability != FLOOR(s.reliability)
+			SORT s._key
+			LIMIT @limit
+			RETURN { _key: s._key, legacy_reliability: s.reliability }`
+
+	type legacySource struct {
+		Key               string      `json:"_key"`
+		LegacyReliability interface{} `json:"legacy_reliability"`
+		Reliability       int32       `json:"reliability"`
+	}
+
+	total := 0
+	after := ""
+	for {
+		sources, err := queryAll[legacySource](ctx, s.DBClient.DB, query, map[string]interface{}{
+			"@collection": s.Collection.Name(),
+			"after":       after,
+			"limit":       MaxBatchSize,
+			"ungradable":  ungradable,
+		})
+		if err != nil {
+			return total, err
+		}
+		if len(sources) == 0 {
+			break
+		}
+
+		keys := make([]string, len(sources))
+		for i, source := range sources {
+			keys[i] = source.Key
+			source.Reliability = ungradable
+		}
+		_, errs, err := s.Collection.UpdateDocuments(ctx, keys, sources)
+		if err == nil {
+			err = errs.FirstNonNil()
+		}
+		if err != nil {
+			return total, err
+		}
+		total += len(sources)
+		after = sources[len(sources)-1].Key
+	}
+
+	if total > 0 {
+		logrus.Infof("✅ Moved the legacy reliability of %d sources, reliabilities from 0 to 6 are kept as grades", total)
+	}
+	return total, nil
+}
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	graphMLContentType = "application/graphml+xml"
+	gexfContentType    = "application/gexf+xml"
+)
+
+func (s *ExportService) ExportGraph(req *base.ExportGraphRequest, stream base.ExportService_ExportGraphServer) error {
+	ctx := stream.Context()
+	logger := logging.GetLogger(ctx)
+
+	contentType, filename := graphMLContentType, "graph.graphml"
+	if req.GetFormat() == base.GraphFormat_GRAPH_FORMAT_GEXF {
+		contentType, filename = gexfContentType, "graph.gexf"
+	}
+
+	stream.SetHeader(downloadHeader(filename))
+	writer := bufio.NewWriterSize(&exportStreamWriter{stream: stream, contentType: contentType}, exportChunkSize)
+	if err := s.ExportGraphTo(ctx, req, writer); err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to send graph export")
+		return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	return nil
+}
+
+// ExportGraphTo writes the selected subgraph to w as GraphML or GEXF. Nodes
+// carry their collection as "collection" and their fields as attributes, with
+// nested fields flattened to dotted names and lists joined by ";".
+func (s *ExportService) ExportGraphTo(ctx context.Context, req *base.ExportGraphRequest, w io.Writer) error {
+	logger := logging.GetLogger(ctx)
+
+	builder := &graphBuilder{
+		nodeIDs:   map[string]bool{},
+		nodeAttrs: &graphAttributes{kinds: map[string]string{}},
+		edgeAttrs: &graphAttributes{kinds: map[string]string{}},
+	}
+	if err := s.walk(ctx, req.GetSelection(), builder.add); err != nil {
+		return err
+	}
+
+	var err error
+	if req.GetFormat() == base.GraphFormat_GRAPH_FORMAT_GEXF {
+		err = builder.writeGEXF(w)
+	} else {
+		err = builder.writeGraphML(w)
+	}
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to write graph export")
+		return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	return nil
+}
+
+type graphElement struct {
+	id         string
+	label      string
+	source     string
+	target     string
+	weight     string
+	attributes map[string]string
+}
+
+// graphAttributes declares the attributes of nodes or edges with the type
+// fitting all of their values.
+type graphAttributes struct {
+	names []string
+	kinds map[string]string
+}
+
+func (a *graphAttributes) observe(name string, value interface{}) string {
+	var kind, text string
+	switch v := value.(type) {
+	case bool:
+		kind, text = "boolean", strconv.FormatBool(v)
+	case float64:
+		kind, text = "long", strconv.FormatFloat(v, 'f', -1, 64)
+		if v != float64(int64(v)) {
+			kind = "double"
+		}
+	default:
+		kind, text = "string", fmt.Sprint(v)
+	}
+
+	previous, ok := a.kinds[name]
+	switch {
+	case !ok:
+		a.names = append(a.names, name)
+		a.kinds[name] = kind
+	case previous == kind:
+	case (previous == "long" || previous == "double") && (kind == "long" || kind == "double"):
+		a.kinds[name] = "double"
+	default:
+		a.kinds[name] = "string"
+	}
+	return text
+}
+
+// graphBuilder collects the subgraph, as attributes are declared before the
+// nodes and edges using them.
+type graphBuilder struct {
+	nodes     []*graphElement
+	edges     []*graphElement
+	nodeIDs   map[string]bool
+	nodeAttrs *graphAttributes
+	edgeAttrs *graphAttributes
+}
+
+func (b *graphBuilder) add(kind string, doc map[string]interface{}) error {
+	id, _ := takeField(doc, "_id").(string)
+	delete(doc, "_key")
+	delete(doc, "_rev")
+
+	if kind == RelationshipsType {
+		from, _ := takeField(doc, "_from").(string)
+		to, _ := takeField(doc, "_to").(string)
+		if !b.nodeIDs[from] || !b.nodeIDs[to] {
+			return nil
+		}
+
+		// Relationship attributes hold a single typed value each
+		if attributes, ok := takeField(doc, "attributes").(map[string]interface{}); ok {
+			for name, value := range attributes {
+				if typed, ok := value.(map[string]interface{}); ok && len(typed) == 1 {
+					for _, v := range typed {
+						doc["attributes."+name] = v
+					}
+				}
+			}
+		}
+
+		edge := &graphElement{id: id, source: from, target: to, attributes: map[string]string{}}
+		edge.label, _ = doc["name"].(string)
+		if confidence, ok := doc["confidence"].(float64); ok && confidence > 0 {
+			edge.weight = strconv.FormatFloat(confidence, 'f', -1, 64)
+		}
+		for name, value := range flattenFields("", doc) {
+			edge.attributes[name] = b.edgeAttrs.observe(name, value)
+		}
+		b.edges = append(b.edges, edge)
+		return nil
+	}
+
+	node := &graphElement{id: id, attributes: map[string]string{}}
+	for _, field := range []string{"name", "title", "url", "domain"} {
+		if label, ok := doc[field].(string); ok && label != "" {
+			node.label = label
+			break
+		}
+	}
+	node.attributes["collection"] = b.nodeAttrs.observe("collection", kind)
+	for name, value := range flattenFields("", doc) {
+		node.attributes[name] = b.nodeAttrs.observe(name, value)
+	}
+	b.nodes = append(b.nodes, node)
+	b.nodeIDs[id] = true
+	return nil
+}
+
+// flattenFields flattens nested fields to dotted names and joins lists.
+func flattenFields(prefix string, doc map[string]interface{}) map[string]interface{} {
+	flat := map[string]interface{}{}
+	for name, value := range doc {
+		switch v := value.(type) {
+		case nil:
+		case map[string]interface{}:
+			for nested, nestedValue := range flattenFields(prefix+name+".", v) {
+				flat[nested] = nestedValue
+			}
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			flat[prefix+name] = strings.Join(items, ";")
+		default:
+			flat[prefix+name] = v
+		}
+	}
+	return flat
+}
+
+func (b *graphBuilder) writeGraphML(w io.Writer) error {
+	out := &xmlWriter{w: w}
+	out.printf(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	out.printf(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://graphml.graphdrawing.org/xmlns http://graphml.graphdrawing.org/xmlns/1.0/graphml.xsd">` + "\n")
+
+	nodeKeys := b.writeGraphMLKeys(out, "node", "n", b.nodeAttrs)
+	edgeKeys := b.writeGraphMLKeys(out, "edge", "e", b.edgeAttrs)
+	out.printf(`  <key id="label" for="all" attr.name="label" attr.type="string"/>` + "\n")
+
+	out.printf(`  <graph id="omnibasement" edgedefault="directed">` + "\n")
+	for _, node := range b.nodes {
+		out.printf(`    <node id="%s">`+"\n", xmlEscape(node.id))
+		out.printf(`      <data key="label">%s</data>`+"\n", xmlEscape(node.label))
+		writeGraphMLData(out, node.attributes, nodeKeys)
+		out.printf("    </node>\n")
+	}
+	for _, edge := range b.edges {
+		out.printf(`    <edge id="%s" source="%s" target="%s">`+"\n", xmlEscape(edge.id), xmlEscape(edge.source), xmlEscape(edge.target))
+		out.printf(`      <data key="label">%s</data>`+"\n", xmlEscape(edge.label))
+		writeGraphMLData(out, edge.attributes, edgeKeys)
+		out.printf("    </edge>\n")
+	}
+	out.printf("  </graph>\n</graphml>\n")
+	return out.err
+}
+
+func (b *graphBuilder) writeGraphMLKeys(out *xmlWriter, element, prefix string, attributes *graphAttributes) map[string]string {
+	keys := map[string]string{}
+	for i, name := range attributes.names {
+		keys[name] = fmt.Sprintf("%s%d", prefix, i)
+		out.printf(`  <key id="%s" for="%s" attr.name="%s" attr.type="%s"/>`+"\n", keys[name], element, xmlEscape(name), attributes.kinds[name])
+	}
+	return keys
+}
+
+func writeGraphMLData(out *xmlWriter, attributes map[string]string, keys map[string]string) {
+	for _, name := range sortedKeys(attributes) {
+		out.printf(`      <data key="%s">%s</data>`+"\n", keys[name], xmlEscape(attributes[name]))
+	}
+}
+
+func (b *graphBuilder) writeGEXF(w io.Writer) error {
+	out := &xmlWriter{w: w}
+	out.printf(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	out.printf(`<gexf xmlns="http://gexf.net/1.3" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://gexf.net/1.3 http://gexf.net/1.3/gexf.xsd" version="1.3">` + "\n")
+	out.printf("  <meta>\n    <creator>omnibasement</creator>\n  </meta>\n")
+	out.printf(`  <graph defaultedgetype="directed" mode="static">` + "\n")
+
+	nodeKeys := b.writeGEXFAttributes(out, "node", b.nodeAttrs)
+	edgeKeys := b.writeGEXFAttributes(out, "edge", b.edgeAttrs)
+
+	out.printf("    <nodes>\n")
+	for _, node := range b.nodes {
+		out.printf(`      <node id="%s" label="%s">`+"\n", xmlEscape(node.id), xmlEscape(node.label))
+		writeGEXFValues(out, node.attributes, nodeKeys)
+		out.printf("      </node>\n")
+	}
+	out.printf("    </nodes>\n    <edges>\n")
+	for _, edge := range b.edges {
+		weight := ""
+		if edge.weight != "" {
+			weight = fmt.Sprintf(` weight="%s"`, edge.weight)
+		}
+		out.printf(`      <edge id="%s" source="%s" target="%s" label="%s"%s>`+"\n",
+			xmlEscape(edge.id), xmlEscape(edge.source), xmlEscape(edge.target), xmlEscape(edge.label), weight)
+		writeGEXFValues(out, edge.attributes, edgeKeys)
+		out.printf("      </edge>\n")
+	}
+	out.printf("    </edges>\n  </graph>\n</gexf>\n")
+	return out.err
+}
+
+func (b *graphBuilder) writeGEXFAttributes(out *xmlWriter, class string, attributes *graphAttributes) map[string]string {
+	keys := map[string]string{}
+	out.printf(`    <attributes class="%s">`+"\n", class)
+	for i, name := range attributes.names {
+		keys[name] = strconv.Itoa(i)
+		out.printf(`      <attribute id="%s" title="%s" type="%s"/>`+"\n", keys[name], xmlEscape(name), attributes.kinds[name])
+	}
+	out.printf("    </attributes>\n")
+	return keys
+}
+
+func writeGEXFValues(out *xmlWriter, attributes map[string]string, keys map[string]string) {
+	if len(attributes) == 0 {
+		return
+	}
+
+	out.printf("        <attvalues>\n")
+	for _, name := range sortedKeys(attributes) {
+		out.printf(`          <attvalue for="%s" value="%s"/>`+"\n", keys[name], xmlEscape(attributes[name]))
+	}
+	out.printf("        </attvalues>\n")
+}
+
+// xmlWriter keeps the first write error so documents can be written without
+// checking every element.
+type xmlWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (x *xmlWriter) printf(format string, args ...interface{}) {
+	if x.err == nil {
+		_, x.err = fmt.Fprintf(x.w, format, args...)
+	}
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
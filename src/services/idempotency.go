@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// IdempotencyKeyHeader is the HTTP header and gRPC metadata key carrying the idempotency key.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotencyKeyTTL is the environment variable overriding how long keys are kept.
+	IdempotencyKeyTTL = "IDEMPOTENCY_KEY_TTL"
+
+	defaultIdempotencyTTL = 24 * time.Hour
+	// A pending key blocks retries only until the original request could have finished
+	pendingIdempotencyTTL = time.Minute
+)
+
+// IdempotencyStore remembers the responses of Create RPCs by idempotency key.
+type IdempotencyStore struct {
+	Collection driver.Collection
+	TTL        time.Duration
+}
+
+type idempotencyRecord struct {
+	Key         string          `json:"_key,omitempty"`
+	Method      string          `json:"method"`
+	RequestHash string          `json:"request_hash"`
+	DocumentId  string          `json:"document_id,omitempty"`
+	Response    json.RawMessage `json:"response,omitempty"`
+	ExpiresAt   int64           `json:"expires_at"`
+}
+
+// NewIdempotencyStore creates the store of idempotency keys. One store is
+// shared by the services with Create RPCs.
+func NewIdempotencyStore(client *clients.ArangoDBClient) (*IdempotencyStore, error) {
+	ttl := defaultIdempotencyTTL
+	if value := os.Getenv(IdempotencyKeyTTL); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %v", IdempotencyKeyTTL, value, err)
+		}
+		ttl = parsed
+	}
+
+	ctx := context.Background()
+	collection, err := GetCreateDocumentCollection(ctx, client, "idempotency_keys")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get or create idempotency_keys collection: %v", err)
+	}
+
+	if err := EnsureIndexes(ctx, collection); err != nil {
+		return nil, err
+	}
+
+	return &IdempotencyStore{
+		Collection: collection,
+		TTL:        ttl,
+	}, nil
+}
+
+// IdempotencyKey returns the idempotency key sent with the request, if any.
+func IdempotencyKey(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(IdempotencyKeyHeader)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// WithIdempotency runs create at most once per idempotency key. A retry with the
+// same key and request replays the stored response, a retry with a different
+// request is rejected. Responses are stored as protobuf JSON so oneofs,
+// well-known types and enums replay as they were sent.
+func WithIdempotency[T proto.Message](ctx context.Context, store *IdempotencyStore, method string, req proto.Message, documentId func(T) string, create func() (T, error)) (T, error) {
+	var none T
+	key := IdempotencyKey(ctx)
+	if key == "" || store == nil {
+		return create()
+	}
+
+	logger := logging.GetLogger(ctx).WithFields(logrus.Fields{
+		"method":          method,
+		"idempotency_key": key,
+	})
+
+	// Deterministic wire encoding, protojson output is unstable by design
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to hash request")
+		return none, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	requestHash := sha256.Sum256(body)
+
+	record := idempotencyRecord{
+		Key:         idempotencyRecordKey(method, key),
+		Method:      method,
+		RequestHash: hex.EncodeToString(requestHash[:]),
+		ExpiresAt:   time.Now().Add(pendingIdempotencyTTL).Unix(),
+	}
+
+	existing, err := store.claim(ctx, &record)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to claim idempotency key")
+		return none, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	if existing != nil {
+		if existing.RequestHash != record.RequestHash {
+			logger.Info("idempotency key reused with a different request")
+			return none, status.Errorf(codes.Aborted, "Idempotency key was already used with a different request")
+		}
+
+		if existing.Response == nil {
+			logger.Info("request with idempotency key is still in progress")
+			return none, status.Errorf(codes.Aborted, "A request with this idempotency key is still in progress")
+		}
+
+		response := none.ProtoReflect().New().Interface().(T)
+		if err := protojson.Unmarshal(existing.Response, response); err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("failed to decode stored response")
+			return none, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+
+		logger.Info("replaying response for idempotency key")
+		return response, nil
+	}
+
+	response, err := create()
+	if err != nil {
+		// Release the key so the client can retry the failed request
+		if _, removeErr := store.Collection.RemoveDocument(ctx, record.Key); removeErr != nil {
+			logger.WithFields(logrus.Fields{
+				"error": removeErr,
+			}).Warn("failed to release idempotency key")
+		}
+		return none, err
+	}
+
+	stored, err := protojson.Marshal(response)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to encode response for idempotency key")
+		return response, nil
+	}
+
+	patch := map[string]interface{}{
+		"document_id": documentId(response),
+		"response":    json.RawMessage(stored),
+		"expires_at":  time.Now().Add(store.TTL).Unix(),
+	}
+	if _, err := store.Collection.UpdateDocument(ctx, record.Key, patch); err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to store response for idempotency key")
+	}
+
+	return response, nil
+}
+
+// claim inserts a pending record for the key. When the key is already taken by
+// an unexpired record, that record is returned instead.
+func (s *IdempotencyStore) claim(ctx context.Context, record *idempotencyRecord) (*idempotencyRecord, error) {
+	for {
+		_, err := s.Collection.CreateDocument(ctx, record)
+		if err == nil {
+			return nil, nil
+		}
+
+		if !driver.IsConflict(err) {
+			return nil, err
+		}
+
+		var existing idempotencyRecord
+		if _, err := s.Collection.ReadDocument(ctx, record.Key, &existing); err != nil {
+			if driver.IsNotFoundGeneral(err) {
+				// The record expired between the insert and the read
+				continue
+			}
+			return nil, err
+		}
+
+		if existing.ExpiresAt >= time.Now().Unix() {
+			return &existing, nil
+		}
+
+		// The TTL index has not removed the expired record yet
+		if _, err := s.Collection.RemoveDocument(ctx, record.Key); err != nil && !driver.IsNotFoundGeneral(err) {
+			return nil, err
+		}
+	}
+}
+
+func idempotencyRecordKey(method, key string) string {
+	sum := sha256.Sum256([]byte(method + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
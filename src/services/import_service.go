@@ -0,0 +1,725 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Fields of import rows that describe the row instead of the document.
+const (
+	ImportTypeField   = "_type"
+	ImportTempIDField = "_tmp_id"
+)
+
+const (
+	// RelationshipsType is the row type of relationships in import and export files.
+	RelationshipsType = "relationships"
+
+	maxImportErrors  = 1000
+	maxImportLineLen = 16 * 1024 * 1024
+)
+
+// EntityCollections lists the vertex collections of the five entity types.
+var EntityCollections = []string{"events", "persons", "organizations", "websites", "sources"}
+
+// DerivedFields lists the fields computed from other fields on write, or by
+// background jobs, which exports leave out and imports ignore.
+var DerivedFields = map[string][]string{
+	"persons":       {"name_keys", "alias_keys"},
+	"organizations": {"normalized_name", "legal_form", "name_keys"},
+	"websites":      {"registrable_domain"},
+	"sources":       {"registrable_domain", "monitor"},
+}
+
+// importDocuments creates the typed document each row type is validated against.
+var importDocuments = map[string]func() interface{}{
+	"events":          func() interface{} { return &model.Event{} },
+	"persons":         func() interface{} { return &model.Person{} },
+	"organizations":   func() interface{} { return &model.Organization{} },
+	"websites":        func() interface{} { return &model.Website{} },
+	"sources":         func() interface{} { return &model.Source{} },
+	RelationshipsType: func() interface{} { return &model.Relation{} },
+}
+
+// csvFieldKinds lists the fields whose CSV values are not plain strings.
+var csvFieldKinds = map[string]string{
+	"happened_at":          "int",
+	"updated_at":           "int",
+	"created_at":           "int",
+	"birth_date":           "int",
+	"founded_at":           "int",
+	"discovered_at":        "int",
+	"last_visited":         "int",
+	"reliability":          "int",
+	"monitoring":           "int",
+	"confidence":           "int",
+	"credibility":          "int",
+	"location.postal_code": "int",
+	"location.latitude":    "float",
+	"location.longitude":   "float",
+	"tags":                 "list",
+	"aliases":              "list",
+}
+
+type ImportService struct {
+	base.UnimplementedImportServiceServer
+
+	DBClient      *clients.ArangoDBClient
+	Collections   map[string]driver.Collection
+	Relationships *RelationshipService
+}
+
+// importRow is one entity or relationship read from an import file.
+type importRow struct {
+	line   int64
+	kind   string
+	tempID string
+	doc    interface{}
+	// Grading of relationships
+	grading relationGrading
+}
+
+func NewImportService(client *clients.ArangoDBClient, changes *ChangeLog) (*ImportService, error) {
+	// Imports are not keyed, rows are written without idempotency keys
+	relationships, err := NewRelationshipService(client, nil, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	collections := map[string]driver.Collection{}
+	for _, name := range EntityCollections {
+		collection, err := client.GetCreateCollection(ctx, name, driver.CreateVertexCollectionOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get or create %s collection: %v", name, err)
+		}
+		collections[name] = relationships.Changes.Watch(collection)
+	}
+
+	service := &ImportService{
+		DBClient:      client,
+		Collections:   collections,
+		Relationships: relationships,
+	}
+	return service, nil
+}
+
+func (s *ImportService) Import(stream base.ImportService_ImportServer) error {
+	ctx := stream.Context()
+	logger := logging.GetLogger(ctx)
+
+	first, err := stream.Recv()
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to receive import options")
+		return status.Errorf(codes.InvalidArgument, "Bad parameter")
+	}
+
+	reader := &importStreamReader{buf: first.GetData(), recv: func() ([]byte, error) {
+		req, err := stream.Recv()
+		return req.GetData(), err
+	}}
+	response, err := s.ImportReader(ctx, first.GetOptions(), reader)
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(response)
+}
+
+// importStreamReader exposes the data chunks of an import stream as a reader.
+type importStreamReader struct {
+	recv func() ([]byte, error)
+	buf  []byte
+}
+
+func (r *importStreamReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		data, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = data
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// ImportReader imports a JSONL or CSV file. Entities are written before
+// relationships so relationships can refer to rows of the file by temporary ID.
+func (s *ImportService) ImportReader(ctx context.Context, options *base.ImportOptions, r io.Reader) (*base.ImportResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Importing %s file", options.GetFormat())
+
+	if options.GetDefaultType() != "" {
+		if _, ok := importDocuments[options.GetDefaultType()]; !ok {
+			logger.WithFields(logrus.Fields{
+				"type": options.GetDefaultType(),
+			}).Info("unknown import type")
+			return nil, status.Errorf(codes.InvalidArgument, "Unknown type %s", options.GetDefaultType())
+		}
+	}
+
+	response := &base.ImportResponse{DryRun: options.GetDryRun()}
+	rows, err := s.readRows(options, r, response)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Info("failed to read import file")
+		return nil, status.Errorf(codes.InvalidArgument, "Failed to read import file: %v", err)
+	}
+
+	if err := s.importRows(ctx, rows, options.GetDryRun(), response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// importRows writes the rows of a file and completes its report.
+func (s *ImportService) importRows(ctx context.Context, rows []*importRow, dryRun bool, response *base.ImportResponse) error {
+	logger := logging.GetLogger(ctx)
+
+	byType := map[string][]*importRow{}
+	tempIDs := map[string]string{}
+	for _, row := range rows {
+		if row.tempID != "" {
+			if _, ok := tempIDs[row.tempID]; ok {
+				rejectImportRow(response, row.line, fmt.Sprintf("duplicate temporary id %q", row.tempID))
+				continue
+			}
+			// Reserve the temporary ID until the row is written
+			tempIDs[row.tempID] = ""
+		}
+		byType[row.kind] = append(byType[row.kind], row)
+	}
+
+	for _, name := range EntityCollections {
+		if err := s.importEntities(ctx, name, byType[name], dryRun, tempIDs, response); err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":      err,
+				"collection": name,
+			}).Error("failed to import entities")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+	}
+
+	if err := s.importRelationships(ctx, byType[RelationshipsType], dryRun, tempIDs, response); err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to import relationships")
+		return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	if !dryRun {
+		response.TempIds = map[string]string{}
+		for tempID, id := range tempIDs {
+			if id != "" {
+				response.TempIds[tempID] = id
+			}
+		}
+	}
+
+	logger.WithFields(logrus.Fields{
+		"rows":     response.Rows,
+		"created":  response.Created,
+		"updated":  response.Updated,
+		"rejected": response.Rejected,
+	}).Info("import finished")
+	return nil
+}
+
+func rejectImportRow(response *base.ImportResponse, line int64, message string) {
+	response.Rejected++
+	if len(response.Errors) < maxImportErrors {
+		response.Errors = append(response.Errors, &base.ImportRowError{Row: line, Message: message})
+	}
+}
+
+func (s *ImportService) readRows(options *base.ImportOptions, r io.Reader, response *base.ImportResponse) ([]*importRow, error) {
+	var rows []*importRow
+	add := func(line int64, fields map[string]interface{}) {
+		response.Rows++
+		row, err := newImportRow(line, fields, options.GetDefaultType())
+		if err != nil {
+			rejectImportRow(response, line, err.Error())
+			return
+		}
+		rows = append(rows, row)
+	}
+
+	switch options.GetFormat() {
+	case base.ImportFormat_IMPORT_FORMAT_JSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxImportLineLen)
+		var line int64
+		for scanner.Scan() {
+			line++
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+
+			var fields map[string]interface{}
+			if err := json.Unmarshal(text, &fields); err != nil {
+				response.Rows++
+				rejectImportRow(response, line, fmt.Sprintf("invalid JSON: %v", err))
+				continue
+			}
+			add(line, fields)
+		}
+		return rows, scanner.Err()
+
+	case base.ImportFormat_IMPORT_FORMAT_CSV:
+		reader := csv.NewReader(r)
+		header, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				return rows, nil
+			}
+
+			if err != nil {
+				var parseErr *csv.ParseError
+				if errors.As(err, &parseErr) && errors.Is(err, csv.ErrFieldCount) {
+					response.Rows++
+					rejectImportRow(response, int64(parseErr.StartLine), err.Error())
+					continue
+				}
+				return nil, err
+			}
+
+			line, _ := reader.FieldPos(0)
+			fields, err := csvRowFields(header, record, options.GetColumnMapping())
+			if err != nil {
+				response.Rows++
+				rejectImportRow(response, int64(line), err.Error())
+				continue
+			}
+			add(int64(line), fields)
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported format %s", options.GetFormat())
+}
+
+// newImportRow validates the fields of a row against the document of its type.
+func newImportRow(line int64, fields map[string]interface{}, defaultType string) (*importRow, error) {
+	kind, _ := fields[ImportTypeField].(string)
+	if kind == "" {
+		kind = defaultType
+	}
+
+	newDocument, ok := importDocuments[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q", kind)
+	}
+
+	tempID, _ := fields[ImportTempIDField].(string)
+	if strings.Contains(tempID, "/") {
+		return nil, fmt.Errorf("temporary id %q must not contain '/'", tempID)
+	}
+	delete(fields, ImportTypeField)
+	delete(fields, ImportTempIDField)
+	for _, field := range DerivedFields[kind] {
+		delete(fields, field)
+	}
+
+	// Relationships carry their grading beside the relation fields
+	var grading relationGrading
+	if kind == RelationshipsType {
+		var err error
+		if grading, err = popRelationGrading(fields); err != nil {
+			return nil, fmt.Errorf("invalid %s grading: %v", kind, err)
+		}
+	}
+
+	// Sensitivity may be given by name
+	if name, ok := fields["sensitivity"].(string); ok {
+		value, ok := model.Sensitivity_value[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown sensitivity %q", name)
+		}
+		fields["sensitivity"] = value
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := newDocument()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(doc); err != nil {
+		return nil, fmt.Errorf("invalid %s document: %v", kind, err)
+	}
+
+	switch doc := doc.(type) {
+	case *model.Relation:
+		if doc.GetFrom() == "" || doc.GetTo() == "" || doc.GetName() == "" {
+			return nil, fmt.Errorf("relationship requires _from, _to and name")
+		}
+	case *model.Website:
+		// Existing websites are matched on their canonical URL
+		canonical, err := newWebsiteDocument(doc, "website")
+		if err != nil {
+			return nil, errors.New(status.Convert(err).Message())
+		}
+		doc.Url, doc.Domain = canonical.Url, canonical.Domain
+	case *model.Source:
+		canonical, err := newSourceDocument(doc, "source")
+		if err != nil {
+			return nil, errors.New(status.Convert(err).Message())
+		}
+		doc.Url, doc.RootUrl = canonical.Url, canonical.RootUrl
+	}
+
+	return &importRow{line: line, kind: kind, tempID: tempID, doc: doc, grading: grading}, nil
+}
+
+// csvRowFields maps a CSV record to document fields. Dotted field names such as
+// "location.latitude" address nested fields.
+func csvRowFields(header []string, record []string, mapping map[string]string) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	for i, column := range header {
+		field := column
+		if len(mapping) > 0 {
+			mapped, ok := mapping[column]
+			if !ok {
+				continue
+			}
+			field = mapped
+		}
+
+		text := strings.TrimSpace(record[i])
+		if text == "" {
+			continue
+		}
+
+		var value interface{} = text
+		switch {
+		case csvFieldKinds[field] == "int":
+			number, err := strconv.ParseInt(text, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("column %q: invalid integer %q", column, text)
+			}
+			value = number
+		case csvFieldKinds[field] == "float":
+			number, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("column %q: invalid number %q", column, text)
+			}
+			value = number
+		case csvFieldKinds[field] == "list":
+			var items []string
+			for _, item := range strings.Split(text, ";") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			value = items
+		case strings.HasPrefix(field, "attributes."):
+			// Relationship attributes are imported as strings
+			value = map[string]interface{}{"string_value": text}
+		}
+
+		target := fields
+		parts := strings.Split(field, ".")
+		for _, part := range parts[:len(parts)-1] {
+			nested, ok := target[part].(map[string]interface{})
+			if !ok {
+				nested = map[string]interface{}{}
+				target[part] = nested
+			}
+			target = nested
+		}
+		target[parts[len(parts)-1]] = value
+	}
+
+	return fields, nil
+}
+
+func (s *ImportService) importEntities(ctx context.Context, name string, rows []*importRow, dryRun bool, tempIDs map[string]string, response *base.ImportResponse) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	collection := s.Collections[name]
+
+	// Websites and sources are matched to existing documents by their URL
+	if name == "websites" || name == "sources" {
+		if err := s.resolveURLKeys(ctx, collection, rows); err != nil {
+			return err
+		}
+	}
+
+	if dryRun {
+		existing, err := existingKeys(ctx, s.DBClient.DB, collection, rows)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if existing[importKey(row.doc)] {
+				response.Updated++
+			} else {
+				response.Created++
+			}
+			if row.tempID != "" {
+				tempIDs[row.tempID] = name + "/" + row.tempID
+			}
+		}
+		return nil
+	}
+
+	for start := 0; start < len(rows); start += MaxBatchSize {
+		chunk := rows[start:min(start+MaxBatchSize, len(rows))]
+		docs := make([]interface{}, len(chunk))
+		for i, row := range chunk {
+			docs[i] = row.doc
+			switch doc := row.doc.(type) {
+			case *model.Person:
+				docs[i] = newPersonDocument(doc)
+			case *model.Organization:
+				docs[i] = newOrganizationDocument(doc)
+			case *model.Website:
+				// The URL was canonicalized with the row
+				docs[i], _ = newWebsiteDocument(doc, "website")
+			case *model.Source:
+				docs[i], _ = newSourceDocument(doc, "source")
+			}
+		}
+
+		// Rows with a key update the existing document
+		metas, errs, err := collection.CreateDocuments(driver.WithOverwriteMode(ctx, driver.OverwriteModeUpdate), docs)
+		if err != nil {
+			return err
+		}
+
+		for i, row := range chunk {
+			if errs[i] != nil {
+				rejectImportRow(response, row.line, batchError(errs[i]).GetMessage())
+				continue
+			}
+
+			if metas[i].OldRev != "" {
+				response.Updated++
+			} else {
+				response.Created++
+			}
+			if row.tempID != "" {
+				tempIDs[row.tempID] = metas[i].ID.String()
+			}
+		}
+	}
+	return nil
+}
+
+func (s *ImportService) importRelationships(ctx context.Context, rows []*importRow, dryRun bool, tempIDs map[string]string, response *base.ImportResponse) error {
+	groups := map[string]*relationshipGroup{}
+	var names []string
+	for _, row := range rows {
+		relationship := row.doc.(*model.Relation)
+
+		// Endpoints without a collection prefix refer to rows of the file
+		resolved := true
+		for _, endpoint := range []*string{&relationship.From, &relationship.To} {
+			if strings.Contains(*endpoint, "/") {
+				continue
+			}
+			id := tempIDs[*endpoint]
+			if id == "" {
+				rejectImportRow(response, row.line, fmt.Sprintf("unknown temporary id %q", *endpoint))
+				resolved = false
+				break
+			}
+			*endpoint = id
+		}
+		if !resolved {
+			continue
+		}
+
+		if dryRun {
+			if _, _, err := s.DBClient.ParseDocID(relationship.From); err != nil {
+				rejectImportRow(response, row.line, fmt.Sprintf("invalid _from %q", relationship.From))
+				continue
+			}
+			if _, _, err := s.DBClient.ParseDocID(relationship.To); err != nil {
+				rejectImportRow(response, row.line, fmt.Sprintf("invalid _to %q", relationship.To))
+				continue
+			}
+			response.Created++
+			continue
+		}
+
+		collection, err := s.Relationships.edgeCollection(ctx, relationship)
+		if err != nil {
+			rejectImportRow(response, row.line, status.Convert(err).Message())
+			continue
+		}
+
+		group, ok := groups[collection.Name()]
+		if !ok {
+			group = &relationshipGroup{collection: collection}
+			groups[collection.Name()] = group
+			names = append(names, collection.Name())
+		}
+		group.items = append(group.items, &relationDocument{Relation: relationship, relationGrading: row.grading})
+		group.positions = append(group.positions, int(row.line))
+	}
+
+	for _, name := range names {
+		group := groups[name]
+		for start := 0; start < len(group.items); start += MaxBatchSize {
+			end := min(start+MaxBatchSize, len(group.items))
+			metas, errs, err := group.collection.CreateDocuments(driver.WithOverwriteMode(ctx, driver.OverwriteModeUpdate), group.items[start:end])
+			if err != nil {
+				return err
+			}
+
+			for i := range metas {
+				if errs[i] != nil {
+					rejectImportRow(response, int64(group.positions[start+i]), batchError(errs[i]).GetMessage())
+					continue
+				}
+
+				if metas[i].OldRev != "" {
+					response.Updated++
+				} else {
+					response.Created++
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resolveURLKeys sets the key of rows without one to the key of the document
+// with the same URL, if there is one.
+func (s *ImportService) resolveURLKeys(ctx context.Context, collection driver.Collection, rows []*importRow) error {
+	var urls []string
+	for _, row := range rows {
+		doc, ok := row.doc.(interface{ GetUrl() string })
+		if ok && importKey(row.doc) == "" && doc.GetUrl() != "" {
+			urls = append(urls, doc.GetUrl())
+		}
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+
+	query := `
+		FOR doc IN @@collection
+			FILTER doc.url IN @urls
+			RETURN { url: doc.url, key: doc._key }
+	`
+
+	cursor, err := s.DBClient.DB.Query(ctx, query, map[string]interface{}{
+		"urls":        urls,
+		"@collection": collection.Name(),
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close()
+
+	keys := map[string]string{}
+	for {
+		var match struct {
+			Url string `json:"url"`
+			Key string `json:"key"`
+		}
+		if _, err := cursor.ReadDocument(ctx, &match); err != nil {
+			if driver.IsNoMoreDocuments(err) {
+				break
+			}
+			return err
+		}
+		keys[match.Url] = match.Key
+	}
+
+	for _, row := range rows {
+		switch doc := row.doc.(type) {
+		case *model.Website:
+			if doc.Key == "" {
+				doc.Key = keys[doc.Url]
+			}
+		case *model.Source:
+			if doc.Key == "" {
+				doc.Key = keys[doc.Url]
+			}
+		}
+	}
+	return nil
+}
+
+// existingKeys returns which of the keys of the rows exist in the collection.
+func existingKeys(ctx context.Context, db driver.Database, collection driver.Collection, rows []*importRow) (map[string]bool, error) {
+	var keys []string
+	for _, row := range rows {
+		if key := importKey(row.doc); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	existing := map[string]bool{}
+	if len(keys) == 0 {
+		return existing, nil
+	}
+
+	query := `
+		FOR doc IN @@collection
+			FILTER doc._key IN @keys
+			RETURN doc._key
+	`
+
+	cursor, err := db.Query(ctx, query, map[string]interface{}{
+		"keys":        keys,
+		"@collection": collection.Name(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	for {
+		var key string
+		if _, err := cursor.ReadDocument(ctx, &key); err != nil {
+			if driver.IsNoMoreDocuments(err) {
+				return existing, nil
+			}
+			return nil, err
+		}
+		existing[key] = true
+	}
+}
+
+func importKey(doc interface{}) string {
+	if keyed, ok := doc.(interface{ GetKey() string }); ok {
+		return keyed.GetKey()
+	}
+	return ""
+}
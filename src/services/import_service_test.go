@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+)
+
+func TestImportService(t *testing.T) {
+	// Skip test if ArangoDB is not available
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	// Create ArangoDB client
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	// Create ImportService
+	service, err := NewImportService(client, changes)
+	if err != nil {
+		t.Fatalf("Failed to create ImportService: %v", err)
+	}
+
+	suffix := time.Now().UnixNano()
+	jsonl := strings.Join([]string{
+		fmt.Sprintf(`{"_type": "persons", "_tmp_id": "p1", "name": "Import Person %d", "sensitivity": "SENSITIVITY_COMMERCIAL"}`, suffix),
+		fmt.Sprintf(`{"_type": "organizations", "_tmp_id": "o1", "name": "Import Organization %d"}`, suffix),
+		`{"_type": "relationships", "_from": "p1", "_to": "o1", "name": "works_for"}`,
+		`{"_type": "relationships", "_from": "p1", "_to": "missing", "name": "works_for"}`,
+		`{"_type": "persons", "unknown_field": 1}`,
+		`not json`,
+	}, "\n")
+
+	t.Run("Dry Run JSONL", func(t *testing.T) {
+		resp, err := service.ImportReader(context.Background(), &base.ImportOptions{
+			Format: base.ImportFormat_IMPORT_FORMAT_JSONL,
+			DryRun: true,
+		}, strings.NewReader(jsonl))
+		if err != nil {
+			t.Fatalf("Failed to import: %v", err)
+		}
+
+		if resp.Rows != 6 || resp.Created != 3 || resp.Rejected != 3 {
+			t.Errorf("Expected 6 rows, 3 created and 3 rejected, got %d, %d and %d", resp.Rows, resp.Created, resp.Rejected)
+		}
+
+		if len(resp.TempIds) != 0 {
+			t.Errorf("Expected no temporary IDs in a dry run, got %v", resp.TempIds)
+		}
+	})
+
+	t.Run("Import JSONL", func(t *testing.T) {
+		resp, err := service.ImportReader(context.Background(), &base.ImportOptions{
+			Format: base.ImportFormat_IMPORT_FORMAT_JSONL,
+		}, strings.NewReader(jsonl))
+		if err != nil {
+			t.Fatalf("Failed to import: %v", err)
+		}
+
+		if resp.Created != 3 || resp.Rejected != 3 {
+			t.Errorf("Expected 3 created and 3 rejected, got %d and %d", resp.Created, resp.Rejected)
+		}
+
+		if !strings.HasPrefix(resp.TempIds["p1"], "persons/") || !strings.HasPrefix(resp.TempIds["o1"], "organizations/") {
+			t.Errorf("Expected temporary IDs to map to documents, got %v", resp.TempIds)
+		}
+
+		for _, rowErr := range resp.Errors {
+			if rowErr.Row < 4 {
+				t.Errorf("Expected only rows 4 to 6 to be rejected, got row %d: %s", rowErr.Row, rowErr.Message)
+			}
+		}
+	})
+
+	t.Run("Import CSV", func(t *testing.T) {
+		csv := "Title,Lat,Lon,Tags\n" +
+			fmt.Sprintf("Import Event %d,52.52,13.40,a;b\n", suffix) +
+			"Broken Event,north,13.40,\n"
+
+		resp, err := service.ImportReader(context.Background(), &base.ImportOptions{
+			Format:      base.ImportFormat_IMPORT_FORMAT_CSV,
+			DefaultType: "events",
+			ColumnMapping: map[string]string{
+				"Title": "title",
+				"Lat":   "location.latitude",
+				"Lon":   "location.longitude",
+				"Tags":  "tags",
+			},
+		}, strings.NewReader(csv))
+		if err != nil {
+			t.Fatalf("Failed to import: %v", err)
+		}
+
+		if resp.Rows != 2 || resp.Created != 1 || resp.Rejected != 1 {
+			t.Errorf("Expected 2 rows, 1 created and 1 rejected, got %d, %d and %d", resp.Rows, resp.Created, resp.Rejected)
+		}
+	})
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/arangodb/go-driver"
+	"github.com/sirupsen/logrus"
+)
+
+// IndexSpec declares an index that should exist on a collection.
+type IndexSpec struct {
+	Name        string
+	Type        driver.IndexType
+	Fields      []string
+	Unique      bool
+	Sparse      bool
+	GeoJSON     bool
+	ExpireAfter int
+}
+
+// IndexDrift describes how an index on a collection differs from its declaration.
+type IndexDrift struct {
+	Name   string
+	Reason string
+}
+
+const (
+	DriftMissing    = "missing"
+	DriftMismatch   = "mismatch"
+	DriftUndeclared = "undeclared"
+)
+
+// CollectionIndexes is the declared index configuration of every managed collection.
+var CollectionIndexes = map[string][]IndexSpec{
+	"events": {
+		{Name: "idx_events_happened_at", Type: driver.PersistentIndex, Fields: []string{"happened_at"}},
+		{Name: "idx_events_location", Type: driver.GeoIndex, Fields: []string{"location.latitude", "location.longitude"}},
+		{Name: "idx_events_tags", Type: driver.PersistentIndex, Fields: []string{"tags[*]"}, Sparse: true},
+		{Name: "idx_events_sensitivity", Type: driver.PersistentIndex, Fields: []string{"sensitivity"}},
+		{Name: "inv_events_text", Type: driver.InvertedIndex, Fields: []string{"title", "description"}},
+	},
+	"persons": {
+		{Name: "idx_persons_name", Type: driver.PersistentIndex, Fields: []string{"name"}},
+		{Name: "idx_persons_aliases", Type: driver.PersistentIndex, Fields: []string{"aliases[*]"}, Sparse: true},
+		{Name: "idx_persons_name_tokens", Type: driver.PersistentIndex, Fields: []string{"name_keys.tokens[*]"}, Sparse: true},
+		{Name: "idx_persons_name_phonetic", Type: driver.PersistentIndex, Fields: []string{"name_keys.phonetic[*]"}, Sparse: true},
+		{Name: "idx_persons_alias_tokens", Type: driver.PersistentIndex, Fields: []string{"alias_keys.tokens[*]"}, Sparse: true},
+		{Name: "idx_persons_alias_phonetic", Type: driver.PersistentIndex, Fields: []string{"alias_keys.phonetic[*]"}, Sparse: true},
+		{Name: "idx_persons_tags", Type: driver.PersistentIndex, Fields: []string{"tags[*]"}, Sparse: true},
+		{Name: "idx_persons_sensitivity", Type: driver.PersistentIndex, Fields: []string{"sensitivity"}},
+	},
+	"organizations": {
+		{Name: "idx_organizations_name", Type: driver.PersistentIndex, Fields: []string{"name"}},
+		{Name: "idx_organizations_normalized_name", Type: driver.PersistentIndex, Fields: []string{"normalized_name"}},
+		{Name: "idx_organizations_legal_form", Type: driver.PersistentIndex, Fields: []string{"legal_form"}, Sparse: true},
+		{Name: "idx_organizations_name_tokens", Type: driver.PersistentIndex, Fields: []string{"name_keys.tokens[*]"}, Sparse: true},
+		{Name: "idx_organizations_name_phonetic", Type: driver.PersistentIndex, Fields: []string{"name_keys.phonetic[*]"}, Sparse: true},
+		{Name: "idx_organizations_tags", Type: driver.PersistentIndex, Fields: []string{"tags[*]"}, Sparse: true},
+		{Name: "idx_organizations_sensitivity", Type: driver.PersistentIndex, Fields: []string{"sensitivity"}},
+	},
+	"websites": {
+		{Name: "uniq_websites_url", Type: driver.PersistentIndex, Fields: []string{"url"}, Unique: true, Sparse: true},
+		{Name: "idx_websites_domain", Type: driver.PersistentIndex, Fields: []string{"domain"}, Sparse: true},
+		{Name: "idx_websites_registrable_domain", Type: driver.PersistentIndex, Fields: []string{"registrable_domain"}, Sparse: true},
+		{Name: "idx_websites_tags", Type: driver.PersistentIndex, Fields: []string{"tags[*]"}, Sparse: true},
+		{Name: "idx_websites_sensitivity", Type: driver.PersistentIndex, Fields: []string{"sensitivity"}},
+	},
+	"sources": {
+		{Name: "uniq_sources_url", Type: driver.PersistentIndex, Fields: []string{"url"}, Unique: true, Sparse: true},
+		{Name: "idx_sources_registrable_domain", Type: driver.PersistentIndex, Fields: []string{"registrable_domain"}, Sparse: true},
+		{Name: "idx_sources_monitoring", Type: driver.PersistentIndex, Fields: []string{"monitoring"}, Sparse: true},
+		{Name: "idx_sources_tags", Type: driver.PersistentIndex, Fields: []string{"tags[*]"}, Sparse: true},
+		{Name: "idx_sources_sensitivity", Type: driver.PersistentIndex, Fields: []string{"sensitivity"}},
+	},
+	"idempotency_keys": {
+		{Name: "ttl_idempotency_keys_expires_at", Type: driver.TTLIndex, Fields: []string{"expires_at"}},
+	},
+	"changes": {
+		{Name: "ttl_changes_expires_at", Type: driver.TTLIndex, Fields: []string{"expires_at"}},
+		{Name: "idx_changes_changed_at", Type: driver.PersistentIndex, Fields: []string{"changed_at"}},
+	},
+	"webhook_deliveries": {
+		{Name: "idx_webhook_deliveries_due", Type: driver.PersistentIndex, Fields: []string{"status", "next_attempt_at"}},
+		{Name: "idx_webhook_deliveries_webhook", Type: driver.PersistentIndex, Fields: []string{"webhook_key", "created_at"}},
+	},
+	"redirects": {
+		{Name: "idx_redirects_to", Type: driver.PersistentIndex, Fields: []string{"to"}},
+	},
+	"duplicate_candidates": {
+		{Name: "idx_duplicate_candidates_status", Type: driver.PersistentIndex, Fields: []string{"status", "score"}},
+		{Name: "idx_duplicate_candidates_scanned", Type: driver.PersistentIndex, Fields: []string{"status", "scanned_at"}},
+		{Name: "idx_duplicate_candidates_person_a", Type: driver.PersistentIndex, Fields: []string{"person_a"}},
+		{Name: "idx_duplicate_candidates_person_b", Type: driver.PersistentIndex, Fields: []string{"person_b"}},
+	},
+	"feed_entries": {
+		{Name: "idx_feed_entries_link", Type: driver.PersistentIndex, Fields: []string{"source_id", "link"}, Sparse: true},
+	},
+}
+
+// EnsureIndexes applies the declared indexes of a collection and logs any drift
+// between the declaration and the indexes that exist afterwards.
+func EnsureIndexes(ctx context.Context, collection driver.Collection) error {
+	specs := CollectionIndexes[collection.Name()]
+	if err := dropRenamedIndexes(ctx, collection, specs); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error":      err,
+			"collection": collection.Name(),
+		}).Warn("failed to drop renamed indexes")
+	}
+	for _, spec := range specs {
+		if err := ensureIndex(ctx, collection, spec); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error":      err,
+				"collection": collection.Name(),
+				"index":      spec.Name,
+			}).Warn("failed to ensure index")
+		}
+	}
+
+	drifts, err := CheckIndexDrift(ctx, collection)
+	if err != nil {
+		return fmt.Errorf("failed to check indexes of %s collection: %v", collection.Name(), err)
+	}
+	for _, drift := range drifts {
+		logrus.WithFields(logrus.Fields{
+			"collection": collection.Name(),
+			"index":      drift.Name,
+			"reason":     drift.Reason,
+		}).Warn("index drift detected")
+	}
+	logrus.Infof("✅ Checked %d indexes of collection %s", len(specs), collection.Name())
+	return nil
+}
+
+// CheckIndexDrift compares the indexes of a collection against its declaration.
+func CheckIndexDrift(ctx context.Context, collection driver.Collection) ([]IndexDrift, error) {
+	indexes, err := collection.Indexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffIndexes(CollectionIndexes[collection.Name()], indexes), nil
+}
+
+func diffIndexes(specs []IndexSpec, indexes []driver.Index) []IndexDrift {
+	existing := make(map[string]driver.Index, len(indexes))
+	for _, index := range indexes {
+		existing[index.UserName()] = index
+	}
+
+	var drifts []IndexDrift
+	declared := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		declared[spec.Name] = true
+		index, ok := existing[spec.Name]
+		if !ok {
+			drifts = append(drifts, IndexDrift{Name: spec.Name, Reason: DriftMissing})
+			continue
+		}
+		if !indexMatches(spec, index) {
+			drifts = append(drifts, IndexDrift{Name: spec.Name, Reason: DriftMismatch})
+		}
+	}
+
+	for _, index := range indexes {
+		if isSystemIndex(index) || declared[index.UserName()] {
+			continue
+		}
+		drifts = append(drifts, IndexDrift{Name: index.UserName(), Reason: DriftUndeclared})
+	}
+	return drifts
+}
+
+// dropRenamedIndexes drops the indexes defined like a declared index but named
+// otherwise, such as the unnamed indexes created before indexes were declared.
+// ArangoDB returns such an index instead of creating the declared one, which
+// would stay missing for good.
+func dropRenamedIndexes(ctx context.Context, collection driver.Collection, specs []IndexSpec) error {
+	indexes, err := collection.Indexes(ctx)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(indexes))
+	for _, index := range indexes {
+		names[index.UserName()] = true
+	}
+	declared := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		declared[spec.Name] = true
+	}
+
+	for _, spec := range specs {
+		if names[spec.Name] {
+			continue
+		}
+		for _, index := range indexes {
+			if isSystemIndex(index) || declared[index.UserName()] || !indexMatches(spec, index) {
+				continue
+			}
+			if err := index.Remove(ctx); err != nil {
+				return err
+			}
+			logrus.WithFields(logrus.Fields{
+				"collection": collection.Name(),
+				"index":      index.UserName(),
+			}).Infof("Dropped index to recreate it as %s", spec.Name)
+		}
+	}
+	return nil
+}
+
+func ensureIndex(ctx context.Context, collection driver.Collection, spec IndexSpec) error {
+	var err error
+	switch spec.Type {
+	case driver.PersistentIndex:
+		_, _, err = collection.EnsurePersistentIndex(ctx, spec.Fields, &driver.EnsurePersistentIndexOptions{
+			Name:         spec.Name,
+			Unique:       spec.Unique,
+			Sparse:       spec.Sparse,
+			InBackground: true,
+		})
+	case driver.GeoIndex:
+		_, _, err = collection.EnsureGeoIndex(ctx, spec.Fields, &driver.EnsureGeoIndexOptions{
+			Name:         spec.Name,
+			GeoJSON:      spec.GeoJSON,
+			InBackground: true,
+		})
+	case driver.TTLIndex:
+		if len(spec.Fields) != 1 {
+			return fmt.Errorf("ttl index requires exactly one field, got %d", len(spec.Fields))
+		}
+		_, _, err = collection.EnsureTTLIndex(ctx, spec.Fields[0], spec.ExpireAfter, &driver.EnsureTTLIndexOptions{
+			Name:         spec.Name,
+			InBackground: true,
+		})
+	case driver.InvertedIndex:
+		fields := make([]driver.InvertedIndexField, 0, len(spec.Fields))
+		for _, field := range spec.Fields {
+			fields = append(fields, driver.InvertedIndexField{Name: field})
+		}
+		_, _, err = collection.EnsureInvertedIndex(ctx, &driver.InvertedIndexOptions{
+			Name:         spec.Name,
+			Fields:       fields,
+			InBackground: true,
+		})
+	default:
+		err = fmt.Errorf("unsupported index type %s", spec.Type)
+	}
+	return err
+}
+
+func indexFields(index driver.Index) []string {
+	if index.Type() != driver.InvertedIndex {
+		return index.Fields()
+	}
+
+	fields := []string{}
+	for _, field := range index.InvertedIndexOptions().Fields {
+		fields = append(fields, field.Name)
+	}
+	return fields
+}
+
+func indexMatches(spec IndexSpec, index driver.Index) bool {
+	if index.Type() != spec.Type || !slices.Equal(indexFields(index), spec.Fields) {
+		return false
+	}
+
+	switch spec.Type {
+	case driver.PersistentIndex:
+		return index.Unique() == spec.Unique && index.Sparse() == spec.Sparse
+	case driver.GeoIndex:
+		return index.GeoJSON() == spec.GeoJSON
+	case driver.TTLIndex:
+		return index.ExpireAfter() == spec.ExpireAfter
+	}
+	return true
+}
+
+func isSystemIndex(index driver.Index) bool {
+	return index.Type() == driver.PrimaryIndex || index.Type() == driver.EdgeIndex
+}
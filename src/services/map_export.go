@@ -0,0 +1,271 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	geoJSONContentType = "application/geo+json"
+	kmlContentType     = "application/vnd.google-earth.kml+xml"
+)
+
+func (s *ExportService) ExportEvents(req *base.ExportEventsRequest, stream base.ExportService_ExportEventsServer) error {
+	ctx := stream.Context()
+	logger := logging.GetLogger(ctx)
+
+	contentType, filename := geoJSONContentType, "events.geojson"
+	if req.GetFormat() == base.MapFormat_MAP_FORMAT_KML {
+		contentType, filename = kmlContentType, "events.kml"
+	}
+
+	stream.SetHeader(downloadHeader(filename))
+	writer := bufio.NewWriterSize(&exportStreamWriter{stream: stream, contentType: contentType}, exportChunkSize)
+	if err := s.ExportEventsTo(ctx, req, writer); err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to send event export")
+		return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	return nil
+}
+
+// ExportEventsTo writes the located events matching the request to w as a
+// GeoJSON feature collection or a KML document, oldest first.
+func (s *ExportService) ExportEventsTo(ctx context.Context, req *base.ExportEventsRequest, w io.Writer) error {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Exporting events with filters: %v", req)
+
+	filters, bindVars, err := eventFilters(req.GetStartTime(), req.GetEndTime(), req.GetBbox(), req.GetTags())
+	if err != nil {
+		return err
+	}
+	filters = append(filters, gradedEventFilters(s.DBClient.OsintGraph.Name(), req.MinReliability, req.MinCredibility, bindVars)...)
+
+	// Events without coordinates cannot be placed on a map
+	filters = append([]string{eventLocatedFilter}, filters...)
+	bindVars["@collection"] = "events"
+
+	query := "FOR doc IN @@collection\n"
+	for _, filter := range filters {
+		query += "\tFILTER " + filter + "\n"
+	}
+	query += "\tSORT doc.happened_at\n\tRETURN doc"
+
+	cursor, err := s.DBClient.DB.Query(ctx, query, bindVars)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to query events")
+		return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	defer cursor.Close()
+
+	var writer eventMapWriter = &geoJSONWriter{w: w}
+	if req.GetFormat() == base.MapFormat_MAP_FORMAT_KML {
+		writer = &kmlWriter{out: &xmlWriter{w: w}}
+	}
+
+	count := 0
+	err = writer.begin()
+	for err == nil {
+		event := &model.Event{}
+		if _, err = cursor.ReadDocument(ctx, event); driver.IsNoMoreDocuments(err) {
+			err = writer.end()
+			break
+		} else if err == nil {
+			err = writer.write(event)
+			count++
+		}
+	}
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to write event export")
+		return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	logger.Infof("Exported %d events", count)
+	return nil
+}
+
+// eventMapWriter writes events one at a time as a document of a map format.
+type eventMapWriter interface {
+	begin() error
+	write(event *model.Event) error
+	end() error
+}
+
+type geoJSONWriter struct {
+	w     io.Writer
+	count int
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Geometry   geoJSONPoint           `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float32 `json:"coordinates"`
+}
+
+func (g *geoJSONWriter) begin() error {
+	_, err := io.WriteString(g.w, `{"type":"FeatureCollection","features":[`)
+	return err
+}
+
+func (g *geoJSONWriter) write(event *model.Event) error {
+	location := event.GetLocation()
+	properties := map[string]interface{}{
+		"key":         event.GetKey(),
+		"title":       event.GetTitle(),
+		"description": event.GetDescription(),
+		"happened_at": event.GetHappenedAt(),
+		"tags":        event.GetTags(),
+	}
+	for name, value := range addressParts(location) {
+		properties[name] = value
+	}
+	if event.GetHappenedAt() != 0 {
+		properties["time"] = time.Unix(event.GetHappenedAt(), 0).UTC().Format(time.RFC3339)
+	}
+
+	data, err := json.Marshal(geoJSONFeature{
+		Type: "Feature",
+		ID:   event.GetId(),
+		Geometry: geoJSONPoint{
+			Type:        "Point",
+			Coordinates: [2]float32{location.GetLongitude(), location.GetLatitude()},
+		},
+		Properties: properties,
+	})
+	if err != nil {
+		return err
+	}
+
+	if g.count > 0 {
+		data = append([]byte{','}, data...)
+	}
+	g.count++
+	_, err = g.w.Write(data)
+	return err
+}
+
+func (g *geoJSONWriter) end() error {
+	_, err := io.WriteString(g.w, "]}\n")
+	return err
+}
+
+type kmlWriter struct {
+	out *xmlWriter
+}
+
+func (k *kmlWriter) begin() error {
+	k.out.printf(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	k.out.printf(`<kml xmlns="http://www.opengis.net/kml/2.2">` + "\n")
+	k.out.printf("  <Document>\n    <name>Events</name>\n")
+	return k.out.err
+}
+
+func (k *kmlWriter) write(event *model.Event) error {
+	location := event.GetLocation()
+	parts := addressParts(location)
+
+	// KML IDs may not contain the "/" of document IDs
+	k.out.printf(`    <Placemark id="event-%s">`+"\n", xmlEscape(event.GetKey()))
+	k.out.printf("      <name>%s</name>\n", xmlEscape(event.GetTitle()))
+	k.out.printf("      <description>%s</description>\n", xmlEscape(event.GetDescription()))
+	if event.GetHappenedAt() != 0 {
+		k.out.printf("      <TimeStamp><when>%s</when></TimeStamp>\n", time.Unix(event.GetHappenedAt(), 0).UTC().Format(time.RFC3339))
+	}
+	if address := formatAddress(location); address != "" {
+		k.out.printf("      <address>%s</address>\n", xmlEscape(address))
+	}
+
+	k.out.printf("      <ExtendedData>\n")
+	data := map[string]string{
+		"id":          event.GetId(),
+		"happened_at": strconv.FormatInt(event.GetHappenedAt(), 10),
+		"tags":        strings.Join(event.GetTags(), ";"),
+	}
+	for name, value := range parts {
+		data[name] = value
+	}
+	for _, name := range sortedKeys(data) {
+		k.out.printf(`        <Data name="%s"><value>%s</value></Data>`+"\n", name, xmlEscape(data[name]))
+	}
+	k.out.printf("      </ExtendedData>\n")
+
+	k.out.printf("      <Point><coordinates>%s,%s</coordinates></Point>\n",
+		strconv.FormatFloat(float64(location.GetLongitude()), 'f', -1, 32),
+		strconv.FormatFloat(float64(location.GetLatitude()), 'f', -1, 32))
+	k.out.printf("    </Placemark>\n")
+	return k.out.err
+}
+
+func (k *kmlWriter) end() error {
+	k.out.printf("  </Document>\n</kml>\n")
+	return k.out.err
+}
+
+// addressParts returns the address fields of a location that are set.
+func addressParts(location *model.LocationData) map[string]string {
+	parts := map[string]string{
+		"country_code":            location.GetCountryCode(),
+		"administrative_area":     location.GetAdministrativeArea(),
+		"sub_administrative_area": location.GetSubAdministrativeArea(),
+		"locality":                location.GetLocality(),
+		"sub_locality":            location.GetSubLocality(),
+		"address":                 location.GetAddress(),
+	}
+	if location.GetPostalCode() != 0 {
+		parts["postal_code"] = strconv.Itoa(int(location.GetPostalCode()))
+	}
+
+	for name, value := range parts {
+		if value == "" {
+			delete(parts, name)
+		}
+	}
+	return parts
+}
+
+// formatAddress joins the address fields of a location from the most to the
+// least specific.
+func formatAddress(location *model.LocationData) string {
+	var parts []string
+	for _, part := range []string{
+		location.GetAddress(),
+		location.GetSubLocality(),
+		location.GetLocality(),
+		location.GetSubAdministrativeArea(),
+		location.GetAdministrativeArea(),
+		location.GetCountryCode(),
+	} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,481 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MergeableCollections lists the collections whose entities can be merged.
+var MergeableCollections = []string{"persons", "organizations"}
+
+// unionFields are merged with MERGE_STRATEGY_UNION unless requested otherwise
+var unionFields = []string{"tags", "aliases"}
+
+type MergeService struct {
+	base.UnimplementedMergeServiceServer
+
+	DBClient    *clients.ArangoDBClient
+	Collections map[string]driver.Collection
+	Candidates  driver.Collection
+	Changes     *ChangeLog
+	Redirects   *RedirectStore
+
+	// ScanInterval is the time between two scans of all persons for duplicates
+	ScanInterval time.Duration
+}
+
+func NewMergeService(client *clients.ArangoDBClient, changes *ChangeLog) (*MergeService, error) {
+	interval := defaultDuplicateScanInterval
+	if value := os.Getenv(DuplicateScanInterval); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %v", DuplicateScanInterval, value, err)
+		}
+		if parsed <= 0 {
+			return nil, fmt.Errorf("invalid %s value %q: must be positive", DuplicateScanInterval, value)
+		}
+		interval = parsed
+	}
+
+	redirects, err := NewRedirectStore(client)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	collections := map[string]driver.Collection{}
+	for _, name := range MergeableCollections {
+		collection, err := client.GetCreateCollection(ctx, name, driver.CreateVertexCollectionOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get or create %s collection: %v", name, err)
+		}
+		collections[name] = changes.Watch(collection)
+	}
+
+	if _, err := getCreateProvenanceCollection(ctx, client); err != nil {
+		return nil, fmt.Errorf("failed to get or create %s collection: %v", ProvenanceCollection, err)
+	}
+
+	candidates, err := GetCreateDocumentCollection(ctx, client, DuplicateCandidatesCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get or create %s collection: %v", DuplicateCandidatesCollection, err)
+	}
+	if err := EnsureIndexes(ctx, candidates); err != nil {
+		return nil, err
+	}
+
+	service := &MergeService{
+		DBClient:     client,
+		Collections:  collections,
+		Candidates:   candidates,
+		Changes:      changes,
+		Redirects:    redirects,
+		ScanInterval: interval,
+	}
+	return service, nil
+}
+
+func (s *MergeService) MergeEntities(ctx context.Context, req *base.MergeEntitiesRequest) (*base.MergeEntitiesResponse, error) {
+	return s.mergeEntities(ctx, req, nil)
+}
+
+// mergeEntities merges the entities of req, calling within, if set, in the
+// transaction of the merge. Pending duplicate candidates of merged persons are
+// removed after within, as the duplicates no longer exist.
+func (s *MergeService) mergeEntities(ctx context.Context, req *base.MergeEntitiesRequest, within func(ctx context.Context) error) (*base.MergeEntitiesResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Merging %d entities into %s", len(req.GetDuplicateIds()), req.GetPrimaryId())
+
+	name, keys, err := s.parseMerge(req)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Info("invalid merge request")
+		return nil, err
+	}
+
+	// Read the edge definitions from the database as relationships add them at runtime
+	graph, err := s.DBClient.DB.Graph(ctx, s.DBClient.OsintGraph.Name())
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to read graph")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	var edges []string
+	for _, definition := range graph.EdgeDefinitions() {
+		if slices.Contains(definition.From, name) || slices.Contains(definition.To, name) {
+			edges = append(edges, definition.Collection)
+		}
+	}
+	// Citations follow the merged entities
+	edges = append(edges, ProvenanceCollection)
+
+	response := &base.MergeEntitiesResponse{}
+	collections := driver.TransactionCollections{Write: append([]string{name, RedirectsCollection, DuplicateCandidatesCollection}, edges...)}
+	err = s.Changes.transact(ctx, collections, func(ctx context.Context) error {
+		collection := s.Collections[name]
+
+		docs := make([]map[string]interface{}, len(keys))
+		for i, key := range keys {
+			if _, err := collection.ReadDocument(ctx, key, &docs[i]); err != nil {
+				if driver.IsNotFoundGeneral(err) {
+					return status.Errorf(codes.NotFound, "Entity %s/%s not found", name, key)
+				}
+				return err
+			}
+		}
+
+		merged := mergeDocuments(name, docs, req.GetFieldStrategy())
+		deriveFields(name, merged)
+		switch name {
+		case "persons":
+			var person model.Person
+			meta, err := collection.ReplaceDocument(driver.WithReturnNew(ctx, &person), keys[0], merged)
+			if err != nil {
+				return err
+			}
+			person.Id = meta.ID.String()
+			person.Key = meta.Key
+			person.Rev = meta.Rev
+			response.Person = &person
+		case "organizations":
+			var organization model.Organization
+			meta, err := collection.ReplaceDocument(driver.WithReturnNew(ctx, &organization), keys[0], merged)
+			if err != nil {
+				return err
+			}
+			organization.Id = meta.ID.String()
+			organization.Key = meta.Key
+			organization.Rev = meta.Rev
+			response.Organization = &organization
+		}
+
+		for _, edge := range edges {
+			moved, removed, err := s.moveRelationships(ctx, edge, req.GetPrimaryId(), req.GetDuplicateIds())
+			if err != nil {
+				return err
+			}
+			response.RelationshipsMoved += moved
+			response.RelationshipsRemoved += removed
+		}
+
+		_, errs, err := collection.RemoveDocuments(ctx, keys[1:])
+		if err != nil {
+			return err
+		}
+		if err := errs.FirstNonNil(); err != nil {
+			return err
+		}
+
+		if err := s.Redirects.redirect(ctx, req.GetDuplicateIds(), req.GetPrimaryId()); err != nil {
+			return err
+		}
+
+		if within != nil {
+			if err := within(ctx); err != nil {
+				return err
+			}
+		}
+		return s.closeCandidates(ctx, req.GetDuplicateIds())
+	})
+	if err != nil {
+		return nil, changeError(ctx, err, "failed to merge entities")
+	}
+
+	logger.Infof("Merged %d entities into %s", len(req.GetDuplicateIds()), req.GetPrimaryId())
+	return response, nil
+}
+
+// parseMerge validates req and returns the collection of the entities and
+// their keys, starting with the primary entity.
+func (s *MergeService) parseMerge(req *base.MergeEntitiesRequest) (string, []string, error) {
+	if len(req.GetDuplicateIds()) == 0 || len(req.GetDuplicateIds()) >= MaxBatchSize {
+		return "", nil, status.Errorf(codes.InvalidArgument, "Between 1 and %d duplicates can be merged", MaxBatchSize-1)
+	}
+
+	name, primary, err := s.DBClient.ParseDocID(req.GetPrimaryId())
+	if err != nil || !slices.Contains(MergeableCollections, name) {
+		return "", nil, status.Errorf(codes.InvalidArgument, "Only %s can be merged", strings.Join(MergeableCollections, " and "))
+	}
+
+	keys := []string{primary}
+	for _, id := range req.GetDuplicateIds() {
+		coll, key, err := s.DBClient.ParseDocID(id)
+		if err != nil || coll != name {
+			return "", nil, status.Errorf(codes.InvalidArgument, "Duplicates must be %s", name)
+		}
+		if slices.Contains(keys, key) {
+			return "", nil, status.Errorf(codes.InvalidArgument, "Entity %s is given twice", id)
+		}
+		keys = append(keys, key)
+	}
+
+	for field := range req.GetFieldStrategy() {
+		if field == "" || strings.HasPrefix(field, "_") {
+			return "", nil, status.Errorf(codes.InvalidArgument, "Invalid field %q", field)
+		}
+	}
+	return name, keys, nil
+}
+
+// moveRelationships re-points the relationships of an edge collection from
+// the duplicates to the primary entity, and removes those between the merged
+// entities. Moved relationships that end up parallel to another one, with the
+// same endpoints and name, or excerpt for citations, are removed in favor of
+// it, and their IDs redirected to it.
+func (s *MergeService) moveRelationships(ctx context.Context, edge, primary string, duplicates []string) (int32, int32, error) {
+	// Relationships between the duplicates and the primary entity would become loops
+	query := `
+		FOR e IN @@collection
+			FILTER e._from IN @duplicates OR e._to IN @duplicates
+			FILTER e._from IN @merged AND e._to IN @merged
+			REMOVE e IN @@collection
+			RETURN OLD
+	`
+	removed, err := queryAll[map[string]interface{}](ctx, s.DBClient.DB, query, map[string]interface{}{
+		"duplicates":  duplicates,
+		"merged":      append([]string{primary}, duplicates...),
+		"@collection": edge,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	query = `
+		FOR e IN @@collection
+			FILTER e._from IN @duplicates OR e._to IN @duplicates
+			UPDATE e WITH {
+				_from: e._from IN @duplicates ? @primary : e._from,
+				_to: e._to IN @duplicates ? @primary : e._to
+			} IN @@collection
+			RETURN NEW
+	`
+	moved, err := queryAll[map[string]interface{}](ctx, s.DBClient.DB, query, map[string]interface{}{
+		"duplicates":  duplicates,
+		"primary":     primary,
+		"@collection": edge,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Keep the relationship the primary entity had, or else the oldest one
+	movedKeys := make([]string, len(moved))
+	for i, doc := range moved {
+		movedKeys[i], _ = (*doc)["_key"].(string)
+	}
+	identity := "name"
+	if edge == ProvenanceCollection {
+		identity = "excerpt"
+	}
+	query = `
+		FOR e IN @@collection
+			FILTER e._from == @primary OR e._to == @primary
+			COLLECT from = e._from, to = e._to, identity = e[@identity] INTO group = e
+			FILTER LENGTH(group) > 1 AND LENGTH(group[* FILTER CURRENT._key IN @moved]) > 0
+			LET kept = FIRST(FOR g IN group SORT g._key IN @moved, g._key RETURN g)
+			FOR d IN group
+				FILTER d._key != kept._key
+				REMOVE d IN @@collection
+				RETURN { doc: OLD, kept: kept._id }
+	`
+	type parallel struct {
+		Doc  map[string]interface{} `json:"doc"`
+		Kept string                 `json:"kept"`
+	}
+	parallels, err := queryAll[parallel](ctx, s.DBClient.DB, query, map[string]interface{}{
+		"primary":     primary,
+		"identity":    identity,
+		"moved":       movedKeys,
+		"@collection": edge,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var changes []*changeRecord
+	deduplicated := map[string]bool{}
+	redirects := map[string][]string{}
+	for _, p := range parallels {
+		removed = append(removed, &p.Doc)
+		meta := documentMeta(p.Doc)
+		deduplicated[meta.Key] = true
+		redirects[p.Kept] = append(redirects[p.Kept], meta.ID.String())
+	}
+	for _, doc := range removed {
+		change := writeChanges(edge, []driver.DocumentMeta{documentMeta(*doc)}, nil, ChangeDelete)
+		change[0].Document = *doc
+		changes = append(changes, change...)
+	}
+	movedCount := 0
+	for _, doc := range moved {
+		meta := documentMeta(*doc)
+		if deduplicated[meta.Key] {
+			continue
+		}
+		changes = append(changes, writeChanges(edge, []driver.DocumentMeta{meta}, nil, ChangeUpdate)...)
+		movedCount++
+	}
+	if err := s.Changes.Record(ctx, changes); err != nil {
+		return 0, 0, err
+	}
+
+	for kept, ids := range redirects {
+		if err := s.Redirects.redirect(ctx, ids, kept); err != nil {
+			return 0, 0, err
+		}
+	}
+	return int32(movedCount), int32(len(removed)), nil
+}
+
+// documentMeta returns the metadata of a document read with AQL.
+func documentMeta(doc map[string]interface{}) driver.DocumentMeta {
+	key, _ := doc["_key"].(string)
+	id, _ := doc["_id"].(string)
+	rev, _ := doc["_rev"].(string)
+	return driver.DocumentMeta{Key: key, ID: driver.DocumentID(id), Rev: rev}
+}
+
+// mergeDocuments combines the fields of docs, the primary document first,
+// with the strategy of every field. The names of merged persons are kept as
+// aliases.
+func mergeDocuments(collection string, docs []map[string]interface{}, strategies map[string]base.MergeStrategy) map[string]interface{} {
+	// Documents by most recent update for MERGE_STRATEGY_NEWEST
+	newest := slices.Clone(docs)
+	sort.SliceStable(newest, func(i, j int) bool {
+		return updatedAt(newest[i]) > updatedAt(newest[j])
+	})
+
+	merged := map[string]interface{}{}
+	for _, doc := range docs {
+		for field := range doc {
+			if _, ok := merged[field]; ok || strings.HasPrefix(field, "_") {
+				continue
+			}
+
+			strategy := strategies[field]
+			if strategy == base.MergeStrategy_MERGE_STRATEGY_UNSPECIFIED {
+				strategy = base.MergeStrategy_MERGE_STRATEGY_PRIMARY
+				if slices.Contains(unionFields, field) {
+					strategy = base.MergeStrategy_MERGE_STRATEGY_UNION
+				}
+			}
+
+			switch strategy {
+			case base.MergeStrategy_MERGE_STRATEGY_NEWEST:
+				merged[field] = firstValue(newest, field)
+			case base.MergeStrategy_MERGE_STRATEGY_UNION:
+				merged[field] = unionValue(docs, field)
+			default:
+				merged[field] = firstValue(docs, field)
+			}
+		}
+	}
+
+	if collection == "persons" {
+		aliases, _ := merged["aliases"].([]interface{})
+		for _, doc := range docs {
+			if name, ok := doc["name"].(string); ok && name != "" && name != merged["name"] && !slices.Contains(aliases, interface{}(name)) {
+				aliases = append(aliases, name)
+			}
+		}
+		if len(aliases) > 0 {
+			merged["aliases"] = aliases
+		}
+	}
+	return merged
+}
+
+// firstValue returns the first value of field in docs that is not empty.
+func firstValue(docs []map[string]interface{}, field string) interface{} {
+	for _, doc := range docs {
+		if value, ok := doc[field]; ok && !isEmptyValue(value) {
+			return value
+		}
+	}
+	return docs[0][field]
+}
+
+// unionValue returns the distinct elements of the list field of docs, or the
+// first value if a document holds another type.
+func unionValue(docs []map[string]interface{}, field string) interface{} {
+	var union []interface{}
+	for _, doc := range docs {
+		value, ok := doc[field]
+		if !ok || value == nil {
+			continue
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			return firstValue(docs, field)
+		}
+		for _, element := range list {
+			if !slices.ContainsFunc(union, func(v interface{}) bool { return reflect.DeepEqual(v, element) }) {
+				union = append(union, element)
+			}
+		}
+	}
+	return union
+}
+
+// deriveFields sets the fields of a merged document computed from its other
+// fields, as its service does on write.
+func deriveFields(collection string, doc map[string]interface{}) {
+	name, _ := doc["name"].(string)
+	var aliases []string
+	if list, ok := doc["aliases"].([]interface{}); ok {
+		for _, alias := range list {
+			if alias, ok := alias.(string); ok {
+				aliases = append(aliases, alias)
+			}
+		}
+	}
+
+	switch collection {
+	case "persons":
+		derived := newPersonDocument(&model.Person{Name: name, Aliases: aliases})
+		doc["name_keys"], doc["alias_keys"] = derived.NameKeys, derived.AliasKeys
+	case "organizations":
+		derived := newOrganizationDocument(&model.Organization{Name: name})
+		doc["normalized_name"], doc["legal_form"], doc["name_keys"] = derived.NormalizedName, derived.LegalForm, derived.NameKeys
+	}
+}
+
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case float64:
+		return v == 0
+	case bool:
+		return !v
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+func updatedAt(doc map[string]interface{}) float64 {
+	value, _ := doc["updated_at"].(float64)
+	return value
+}
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMergeService(t *testing.T) {
+	// Skip test if ArangoDB is not available
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	// Create ArangoDB client
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
+	// Create MergeService
+	service, err := NewMergeService(client, changes)
+	if err != nil {
+		t.Fatalf("Failed to create MergeService: %v", err)
+	}
+
+	personService, err := NewPersonService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create PersonService: %v", err)
+	}
+
+	organizationService, err := NewOrganizationService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create OrganizationService: %v", err)
+	}
+
+	relationshipService, err := NewRelationshipService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create RelationshipService: %v", err)
+	}
+
+	ctx := context.Background()
+	createPerson := func(person *model.Person) *model.Person {
+		resp, err := personService.CreatePerson(ctx, &base.CreatePersonRequest{Person: person})
+		if err != nil {
+			t.Fatalf("Failed to create person: %v", err)
+		}
+		return resp.Person
+	}
+	createRelationship := func(name, from, to string) *model.Relation {
+		resp, err := relationshipService.CreateRelationship(ctx, &base.CreateRelationshipRequest{
+			Relationship: &model.Relation{Name: name, From: from, To: to},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create relationship: %v", err)
+		}
+		return resp.Relationship
+	}
+
+	primary := createPerson(&model.Person{Name: "Jane Doe", Role: "Analyst", Tags: []string{"a"}, Aliases: []string{"J. Doe"}})
+	defer personService.DeletePerson(ctx, &base.DeletePersonRequest{Key: primary.Key})
+	duplicate := createPerson(&model.Person{Name: "Jane A. Doe", Nationality: "FR", Tags: []string{"b"}})
+	other := createPerson(&model.Person{Name: "Jane Doe", Tags: []string{"a", "c"}})
+
+	organization, err := organizationService.CreateOrganization(ctx, &base.CreateOrganizationRequest{
+		Organization: &model.Organization{Name: "Merge Corp"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create organization: %v", err)
+	}
+	defer organizationService.DeleteOrganization(ctx, &base.DeleteOrganizationRequest{Key: organization.Organization.Key})
+
+	employment := createRelationship("employment", duplicate.Id, organization.Organization.Id)
+	defer relationshipService.DeleteRelationship(ctx, &base.DeleteRelationshipRequest{Id: employment.Id})
+	loop := createRelationship("knows", duplicate.Id, primary.Id)
+	kept := createRelationship("membership", primary.Id, organization.Organization.Id)
+	defer relationshipService.DeleteRelationship(ctx, &base.DeleteRelationshipRequest{Id: kept.Id})
+	parallel := createRelationship("membership", other.Id, organization.Organization.Id)
+
+	t.Run("Merge", func(t *testing.T) {
+		resp, err := service.MergeEntities(ctx, &base.MergeEntitiesRequest{
+			PrimaryId:    primary.Id,
+			DuplicateIds: []string{duplicate.Id, other.Id},
+		})
+		if err != nil {
+			t.Fatalf("Failed to merge entities: %v", err)
+		}
+
+		merged := resp.GetPerson()
+		if merged.GetKey() != primary.Key || merged.GetName() != "Jane Doe" || merged.GetRole() != "Analyst" {
+			t.Errorf("Expected the primary person to survive, got %v", merged)
+		}
+		if merged.GetNationality() != "FR" {
+			t.Errorf("Expected the nationality of the duplicate, got %q", merged.GetNationality())
+		}
+		if !slices.Equal(merged.GetTags(), []string{"a", "b", "c"}) {
+			t.Errorf("Expected the union of the tags, got %v", merged.GetTags())
+		}
+		if !slices.Equal(merged.GetAliases(), []string{"J. Doe", "Jane A. Doe"}) {
+			t.Errorf("Expected the aliases to include the merged name, got %v", merged.GetAliases())
+		}
+		if resp.RelationshipsMoved != 1 || resp.RelationshipsRemoved != 2 {
+			t.Errorf("Expected 1 moved and 2 removed relationships, got %d and %d", resp.RelationshipsMoved, resp.RelationshipsRemoved)
+		}
+
+		moved, err := queryAll[model.Relation](ctx, client.DB, "RETURN DOCUMENT(@id)", map[string]interface{}{"id": employment.Id})
+		if err != nil {
+			t.Fatalf("Failed to read relationship: %v", err)
+		}
+		if len(moved) != 1 || moved[0].From != primary.Id {
+			t.Errorf("Expected the relationship to start at the primary person, got %v", moved)
+		}
+
+		removed, err := queryAll[model.Relation](ctx, client.DB, "FOR r IN [DOCUMENT(@id)] FILTER r != null RETURN r", map[string]interface{}{"id": loop.Id})
+		if err != nil {
+			t.Fatalf("Failed to read relationship: %v", err)
+		}
+		if len(removed) != 0 {
+			t.Errorf("Expected the relationship between merged persons to be removed")
+		}
+
+		parallels, err := queryAll[model.Relation](ctx, client.DB, "FOR r IN [DOCUMENT(@id)] FILTER r != null RETURN r", map[string]interface{}{"id": parallel.Id})
+		if err != nil {
+			t.Fatalf("Failed to read relationship: %v", err)
+		}
+		if len(parallels) != 0 {
+			t.Errorf("Expected the parallel relationship to be removed")
+		}
+	})
+
+	t.Run("Redirect", func(t *testing.T) {
+		resp, err := personService.GetPerson(ctx, &base.GetPersonRequest{Key: duplicate.Key})
+		if err != nil {
+			t.Fatalf("Failed to get merged person: %v", err)
+		}
+		if resp.Person.Key != primary.Key {
+			t.Errorf("Expected merged person to resolve to %s, got %s", primary.Key, resp.Person.Key)
+		}
+
+		// Removed parallel relationships resolve to the one kept
+		relationship, err := relationshipService.GetRelationship(ctx, &base.GetRelationshipRequest{Id: parallel.Id})
+		if err != nil {
+			t.Fatalf("Failed to get removed relationship: %v", err)
+		}
+		if relationship.Relationship.Id != kept.Id {
+			t.Errorf("Expected removed relationship to resolve to %s, got %s", kept.Id, relationship.Relationship.Id)
+		}
+
+		// New relationships of a merged person start at the survivor
+		created := createRelationship("knows", duplicate.Id, organization.Organization.Id)
+		defer relationshipService.DeleteRelationship(ctx, &base.DeleteRelationshipRequest{Id: created.Id})
+		if created.From != primary.Id {
+			t.Errorf("Expected relationship to start at %s, got %s", primary.Id, created.From)
+		}
+
+		// Redirects follow the survivor of later merges
+		survivor := createPerson(&model.Person{Name: "Jane Survivor"})
+		defer personService.DeletePerson(ctx, &base.DeletePersonRequest{Key: survivor.Key})
+		if _, err := service.MergeEntities(ctx, &base.MergeEntitiesRequest{
+			PrimaryId:    survivor.Id,
+			DuplicateIds: []string{primary.Id},
+		}); err != nil {
+			t.Fatalf("Failed to merge entities: %v", err)
+		}
+
+		to, err := service.Redirects.Resolve(ctx, duplicate.Id)
+		if err != nil {
+			t.Fatalf("Failed to resolve redirect: %v", err)
+		}
+		if to != survivor.Id {
+			t.Errorf("Expected %s to resolve to %s, got %s", duplicate.Id, survivor.Id, to)
+		}
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		_, err := service.MergeEntities(ctx, &base.MergeEntitiesRequest{
+			PrimaryId:    primary.Id,
+			DuplicateIds: []string{organization.Organization.Id},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument error, got %v", err)
+		}
+
+		_, err = service.MergeEntities(ctx, &base.MergeEntitiesRequest{
+			PrimaryId:    "persons/does_not_exist",
+			DuplicateIds: []string{"persons/does_not_exist_either"},
+		})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("Expected NotFound error, got %v", err)
+		}
+	})
+}
+
+func TestDuplicateCandidates(t *testing.T) {
+	// Skip test if ArangoDB is not available
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	// Create ArangoDB client
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
+	// Create MergeService
+	service, err := NewMergeService(client, changes)
+	if err != nil {
+		t.Fatalf("Failed to create MergeService: %v", err)
+	}
+
+	personService, err := NewPersonService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create PersonService: %v", err)
+	}
+
+	ctx := context.Background()
+	birthDate := time.Date(1971, 3, 14, 0, 0, 0, 0, time.UTC).Unix()
+	createPerson := func(name string) *model.Person {
+		resp, err := personService.CreatePerson(ctx, &base.CreatePersonRequest{
+			Person: &model.Person{Name: name, BirthDate: birthDate, Nationality: "GB"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create person: %v", err)
+		}
+		return resp.Person
+	}
+	findCandidate := func(person, other string, candidateStatus base.CandidateStatus) *base.DuplicateCandidate {
+		resp, err := service.FindDuplicateCandidates(ctx, &base.FindDuplicateCandidatesRequest{
+			PersonId: person,
+			Status:   candidateStatus,
+		})
+		if err != nil {
+			t.Fatalf("Failed to find duplicate candidates: %v", err)
+		}
+		for _, candidate := range resp.Candidates {
+			if candidate.PersonA == other || candidate.PersonB == other {
+				return candidate
+			}
+		}
+		return nil
+	}
+
+	person := createPerson("Jonathan Smyth")
+	defer personService.DeletePerson(ctx, &base.DeletePersonRequest{Key: person.Key})
+	similar := createPerson("Smith, Jonathon")
+	defer personService.DeletePerson(ctx, &base.DeletePersonRequest{Key: similar.Key})
+	distinct := createPerson("Margaret Okonkwo")
+	defer personService.DeletePerson(ctx, &base.DeletePersonRequest{Key: distinct.Key})
+
+	t.Run("Find", func(t *testing.T) {
+		candidate := findCandidate(person.Id, similar.Id, base.CandidateStatus_CANDIDATE_STATUS_UNSPECIFIED)
+		if candidate == nil {
+			t.Fatalf("Expected %s to be a duplicate candidate of %s", similar.Id, person.Id)
+		}
+		if candidate.Score < duplicateThreshold || candidate.Scores.BirthDate != 1 || candidate.Scores.Nationality != 1 {
+			t.Errorf("Unexpected candidate scores %v", candidate)
+		}
+
+		if findCandidate(person.Id, distinct.Id, base.CandidateStatus_CANDIDATE_STATUS_UNSPECIFIED) != nil {
+			t.Errorf("Expected %s not to be a duplicate candidate", distinct.Id)
+		}
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		candidate := findCandidate(person.Id, similar.Id, base.CandidateStatus_CANDIDATE_STATUS_PENDING)
+		if candidate == nil {
+			t.Fatalf("Expected a pending candidate")
+		}
+		if _, err := service.RejectDuplicateCandidate(ctx, &base.RejectDuplicateCandidateRequest{Key: candidate.Key}); err != nil {
+			t.Fatalf("Failed to reject duplicate candidate: %v", err)
+		}
+
+		// Scoring again must not bring the rejected pair back
+		if findCandidate(person.Id, similar.Id, base.CandidateStatus_CANDIDATE_STATUS_PENDING) != nil {
+			t.Errorf("Expected the rejected candidate not to come back")
+		}
+		if findCandidate(person.Id, similar.Id, base.CandidateStatus_CANDIDATE_STATUS_REJECTED) == nil {
+			t.Errorf("Expected the candidate to stay rejected")
+		}
+	})
+
+	t.Run("Accept", func(t *testing.T) {
+		duplicate := createPerson("Jonathan Smyth")
+		candidate := findCandidate(person.Id, duplicate.Id, base.CandidateStatus_CANDIDATE_STATUS_PENDING)
+		if candidate == nil {
+			t.Fatalf("Expected a pending candidate")
+		}
+
+		resp, err := service.AcceptDuplicateCandidate(ctx, &base.AcceptDuplicateCandidateRequest{
+			Key:       candidate.Key,
+			PrimaryId: person.Id,
+		})
+		if err != nil {
+			t.Fatalf("Failed to accept duplicate candidate: %v", err)
+		}
+		if resp.Candidate.Status != base.CandidateStatus_CANDIDATE_STATUS_ACCEPTED || resp.Merge.GetPerson().GetKey() != person.Key {
+			t.Errorf("Unexpected accepted candidate %v", resp)
+		}
+
+		merged, err := personService.GetPerson(ctx, &base.GetPersonRequest{Key: duplicate.Key})
+		if err != nil {
+			t.Fatalf("Failed to get merged person: %v", err)
+		}
+		if merged.Person.Key != person.Key {
+			t.Errorf("Expected merged person to resolve to %s, got %s", person.Key, merged.Person.Key)
+		}
+
+		_, err = service.AcceptDuplicateCandidate(ctx, &base.AcceptDuplicateCandidateRequest{Key: candidate.Key})
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("Expected FailedPrecondition error, got %v", err)
+		}
+
+		// Other pairs of the merged person are closed with the merge
+		if findCandidate(similar.Id, duplicate.Id, base.CandidateStatus_CANDIDATE_STATUS_PENDING) != nil {
+			t.Errorf("Expected no pending candidate of the merged person")
+		}
+	})
+
+	t.Run("Scripts", func(t *testing.T) {
+		latin := createPerson("Ivan Petrov")
+		defer personService.DeletePerson(ctx, &base.DeletePersonRequest{Key: latin.Key})
+		cyrillic := createPerson("Иван Петров")
+		defer personService.DeletePerson(ctx, &base.DeletePersonRequest{Key: cyrillic.Key})
+
+		if findCandidate(cyrillic.Id, latin.Id, base.CandidateStatus_CANDIDATE_STATUS_PENDING) == nil {
+			t.Errorf("Expected %s to be a duplicate candidate of %s", latin.Id, cyrillic.Id)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"math"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Mapbox Vector Tile 2.1 encoding of point layers
+// (https://github.com/mapbox/vector-tile-spec/tree/master/2.1).
+
+const (
+	// TileExtent is the number of units across a tile.
+	TileExtent = 4096
+
+	mvtVersion    = 2
+	mvtPoint      = 1
+	mvtMoveToOnce = 1&0x7 | 1<<3
+)
+
+// mvtLayer collects the point features of one layer with their properties.
+type mvtLayer struct {
+	name     string
+	keys     []string
+	keyIndex map[string]uint64
+	values   [][]byte
+	valIndex map[string]uint64
+	features [][]byte
+}
+
+func newMVTLayer(name string) *mvtLayer {
+	return &mvtLayer{
+		name:     name,
+		keyIndex: map[string]uint64{},
+		valIndex: map[string]uint64{},
+	}
+}
+
+// addPoint adds a point at tile coordinates x and y, in [0, TileExtent).
+// Properties may be strings, booleans, integers or floats.
+func (l *mvtLayer) addPoint(x, y int64, properties map[string]interface{}) {
+	var tags []byte
+	for _, key := range sortedPropertyKeys(properties) {
+		value, ok := encodeMVTValue(properties[key])
+		if !ok {
+			continue
+		}
+		tags = protowire.AppendVarint(tags, l.key(key))
+		tags = protowire.AppendVarint(tags, l.value(value))
+	}
+
+	var geometry []byte
+	geometry = protowire.AppendVarint(geometry, mvtMoveToOnce)
+	geometry = protowire.AppendVarint(geometry, protowire.EncodeZigZag(x))
+	geometry = protowire.AppendVarint(geometry, protowire.EncodeZigZag(y))
+
+	var feature []byte
+	feature = protowire.AppendTag(feature, 2, protowire.BytesType)
+	feature = protowire.AppendBytes(feature, tags)
+	feature = protowire.AppendTag(feature, 3, protowire.VarintType)
+	feature = protowire.AppendVarint(feature, mvtPoint)
+	feature = protowire.AppendTag(feature, 4, protowire.BytesType)
+	feature = protowire.AppendBytes(feature, geometry)
+	l.features = append(l.features, feature)
+}
+
+func (l *mvtLayer) key(key string) uint64 {
+	index, ok := l.keyIndex[key]
+	if !ok {
+		index = uint64(len(l.keys))
+		l.keyIndex[key] = index
+		l.keys = append(l.keys, key)
+	}
+	return index
+}
+
+func (l *mvtLayer) value(value []byte) uint64 {
+	index, ok := l.valIndex[string(value)]
+	if !ok {
+		index = uint64(len(l.values))
+		l.valIndex[string(value)] = index
+		l.values = append(l.values, value)
+	}
+	return index
+}
+
+func encodeMVTValue(value interface{}) ([]byte, bool) {
+	var b []byte
+	switch v := value.(type) {
+	case string:
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	case bool:
+		b = protowire.AppendTag(b, 7, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case int:
+		return encodeMVTValue(int64(v))
+	case int64:
+		b = protowire.AppendTag(b, 6, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeZigZag(v))
+	case float64:
+		b = protowire.AppendTag(b, 3, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(v))
+	default:
+		return nil, false
+	}
+	return b, true
+}
+
+// encodeMVTTile encodes layers as a tile. Empty layers are left out.
+func encodeMVTTile(layers ...*mvtLayer) []byte {
+	var tile []byte
+	for _, l := range layers {
+		if len(l.features) == 0 {
+			continue
+		}
+
+		var layer []byte
+		layer = protowire.AppendTag(layer, 15, protowire.VarintType)
+		layer = protowire.AppendVarint(layer, mvtVersion)
+		layer = protowire.AppendTag(layer, 1, protowire.BytesType)
+		layer = protowire.AppendString(layer, l.name)
+		for _, feature := range l.features {
+			layer = protowire.AppendTag(layer, 2, protowire.BytesType)
+			layer = protowire.AppendBytes(layer, feature)
+		}
+		for _, key := range l.keys {
+			layer = protowire.AppendTag(layer, 3, protowire.BytesType)
+			layer = protowire.AppendString(layer, key)
+		}
+		for _, value := range l.values {
+			layer = protowire.AppendTag(layer, 4, protowire.BytesType)
+			layer = protowire.AppendBytes(layer, value)
+		}
+		layer = protowire.AppendTag(layer, 5, protowire.VarintType)
+		layer = protowire.AppendVarint(layer, TileExtent)
+
+		tile = protowire.AppendTag(tile, 3, protowire.BytesType)
+		tile = protowire.AppendBytes(tile, layer)
+	}
+	return tile
+}
+
+func sortedPropertyKeys(properties map[string]interface{}) []string {
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
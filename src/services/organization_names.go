@@ -0,0 +1,170 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	_ "embed"
+	"slices"
+	"strings"
+
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/text/cases"
+)
+
+//go:embed legal_forms.tsv
+var legalFormsTable string
+
+// legalForm is a spelling of a legal form as name words.
+type legalForm struct {
+	Form   string
+	Tokens []string
+	Prefix bool
+}
+
+// legalForms holds the spellings of legalFormsTable, longest first.
+var legalForms = parseLegalForms(legalFormsTable)
+
+// organizationDocument is an organization stored with its normalized name and
+// legal form, which organization lookups match on, and the search keys of its
+// name.
+type organizationDocument struct {
+	*model.Organization
+	// All are set when the organization has a name, so updates keep them in sync
+	NormalizedName *string     `json:"normalized_name,omitempty"`
+	LegalForm      *string     `json:"legal_form,omitempty"`
+	NameKeys       *searchKeys `json:"name_keys,omitempty"`
+}
+
+func parseLegalForms(table string) []legalForm {
+	var forms []legalForm
+	for _, line := range strings.Split(table, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		columns := strings.Split(line, "\t")
+		if len(columns) < 2 {
+			continue
+		}
+		for _, spelling := range strings.Split(columns[1], "|") {
+			forms = append(forms, legalForm{
+				Form:   columns[0],
+				Tokens: strings.Fields(spelling),
+				Prefix: len(columns) > 2 && columns[2] == "prefix",
+			})
+		}
+	}
+	slices.SortStableFunc(forms, func(a, b legalForm) int {
+		return cmp.Compare(len(b.Tokens), len(a.Tokens))
+	})
+	return forms
+}
+
+// newOrganizationDocument returns organization with its normalized name, legal
+// form and search keys.
+func newOrganizationDocument(organization *model.Organization) *organizationDocument {
+	doc := &organizationDocument{Organization: organization}
+	if organization.GetName() != "" {
+		normalized, form := parseOrganizationName(organization.GetName())
+		doc.NormalizedName = &normalized
+		doc.LegalForm = &form
+		doc.NameKeys = newSearchKeys(organization.GetName())
+	}
+	return doc
+}
+
+// parseOrganizationName returns the casefolded words of name without
+// punctuation or legal form, and the canonical legal form if name has one.
+func parseOrganizationName(name string) (normalized string, form string) {
+	tokens := organizationNameTokens(name)
+	for _, candidate := range legalForms {
+		// Keep names that are only a legal form
+		if len(candidate.Tokens) >= len(tokens) {
+			continue
+		}
+		if slices.Equal(tokens[len(tokens)-len(candidate.Tokens):], candidate.Tokens) {
+			tokens, form = tokens[:len(tokens)-len(candidate.Tokens)], candidate.Form
+			break
+		}
+		if candidate.Prefix && slices.Equal(tokens[:len(candidate.Tokens)], candidate.Tokens) {
+			tokens, form = tokens[len(candidate.Tokens):], candidate.Form
+			break
+		}
+	}
+
+	normalized = strings.Join(tokens, " ")
+	if normalized == "" {
+		normalized = strings.ToLower(strings.TrimSpace(name))
+	}
+	return normalized, form
+}
+
+// organizationNameTokens returns the casefolded words of name as nameTokens
+// does, keeping abbreviations such as "S.A." as one word.
+func organizationNameTokens(name string) []string {
+	name = strings.NewReplacer(".", "", "'", "", "’", "").Replace(name)
+	return nameTokens(cases.Fold().String(name))
+}
+
+// organizationNormalizedName returns the normalized name of an organization.
+func organizationNormalizedName(name string) string {
+	normalized, _ := parseOrganizationName(name)
+	return normalized
+}
+
+// NormalizeNames stores the normalized name, legal form and search keys of all
+// organizations, for those created before they were introduced or keyed by an
+// older transliteration, and returns the number of organizations updated.
+func (s *OrganizationService) NormalizeNames(ctx context.Context) (int, error) {
+	query := `
+		FOR o IN @@collection
+			FILTER o._key > @after AND o.name != null
+			SORT o._key
+			LIMIT @limit
+			RETURN KEEP(o, "_key", "name")`
+	update := `
+		FOR u IN @updates
+			UPDATE u._key WITH { normalized_name: u.normalized_name, legal_form: u.legal_form, name_keys: u.name_keys } IN @@collection`
+
+	total := 0
+	after := ""
+	for {
+		organizations, err := queryAll[model.Organization](ctx, s.DBClient.DB, query, map[string]interface{}{
+			"@collection": s.Collection.Name(),
+			"after":       after,
+			"limit":       MaxBatchSize,
+		})
+		if err != nil {
+			return total, err
+		}
+		if len(organizations) == 0 {
+			break
+		}
+
+		updates := make([]map[string]interface{}, len(organizations))
+		for i, organization := range organizations {
+			normalized, form := parseOrganizationName(organization.Name)
+			updates[i] = map[string]interface{}{
+				"_key":            organization.Key,
+				"normalized_name": normalized,
+				"legal_form":      form,
+				"name_keys":       newSearchKeys(organization.Name),
+			}
+		}
+		cursor, err := s.DBClient.DB.Query(ctx, update, map[string]interface{}{
+			"@collection": s.Collection.Name(),
+			"updates":     updates,
+		})
+		if err != nil {
+			return total, err
+		}
+		cursor.Close()
+		total += len(organizations)
+		after = organizations[len(organizations)-1].Key
+	}
+
+	if total > 0 {
+		logrus.Infof("✅ Normalized the names of %d organizations", total)
+	}
+	return total, nil
+}
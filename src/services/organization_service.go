@@ -17,11 +17,14 @@ import (
 type OrganizationService struct {
 	base.UnimplementedOrganizationServiceServer
 
-	DBClient   *clients.ArangoDBClient
-	Collection driver.Collection
+	DBClient    *clients.ArangoDBClient
+	Collection  driver.Collection
+	Idempotency *IdempotencyStore
+	Redirects   *RedirectStore
+	Changes     *ChangeLog
 }
 
-func NewOrganizationService(client *clients.ArangoDBClient) (*OrganizationService, error) {
+func NewOrganizationService(client *clients.ArangoDBClient, idempotency *IdempotencyStore, changes *ChangeLog) (*OrganizationService, error) {
 	// Create organizations collection
 	ctx := context.Background()
 	collection, err := client.GetCreateCollection(ctx, "organizations", driver.CreateVertexCollectionOptions{})
@@ -30,9 +33,26 @@ func NewOrganizationService(client *clients.ArangoDBClient) (*OrganizationServic
 	}
 	logrus.Infof("✅ Initialized collection %s", collection.Name())
 
+	if err := EnsureIndexes(ctx, collection); err != nil {
+		return nil, err
+	}
+
+	redirects, err := NewRedirectStore(client)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deletes remove the citations of the deleted documents
+	if _, err := getCreateProvenanceCollection(ctx, client); err != nil {
+		return nil, fmt.Errorf("failed to get or create %s collection: %v", ProvenanceCollection, err)
+	}
+
 	service := &OrganizationService{
-		DBClient:   client,
-		Collection: collection,
+		DBClient:    client,
+		Collection:  changes.Watch(collection),
+		Idempotency: idempotency,
+		Redirects:   redirects,
+		Changes:     changes,
 	}
 	return service, nil
 }
@@ -41,9 +61,9 @@ func (s *OrganizationService) GetOrganization(ctx context.Context, req *base.Get
 	logger := logging.GetLogger(ctx)
 	logger.Infof("Getting organization with ID: %s", req.GetKey())
 
-	// Read document from collection
+	// Read document from collection, resolving organizations merged into another organization
 	var organization model.Organization
-	meta, err := s.Collection.ReadDocument(ctx, req.GetKey(), &organization)
+	meta, err := s.Redirects.ReadDocument(ctx, s.Collection, req.GetKey(), &organization)
 	if err != nil {
 		if driver.IsNotFoundGeneral(err) {
 			logger.WithFields(logrus.Fields{
@@ -62,28 +82,71 @@ func (s *OrganizationService) GetOrganization(ctx context.Context, req *base.Get
 	organization.Id = meta.ID.String()
 	organization.Key = meta.Key
 	organization.Rev = meta.Rev
-	return &base.GetOrganizationResponse{Organization: &organization}, nil
+	response := &base.GetOrganizationResponse{Organization: &organization}
+	if req.GetIncludeCitations() {
+		citations, err := listCitations(ctx, s.DBClient.DB, organization.Id)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"key":   req.GetKey(),
+			}).Error("failed to list organization citations")
+			return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		response.Citations = citations
+	}
+	return response, nil
 }
 
 func (s *OrganizationService) CreateOrganization(ctx context.Context, req *base.CreateOrganizationRequest) (*base.CreateOrganizationResponse, error) {
+	return WithIdempotency(ctx, s.Idempotency, "CreateOrganization", req, func(resp *base.CreateOrganizationResponse) string {
+		return resp.GetOrganization().GetId()
+	}, func() (*base.CreateOrganizationResponse, error) {
+		return s.createOrganization(ctx, req)
+	})
+}
+
+func (s *OrganizationService) createOrganization(ctx context.Context, req *base.CreateOrganizationRequest) (*base.CreateOrganizationResponse, error) {
 	logger := logging.GetLogger(ctx)
 	logger.Infof("Creating organization")
 
-	// Create document in collection
-	var organization model.Organization
-	ctxWithReturnNew := driver.WithReturnNew(ctx, &organization)
-	meta, err := s.Collection.CreateDocument(ctxWithReturnNew, req.GetOrganization())
+	var response *base.CreateOrganizationResponse
+	err := s.Changes.transact(ctx, duplicateCheckCollections(s.Collection.Name(), req.GetFailOnDuplicate()), func(ctx context.Context) error {
+		// Look up existing organizations resembling the new one
+		duplicates, err := findNamedDuplicates(ctx, s.DBClient, s.Collection.Name(), []string{"name_keys"}, []string{req.GetOrganization().GetName()}, organizationNormalizedName)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("failed to look up possible duplicate organizations")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		if req.GetFailOnDuplicate() && len(duplicates) > 0 {
+			logger.WithFields(logrus.Fields{
+				"duplicates": len(duplicates),
+			}).Info("organization has possible duplicates")
+			return duplicateError(duplicates)
+		}
+
+		// Create document in collection
+		var organization model.Organization
+		ctxWithReturnNew := driver.WithReturnNew(ctx, &organization)
+		meta, err := s.Collection.CreateDocument(ctxWithReturnNew, newOrganizationDocument(req.GetOrganization()))
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("failed to create organization document")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+
+		organization.Id = meta.ID.String()
+		organization.Key = meta.Key
+		organization.Rev = meta.Rev
+		response = &base.CreateOrganizationResponse{Organization: &organization, PossibleDuplicates: duplicates}
+		return nil
+	})
 	if err != nil {
-		logger.WithFields(logrus.Fields{
-			"error": err,
-		}).Error("failed to create organization document")
-		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		return nil, changeError(ctx, err, "failed to create organization")
 	}
-
-	organization.Id = meta.ID.String()
-	organization.Key = meta.Key
-	organization.Rev = meta.Rev
-	return &base.CreateOrganizationResponse{Organization: &organization}, nil
+	return response, nil
 }
 
 func (s *OrganizationService) UpdateOrganization(ctx context.Context, req *base.UpdateOrganizationRequest) (*base.UpdateOrganizationResponse, error) {
@@ -93,7 +156,7 @@ func (s *OrganizationService) UpdateOrganization(ctx context.Context, req *base.
 	// Update document in collection
 	var organization model.Organization
 	ctxWithReturnNew := driver.WithReturnNew(ctx, &organization)
-	meta, err := s.Collection.UpdateDocument(ctxWithReturnNew, req.GetOrganization().GetKey(), req.GetOrganization())
+	meta, err := s.Collection.UpdateDocument(ctxWithReturnNew, req.GetOrganization().GetKey(), newOrganizationDocument(req.GetOrganization()))
 	if err != nil {
 		if driver.IsNotFoundGeneral(err) {
 			logger.WithFields(logrus.Fields{
@@ -119,8 +182,14 @@ func (s *OrganizationService) DeleteOrganization(ctx context.Context, req *base.
 	logger := logging.GetLogger(ctx)
 	logger.Infof("Deleting organization with Key: %s", req.GetKey())
 
-	// Remove document from collection
-	_, err := s.Collection.RemoveDocument(ctx, req.GetKey())
+	// Remove document from collection with its citations
+	err := s.Changes.transact(ctx, driver.TransactionCollections{Write: []string{s.Collection.Name(), ProvenanceCollection}}, func(ctx context.Context) error {
+		meta, err := s.Collection.RemoveDocument(ctx, req.GetKey())
+		if err != nil {
+			return err
+		}
+		return removeCitations(ctx, s.DBClient.DB, s.Changes, []string{meta.ID.String()})
+	})
 	if err != nil {
 		if driver.IsNotFoundGeneral(err) {
 			logger.WithFields(logrus.Fields{
@@ -138,3 +207,242 @@ func (s *OrganizationService) DeleteOrganization(ctx context.Context, req *base.
 
 	return &base.DeleteOrganizationResponse{}, nil
 }
+
+func (s *OrganizationService) UpsertOrganization(ctx context.Context, req *base.UpsertOrganizationRequest) (*base.UpsertOrganizationResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Upserting organization with name: %s", req.GetOrganization().GetName())
+
+	if req.GetOrganization().GetName() == "" {
+		logger.Error("organization name is empty")
+		return nil, status.Errorf(codes.InvalidArgument, "Bad parameter")
+	}
+
+	// Using AQL query to insert or merge the document matched by its normalized
+	// name and legal form, as "Acme Inc" and "Acme GmbH" are distinct companies
+	query := `
+		LET doc = UNSET(@doc, "_id", "_key", "_rev")
+		UPSERT { normalized_name: doc.normalized_name, legal_form: doc.legal_form }
+		INSERT doc
+		UPDATE doc
+		IN @@collection OPTIONS { exclusive: true }
+		RETURN { doc: NEW, created: OLD == null }
+	`
+
+	var result struct {
+		Doc     model.Organization `json:"doc"`
+		Created bool               `json:"created"`
+	}
+	err := s.Changes.transact(ctx, driver.TransactionCollections{Exclusive: []string{s.Collection.Name()}}, func(ctx context.Context) error {
+		cursor, err := s.DBClient.DB.Query(ctx, query, map[string]interface{}{
+			"doc":         newOrganizationDocument(req.GetOrganization()),
+			"@collection": s.Collection.Name(),
+		})
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"data":  req.GetOrganization(),
+			}).Error("failed to execute AQL query for upserting organization")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		defer cursor.Close()
+
+		if _, err := cursor.ReadDocument(ctx, &result); err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"name":  req.GetOrganization().GetName(),
+			}).Error("failed to read upserted organization document")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+
+		operation := ChangeUpdate
+		if result.Created {
+			operation = ChangeCreate
+		}
+		return s.Changes.recordWrite(ctx, s.Collection.Name(), operation, driver.DocumentMeta{
+			Key: result.Doc.Key,
+			ID:  driver.DocumentID(result.Doc.Id),
+			Rev: result.Doc.Rev,
+		}, nil)
+	})
+	if err != nil {
+		return nil, changeError(ctx, err, "failed to upsert organization")
+	}
+
+	return &base.UpsertOrganizationResponse{Organization: &result.Doc, Created: result.Created}, nil
+}
+
+func (s *OrganizationService) BatchCreateOrganizations(ctx context.Context, req *base.BatchCreateOrganizationsRequest) (*base.BatchCreateOrganizationsResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch creating %d organizations", len(req.GetOrganizations()))
+
+	if err := checkBatchSize(len(req.GetOrganizations())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetOrganizations()))
+		return nil, err
+	}
+
+	docs := make([]*organizationDocument, len(req.GetOrganizations()))
+	for i, organization := range req.GetOrganizations() {
+		docs[i] = newOrganizationDocument(organization)
+	}
+
+	// Create documents in collection
+	organizations := make([]model.Organization, len(req.GetOrganizations()))
+	metas := make(driver.DocumentMetaSlice, len(req.GetOrganizations()))
+	errs := make([]error, len(req.GetOrganizations()))
+	err := runBatch(ctx, s.DBClient.DB, []string{s.Collection.Name()}, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		created, itemErrs, err := s.Collection.CreateDocuments(driver.WithReturnNew(ctx, organizations), docs)
+		copy(metas, created)
+		copy(errs, itemErrs)
+		return err
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to create organization documents")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	response := &base.BatchCreateOrganizationsResponse{}
+	for i := range organizations {
+		result := &base.BatchOrganizationResult{Error: batchError(errs[i])}
+		if errs[i] == nil {
+			organizations[i].Id = metas[i].ID.String()
+			organizations[i].Key = metas[i].Key
+			organizations[i].Rev = metas[i].Rev
+			result.Organization = &organizations[i]
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+func (s *OrganizationService) BatchUpdateOrganizations(ctx context.Context, req *base.BatchUpdateOrganizationsRequest) (*base.BatchUpdateOrganizationsResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch updating %d organizations", len(req.GetOrganizations()))
+
+	if err := checkBatchSize(len(req.GetOrganizations())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetOrganizations()))
+		return nil, err
+	}
+
+	// Items without a key never reach the database
+	errs := make([]error, len(req.GetOrganizations()))
+	var keys []string
+	var patches []*organizationDocument
+	var positions []int
+	for i, organization := range req.GetOrganizations() {
+		if organization.GetKey() == "" {
+			errs[i] = errMissingKey
+			continue
+		}
+		keys = append(keys, organization.GetKey())
+		patches = append(patches, newOrganizationDocument(organization))
+		positions = append(positions, i)
+	}
+
+	// Update documents in collection
+	updated := make([]model.Organization, len(keys))
+	err := runBatch(ctx, s.DBClient.DB, []string{s.Collection.Name()}, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		if len(keys) == 0 {
+			return nil
+		}
+
+		metas, itemErrs, err := s.Collection.UpdateDocuments(driver.WithReturnNew(ctx, updated), keys, patches)
+		if err != nil {
+			return err
+		}
+
+		for j, position := range positions {
+			errs[position] = itemErrs[j]
+			if itemErrs[j] == nil {
+				updated[j].Id = metas[j].ID.String()
+				updated[j].Key = metas[j].Key
+				updated[j].Rev = metas[j].Rev
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to update organization documents")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	organizations := make([]*model.Organization, len(req.GetOrganizations()))
+	for j, position := range positions {
+		organizations[position] = &updated[j]
+	}
+
+	response := &base.BatchUpdateOrganizationsResponse{}
+	for i := range organizations {
+		result := &base.BatchOrganizationResult{Error: batchError(errs[i])}
+		if errs[i] == nil {
+			result.Organization = organizations[i]
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+func (s *OrganizationService) BatchDeleteOrganizations(ctx context.Context, req *base.BatchDeleteOrganizationsRequest) (*base.BatchDeleteOrganizationsResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch deleting %d organizations", len(req.GetKeys()))
+
+	if err := checkBatchSize(len(req.GetKeys())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetKeys()))
+		return nil, err
+	}
+
+	// Items without a key never reach the database
+	errs := make([]error, len(req.GetKeys()))
+	var keys []string
+	var positions []int
+	for i, key := range req.GetKeys() {
+		if key == "" {
+			errs[i] = errMissingKey
+			continue
+		}
+		keys = append(keys, key)
+		positions = append(positions, i)
+	}
+
+	// Remove documents from collection with their citations
+	collections := []string{s.Collection.Name(), ProvenanceCollection}
+	err := runBatch(ctx, s.DBClient.DB, collections, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		if len(keys) == 0 {
+			return nil
+		}
+
+		return s.Changes.transact(ctx, driver.TransactionCollections{Write: collections}, func(ctx context.Context) error {
+			metas, itemErrs, err := s.Collection.RemoveDocuments(ctx, keys)
+			if err != nil {
+				return err
+			}
+
+			var ids []string
+			for j, position := range positions {
+				errs[position] = itemErrs[j]
+				if itemErrs[j] == nil {
+					ids = append(ids, metas[j].ID.String())
+				}
+			}
+			return removeCitations(ctx, s.DBClient.DB, s.Changes, ids)
+		})
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to delete organization documents")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	response := &base.BatchDeleteOrganizationsResponse{}
+	for i, key := range req.GetKeys() {
+		response.Results = append(response.Results, &base.BatchDeleteResult{
+			Key:   key,
+			Error: batchError(errs[i]),
+		})
+	}
+	return response, nil
+}
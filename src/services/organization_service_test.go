@@ -7,6 +7,8 @@ import (
     "github.com/omnsight/omnibasement/gen/base/v1"
     "github.com/omnsight/omniscent-library/gen/model/v1"
     "github.com/omnsight/omniscent-library/src/clients"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
 )
 
 func TestOrganizationService(t *testing.T) {
@@ -21,8 +23,18 @@ func TestOrganizationService(t *testing.T) {
 		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
 	}
 
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
 	// Create OrganizationService
-	service, err := NewOrganizationService(client)
+	service, err := NewOrganizationService(client, idempotency, changes)
 	if err != nil {
 		t.Fatalf("Failed to create OrganizationService: %v", err)
 	}
@@ -124,3 +136,187 @@ func TestOrganizationService(t *testing.T) {
 		}
 	})
 }
+
+func TestCreateOrganizationDuplicates(t *testing.T) {
+	// Skip test if ArangoDB is not available
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	// Create ArangoDB client
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
+	// Create OrganizationService
+	service, err := NewOrganizationService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create OrganizationService: %v", err)
+	}
+
+	ctx := context.Background()
+	existing, err := service.CreateOrganization(ctx, &base.CreateOrganizationRequest{
+		Organization: &model.Organization{Name: "Acme Corporation"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create organization: %v", err)
+	}
+	defer service.DeleteOrganization(ctx, &base.DeleteOrganizationRequest{Key: existing.Organization.Key})
+
+	t.Run("Warning", func(t *testing.T) {
+		resp, err := service.CreateOrganization(ctx, &base.CreateOrganizationRequest{
+			Organization: &model.Organization{Name: "ACME Corp"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create organization: %v", err)
+		}
+		defer service.DeleteOrganization(ctx, &base.DeleteOrganizationRequest{Key: resp.Organization.Key})
+
+		found := false
+		for _, duplicate := range resp.PossibleDuplicates {
+			if duplicate.Id == existing.Organization.Id {
+				found = duplicate.Score >= possibleDuplicateThreshold && duplicate.Name == "Acme Corporation"
+			}
+		}
+		if !found {
+			t.Errorf("Expected %s among the possible duplicates, got %v", existing.Organization.Id, resp.PossibleDuplicates)
+		}
+	})
+
+	t.Run("Fail On Duplicate", func(t *testing.T) {
+		_, err := service.CreateOrganization(ctx, &base.CreateOrganizationRequest{
+			Organization:    &model.Organization{Name: "ACME Corp"},
+			FailOnDuplicate: true,
+		})
+		if status.Code(err) != codes.AlreadyExists {
+			t.Fatalf("Expected AlreadyExists error, got %v", err)
+		}
+
+		var duplicates []*base.PossibleDuplicate
+		for _, detail := range status.Convert(err).Details() {
+			if d, ok := detail.(*base.PossibleDuplicates); ok {
+				duplicates = d.Duplicates
+			}
+		}
+		if len(duplicates) == 0 {
+			t.Errorf("Expected the possible duplicates in the error details")
+		}
+	})
+
+	t.Run("Diacritics", func(t *testing.T) {
+		accented, err := service.CreateOrganization(ctx, &base.CreateOrganizationRequest{
+			Organization: &model.Organization{Name: "Société Générale Zyxwv"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create organization: %v", err)
+		}
+		defer service.DeleteOrganization(ctx, &base.DeleteOrganizationRequest{Key: accented.Organization.Key})
+
+		_, err = service.CreateOrganization(ctx, &base.CreateOrganizationRequest{
+			Organization:    &model.Organization{Name: "Societe Generale Zyxwv SA"},
+			FailOnDuplicate: true,
+		})
+		if status.Code(err) != codes.AlreadyExists {
+			t.Errorf("Expected AlreadyExists error, got %v", err)
+		}
+	})
+
+	t.Run("Distinct", func(t *testing.T) {
+		resp, err := service.CreateOrganization(ctx, &base.CreateOrganizationRequest{
+			Organization:    &model.Organization{Name: "Zyxwv Holdings Unrelated"},
+			FailOnDuplicate: true,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create organization: %v", err)
+		}
+		defer service.DeleteOrganization(ctx, &base.DeleteOrganizationRequest{Key: resp.Organization.Key})
+	})
+}
+
+func TestOrganizationNames(t *testing.T) {
+	// Skip test if ArangoDB is not available
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	// Create ArangoDB client
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
+	// Create OrganizationService
+	service, err := NewOrganizationService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create OrganizationService: %v", err)
+	}
+
+	ctx := context.Background()
+	created, err := service.CreateOrganization(ctx, &base.CreateOrganizationRequest{
+		Organization: &model.Organization{Name: "Normalized Widgets, Inc."},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create organization: %v", err)
+	}
+	defer service.DeleteOrganization(ctx, &base.DeleteOrganizationRequest{Key: created.Organization.Key})
+
+	t.Run("Stored", func(t *testing.T) {
+		var doc struct {
+			NormalizedName string `json:"normalized_name"`
+			LegalForm      string `json:"legal_form"`
+		}
+		if _, err := service.Collection.ReadDocument(ctx, created.Organization.Key, &doc); err != nil {
+			t.Fatalf("Failed to read organization: %v", err)
+		}
+		if doc.NormalizedName != "normalized widgets" || doc.LegalForm != "Inc" {
+			t.Errorf("Expected normalized name %q and legal form %q, got %q and %q", "normalized widgets", "Inc", doc.NormalizedName, doc.LegalForm)
+		}
+	})
+
+	t.Run("Upsert", func(t *testing.T) {
+		for _, name := range []string{"NORMALIZED WIDGETS INC", "Normalized Widgets Incorporated"} {
+			resp, err := service.UpsertOrganization(ctx, &base.UpsertOrganizationRequest{
+				Organization: &model.Organization{Name: name},
+			})
+			if err != nil {
+				t.Fatalf("Failed to upsert organization: %v", err)
+			}
+			if resp.Created || resp.Organization.Key != created.Organization.Key {
+				t.Errorf("Expected %q to match %s, got %v", name, created.Organization.Key, resp.Organization)
+			}
+		}
+
+		// Another legal form is another organization
+		resp, err := service.UpsertOrganization(ctx, &base.UpsertOrganizationRequest{
+			Organization: &model.Organization{Name: "Normalized Widgets GmbH"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to upsert organization: %v", err)
+		}
+		defer service.DeleteOrganization(ctx, &base.DeleteOrganizationRequest{Key: resp.Organization.Key})
+		if !resp.Created || resp.Organization.Key == created.Organization.Key {
+			t.Errorf("Expected %q to create another organization, got %v", "Normalized Widgets GmbH", resp.Organization)
+		}
+	})
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// OutboxCollection holds the changes waiting to be published.
+	OutboxCollection = "outbox"
+	// OutboxPublisher is the environment variable naming the publisher of the
+	// outbox in Publishers. Changes are only written to the outbox when it is
+	// set.
+	OutboxPublisher = "OUTBOX_PUBLISHER"
+
+	outboxPollInterval = time.Second
+	outboxBatchSize    = 100
+	outboxRetryBase    = time.Second
+	outboxRetryMax     = time.Minute
+)
+
+// OutboxMessage is a change published to a message broker.
+type OutboxMessage struct {
+	// ID is the cursor of the change, identical when a message is published again
+	ID string
+	// Topic is the event type of the change, such as "persons.create"
+	Topic string
+	// Key is the ID of the changed document. Messages with the same key are
+	// published in the order of their changes.
+	Key string
+	// Payload is the change in the JSON representation of the change feed
+	Payload []byte
+}
+
+// Publisher sends outbox messages to a message broker.
+type Publisher interface {
+	// Publish returns nil once the broker accepted every message. Messages
+	// are published again after an error, so delivery is at-least-once.
+	Publish(ctx context.Context, messages []*OutboxMessage) error
+}
+
+// Publishers creates the publishers selectable with OutboxPublisher.
+// Publishers of message brokers register themselves here.
+var Publishers = map[string]func() (Publisher, error){}
+
+// NewPublisher creates the publisher named by OutboxPublisher, or returns nil
+// if it is not set.
+func NewPublisher() (Publisher, error) {
+	name := os.Getenv(OutboxPublisher)
+	if name == "" {
+		return nil, nil
+	}
+
+	create, ok := Publishers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown %s value %q", OutboxPublisher, name)
+	}
+	return create()
+}
+
+// InProcessPublisher keeps the published messages in memory.
+type InProcessPublisher struct {
+	mu       sync.Mutex
+	messages []*OutboxMessage
+	err      error
+}
+
+func NewInProcessPublisher() *InProcessPublisher {
+	return &InProcessPublisher{}
+}
+
+func (p *InProcessPublisher) Publish(ctx context.Context, messages []*OutboxMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.messages = append(p.messages, messages...)
+	return nil
+}
+
+// Messages returns the messages published so far.
+func (p *InProcessPublisher) Messages() []*OutboxMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*OutboxMessage(nil), p.messages...)
+}
+
+// SetErr makes Publish fail with err, as if the broker was unavailable, or
+// succeed again if err is nil.
+func (p *InProcessPublisher) SetErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// OutboxRelay publishes the outbox in the order of the changes and removes
+// the records once they are published. A single relay should run at a time
+// to preserve the order.
+type OutboxRelay struct {
+	DBClient  *clients.ArangoDBClient
+	Outbox    driver.Collection
+	Publisher Publisher
+
+	// RetryBase is the delay after a failed publish, doubling with every
+	// failure in a row up to RetryMax
+	RetryBase time.Duration
+	RetryMax  time.Duration
+}
+
+func NewOutboxRelay(client *clients.ArangoDBClient, publisher Publisher) (*OutboxRelay, error) {
+	outbox, err := GetCreateDocumentCollection(context.Background(), client, OutboxCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get or create %s collection: %v", OutboxCollection, err)
+	}
+
+	relay := &OutboxRelay{
+		DBClient:  client,
+		Outbox:    outbox,
+		Publisher: publisher,
+		RetryBase: outboxRetryBase,
+		RetryMax:  outboxRetryMax,
+	}
+	return relay, nil
+}
+
+// Run relays the outbox until ctx is done.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	delay := time.Duration(0)
+	for {
+		wake := changeSignal.wait()
+
+		relayed, err := r.RelayOnce(ctx)
+		if err != nil {
+			delay = min(max(2*delay, r.RetryBase), r.RetryMax)
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+				"retry": delay,
+			}).Error("failed to relay outbox")
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			continue
+		}
+		delay = 0
+
+		if relayed == outboxBatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce publishes the oldest records of the outbox and returns how many
+// it published.
+func (r *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	records, err := queryAll[changeRecord](ctx, r.DBClient.DB, "FOR c IN @@collection SORT c._key LIMIT @limit RETURN c", map[string]interface{}{
+		"limit":       outboxBatchSize,
+		"@collection": r.Outbox.Name(),
+	})
+	if err != nil || len(records) == 0 {
+		return 0, err
+	}
+
+	messages := make([]*OutboxMessage, len(records))
+	keys := make([]string, len(records))
+	for i, record := range records {
+		change, err := record.toChange()
+		if err != nil {
+			return 0, err
+		}
+		payload, err := protojson.Marshal(change)
+		if err != nil {
+			return 0, err
+		}
+
+		messages[i] = &OutboxMessage{
+			ID:      record.Key,
+			Topic:   changeEventType(record),
+			Key:     record.DocumentID,
+			Payload: payload,
+		}
+		keys[i] = record.Key
+	}
+
+	if err := r.Publisher.Publish(ctx, messages); err != nil {
+		return 0, err
+	}
+
+	// Records that cannot be removed are published again
+	_, errs, err := r.Outbox.RemoveDocuments(ctx, keys)
+	if err != nil {
+		return 0, err
+	}
+	for i, err := range errs {
+		if err != nil && !driver.IsNotFoundGeneral(err) {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+				"key":   keys[i],
+			}).Warn("failed to remove published outbox record, it will be published again")
+		}
+	}
+	return len(records), nil
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestOutboxRelay(t *testing.T) {
+	// Skip test if ArangoDB is not available
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	// Create ArangoDB client
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
+	// Changes are written to the outbox of services created with a publisher
+	t.Setenv(OutboxPublisher, "test")
+	personService, err := NewPersonService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create PersonService: %v", err)
+	}
+
+	publisher := NewInProcessPublisher()
+	relay, err := NewOutboxRelay(client, publisher)
+	if err != nil {
+		t.Fatalf("Failed to create OutboxRelay: %v", err)
+	}
+
+	ctx := context.Background()
+	relayAll := func() {
+		for {
+			n, err := relay.RelayOnce(ctx)
+			if err != nil {
+				t.Fatalf("Failed to relay outbox: %v", err)
+			}
+			if n < outboxBatchSize {
+				return
+			}
+		}
+	}
+	published := func(id, topic string) []*OutboxMessage {
+		var messages []*OutboxMessage
+		for _, message := range publisher.Messages() {
+			if message.Key == id && message.Topic == topic {
+				messages = append(messages, message)
+			}
+		}
+		return messages
+	}
+
+	// Publish what earlier writes left in the outbox
+	relayAll()
+
+	created, err := personService.CreatePerson(ctx, &base.CreatePersonRequest{
+		Person: &model.Person{Name: "Outbox Person", Role: "Analyst"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create person: %v", err)
+	}
+	defer personService.DeletePerson(ctx, &base.DeletePersonRequest{Key: created.Person.Key})
+
+	t.Run("Publish", func(t *testing.T) {
+		relayAll()
+
+		messages := published(created.Person.Id, "persons.create")
+		if len(messages) != 1 {
+			t.Fatalf("Expected 1 published create, got %d", len(messages))
+		}
+
+		var change base.Change
+		if err := protojson.Unmarshal(messages[0].Payload, &change); err != nil {
+			t.Fatalf("Failed to decode payload: %v", err)
+		}
+		if change.Cursor != messages[0].ID || change.Key != created.Person.Key {
+			t.Errorf("Unexpected change %v", &change)
+		}
+		if change.Document.GetFields()["name"].GetStringValue() != "Outbox Person" {
+			t.Errorf("Expected the person document in the change, got %v", change.Document)
+		}
+	})
+
+	t.Run("Broker Unavailable", func(t *testing.T) {
+		_, err := personService.UpdatePerson(ctx, &base.UpdatePersonRequest{
+			Key:    created.Person.Key,
+			Person: &model.Person{Key: created.Person.Key, Name: "Outbox Person", Role: "Manager"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to update person: %v", err)
+		}
+
+		publisher.SetErr(errors.New("broker unavailable"))
+		if _, err := relay.RelayOnce(ctx); err == nil {
+			t.Errorf("Expected relay to fail while the broker is unavailable")
+		}
+		if len(published(created.Person.Id, "persons.update")) != 0 {
+			t.Errorf("Expected no published update while the broker is unavailable")
+		}
+
+		publisher.SetErr(nil)
+		relayAll()
+		if len(published(created.Person.Id, "persons.update")) != 1 {
+			t.Errorf("Expected the update to be published once the broker is available")
+		}
+	})
+
+	t.Run("Rolled Back", func(t *testing.T) {
+		before := len(published(created.Person.Id, "persons.update"))
+
+		resp, err := personService.BatchUpdatePersons(ctx, &base.BatchUpdatePersonsRequest{
+			Persons: []*model.Person{
+				{Key: created.Person.Key, Role: "Director"},
+				{Key: "does_not_exist", Role: "Director"},
+			},
+			AllOrNothing: true,
+		})
+		if err != nil {
+			t.Fatalf("Failed to batch update persons: %v", err)
+		}
+		if resp.Results[0].Error == nil {
+			t.Fatalf("Expected the update to be rolled back")
+		}
+
+		relayAll()
+		if len(published(created.Person.Id, "persons.update")) != before {
+			t.Errorf("Expected no published change for a rolled back update")
+		}
+	})
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Weights of the signals of a duplicate score. Signals that are unknown for
+// one of the persons do not count.
+const (
+	nameWeight        = 0.4
+	phoneticWeight    = 0.2
+	birthDateWeight   = 0.15
+	nationalityWeight = 0.1
+	neighborsWeight   = 0.15
+)
+
+// personProfile holds the fields of a person compared to find duplicates.
+type personProfile struct {
+	ID          string   `json:"_id"`
+	Name        string   `json:"name"`
+	Aliases     []string `json:"aliases"`
+	BirthDate   int64    `json:"birth_date"`
+	Nationality string   `json:"nationality"`
+
+	names []string
+	// Blocking keys: Soundex codes of the Latin words of the names, and the
+	// words themselves where no Latin reading exists
+	codes []string
+}
+
+// duplicateScores are the signals of a duplicate score between 0 and 1, or -1
+// when unknown.
+type duplicateScores struct {
+	Name        float64 `json:"name"`
+	Phonetic    float64 `json:"phonetic"`
+	BirthDate   float64 `json:"birth_date"`
+	Nationality float64 `json:"nationality"`
+	Neighbors   float64 `json:"neighbors"`
+}
+
+// prepare computes the normalized names and blocking keys of p. Names in
+// other scripts are compared both as written and transliterated.
+func (p *personProfile) prepare() {
+	for _, name := range append([]string{p.Name}, p.Aliases...) {
+		for _, normalized := range []string{normalizedName(name), normalizedName(transliterate(name))} {
+			if normalized != "" && !slices.Contains(p.names, normalized) {
+				p.names = append(p.names, normalized)
+			}
+		}
+		// The keys match the phonetic and token keys of the name in the index
+		for _, token := range nameTokens(transliterate(name)) {
+			code := soundex(token)
+			if code == "" {
+				code = token
+			}
+			if !slices.Contains(p.codes, code) {
+				p.codes = append(p.codes, code)
+			}
+		}
+	}
+}
+
+// scoreNames returns the name and phonetic signals of a and b.
+func scoreNames(a, b *personProfile) duplicateScores {
+	scores := duplicateScores{BirthDate: -1, Nationality: -1, Neighbors: -1}
+	scores.Name = nameSimilarity(a.names, b.names)
+	scores.Phonetic = jaccard(a.codes, b.codes)
+	return scores
+}
+
+// scorePersons completes the name signals of a and b with the signals of
+// their other fields and the IDs of their neighbors in the graph.
+func scorePersons(a, b *personProfile, scores duplicateScores, neighborsA, neighborsB []string) duplicateScores {
+	if a.BirthDate != 0 && b.BirthDate != 0 {
+		x, y := time.Unix(a.BirthDate, 0).UTC(), time.Unix(b.BirthDate, 0).UTC()
+		switch {
+		case x.Format(time.DateOnly) == y.Format(time.DateOnly):
+			scores.BirthDate = 1
+		case x.Year() == y.Year():
+			scores.BirthDate = 0.5
+		default:
+			scores.BirthDate = 0
+		}
+	}
+	if a.Nationality != "" && b.Nationality != "" {
+		scores.Nationality = 0
+		if strings.EqualFold(a.Nationality, b.Nationality) {
+			scores.Nationality = 1
+		}
+	}
+	if len(neighborsA) > 0 && len(neighborsB) > 0 {
+		scores.Neighbors = jaccard(neighborsA, neighborsB)
+	}
+	return scores
+}
+
+// total returns the weighted average of the known signals.
+func (s duplicateScores) total() float64 {
+	var sum, weights float64
+	for _, signal := range []struct{ score, weight float64 }{
+		{s.Name, nameWeight},
+		{s.Phonetic, phoneticWeight},
+		{s.BirthDate, birthDateWeight},
+		{s.Nationality, nationalityWeight},
+		{s.Neighbors, neighborsWeight},
+	} {
+		if signal.score >= 0 {
+			sum += signal.score * signal.weight
+			weights += signal.weight
+		}
+	}
+	return sum / weights
+}
+
+// normalizedName returns the words of name as nameTokens does, sorted so that
+// names written surname first match.
+func normalizedName(name string) string {
+	tokens := nameTokens(name)
+	slices.Sort(tokens)
+	return strings.Join(tokens, " ")
+}
+
+// nameSimilarity returns the best similarity of the normalized names of a and b.
+func nameSimilarity(a, b []string) float64 {
+	var best float64
+	for _, x := range a {
+		for _, y := range b {
+			best = max(best, jaroWinkler(x, y))
+		}
+	}
+	return best
+}
+
+// nameTokens returns the words of name in lower case without diacritics or
+// punctuation.
+func nameTokens(name string) []string {
+	folded, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), name)
+	if err != nil {
+		folded = name
+	}
+	return strings.FieldsFunc(strings.ToLower(folded), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// soundex returns the American Soundex code of a word of Latin letters, or ""
+// if it starts with another character.
+func soundex(word string) string {
+	const codes = "01230120022455012623010202"
+
+	var code []byte
+	var last byte
+	for i, r := range word {
+		if r < 'a' || r > 'z' {
+			if i == 0 {
+				return ""
+			}
+			continue
+		}
+		digit := codes[r-'a']
+		if i == 0 {
+			code = append(code, byte(unicode.ToUpper(r)))
+		} else if digit != '0' && digit != last {
+			code = append(code, digit)
+		}
+		// H and W do not separate letters with the same code
+		if r != 'h' && r != 'w' {
+			last = digit
+		}
+		if len(code) == 4 {
+			break
+		}
+	}
+	for len(code) < 4 {
+		code = append(code, '0')
+	}
+	return string(code)
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of a and b.
+func jaroWinkler(a, b string) float64 {
+	x, y := []rune(a), []rune(b)
+	if len(x) == 0 || len(y) == 0 {
+		return 0
+	}
+
+	// The window is empty for one-letter strings, which match in place
+	window := max(0, max(len(x), len(y))/2-1)
+	matchedX := make([]bool, len(x))
+	matchedY := make([]bool, len(y))
+	matches := 0
+	for i := range x {
+		for j := max(0, i-window); j < min(len(y), i+window+1); j++ {
+			if !matchedY[j] && x[i] == y[j] {
+				matchedX[i], matchedY[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions := 0
+	j := 0
+	for i := range x {
+		if !matchedX[i] {
+			continue
+		}
+		for !matchedY[j] {
+			j++
+		}
+		if x[i] != y[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(x)) + m/float64(len(y)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(x), len(y)) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+// jaccard returns the Jaccard index of two sets of distinct values.
+func jaccard(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for _, value := range a {
+		if slices.Contains(b, value) {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
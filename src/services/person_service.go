@@ -17,11 +17,14 @@ import (
 type PersonService struct {
 	base.UnimplementedPersonServiceServer
 
-	DBClient   *clients.ArangoDBClient
-	Collection driver.Collection
+	DBClient    *clients.ArangoDBClient
+	Collection  driver.Collection
+	Idempotency *IdempotencyStore
+	Redirects   *RedirectStore
+	Changes     *ChangeLog
 }
 
-func NewPersonService(client *clients.ArangoDBClient) (*PersonService, error) {
+func NewPersonService(client *clients.ArangoDBClient, idempotency *IdempotencyStore, changes *ChangeLog) (*PersonService, error) {
 	// Create persons collection
 	ctx := context.Background()
 	collection, err := client.GetCreateCollection(ctx, "persons", driver.CreateVertexCollectionOptions{})
@@ -30,9 +33,26 @@ func NewPersonService(client *clients.ArangoDBClient) (*PersonService, error) {
 	}
 	fmt.Printf("✅ Initialized collection %s", collection.Name())
 
+	if err := EnsureIndexes(ctx, collection); err != nil {
+		return nil, err
+	}
+
+	redirects, err := NewRedirectStore(client)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deletes remove the citations of the deleted documents
+	if _, err := getCreateProvenanceCollection(ctx, client); err != nil {
+		return nil, fmt.Errorf("failed to get or create %s collection: %v", ProvenanceCollection, err)
+	}
+
 	service := &PersonService{
-		DBClient:   client,
-		Collection: collection,
+		DBClient:    client,
+		Collection:  changes.Watch(collection),
+		Idempotency: idempotency,
+		Redirects:   redirects,
+		Changes:     changes,
 	}
 	return service, nil
 }
@@ -41,9 +61,9 @@ func (s *PersonService) GetPerson(ctx context.Context, req *base.GetPersonReques
 	logger := logging.GetLogger(ctx)
 	logger.Infof("Getting person with ID: %s", req.GetKey())
 
-	// Read document from collection
+	// Read document from collection, resolving persons merged into another person
 	var person model.Person
-	meta, err := s.Collection.ReadDocument(ctx, req.GetKey(), &person)
+	meta, err := s.Redirects.ReadDocument(ctx, s.Collection, req.GetKey(), &person)
 	if err != nil {
 		if driver.IsNotFoundGeneral(err) {
 			logger.WithFields(logrus.Fields{
@@ -62,28 +82,71 @@ func (s *PersonService) GetPerson(ctx context.Context, req *base.GetPersonReques
 	person.Id = meta.ID.String()
 	person.Key = meta.Key
 	person.Rev = meta.Rev
-	return &base.GetPersonResponse{Person: &person}, nil
+	response := &base.GetPersonResponse{Person: &person}
+	if req.GetIncludeCitations() {
+		citations, err := listCitations(ctx, s.DBClient.DB, person.Id)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"key":   req.GetKey(),
+			}).Error("failed to list person citations")
+			return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		response.Citations = citations
+	}
+	return response, nil
 }
 
 func (s *PersonService) CreatePerson(ctx context.Context, req *base.CreatePersonRequest) (*base.CreatePersonResponse, error) {
+	return WithIdempotency(ctx, s.Idempotency, "CreatePerson", req, func(resp *base.CreatePersonResponse) string {
+		return resp.GetPerson().GetId()
+	}, func() (*base.CreatePersonResponse, error) {
+		return s.createPerson(ctx, req)
+	})
+}
+
+func (s *PersonService) createPerson(ctx context.Context, req *base.CreatePersonRequest) (*base.CreatePersonResponse, error) {
 	logger := logging.GetLogger(ctx)
 	logger.Infof("Creating person")
 
-	// Create document in collection
-	var person model.Person
-	ctxWithReturnNew := driver.WithReturnNew(ctx, &person)
-	meta, err := s.Collection.CreateDocument(ctxWithReturnNew, req.GetPerson())
+	var response *base.CreatePersonResponse
+	err := s.Changes.transact(ctx, duplicateCheckCollections(s.Collection.Name(), req.GetFailOnDuplicate()), func(ctx context.Context) error {
+		// Look up existing persons resembling the new one
+		duplicates, err := findNamedDuplicates(ctx, s.DBClient, s.Collection.Name(), []string{"name_keys", "alias_keys"}, append([]string{req.GetPerson().GetName()}, req.GetPerson().GetAliases()...), normalizedName)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("failed to look up possible duplicate persons")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		if req.GetFailOnDuplicate() && len(duplicates) > 0 {
+			logger.WithFields(logrus.Fields{
+				"duplicates": len(duplicates),
+			}).Info("person has possible duplicates")
+			return duplicateError(duplicates)
+		}
+
+		// Create document in collection
+		var person model.Person
+		ctxWithReturnNew := driver.WithReturnNew(ctx, &person)
+		meta, err := s.Collection.CreateDocument(ctxWithReturnNew, newPersonDocument(req.GetPerson()))
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("failed to create person document")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+
+		person.Id = meta.ID.String()
+		person.Key = meta.Key
+		person.Rev = meta.Rev
+		response = &base.CreatePersonResponse{Person: &person, PossibleDuplicates: duplicates}
+		return nil
+	})
 	if err != nil {
-		logger.WithFields(logrus.Fields{
-			"error": err,
-		}).Error("failed to create person document")
-		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		return nil, changeError(ctx, err, "failed to create person")
 	}
-
-	person.Id = meta.ID.String()
-	person.Key = meta.Key
-	person.Rev = meta.Rev
-	return &base.CreatePersonResponse{Person: &person}, nil
+	return response, nil
 }
 
 func (s *PersonService) UpdatePerson(ctx context.Context, req *base.UpdatePersonRequest) (*base.UpdatePersonResponse, error) {
@@ -93,7 +156,7 @@ func (s *PersonService) UpdatePerson(ctx context.Context, req *base.UpdatePerson
 	// Update document in collection
 	var person model.Person
 	ctxWithReturnNew := driver.WithReturnNew(ctx, &person)
-	meta, err := s.Collection.UpdateDocument(ctxWithReturnNew, req.GetPerson().GetKey(), req.GetPerson())
+	meta, err := s.Collection.UpdateDocument(ctxWithReturnNew, req.GetPerson().GetKey(), newPersonDocument(req.GetPerson()))
 	if err != nil {
 		if driver.IsNotFoundGeneral(err) {
 			logger.WithFields(logrus.Fields{
@@ -119,8 +182,14 @@ func (s *PersonService) DeletePerson(ctx context.Context, req *base.DeletePerson
 	logger := logging.GetLogger(ctx)
 	logger.Infof("Deleting person with Key: %s", req.GetKey())
 
-	// Remove document from collection
-	_, err := s.Collection.RemoveDocument(ctx, req.GetKey())
+	// Remove document from collection with its citations
+	err := s.Changes.transact(ctx, driver.TransactionCollections{Write: []string{s.Collection.Name(), ProvenanceCollection}}, func(ctx context.Context) error {
+		meta, err := s.Collection.RemoveDocument(ctx, req.GetKey())
+		if err != nil {
+			return err
+		}
+		return removeCitations(ctx, s.DBClient.DB, s.Changes, []string{meta.ID.String()})
+	})
 	if err != nil {
 		if driver.IsNotFoundGeneral(err) {
 			logger.WithFields(logrus.Fields{
@@ -138,3 +207,235 @@ func (s *PersonService) DeletePerson(ctx context.Context, req *base.DeletePerson
 
 	return &base.DeletePersonResponse{}, nil
 }
+
+func (s *PersonService) BatchCreatePersons(ctx context.Context, req *base.BatchCreatePersonsRequest) (*base.BatchCreatePersonsResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch creating %d persons", len(req.GetPersons()))
+
+	if err := checkBatchSize(len(req.GetPersons())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetPersons()))
+		return nil, err
+	}
+
+	docs := make([]*personDocument, len(req.GetPersons()))
+	for i, person := range req.GetPersons() {
+		docs[i] = newPersonDocument(person)
+	}
+
+	// Create documents in collection
+	persons := make([]model.Person, len(req.GetPersons()))
+	metas := make(driver.DocumentMetaSlice, len(req.GetPersons()))
+	errs := make([]error, len(req.GetPersons()))
+	err := runBatch(ctx, s.DBClient.DB, []string{s.Collection.Name()}, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		created, itemErrs, err := s.Collection.CreateDocuments(driver.WithReturnNew(ctx, persons), docs)
+		copy(metas, created)
+		copy(errs, itemErrs)
+		return err
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to create person documents")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	response := &base.BatchCreatePersonsResponse{}
+	for i := range persons {
+		result := &base.BatchPersonResult{Error: batchError(errs[i])}
+		if errs[i] == nil {
+			persons[i].Id = metas[i].ID.String()
+			persons[i].Key = metas[i].Key
+			persons[i].Rev = metas[i].Rev
+			result.Person = &persons[i]
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+func (s *PersonService) BatchUpdatePersons(ctx context.Context, req *base.BatchUpdatePersonsRequest) (*base.BatchUpdatePersonsResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch updating %d persons", len(req.GetPersons()))
+
+	if err := checkBatchSize(len(req.GetPersons())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetPersons()))
+		return nil, err
+	}
+
+	// Items without a key never reach the database
+	errs := make([]error, len(req.GetPersons()))
+	var keys []string
+	var patches []*personDocument
+	var positions []int
+	for i, person := range req.GetPersons() {
+		if person.GetKey() == "" {
+			errs[i] = errMissingKey
+			continue
+		}
+		keys = append(keys, person.GetKey())
+		patches = append(patches, newPersonDocument(person))
+		positions = append(positions, i)
+	}
+
+	// Update documents in collection
+	updated := make([]model.Person, len(keys))
+	err := runBatch(ctx, s.DBClient.DB, []string{s.Collection.Name()}, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		if len(keys) == 0 {
+			return nil
+		}
+
+		metas, itemErrs, err := s.Collection.UpdateDocuments(driver.WithReturnNew(ctx, updated), keys, patches)
+		if err != nil {
+			return err
+		}
+
+		for j, position := range positions {
+			errs[position] = itemErrs[j]
+			if itemErrs[j] == nil {
+				updated[j].Id = metas[j].ID.String()
+				updated[j].Key = metas[j].Key
+				updated[j].Rev = metas[j].Rev
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to update person documents")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	persons := make([]*model.Person, len(req.GetPersons()))
+	for j, position := range positions {
+		persons[position] = &updated[j]
+	}
+
+	response := &base.BatchUpdatePersonsResponse{}
+	for i := range persons {
+		result := &base.BatchPersonResult{Error: batchError(errs[i])}
+		if errs[i] == nil {
+			result.Person = persons[i]
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+func (s *PersonService) BatchDeletePersons(ctx context.Context, req *base.BatchDeletePersonsRequest) (*base.BatchDeletePersonsResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch deleting %d persons", len(req.GetKeys()))
+
+	if err := checkBatchSize(len(req.GetKeys())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetKeys()))
+		return nil, err
+	}
+
+	// Items without a key never reach the database
+	errs := make([]error, len(req.GetKeys()))
+	var keys []string
+	var positions []int
+	for i, key := range req.GetKeys() {
+		if key == "" {
+			errs[i] = errMissingKey
+			continue
+		}
+		keys = append(keys, key)
+		positions = append(positions, i)
+	}
+
+	// Remove documents from collection with their citations
+	collections := []string{s.Collection.Name(), ProvenanceCollection}
+	err := runBatch(ctx, s.DBClient.DB, collections, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		if len(keys) == 0 {
+			return nil
+		}
+
+		return s.Changes.transact(ctx, driver.TransactionCollections{Write: collections}, func(ctx context.Context) error {
+			metas, itemErrs, err := s.Collection.RemoveDocuments(ctx, keys)
+			if err != nil {
+				return err
+			}
+
+			var ids []string
+			for j, position := range positions {
+				errs[position] = itemErrs[j]
+				if itemErrs[j] == nil {
+					ids = append(ids, metas[j].ID.String())
+				}
+			}
+			return removeCitations(ctx, s.DBClient.DB, s.Changes, ids)
+		})
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to delete person documents")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	response := &base.BatchDeletePersonsResponse{}
+	for i, key := range req.GetKeys() {
+		response.Results = append(response.Results, &base.BatchDeleteResult{
+			Key:   key,
+			Error: batchError(errs[i]),
+		})
+	}
+	return response, nil
+}
+
+// NormalizeNames stores the search keys of all persons, for those created
+// before the keys were introduced or keyed by an older transliteration, and
+// returns the number of persons updated.
+func (s *PersonService) NormalizeNames(ctx context.Context) (int, error) {
+	query := `
+		FOR p IN @@collection
+			FILTER p._key > @after
+			SORT p._key
+			LIMIT @limit
+			RETURN KEEP(p, "_key", "name", "aliases")`
+	update := `
+		FOR u IN @updates
+			UPDATE u._key WITH { name_keys: u.name_keys, alias_keys: u.alias_keys } IN @@collection`
+
+	total := 0
+	after := ""
+	for {
+		persons, err := queryAll[model.Person](ctx, s.DBClient.DB, query, map[string]interface{}{
+			"@collection": s.Collection.Name(),
+			"after":       after,
+			"limit":       MaxBatchSize,
+		})
+		if err != nil {
+			return total, err
+		}
+		if len(persons) == 0 {
+			break
+		}
+
+		updates := make([]map[string]interface{}, len(persons))
+		for i, person := range persons {
+			doc := newPersonDocument(person)
+			updates[i] = map[string]interface{}{
+				"_key":       person.Key,
+				"name_keys":  doc.NameKeys,
+				"alias_keys": doc.AliasKeys,
+			}
+		}
+		cursor, err := s.DBClient.DB.Query(ctx, update, map[string]interface{}{
+			"@collection": s.Collection.Name(),
+			"updates":     updates,
+		})
+		if err != nil {
+			return total, err
+		}
+		cursor.Close()
+		total += len(persons)
+		after = persons[len(persons)-1].Key
+	}
+
+	if total > 0 {
+		logrus.Infof("✅ Indexed the names of %d persons", total)
+	}
+	return total, nil
+}
@@ -7,6 +7,7 @@ import (
     "github.com/omnsight/omnibasement/gen/base/v1"
     "github.com/omnsight/omniscent-library/gen/model/v1"
     "github.com/omnsight/omniscent-library/src/clients"
+    "google.golang.org/grpc/codes"
 )
 
 func TestPersonService(t *testing.T) {
@@ -21,8 +22,18 @@ func TestPersonService(t *testing.T) {
 		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
 	}
 
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
 	// Create PersonService
-	service, err := NewPersonService(client)
+	service, err := NewPersonService(client, idempotency, changes)
 	if err != nil {
 		t.Fatalf("Failed to create PersonService: %v", err)
 	}
@@ -123,4 +134,87 @@ func TestPersonService(t *testing.T) {
 			t.Error("Expected error when getting deleted person")
 		}
 	})
+
+	t.Run("Batch Operations", func(t *testing.T) {
+		// Create persons in one batch
+		createResp, err := service.BatchCreatePersons(context.Background(), &base.BatchCreatePersonsRequest{
+			Persons: []*model.Person{
+				{Name: "Batch Person 1"},
+				{Name: "Batch Person 2"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to batch create persons: %v", err)
+		}
+
+		if len(createResp.Results) != 2 {
+			t.Fatalf("Expected 2 results, got %d", len(createResp.Results))
+		}
+
+		var keys []string
+		for i, result := range createResp.Results {
+			if result.Error != nil {
+				t.Fatalf("Expected person %d to be created, got error: %s", i, result.Error.Message)
+			}
+			keys = append(keys, result.Person.Key)
+		}
+
+		// Update with one unknown key, each item reports its own outcome
+		updateResp, err := service.BatchUpdatePersons(context.Background(), &base.BatchUpdatePersonsRequest{
+			Persons: []*model.Person{
+				{Key: keys[0], Role: "Analyst"},
+				{Key: "does_not_exist", Role: "Analyst"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to batch update persons: %v", err)
+		}
+
+		if updateResp.Results[0].Error != nil || updateResp.Results[0].Person.Role != "Analyst" {
+			t.Errorf("Expected first person to be updated, got %v", updateResp.Results[0])
+		}
+
+		if updateResp.Results[1].Error == nil || codes.Code(updateResp.Results[1].Error.Code) != codes.NotFound {
+			t.Errorf("Expected NotFound error for unknown key, got %v", updateResp.Results[1].Error)
+		}
+
+		// The same update as all or nothing must roll back the first item
+		updateResp, err = service.BatchUpdatePersons(context.Background(), &base.BatchUpdatePersonsRequest{
+			Persons: []*model.Person{
+				{Key: keys[0], Role: "Manager"},
+				{Key: "does_not_exist", Role: "Manager"},
+			},
+			AllOrNothing: true,
+		})
+		if err != nil {
+			t.Fatalf("Failed to batch update persons: %v", err)
+		}
+
+		if updateResp.Results[0].Error == nil || codes.Code(updateResp.Results[0].Error.Code) != codes.Aborted {
+			t.Errorf("Expected first person to be rolled back, got %v", updateResp.Results[0])
+		}
+
+		getResp, err := service.GetPerson(context.Background(), &base.GetPersonRequest{Key: keys[0]})
+		if err != nil {
+			t.Fatalf("Failed to get person: %v", err)
+		}
+
+		if getResp.Person.Role != "Analyst" {
+			t.Errorf("Expected role to be 'Analyst', got '%s'", getResp.Person.Role)
+		}
+
+		// Delete the persons
+		deleteResp, err := service.BatchDeletePersons(context.Background(), &base.BatchDeletePersonsRequest{
+			Keys: keys,
+		})
+		if err != nil {
+			t.Fatalf("Failed to batch delete persons: %v", err)
+		}
+
+		for _, result := range deleteResp.Results {
+			if result.Error != nil {
+				t.Errorf("Expected person %s to be deleted, got error: %s", result.Key, result.Error.Message)
+			}
+		}
+	})
 }
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// possibleDuplicateThreshold is the lowest similarity reported as a possible duplicate
+	possibleDuplicateThreshold = 0.85
+	maxPossibleDuplicates      = 5
+	// Entities sharing a word with the created one that are compared at most
+	maxDuplicateLookup = 200
+	// Shorter words are too common to look up
+	minLookupTokenLength = 3
+)
+
+// namedEntity holds the names of a person or organization compared on create.
+type namedEntity struct {
+	ID      string   `json:"_id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+}
+
+// findNamedDuplicates returns the entities of collection whose name or aliases
+// resemble the given names once normalized, most similar first. Entities are
+// looked up by the words of the normalized names in the indexed search keys
+// stored in keyFields.
+func findNamedDuplicates(ctx context.Context, client *clients.ArangoDBClient, collection string, keyFields []string, names []string, normalize func(string) string) ([]*base.PossibleDuplicate, error) {
+	var normalized []string
+	for _, name := range names {
+		if n := normalize(name); n != "" && !slices.Contains(normalized, n) {
+			normalized = append(normalized, n)
+		}
+	}
+	keys := newSearchKeys(normalized...)
+	if keys == nil {
+		return nil, nil
+	}
+	var tokens []string
+	for _, token := range keys.Tokens {
+		if len([]rune(token)) >= minLookupTokenLength {
+			tokens = append(tokens, token)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	// Prefilter on shared words, then score the normalized names
+	lookups := make([]string, len(keyFields))
+	for i, field := range keyFields {
+		lookups[i] = fmt.Sprintf("(FOR t IN @tokens FOR d IN @@collection FILTER t IN d.%s.tokens[*] LIMIT @limit RETURN d._id)", field)
+	}
+	query := `
+		FOR id IN UNIQUE(FLATTEN([` + strings.Join(lookups, ", ") + `]))
+			LIMIT @limit
+			LET d = DOCUMENT(id)
+			RETURN KEEP(d, "_id", "name", "aliases")`
+	entities, err := queryAll[namedEntity](ctx, client.DB, query, map[string]interface{}{
+		"@collection": collection,
+		"tokens":      tokens,
+		"limit":       maxDuplicateLookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var duplicates []*base.PossibleDuplicate
+	for _, entity := range entities {
+		var entityNames []string
+		for _, name := range append([]string{entity.Name}, entity.Aliases...) {
+			if n := normalize(name); n != "" {
+				entityNames = append(entityNames, n)
+			}
+		}
+		if score := nameSimilarity(normalized, entityNames); score >= possibleDuplicateThreshold {
+			duplicates = append(duplicates, &base.PossibleDuplicate{Id: entity.ID, Name: entity.Name, Score: score})
+		}
+	}
+	return topDuplicates(duplicates), nil
+}
+
+// findWebsiteDuplicates returns the websites of collection in the same domain
+// whose URL resembles rawURL, most similar first.
+func findWebsiteDuplicates(ctx context.Context, client *clients.ArangoDBClient, collection, rawURL, domain string) ([]*base.PossibleDuplicate, error) {
+	normalized := normalizedURL(rawURL)
+	domain = strings.TrimPrefix(strings.ToLower(domain), "www.")
+	if domain == "" {
+		domain = urlDomain(rawURL)
+	}
+	if normalized == "" || domain == "" {
+		return nil, nil
+	}
+
+	query := `
+		FOR w IN @@collection
+			FILTER w.domain IN @domains
+			LIMIT @limit
+			RETURN { _id: w._id, name: w.url }`
+	websites, err := queryAll[namedEntity](ctx, client.DB, query, map[string]interface{}{
+		"@collection": collection,
+		"domains":     []string{domain, "www." + domain},
+		"limit":       maxDuplicateLookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var duplicates []*base.PossibleDuplicate
+	for _, website := range websites {
+		if score := jaroWinkler(normalized, normalizedURL(website.Name)); score >= possibleDuplicateThreshold {
+			duplicates = append(duplicates, &base.PossibleDuplicate{Id: website.ID, Name: website.Name, Score: score})
+		}
+	}
+	return topDuplicates(duplicates), nil
+}
+
+// duplicateCheckCollections returns the collections of a transaction creating
+// a document in collection. Creates failing on duplicates lock the collection
+// exclusively, so that no document is written between the lookup of the
+// duplicates and the insert.
+func duplicateCheckCollections(collection string, failOnDuplicate bool) driver.TransactionCollections {
+	if failOnDuplicate {
+		return driver.TransactionCollections{Exclusive: []string{collection}}
+	}
+	return driver.TransactionCollections{Write: []string{collection}}
+}
+
+// topDuplicates sorts duplicates by descending score and keeps the best ones.
+func topDuplicates(duplicates []*base.PossibleDuplicate) []*base.PossibleDuplicate {
+	slices.SortFunc(duplicates, func(a, b *base.PossibleDuplicate) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), strings.Compare(a.Id, b.Id))
+	})
+	if len(duplicates) > maxPossibleDuplicates {
+		duplicates = duplicates[:maxPossibleDuplicates]
+	}
+	return duplicates
+}
+
+// duplicateError returns the AlreadyExists error of a create failing on
+// duplicates, with the duplicates as details.
+func duplicateError(duplicates []*base.PossibleDuplicate) error {
+	ids := make([]string, len(duplicates))
+	for i, duplicate := range duplicates {
+		ids[i] = duplicate.Id
+	}
+	st := status.New(codes.AlreadyExists, fmt.Sprintf("Possible duplicates exist: %s", strings.Join(ids, ", ")))
+	if detailed, err := st.WithDetails(&base.PossibleDuplicates{Duplicates: duplicates}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// normalizedURL returns rawURL without scheme, "www.", query, fragment or
+// trailing slash, in lower case except for the path.
+func normalizedURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		// URLs without scheme parse as a path
+		u, err = url.Parse("//" + strings.TrimSpace(rawURL))
+		if err != nil || u.Host == "" {
+			return ""
+		}
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	return host + strings.TrimRight(u.EscapedPath(), "/")
+}
+
+// urlDomain returns the host of rawURL without "www.".
+func urlDomain(rawURL string) string {
+	host, _, _ := strings.Cut(normalizedURL(rawURL), "/")
+	return host
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ProvenanceCollection holds the edges from entities and relationships to the
+// sources citing them. It is not part of the OSINT graph, as its edges start
+// from documents of any collection, relationships included.
+const ProvenanceCollection = "cited_by"
+
+type ProvenanceService struct {
+	base.UnimplementedProvenanceServiceServer
+
+	DBClient   *clients.ArangoDBClient
+	Collection driver.Collection
+	Changes    *ChangeLog
+	Redirects  *RedirectStore
+}
+
+// evidenceDocument is a cited_by edge.
+type evidenceDocument struct {
+	ID          string `json:"_id,omitempty"`
+	Key         string `json:"_key,omitempty"`
+	Rev         string `json:"_rev,omitempty"`
+	From        string `json:"_from"`
+	To          string `json:"_to"`
+	Excerpt     string `json:"excerpt"`
+	RetrievedAt int64  `json:"retrieved_at,omitempty"`
+	CreatedAt   int64  `json:"created_at,omitempty"`
+}
+
+func (d *evidenceDocument) evidence() *base.Evidence {
+	return &base.Evidence{
+		Id:          d.ID,
+		EntityId:    d.From,
+		SourceId:    d.To,
+		Excerpt:     d.Excerpt,
+		RetrievedAt: d.RetrievedAt,
+		CreatedAt:   d.CreatedAt,
+	}
+}
+
+func NewProvenanceService(client *clients.ArangoDBClient, changes *ChangeLog) (*ProvenanceService, error) {
+	ctx := context.Background()
+	collection, err := getCreateProvenanceCollection(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get or create %s collection: %v", ProvenanceCollection, err)
+	}
+	logrus.Infof("✅ Initialized collection %s", collection.Name())
+
+	redirects, err := NewRedirectStore(client)
+	if err != nil {
+		return nil, err
+	}
+
+	service := &ProvenanceService{
+		DBClient:   client,
+		Collection: changes.Watch(collection),
+		Changes:    changes,
+		Redirects:  redirects,
+	}
+	return service, nil
+}
+
+func getCreateProvenanceCollection(ctx context.Context, client *clients.ArangoDBClient) (driver.Collection, error) {
+	return getCreateDocumentCollection(ctx, client, ProvenanceCollection, &driver.CreateCollectionOptions{Type: driver.CollectionTypeEdge})
+}
+
+func (s *ProvenanceService) AttachEvidence(ctx context.Context, req *base.AttachEvidenceRequest) (*base.AttachEvidenceResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Attaching evidence from %s to %s", req.GetSourceId(), req.GetEntityId())
+
+	if _, _, err := s.DBClient.ParseDocID(req.GetEntityId()); err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"id":    req.GetEntityId(),
+		}).Info("failed to parse entity id")
+		return nil, fieldError("entity_id", errors.New("must be the ID of an entity or relationship"))
+	}
+	if collection, key, _ := strings.Cut(req.GetSourceId(), "/"); collection != "sources" || key == "" {
+		logger.WithFields(logrus.Fields{
+			"id": req.GetSourceId(),
+		}).Info("evidence source is not a source")
+		return nil, fieldError("source_id", errors.New("must be the ID of a source"))
+	}
+
+	// Evidence of a merged entity is attached to the entity it was merged into
+	entity, err := s.Redirects.Follow(ctx, req.GetEntityId())
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"id":    req.GetEntityId(),
+		}).Error("failed to resolve merged entity")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	// Using AQL query to insert or refresh the evidence matched by its excerpt
+	query := `
+		LET entity = DOCUMENT(@entity)
+		LET source = DOCUMENT(@source)
+		FILTER entity != null AND source != null
+		UPSERT { _from: @entity, _to: @source, excerpt: @excerpt }
+		INSERT { _from: @entity, _to: @source, excerpt: @excerpt, retrieved_at: @retrievedAt, created_at: @now }
+		UPDATE { retrieved_at: @retrievedAt || OLD.retrieved_at }
+		IN @@collection
+		RETURN { doc: NEW, created: OLD == null }
+	`
+
+	var result struct {
+		Doc     evidenceDocument `json:"doc"`
+		Created bool             `json:"created"`
+	}
+	err = s.Changes.transact(ctx, driver.TransactionCollections{Exclusive: []string{s.Collection.Name()}}, func(ctx context.Context) error {
+		cursor, err := s.DBClient.DB.Query(ctx, query, map[string]interface{}{
+			"entity":      entity,
+			"source":      req.GetSourceId(),
+			"excerpt":     req.GetExcerpt(),
+			"retrievedAt": req.GetRetrievedAt(),
+			"now":         time.Now().Unix(),
+			"@collection": s.Collection.Name(),
+		})
+		if err != nil {
+			if driver.IsNotFoundGeneral(err) {
+				// DOCUMENT fails on IDs of collections that do not exist
+				logger.WithFields(logrus.Fields{
+					"entity": entity,
+				}).Info("entity collection not found for evidence")
+				return status.Errorf(codes.NotFound, "Entity or source not found")
+			}
+
+			logger.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("failed to execute AQL query for attaching evidence")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		defer cursor.Close()
+
+		if _, err := cursor.ReadDocument(ctx, &result); err != nil {
+			if driver.IsNoMoreDocuments(err) {
+				logger.WithFields(logrus.Fields{
+					"entity": entity,
+					"source": req.GetSourceId(),
+				}).Info("entity or source not found for evidence")
+				return status.Errorf(codes.NotFound, "Entity or source not found")
+			}
+
+			logger.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("failed to read attached evidence document")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+
+		operation := ChangeUpdate
+		if result.Created {
+			operation = ChangeCreate
+		}
+		return s.Changes.recordWrite(ctx, s.Collection.Name(), operation, driver.DocumentMeta{
+			Key: result.Doc.Key,
+			ID:  driver.DocumentID(result.Doc.ID),
+			Rev: result.Doc.Rev,
+		}, nil)
+	})
+	if err != nil {
+		return nil, changeError(ctx, err, "failed to attach evidence")
+	}
+
+	return &base.AttachEvidenceResponse{Evidence: result.Doc.evidence(), Created: result.Created}, nil
+}
+
+func (s *ProvenanceService) GetProvenance(ctx context.Context, req *base.GetProvenanceRequest) (*base.GetProvenanceResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Getting provenance of %s", req.GetId())
+
+	if _, _, err := s.DBClient.ParseDocID(req.GetId()); err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"id":    req.GetId(),
+		}).Info("failed to parse entity id")
+		return nil, status.Errorf(codes.InvalidArgument, "Bad parameter")
+	}
+
+	// Citations of a merged entity follow it to the entity it was merged into
+	id, err := s.Redirects.Follow(ctx, req.GetId())
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"id":    req.GetId(),
+		}).Error("failed to resolve merged entity")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	citations, err := listCitations(ctx, s.DBClient.DB, id)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"id":    req.GetId(),
+		}).Error("failed to list citations")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	return &base.GetProvenanceResponse{Citations: citations}, nil
+}
+
+// listCitations returns the sources citing the entity or relationship with the
+// given ID, most recently retrieved first.
+func listCitations(ctx context.Context, db driver.Database, id string) ([]*base.Citation, error) {
+	query := `
+		FOR e IN @@collection
+			FILTER e._from == @id
+			LET source = DOCUMENT(e._to)
+			FILTER source != null
+			SORT e.retrieved_at DESC, e.created_at DESC
+			RETURN { evidence: e, source: source }`
+	type citation struct {
+		Evidence evidenceDocument `json:"evidence"`
+		Source   model.Source     `json:"source"`
+	}
+	rows, err := queryAll[citation](ctx, db, query, map[string]interface{}{
+		"@collection": ProvenanceCollection,
+		"id":          id,
+	})
+	if driver.IsNotFoundGeneral(err) {
+		// No evidence was ever attached
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	citations := make([]*base.Citation, len(rows))
+	for i, row := range rows {
+		citations[i] = &base.Citation{Source: &row.Source, Evidence: row.Evidence.evidence()}
+	}
+	return citations, nil
+}
+
+// removeCitations removes the cited_by edges from and to the documents with the
+// given IDs, and records their removal in the transaction of ctx. It is called
+// when the documents are deleted, as citations of missing documents are never
+// listed.
+func removeCitations(ctx context.Context, db driver.Database, changes *ChangeLog, ids []string) error {
+	query := `
+		FOR e IN @@collection
+			FILTER e._from IN @ids OR e._to IN @ids
+			REMOVE e IN @@collection
+			RETURN OLD`
+	removed, err := queryAll[map[string]interface{}](ctx, db, query, map[string]interface{}{
+		"@collection": ProvenanceCollection,
+		"ids":         ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	var records []*changeRecord
+	for _, doc := range removed {
+		change := writeChanges(ProvenanceCollection, []driver.DocumentMeta{documentMeta(*doc)}, nil, ChangeDelete)
+		change[0].Document = *doc
+		records = append(records, change...)
+	}
+	return changes.Record(ctx, records)
+}
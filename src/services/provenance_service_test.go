@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestProvenanceService(t *testing.T) {
+	// Skip test if ArangoDB is not available
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	// Create ArangoDB client
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
+	service, err := NewProvenanceService(client, changes)
+	if err != nil {
+		t.Fatalf("Failed to create ProvenanceService: %v", err)
+	}
+	personService, err := NewPersonService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create PersonService: %v", err)
+	}
+	sourceService, err := NewSourceService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create SourceService: %v", err)
+	}
+
+	ctx := context.Background()
+	person, err := personService.CreatePerson(ctx, &base.CreatePersonRequest{Person: &model.Person{Name: "Provenance Test Person"}})
+	if err != nil {
+		t.Fatalf("Failed to create person: %v", err)
+	}
+	defer personService.DeletePerson(ctx, &base.DeletePersonRequest{Key: person.Person.Key})
+
+	var sources []*model.Source
+	for _, name := range []string{"Provenance Test Wire", "Provenance Test Paper"} {
+		resp, err := sourceService.CreateSource(ctx, &base.CreateSourceRequest{Source: &model.Source{Name: name}})
+		if err != nil {
+			t.Fatalf("Failed to create source: %v", err)
+		}
+		defer sourceService.DeleteSource(ctx, &base.DeleteSourceRequest{Key: resp.Source.Key})
+		sources = append(sources, resp.Source)
+	}
+
+	t.Run("Attach", func(t *testing.T) {
+		for i, source := range sources {
+			resp, err := service.AttachEvidence(ctx, &base.AttachEvidenceRequest{
+				EntityId:    person.Person.Id,
+				SourceId:    source.Id,
+				Excerpt:     "was seen in the capital",
+				RetrievedAt: int64(1700000000 + i),
+			})
+			if err != nil {
+				t.Fatalf("Failed to attach evidence: %v", err)
+			}
+			if !resp.Created {
+				t.Error("Expected evidence to be created")
+			}
+			defer service.Collection.RemoveDocument(ctx, strings.TrimPrefix(resp.Evidence.Id, ProvenanceCollection+"/"))
+		}
+
+		// Attaching the same excerpt again refreshes it
+		resp, err := service.AttachEvidence(ctx, &base.AttachEvidenceRequest{
+			EntityId:    person.Person.Id,
+			SourceId:    sources[0].Id,
+			Excerpt:     "was seen in the capital",
+			RetrievedAt: 1800000000,
+		})
+		if err != nil {
+			t.Fatalf("Failed to attach evidence again: %v", err)
+		}
+		if resp.Created || resp.Evidence.RetrievedAt != 1800000000 {
+			t.Errorf("Expected evidence to be refreshed, got %v", resp)
+		}
+
+		provenance, err := service.GetProvenance(ctx, &base.GetProvenanceRequest{Id: person.Person.Id})
+		if err != nil {
+			t.Fatalf("Failed to get provenance: %v", err)
+		}
+		if len(provenance.Citations) != 2 || provenance.Citations[0].Source.Id != sources[0].Id {
+			t.Errorf("Expected 2 citations, most recently retrieved first, got %v", provenance.Citations)
+		}
+
+		got, err := personService.GetPerson(ctx, &base.GetPersonRequest{Key: person.Person.Key, IncludeCitations: true})
+		if err != nil {
+			t.Fatalf("Failed to get person: %v", err)
+		}
+		if len(got.Citations) != 2 {
+			t.Errorf("Expected person to be returned with 2 citations, got %d", len(got.Citations))
+		}
+
+		got, err = personService.GetPerson(ctx, &base.GetPersonRequest{Key: person.Person.Key})
+		if err != nil {
+			t.Fatalf("Failed to get person: %v", err)
+		}
+		if len(got.Citations) != 0 {
+			t.Errorf("Expected no citations unless requested, got %d", len(got.Citations))
+		}
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		_, err := service.AttachEvidence(ctx, &base.AttachEvidenceRequest{EntityId: person.Person.Id, SourceId: person.Person.Id})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for a source_id that is not a source, got %v", err)
+		}
+
+		_, err = service.AttachEvidence(ctx, &base.AttachEvidenceRequest{EntityId: "persons/missing-provenance-test", SourceId: sources[0].Id})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("Expected NotFound for a missing entity, got %v", err)
+		}
+
+		_, err = service.AttachEvidence(ctx, &base.AttachEvidenceRequest{EntityId: "missing_provenance_collection/test", SourceId: sources[0].Id})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("Expected NotFound for an entity of a missing collection, got %v", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		deleted, err := personService.CreatePerson(ctx, &base.CreatePersonRequest{Person: &model.Person{Name: "Provenance Test Deleted"}})
+		if err != nil {
+			t.Fatalf("Failed to create person: %v", err)
+		}
+		_, err = service.AttachEvidence(ctx, &base.AttachEvidenceRequest{
+			EntityId: deleted.Person.Id,
+			SourceId: sources[1].Id,
+			Excerpt:  "was deleted later",
+		})
+		if err != nil {
+			t.Fatalf("Failed to attach evidence: %v", err)
+		}
+
+		if _, err := personService.DeletePerson(ctx, &base.DeletePersonRequest{Key: deleted.Person.Key}); err != nil {
+			t.Fatalf("Failed to delete person: %v", err)
+		}
+
+		provenance, err := service.GetProvenance(ctx, &base.GetProvenanceRequest{Id: deleted.Person.Id})
+		if err != nil {
+			t.Fatalf("Failed to get provenance: %v", err)
+		}
+		if len(provenance.Citations) != 0 {
+			t.Errorf("Expected the citations of a deleted person to be removed, got %v", provenance.Citations)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omniscent-library/src/clients"
+)
+
+// RedirectsCollection maps the IDs of merged entities to their survivor.
+const RedirectsCollection = "redirects"
+
+// RedirectStore resolves the IDs of entities merged into another entity.
+type RedirectStore struct {
+	Collection driver.Collection
+}
+
+type redirectRecord struct {
+	Key      string `json:"_key,omitempty"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	MergedAt int64  `json:"merged_at"`
+}
+
+func NewRedirectStore(client *clients.ArangoDBClient) (*RedirectStore, error) {
+	ctx := context.Background()
+	collection, err := GetCreateDocumentCollection(ctx, client, RedirectsCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get or create %s collection: %v", RedirectsCollection, err)
+	}
+
+	if err := EnsureIndexes(ctx, collection); err != nil {
+		return nil, err
+	}
+
+	return &RedirectStore{
+		Collection: collection,
+	}, nil
+}
+
+// Resolve returns the ID of the entity that id was merged into, or "" if id
+// was not merged.
+func (r *RedirectStore) Resolve(ctx context.Context, id string) (string, error) {
+	var record redirectRecord
+	if _, err := r.Collection.ReadDocument(ctx, redirectKey(id), &record); err != nil {
+		if driver.IsNotFoundGeneral(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return record.To, nil
+}
+
+// Follow returns the ID of the entity that id was merged into, or id itself
+// if it was not merged.
+func (r *RedirectStore) Follow(ctx context.Context, id string) (string, error) {
+	to, err := r.Resolve(ctx, id)
+	if err != nil || to == "" {
+		return id, err
+	}
+	return to, nil
+}
+
+// ReadDocument reads a document of collection like collection.ReadDocument,
+// reading the survivor instead if the document was merged into another one.
+func (r *RedirectStore) ReadDocument(ctx context.Context, collection driver.Collection, key string, result interface{}) (driver.DocumentMeta, error) {
+	meta, err := collection.ReadDocument(ctx, key, result)
+	if !driver.IsNotFoundGeneral(err) {
+		return meta, err
+	}
+
+	to, redirectErr := r.Resolve(ctx, collection.Name()+"/"+key)
+	if redirectErr != nil {
+		return meta, redirectErr
+	}
+	if to == "" {
+		return meta, err
+	}
+	return collection.ReadDocument(ctx, strings.TrimPrefix(to, collection.Name()+"/"), result)
+}
+
+// redirect points the merged IDs, and the IDs merged into them before, to the
+// survivor in the transaction of ctx.
+func (r *RedirectStore) redirect(ctx context.Context, merged []string, survivor string) error {
+	query := `
+		FOR r IN @@collection
+			FILTER r.to IN @merged
+			UPDATE r WITH { to: @survivor } IN @@collection
+	`
+	cursor, err := r.Collection.Database().Query(ctx, query, map[string]interface{}{
+		"merged":      merged,
+		"survivor":    survivor,
+		"@collection": r.Collection.Name(),
+	})
+	if err != nil {
+		return err
+	}
+	cursor.Close()
+
+	now := time.Now().Unix()
+	records := make([]*redirectRecord, len(merged))
+	for i, id := range merged {
+		records[i] = &redirectRecord{Key: redirectKey(id), From: id, To: survivor, MergedAt: now}
+	}
+	_, errs, err := r.Collection.CreateDocuments(driver.WithOverwriteMode(ctx, driver.OverwriteModeReplace), records)
+	if err != nil {
+		return err
+	}
+	return errs.FirstNonNil()
+}
+
+// redirectKey returns the key of the redirect of id, which cannot contain "/".
+func redirectKey(id string) string {
+	return strings.Replace(id, "/", ":", 1)
+}
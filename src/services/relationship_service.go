@@ -18,18 +18,96 @@ import (
 type RelationshipService struct {
 	base.UnimplementedRelationshipServiceServer
 
-	DBClient *clients.ArangoDBClient
+	DBClient    *clients.ArangoDBClient
+	Idempotency *IdempotencyStore
+	Changes     *ChangeLog
+	Redirects   *RedirectStore
 }
 
-func NewRelationshipService(client *clients.ArangoDBClient) (*RelationshipService, error) {
+func NewRelationshipService(client *clients.ArangoDBClient, idempotency *IdempotencyStore, changes *ChangeLog) (*RelationshipService, error) {
+	// Deletes remove the citations of the deleted relationships
+	if _, err := getCreateProvenanceCollection(context.Background(), client); err != nil {
+		return nil, fmt.Errorf("failed to get or create %s collection: %v", ProvenanceCollection, err)
+	}
+
+	redirects, err := NewRedirectStore(client)
+	if err != nil {
+		return nil, err
+	}
+
 	service := &RelationshipService{
-		DBClient: client,
+		DBClient:    client,
+		Idempotency: idempotency,
+		Changes:     changes,
+		Redirects:   redirects,
 	}
 
 	return service, nil
 }
 
+func (s *RelationshipService) GetRelationship(ctx context.Context, req *base.GetRelationshipRequest) (*base.GetRelationshipResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Getting relationship with ID: %s", req.GetId())
+
+	coll, key, err := s.DBClient.ParseDocID(req.GetId())
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"id":    req.GetId(),
+		}).Error("failed to parse relation id")
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid parameter")
+	}
+
+	// Read document from collection, resolving duplicates removed by a merge
+	var relationship model.Relation
+	collection, err := s.DBClient.DB.Collection(ctx, coll)
+	if err == nil {
+		var meta driver.DocumentMeta
+		meta, err = s.Redirects.ReadDocument(ctx, collection, key, &relationship)
+		relationship.Id = meta.ID.String()
+		relationship.Key = meta.Key
+		relationship.Rev = meta.Rev
+	}
+	if err != nil {
+		if driver.IsNotFoundGeneral(err) {
+			logger.WithFields(logrus.Fields{
+				"id": req.GetId(),
+			}).Info("relationship not found")
+			return nil, status.Errorf(codes.NotFound, "Relation not found")
+		}
+
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"id":    req.GetId(),
+		}).Error("failed to read relationship document")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	gradings := s.grade(ctx, &relationship)
+	response := &base.GetRelationshipResponse{Relationship: &relationship, Grading: gradings[relationship.Id]}
+	if req.GetIncludeCitations() {
+		citations, err := listCitations(ctx, s.DBClient.DB, relationship.Id)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"id":    req.GetId(),
+			}).Error("failed to list relationship citations")
+			return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		response.Citations = citations
+	}
+	return response, nil
+}
+
 func (s *RelationshipService) CreateRelationship(ctx context.Context, req *base.CreateRelationshipRequest) (*base.CreateRelationshipResponse, error) {
+	return WithIdempotency(ctx, s.Idempotency, "CreateRelationship", req, func(resp *base.CreateRelationshipResponse) string {
+		return resp.GetRelationship().GetId()
+	}, func() (*base.CreateRelationshipResponse, error) {
+		return s.createRelationship(ctx, req)
+	})
+}
+
+func (s *RelationshipService) createRelationship(ctx context.Context, req *base.CreateRelationshipRequest) (*base.CreateRelationshipResponse, error) {
 	logger := logging.GetLogger(ctx)
 	logger.Infof("Creating relationship")
 
@@ -39,6 +117,75 @@ func (s *RelationshipService) CreateRelationship(ctx context.Context, req *base.
 		return nil, status.Errorf(codes.InvalidArgument, "Bad parameter")
 	}
 
+	grading, err := newRelationGrading(req.GetGrading(), "grading")
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Info("invalid relationship grading")
+		return nil, err
+	}
+
+	collection, err := s.edgeCollection(ctx, relationship)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create document in collection
+	relationship.Id = ""
+	relationship.Key = ""
+	relationship.Rev = ""
+
+	var createdRelationship model.Relation
+	ctxWithReturnNew := driver.WithReturnNew(ctx, &createdRelationship)
+	meta, err := collection.CreateDocument(ctxWithReturnNew, &relationDocument{Relation: relationship, relationGrading: grading})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"data":  relationship,
+		}).Error("failed to create relationship document")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	createdRelationship.Id = meta.ID.String()
+	createdRelationship.Key = meta.Key
+	createdRelationship.Rev = meta.Rev
+	gradings := s.grade(ctx, &createdRelationship)
+	return &base.CreateRelationshipResponse{Relationship: &createdRelationship, Grading: gradings[createdRelationship.Id]}, nil
+}
+
+// grade returns the gradings of relationships by ID. Gradings are computed on
+// reads, so failing to compute them only leaves them out.
+func (s *RelationshipService) grade(ctx context.Context, relationships ...*model.Relation) map[string]*base.Grading {
+	var ids []string
+	for _, relationship := range relationships {
+		if relationship != nil {
+			ids = append(ids, relationship.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	gradings, err := gradeRelationships(ctx, s.DBClient.DB, ids)
+	if err != nil {
+		logging.GetLogger(ctx).WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to grade relationships")
+		return nil
+	}
+	return gradings
+}
+
+// edgeCollection returns the edge collection a relationship belongs to, named
+// after the collections it connects and its relation name, creating it if needed.
+// Endpoints merged into another entity are re-pointed to the survivor first.
+func (s *RelationshipService) edgeCollection(ctx context.Context, relationship *model.Relation) (driver.Collection, error) {
+	logger := logging.GetLogger(ctx)
+
+	if err := s.followEndpoints(ctx, relationship); err != nil {
+		return nil, err
+	}
+
 	fromColl, _, err := s.DBClient.ParseDocID(relationship.From)
 	if err != nil {
 		logger.WithFields(logrus.Fields{
@@ -80,27 +227,27 @@ func (s *RelationshipService) CreateRelationship(ctx context.Context, req *base.
 	}
 
 	s.DBClient.OsintGraph.CreateVertexCollectionWithOptions(ctx, collection.Name(), driver.CreateVertexCollectionOptions{})
+	return s.Changes.Watch(collection), nil
+}
 
-	// Create document in collection
-	relationship.Id = ""
-	relationship.Key = ""
-	relationship.Rev = ""
-
-	var createdRelationship model.Relation
-	ctxWithReturnNew := driver.WithReturnNew(ctx, &createdRelationship)
-	meta, err := collection.CreateDocument(ctxWithReturnNew, relationship)
-	if err != nil {
-		logger.WithFields(logrus.Fields{
-			"error": err,
-			"data":  relationship,
-		}).Error("failed to create relationship document")
-		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+// followEndpoints re-points the endpoints of a relationship that were merged
+// into another entity to the survivor.
+func (s *RelationshipService) followEndpoints(ctx context.Context, relationship *model.Relation) error {
+	for _, endpoint := range []*string{&relationship.From, &relationship.To} {
+		if *endpoint == "" {
+			continue
+		}
+		id, err := s.Redirects.Follow(ctx, *endpoint)
+		if err != nil {
+			logging.GetLogger(ctx).WithFields(logrus.Fields{
+				"error": err,
+				"id":    *endpoint,
+			}).Error("failed to resolve merged entity")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		*endpoint = id
 	}
-
-	createdRelationship.Id = meta.ID.String()
-	createdRelationship.Key = meta.Key
-	createdRelationship.Rev = meta.Rev
-	return &base.CreateRelationshipResponse{Relationship: &createdRelationship}, nil
+	return nil
 }
 
 func (s *RelationshipService) UpdateRelationship(ctx context.Context, req *base.UpdateRelationshipRequest) (*base.UpdateRelationshipResponse, error) {
@@ -116,6 +263,21 @@ func (s *RelationshipService) UpdateRelationship(ctx context.Context, req *base.
 		return nil, status.Errorf(codes.InvalidArgument, "Invalid parameter")
 	}
 
+	grading, err := newRelationGrading(req.GetGrading(), "grading")
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Info("invalid relationship grading")
+		return nil, err
+	}
+	patch := &relationDocument{Relation: req.GetRelationship(), relationGrading: grading}
+	if patch.Relation == nil {
+		patch.Relation = &model.Relation{}
+	}
+	if err := s.followEndpoints(ctx, patch.Relation); err != nil {
+		return nil, err
+	}
+
 	// Using AQL query to update the document with arangodb ID
 	query := `
 		LET cleanPatch = UNSET(@patch, "_id", "_key", "_rev")
@@ -123,41 +285,50 @@ func (s *RelationshipService) UpdateRelationship(ctx context.Context, req *base.
 		RETURN NEW
 	`
 
-	cursor, err := s.DBClient.DB.Query(ctx, query, map[string]interface{}{
-		"key":         key,
-		"patch":       req.GetRelationship(),
-		"@collection": coll,
-	})
-	if err != nil {
-		logger.WithFields(logrus.Fields{
-			"error": err,
-			"data":  req.GetRelationship(),
-		}).Error("failed to execute AQL query for updating relationship")
-		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
-	}
-	defer cursor.Close()
-
 	var relationship model.Relation
-	meta, err := cursor.ReadDocument(ctx, &relationship)
-	if err != nil {
-		if driver.IsNoMoreDocuments(err) {
+	var meta driver.DocumentMeta
+	err = s.Changes.transact(ctx, driver.TransactionCollections{Write: []string{coll, ProvenanceCollection}}, func(ctx context.Context) error {
+		cursor, err := s.DBClient.DB.Query(ctx, query, map[string]interface{}{
+			"key":         key,
+			"patch":       patch,
+			"@collection": coll,
+		})
+		if err != nil {
 			logger.WithFields(logrus.Fields{
-				"id": req.GetId(),
-			}).Info("relationship not found for update")
-			return nil, status.Errorf(codes.NotFound, "Relation not found")
+				"error": err,
+				"data":  req.GetRelationship(),
+			}).Error("failed to execute AQL query for updating relationship")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
 		}
+		defer cursor.Close()
 
-		logger.WithFields(logrus.Fields{
-			"error": err,
-			"id":    req.GetId(),
-		}).Error("failed to read updated relationship document")
-		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		meta, err = cursor.ReadDocument(ctx, &relationship)
+		if err != nil {
+			if driver.IsNoMoreDocuments(err) {
+				logger.WithFields(logrus.Fields{
+					"id": req.GetId(),
+				}).Info("relationship not found for update")
+				return status.Errorf(codes.NotFound, "Relation not found")
+			}
+
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"id":    req.GetId(),
+			}).Error("failed to read updated relationship document")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+
+		return s.Changes.recordWrite(ctx, coll, ChangeUpdate, meta, nil)
+	})
+	if err != nil {
+		return nil, changeError(ctx, err, "failed to update relationship")
 	}
 
 	relationship.Id = meta.ID.String()
 	relationship.Key = meta.Key
 	relationship.Rev = meta.Rev
-	return &base.UpdateRelationshipResponse{Relationship: &relationship}, nil
+	gradings := s.grade(ctx, &relationship)
+	return &base.UpdateRelationshipResponse{Relationship: &relationship, Grading: gradings[relationship.Id]}, nil
 }
 
 func (s *RelationshipService) DeleteRelationship(ctx context.Context, req *base.DeleteRelationshipRequest) (*base.DeleteRelationshipResponse, error) {
@@ -181,35 +352,311 @@ func (s *RelationshipService) DeleteRelationship(ctx context.Context, req *base.
 			RETURN OLD
 	`
 
-	cursor, err := s.DBClient.DB.Query(ctx, query, map[string]interface{}{
-		"key":         key,
-		"@collection": coll,
+	err = s.Changes.transact(ctx, driver.TransactionCollections{Write: []string{coll, ProvenanceCollection}}, func(ctx context.Context) error {
+		cursor, err := s.DBClient.DB.Query(ctx, query, map[string]interface{}{
+			"key":         key,
+			"@collection": coll,
+		})
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"id":    req.GetId(),
+			}).Error("failed to execute AQL query for deleting relationship")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		defer cursor.Close()
+
+		var old map[string]interface{}
+		meta, err := cursor.ReadDocument(ctx, &old)
+		if err != nil {
+			if driver.IsNoMoreDocuments(err) {
+				logger.WithFields(logrus.Fields{
+					"id": req.GetId(),
+				}).Info("relationship not found for deletion")
+				return status.Errorf(codes.NotFound, "Relation not found")
+			}
+
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"id":    req.GetId(),
+			}).Error("failed to read deleted relationship document")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+
+		if err := s.Changes.recordWrite(ctx, coll, ChangeDelete, meta, old); err != nil {
+			return err
+		}
+		return removeCitations(ctx, s.DBClient.DB, s.Changes, []string{meta.ID.String()})
+	})
+	if err != nil {
+		return nil, changeError(ctx, err, "failed to delete relationship")
+	}
+
+	return &base.DeleteRelationshipResponse{}, nil
+}
+
+// relationshipGroup collects the items of a batch that target one edge collection.
+type relationshipGroup struct {
+	collection driver.Collection
+	keys       []string
+	items      []interface{}
+	positions  []int
+}
+
+// groupByID groups batch items by the edge collection of their IDs. Items with
+// an invalid ID are recorded in errs and left out, as are items errs already
+// holds an error for.
+func (s *RelationshipService) groupByID(ctx context.Context, ids []string, items []*model.Relation, errs []error) (map[string]*relationshipGroup, []string) {
+	logger := logging.GetLogger(ctx)
+
+	groups := map[string]*relationshipGroup{}
+	var names []string
+	for i, id := range ids {
+		if errs[i] != nil {
+			continue
+		}
+
+		coll, key, err := s.DBClient.ParseDocID(id)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"id":    id,
+			}).Info("failed to parse relation id")
+			errs[i] = status.Errorf(codes.InvalidArgument, "Invalid parameter")
+			continue
+		}
+
+		group, ok := groups[coll]
+		if !ok {
+			collection, err := s.DBClient.DB.Collection(ctx, coll)
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			group = &relationshipGroup{collection: s.Changes.Watch(collection)}
+			groups[coll] = group
+			names = append(names, coll)
+		}
+
+		group.keys = append(group.keys, key)
+		if items != nil {
+			group.items = append(group.items, items[i])
+		}
+		group.positions = append(group.positions, i)
+	}
+
+	return groups, names
+}
+
+func (s *RelationshipService) BatchCreateRelationships(ctx context.Context, req *base.BatchCreateRelationshipsRequest) (*base.BatchCreateRelationshipsResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch creating %d relationships", len(req.GetRelationships()))
+
+	if err := checkBatchSize(len(req.GetRelationships())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetRelationships()))
+		return nil, err
+	}
+	if len(req.GetGradings()) > len(req.GetRelationships()) {
+		logger.Infof("%d gradings for %d relationships", len(req.GetGradings()), len(req.GetRelationships()))
+		return nil, status.Errorf(codes.InvalidArgument, "More gradings than relationships")
+	}
+
+	// Group relationships by the edge collection they belong to
+	errs := make([]error, len(req.GetRelationships()))
+	groups := map[string]*relationshipGroup{}
+	var names []string
+	for i, relationship := range req.GetRelationships() {
+		if relationship == nil {
+			errs[i] = status.Errorf(codes.InvalidArgument, "Bad parameter")
+			continue
+		}
+
+		var grading relationGrading
+		if i < len(req.GetGradings()) {
+			var err error
+			if grading, err = newRelationGrading(req.GetGradings()[i], fmt.Sprintf("gradings[%d]", i)); err != nil {
+				errs[i] = err
+				continue
+			}
+		}
+
+		collection, err := s.edgeCollection(ctx, relationship)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		relationship.Id = ""
+		relationship.Key = ""
+		relationship.Rev = ""
+
+		group, ok := groups[collection.Name()]
+		if !ok {
+			group = &relationshipGroup{collection: collection}
+			groups[collection.Name()] = group
+			names = append(names, collection.Name())
+		}
+		group.items = append(group.items, &relationDocument{Relation: relationship, relationGrading: grading})
+		group.positions = append(group.positions, i)
+	}
+
+	// Create documents in every edge collection
+	relationships := make([]*model.Relation, len(req.GetRelationships()))
+	err := runBatch(ctx, s.DBClient.DB, names, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		for _, name := range names {
+			group := groups[name]
+			created := make([]model.Relation, len(group.items))
+			metas, itemErrs, err := group.collection.CreateDocuments(driver.WithReturnNew(ctx, created), group.items)
+			if err != nil {
+				return err
+			}
+
+			for j, position := range group.positions {
+				errs[position] = itemErrs[j]
+				if itemErrs[j] == nil {
+					created[j].Id = metas[j].ID.String()
+					created[j].Key = metas[j].Key
+					created[j].Rev = metas[j].Rev
+					relationships[position] = &created[j]
+				}
+			}
+		}
+		return nil
 	})
 	if err != nil {
 		logger.WithFields(logrus.Fields{
 			"error": err,
-			"id":    req.GetId(),
-		}).Error("failed to execute AQL query for deleting relationship")
+		}).Error("failed to create relationship documents")
 		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
 	}
-	defer cursor.Close()
 
-	var relationship model.Relation
-	_, err = cursor.ReadDocument(ctx, &relationship)
+	gradings := s.grade(ctx, relationships...)
+	response := &base.BatchCreateRelationshipsResponse{}
+	for i := range relationships {
+		result := &base.BatchRelationshipResult{Error: batchError(errs[i])}
+		if errs[i] == nil {
+			result.Relationship = relationships[i]
+			result.Grading = gradings[relationships[i].Id]
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+func (s *RelationshipService) BatchUpdateRelationships(ctx context.Context, req *base.BatchUpdateRelationshipsRequest) (*base.BatchUpdateRelationshipsResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch updating %d relationships", len(req.GetRelationships()))
+
+	if err := checkBatchSize(len(req.GetRelationships())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetRelationships()))
+		return nil, err
+	}
+
+	errs := make([]error, len(req.GetRelationships()))
+	ids := make([]string, len(req.GetRelationships()))
+	for i, relationship := range req.GetRelationships() {
+		ids[i] = relationship.GetId()
+		if relationship != nil {
+			errs[i] = s.followEndpoints(ctx, relationship)
+		}
+	}
+
+	groups, names := s.groupByID(ctx, ids, req.GetRelationships(), errs)
+
+	// Update documents in every edge collection
+	relationships := make([]*model.Relation, len(req.GetRelationships()))
+	err := runBatch(ctx, s.DBClient.DB, names, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		for _, name := range names {
+			group := groups[name]
+			updated := make([]model.Relation, len(group.items))
+			metas, itemErrs, err := group.collection.UpdateDocuments(driver.WithReturnNew(ctx, updated), group.keys, group.items)
+			if err != nil {
+				return err
+			}
+
+			for j, position := range group.positions {
+				errs[position] = itemErrs[j]
+				if itemErrs[j] == nil {
+					updated[j].Id = metas[j].ID.String()
+					updated[j].Key = metas[j].Key
+					updated[j].Rev = metas[j].Rev
+					relationships[position] = &updated[j]
+				}
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		if driver.IsNoMoreDocuments(err) {
-			logger.WithFields(logrus.Fields{
-				"id": req.GetId(),
-			}).Info("relationship not found for deletion")
-			return nil, status.Errorf(codes.NotFound, "Relation not found")
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to update relationship documents")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	gradings := s.grade(ctx, relationships...)
+	response := &base.BatchUpdateRelationshipsResponse{}
+	for i := range relationships {
+		result := &base.BatchRelationshipResult{Error: batchError(errs[i])}
+		if errs[i] == nil {
+			result.Relationship = relationships[i]
+			result.Grading = gradings[relationships[i].Id]
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+func (s *RelationshipService) BatchDeleteRelationships(ctx context.Context, req *base.BatchDeleteRelationshipsRequest) (*base.BatchDeleteRelationshipsResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch deleting %d relationships", len(req.GetIds()))
+
+	if err := checkBatchSize(len(req.GetIds())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetIds()))
+		return nil, err
+	}
+
+	errs := make([]error, len(req.GetIds()))
+	groups, names := s.groupByID(ctx, req.GetIds(), nil, errs)
+
+	// Remove documents from every edge collection with their citations
+	collections := append([]string{ProvenanceCollection}, names...)
+	err := runBatch(ctx, s.DBClient.DB, collections, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		if len(names) == 0 {
+			return nil
 		}
 
+		return s.Changes.transact(ctx, driver.TransactionCollections{Write: collections}, func(ctx context.Context) error {
+			var ids []string
+			for _, name := range names {
+				group := groups[name]
+				metas, itemErrs, err := group.collection.RemoveDocuments(ctx, group.keys)
+				if err != nil {
+					return err
+				}
+
+				for j, position := range group.positions {
+					errs[position] = itemErrs[j]
+					if itemErrs[j] == nil {
+						ids = append(ids, metas[j].ID.String())
+					}
+				}
+			}
+			return removeCitations(ctx, s.DBClient.DB, s.Changes, ids)
+		})
+	})
+	if err != nil {
 		logger.WithFields(logrus.Fields{
 			"error": err,
-			"id":    req.GetId(),
-		}).Error("failed to read deleted relationship document")
+		}).Error("failed to delete relationship documents")
 		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
 	}
 
-	return &base.DeleteRelationshipResponse{}, nil
+	response := &base.BatchDeleteRelationshipsResponse{}
+	for i, id := range req.GetIds() {
+		response.Results = append(response.Results, &base.BatchDeleteRelationshipResult{
+			Id:    id,
+			Error: batchError(errs[i]),
+		})
+	}
+	return response, nil
 }
@@ -23,19 +23,29 @@ func TestRelationshipService(t *testing.T) {
 		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
 	}
 
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
 	// Create required services
-	personService, err := NewPersonService(client)
+	personService, err := NewPersonService(client, idempotency, changes)
 	if err != nil {
 		t.Fatalf("Failed to create PersonService: %v", err)
 	}
 
-	orgService, err := NewOrganizationService(client)
+	orgService, err := NewOrganizationService(client, idempotency, changes)
 	if err != nil {
 		t.Fatalf("Failed to create OrganizationService: %v", err)
 	}
 
 	// Create RelationshipService
-	service, err := NewRelationshipService(client)
+	service, err := NewRelationshipService(client, idempotency, changes)
 	if err != nil {
 		t.Fatalf("Failed to create RelationshipService: %v", err)
 	}
@@ -210,3 +220,203 @@ func TestRelationshipService(t *testing.T) {
 		}
 	})
 }
+
+func TestRelationshipGrading(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
+	personService, err := NewPersonService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create PersonService: %v", err)
+	}
+	sourceService, err := NewSourceService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create SourceService: %v", err)
+	}
+	service, err := NewRelationshipService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create RelationshipService: %v", err)
+	}
+
+	ctx := context.Background()
+	source, err := sourceService.CreateSource(ctx, &base.CreateSourceRequest{
+		Source: &model.Source{Name: "Grading Test Source", Reliability: int32(base.SourceReliability_SOURCE_RELIABILITY_USUALLY_RELIABLE)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create source: %v", err)
+	}
+	defer sourceService.DeleteSource(ctx, &base.DeleteSourceRequest{Key: source.Source.Key})
+
+	var ids []string
+	for _, name := range []string{"Grading Test A", "Grading Test B"} {
+		resp, err := personService.CreatePerson(ctx, &base.CreatePersonRequest{Person: &model.Person{Name: name}})
+		if err != nil {
+			t.Fatalf("Failed to create person: %v", err)
+		}
+		defer personService.DeletePerson(ctx, &base.DeletePersonRequest{Key: resp.Person.Key})
+		ids = append(ids, resp.Person.Id)
+	}
+
+	t.Run("Graded", func(t *testing.T) {
+		created, err := service.CreateRelationship(ctx, &base.CreateRelationshipRequest{
+			Relationship: &model.Relation{Name: "knows", From: ids[0], To: ids[1]},
+			Grading: &base.Grading{
+				Credibility: base.InformationCredibility_INFORMATION_CREDIBILITY_PROBABLY_TRUE,
+				SourceId:    source.Source.Id,
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create relationship: %v", err)
+		}
+		defer service.DeleteRelationship(ctx, &base.DeleteRelationshipRequest{Id: created.Relationship.Id})
+
+		resp, err := service.GetRelationship(ctx, &base.GetRelationshipRequest{Id: created.Relationship.Id})
+		if err != nil {
+			t.Fatalf("Failed to get relationship: %v", err)
+		}
+		if resp.Grading.GetCode() != "B2" {
+			t.Errorf("Expected grade 'B2', got '%s'", resp.Grading.GetCode())
+		}
+		if resp.Grading.GetConfidence() < 0.63 || resp.Grading.GetConfidence() > 0.65 {
+			t.Errorf("Expected confidence 0.64, got %f", resp.Grading.GetConfidence())
+		}
+
+		// The credibility alone can be regraded
+		updated, err := service.UpdateRelationship(ctx, &base.UpdateRelationshipRequest{
+			Id:           created.Relationship.Id,
+			Relationship: &model.Relation{},
+			Grading:      &base.Grading{Credibility: base.InformationCredibility_INFORMATION_CREDIBILITY_CONFIRMED},
+		})
+		if err != nil {
+			t.Fatalf("Failed to update relationship: %v", err)
+		}
+		if updated.Grading.GetCode() != "B1" || updated.Grading.GetSourceId() != source.Source.Id {
+			t.Errorf("Expected grade 'B1' from %s, got %v", source.Source.Id, updated.Grading)
+		}
+	})
+
+	t.Run("Ungraded", func(t *testing.T) {
+		created, err := service.CreateRelationship(ctx, &base.CreateRelationshipRequest{
+			Relationship: &model.Relation{Name: "knows", From: ids[1], To: ids[0]},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create relationship: %v", err)
+		}
+		defer service.DeleteRelationship(ctx, &base.DeleteRelationshipRequest{Id: created.Relationship.Id})
+
+		if created.Grading.GetCode() != "F6" {
+			t.Errorf("Expected grade 'F6', got '%s'", created.Grading.GetCode())
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		resp, err := service.BatchCreateRelationships(ctx, &base.BatchCreateRelationshipsRequest{
+			Relationships: []*model.Relation{
+				{Name: "knows", From: ids[0], To: ids[1]},
+				{Name: "knows", From: ids[1], To: ids[0]},
+				{Name: "knows", From: ids[0], To: ids[1]},
+			},
+			Gradings: []*base.Grading{
+				{Credibility: base.InformationCredibility_INFORMATION_CREDIBILITY_CONFIRMED, SourceId: source.Source.Id},
+				{Credibility: 7},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to batch create relationships: %v", err)
+		}
+		for _, result := range resp.Results {
+			if result.Relationship != nil {
+				defer service.DeleteRelationship(ctx, &base.DeleteRelationshipRequest{Id: result.Relationship.Id})
+			}
+		}
+
+		if resp.Results[0].Grading.GetCode() != "B1" {
+			t.Errorf("Expected grade 'B1', got %v", resp.Results[0])
+		}
+		if resp.Results[1].Error.GetCode() != int32(codes.InvalidArgument) {
+			t.Errorf("Expected InvalidArgument for credibility 7, got %v", resp.Results[1])
+		}
+		if resp.Results[2].Grading.GetCode() != "F6" {
+			t.Errorf("Expected grade 'F6' past the gradings, got %v", resp.Results[2])
+		}
+
+		_, err = service.BatchCreateRelationships(ctx, &base.BatchCreateRelationshipsRequest{
+			Relationships: []*model.Relation{{Name: "knows", From: ids[0], To: ids[1]}},
+			Gradings:      []*base.Grading{{}, {}},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for more gradings than relationships, got %v", err)
+		}
+	})
+
+	t.Run("Legacy Reliability", func(t *testing.T) {
+		legacy, err := sourceService.CreateSource(ctx, &base.CreateSourceRequest{
+			Source: &model.Source{Name: "Grading Test Legacy"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create source: %v", err)
+		}
+		defer sourceService.DeleteSource(ctx, &base.DeleteSourceRequest{Key: legacy.Source.Key})
+
+		// Stored before reliability was a grade
+		if _, err := sourceService.Collection.UpdateDocument(ctx, legacy.Source.Key, map[string]interface{}{"reliability": 80}); err != nil {
+			t.Fatalf("Failed to store legacy reliability: %v", err)
+		}
+
+		if _, err := sourceService.GradeLegacySources(ctx); err != nil {
+			t.Fatalf("Failed to grade legacy sources: %v", err)
+		}
+
+		var doc struct {
+			Reliability       int32 `json:"reliability"`
+			LegacyReliability int32 `json:"legacy_reliability"`
+		}
+		if _, err := sourceService.Collection.ReadDocument(ctx, legacy.Source.Key, &doc); err != nil {
+			t.Fatalf("Failed to read source: %v", err)
+		}
+		if doc.Reliability != ungradable || doc.LegacyReliability != 80 {
+			t.Errorf("Expected reliability %d and legacy reliability 80, got %d and %d", ungradable, doc.Reliability, doc.LegacyReliability)
+		}
+
+		// Graded sources are left as they are
+		if _, err := sourceService.Collection.ReadDocument(ctx, source.Source.Key, &doc); err != nil {
+			t.Fatalf("Failed to read source: %v", err)
+		}
+		if doc.Reliability != int32(base.SourceReliability_SOURCE_RELIABILITY_USUALLY_RELIABLE) {
+			t.Errorf("Expected reliability %d, got %d", base.SourceReliability_SOURCE_RELIABILITY_USUALLY_RELIABLE, doc.Reliability)
+		}
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		_, err := service.CreateRelationship(ctx, &base.CreateRelationshipRequest{
+			Relationship: &model.Relation{Name: "knows", From: ids[0], To: ids[1]},
+			Grading:      &base.Grading{SourceId: ids[0]},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for a source_id that is not a source, got %v", err)
+		}
+
+		_, err = sourceService.CreateSource(ctx, &base.CreateSourceRequest{
+			Source: &model.Source{Name: "Grading Test Invalid", Reliability: 7},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for reliability 7, got %v", err)
+		}
+	})
+}
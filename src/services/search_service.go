@@ -0,0 +1,251 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SearchableCollections lists the collections whose names SearchNames matches.
+var SearchableCollections = []string{"persons", "organizations"}
+
+const (
+	defaultNameSearchLimit    = 20
+	maxNameSearchLimit        = 100
+	defaultNameSearchMinScore = 0.7
+	// Entities sharing a word or phonetic code with the query that are scored at most
+	maxNameSearchCandidates = 1000
+)
+
+// searchKeys are the keys of names matched by SearchNames.
+type searchKeys struct {
+	// Names in their script, Unicode-normalized and casefolded
+	Names []string `json:"names"`
+	// Names transliterated to Latin script without diacritics
+	Latin []string `json:"latin"`
+	// Words of Names and Latin, looked up by index
+	Tokens []string `json:"tokens"`
+	// Soundex codes of the words of Latin
+	Phonetic []string `json:"phonetic"`
+}
+
+// personDocument is a person stored with the search keys of its name and
+// aliases. Each key field is set with its source field, so updates keep them in
+// sync.
+type personDocument struct {
+	*model.Person
+	NameKeys  *searchKeys `json:"name_keys,omitempty"`
+	AliasKeys *searchKeys `json:"alias_keys,omitempty"`
+}
+
+type SearchService struct {
+	base.UnimplementedSearchServiceServer
+
+	DBClient    *clients.ArangoDBClient
+	Collections map[string]driver.Collection
+}
+
+func NewSearchService(client *clients.ArangoDBClient) (*SearchService, error) {
+	ctx := context.Background()
+	collections := map[string]driver.Collection{}
+	for _, name := range SearchableCollections {
+		collection, err := client.GetCreateCollection(ctx, name, driver.CreateVertexCollectionOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get or create %s collection: %v", name, err)
+		}
+		if err := EnsureIndexes(ctx, collection); err != nil {
+			return nil, err
+		}
+		collections[name] = collection
+	}
+
+	service := &SearchService{
+		DBClient:    client,
+		Collections: collections,
+	}
+	return service, nil
+}
+
+func (s *SearchService) SearchNames(ctx context.Context, req *base.SearchNamesRequest) (*base.SearchNamesResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Searching names matching %q", req.GetQuery())
+
+	query := newSearchKeys(req.GetQuery())
+	if query == nil {
+		logger.Info("search query has no words")
+		return nil, status.Errorf(codes.InvalidArgument, "Bad parameter")
+	}
+	collections := req.GetCollections()
+	if len(collections) == 0 {
+		collections = SearchableCollections
+	}
+	for _, name := range collections {
+		if !slices.Contains(SearchableCollections, name) {
+			logger.Infof("collection %s is not searchable", name)
+			return nil, status.Errorf(codes.InvalidArgument, "Unknown collection %s", name)
+		}
+	}
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultNameSearchLimit
+	}
+	limit = min(limit, maxNameSearchLimit)
+	minScore := req.GetMinScore()
+	if minScore <= 0 {
+		minScore = defaultNameSearchMinScore
+	}
+
+	response := &base.SearchNamesResponse{}
+	for _, name := range collections {
+		matches, err := s.searchCollection(ctx, name, query)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":      err,
+				"collection": name,
+			}).Error("failed to search names")
+			return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		for _, match := range matches {
+			if match.Score >= minScore {
+				response.Matches = append(response.Matches, match)
+			}
+		}
+	}
+
+	slices.SortStableFunc(response.Matches, func(a, b *base.NameMatch) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	if len(response.Matches) > limit {
+		response.Matches = response.Matches[:limit]
+	}
+	return response, nil
+}
+
+// searchCollection scores the entities of a collection sharing a word or a
+// phonetic code with the query.
+func (s *SearchService) searchCollection(ctx context.Context, name string, query *searchKeys) ([]*base.NameMatch, error) {
+	candidates := `
+		FOR key IN UNION_DISTINCT(
+			(FOR t IN @tokens FOR d IN @@collection FILTER t IN d.name_keys.tokens[*] RETURN d._key),
+			(FOR t IN @tokens FOR d IN @@collection FILTER t IN d.alias_keys.tokens[*] RETURN d._key),
+			(FOR c IN @codes FOR d IN @@collection FILTER c IN d.name_keys.phonetic[*] RETURN d._key),
+			(FOR c IN @codes FOR d IN @@collection FILTER c IN d.alias_keys.phonetic[*] RETURN d._key)
+		)
+			LIMIT @limit
+			RETURN DOCUMENT(@@collection, key)`
+	bindVars := map[string]interface{}{
+		"@collection": name,
+		"tokens":      query.Tokens,
+		"codes":       append([]string{}, query.Phonetic...),
+		"limit":       maxNameSearchCandidates,
+	}
+
+	var matches []*base.NameMatch
+	switch name {
+	case "persons":
+		persons, err := queryAll[model.Person](ctx, s.DBClient.DB, candidates, bindVars)
+		if err != nil {
+			return nil, err
+		}
+		for _, person := range persons {
+			matched, score := scoreNameMatch(query, append([]string{person.Name}, person.Aliases...))
+			matches = append(matches, &base.NameMatch{Person: person, MatchedName: matched, Score: score})
+		}
+	case "organizations":
+		organizations, err := queryAll[model.Organization](ctx, s.DBClient.DB, candidates, bindVars)
+		if err != nil {
+			return nil, err
+		}
+		for _, organization := range organizations {
+			// Legal forms such as "Ltd" or "ООО" do not count
+			_, score := scoreNameMatch(query, []string{organization.Name, organizationNormalizedName(organization.Name)})
+			matches = append(matches, &base.NameMatch{Organization: organization, MatchedName: organization.Name, Score: score})
+		}
+	}
+	return matches, nil
+}
+
+// scoreNameMatch returns the name most similar to the query and its score.
+// Names equal in their own script score 1; other names are compared in Latin
+// script by spelling and sound.
+func scoreNameMatch(query *searchKeys, names []string) (string, float64) {
+	queryProfile := &personProfile{Aliases: query.Latin}
+	queryProfile.prepare()
+
+	var matched string
+	var best float64
+	for _, name := range names {
+		keys := newSearchKeys(name)
+		if keys == nil {
+			continue
+		}
+
+		score := 1.0
+		if !slices.Contains(query.Names, keys.Names[0]) {
+			profile := &personProfile{Aliases: keys.Latin}
+			profile.prepare()
+			score = scoreNames(queryProfile, profile).total()
+		}
+		if score > best {
+			matched, best = name, score
+		}
+	}
+	return matched, best
+}
+
+// newSearchKeys returns the search keys of names, or nil if they have no words.
+func newSearchKeys(names ...string) *searchKeys {
+	keys := &searchKeys{}
+	for _, name := range names {
+		words := strings.FieldsFunc(cases.Fold().String(norm.NFKC.String(name)), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		latinWords := nameTokens(transliterate(name))
+		if len(words) == 0 || len(latinWords) == 0 {
+			continue
+		}
+
+		keys.Names = append(keys.Names, strings.Join(words, " "))
+		keys.Latin = append(keys.Latin, strings.Join(latinWords, " "))
+		for _, word := range append(words, latinWords...) {
+			if !slices.Contains(keys.Tokens, word) {
+				keys.Tokens = append(keys.Tokens, word)
+			}
+		}
+		for _, word := range latinWords {
+			if code := soundex(word); code != "" && !slices.Contains(keys.Phonetic, code) {
+				keys.Phonetic = append(keys.Phonetic, code)
+			}
+		}
+	}
+	if len(keys.Names) == 0 {
+		return nil
+	}
+	return keys
+}
+
+// newPersonDocument returns person with the search keys of its name and aliases.
+func newPersonDocument(person *model.Person) *personDocument {
+	doc := &personDocument{Person: person}
+	if person.GetName() != "" {
+		doc.NameKeys = newSearchKeys(person.GetName())
+	}
+	if len(person.GetAliases()) > 0 {
+		doc.AliasKeys = newSearchKeys(person.GetAliases()...)
+	}
+	return doc
+}
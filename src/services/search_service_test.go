@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSearchService(t *testing.T) {
+	// Skip test if ArangoDB is not available
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	// Create ArangoDB client
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
+	// Create SearchService
+	service, err := NewSearchService(client)
+	if err != nil {
+		t.Fatalf("Failed to create SearchService: %v", err)
+	}
+
+	personService, err := NewPersonService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create PersonService: %v", err)
+	}
+
+	organizationService, err := NewOrganizationService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create OrganizationService: %v", err)
+	}
+
+	ctx := context.Background()
+	person, err := personService.CreatePerson(ctx, &base.CreatePersonRequest{
+		Person: &model.Person{Name: "Владислав Транслитов", Aliases: []string{"Βλάντισλαβ Τρανσλίτοφ"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create person: %v", err)
+	}
+	defer personService.DeletePerson(ctx, &base.DeletePersonRequest{Key: person.Person.Key})
+
+	organization, err := organizationService.CreateOrganization(ctx, &base.CreateOrganizationRequest{
+		Organization: &model.Organization{Name: "ООО Ромашкатест"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create organization: %v", err)
+	}
+	defer organizationService.DeleteOrganization(ctx, &base.DeleteOrganizationRequest{Key: organization.Organization.Key})
+
+	search := func(query string, collections ...string) *base.SearchNamesResponse {
+		resp, err := service.SearchNames(ctx, &base.SearchNamesRequest{Query: query, Collections: collections})
+		if err != nil {
+			t.Fatalf("Failed to search names: %v", err)
+		}
+		return resp
+	}
+
+	t.Run("Transliterated", func(t *testing.T) {
+		resp := search("Vladislav Translitov")
+		if len(resp.Matches) == 0 || resp.Matches[0].GetPerson().GetKey() != person.Person.Key {
+			t.Fatalf("Expected %s to match first, got %v", person.Person.Id, resp.Matches)
+		}
+		if resp.Matches[0].Score < defaultNameSearchMinScore {
+			t.Errorf("Expected a score of at least %v, got %v", defaultNameSearchMinScore, resp.Matches[0].Score)
+		}
+
+		resp = search("Romashkatest", "organizations")
+		if len(resp.Matches) == 0 || resp.Matches[0].GetOrganization().GetKey() != organization.Organization.Key {
+			t.Errorf("Expected %s to match first, got %v", organization.Organization.Id, resp.Matches)
+		}
+	})
+
+	t.Run("Same Script", func(t *testing.T) {
+		resp := search("Транслитов Владислав", "persons")
+		if len(resp.Matches) == 0 || resp.Matches[0].GetPerson().GetKey() != person.Person.Key {
+			t.Fatalf("Expected %s to match first, got %v", person.Person.Id, resp.Matches)
+		}
+	})
+
+	t.Run("Alias", func(t *testing.T) {
+		resp := search("Βλάντισλαβ Τρανσλίτοφ", "persons")
+		if len(resp.Matches) == 0 || resp.Matches[0].MatchedName != "Βλάντισλαβ Τρανσλίτοφ" || resp.Matches[0].Score != 1 {
+			t.Errorf("Expected the alias to match exactly, got %v", resp.Matches)
+		}
+	})
+
+	t.Run("Han", func(t *testing.T) {
+		han, err := personService.CreatePerson(ctx, &base.CreatePersonRequest{
+			Person: &model.Person{Name: "詹雪薇"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create person: %v", err)
+		}
+		defer personService.DeletePerson(ctx, &base.DeletePersonRequest{Key: han.Person.Key})
+
+		resp := search("Zhan Xuewei", "persons")
+		if len(resp.Matches) == 0 || resp.Matches[0].GetPerson().GetKey() != han.Person.Key {
+			t.Errorf("Expected %s to match first, got %v", han.Person.Id, resp.Matches)
+		}
+		if got := transliterate("李小龍"); got != "li xiaolong" {
+			t.Errorf("Expected %q, got %q", "li xiaolong", got)
+		}
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		_, err := service.SearchNames(ctx, &base.SearchNamesRequest{Query: "  "})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument error, got %v", err)
+		}
+
+		_, err = service.SearchNames(ctx, &base.SearchNamesRequest{Query: "Vladislav", Collections: []string{"events"}})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument error, got %v", err)
+		}
+	})
+}
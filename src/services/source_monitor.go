@@ -0,0 +1,399 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SourceMonitorDomainInterval is the environment variable overriding the
+	// time between two requests of the source monitor, or of the feed
+	// ingester, to the same domain.
+	SourceMonitorDomainInterval = "SOURCE_MONITOR_DOMAIN_INTERVAL"
+
+	defaultDomainInterval = 5 * time.Second
+	monitorPollInterval   = time.Minute
+	monitorBatchSize      = 100
+	monitorConcurrency    = 8
+	monitorTimeout        = 30 * time.Second
+	sourceUserAgent       = "omnibasement/1.0"
+	// Content past this size is not hashed
+	maxMonitoredContent = 10 << 20
+	// Longest Retry-After honored before the next scheduled check
+	maxRetryAfter = time.Hour
+)
+
+// monitoredSource holds the fields of a source that the monitor reads. The
+// monitoring field of a source is its check interval in minutes, and sources
+// with no interval are not monitored.
+type monitoredSource struct {
+	ID         string       `json:"_id"`
+	Key        string       `json:"_key"`
+	Url        string       `json:"url"`
+	Monitoring int32        `json:"monitoring"`
+	Monitor    *sourceCheck `json:"monitor,omitempty"`
+}
+
+// sourceCheck is the result of the last check of a source, stored as its
+// monitor field.
+type sourceCheck struct {
+	// Validators sent with the next request to make it conditional
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	// SHA-256 of the content, in hex
+	ContentHash string `json:"content_hash,omitempty"`
+	// Changed is set when the content differs from the previous check
+	Changed     bool   `json:"changed"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	Error       string `json:"error,omitempty"`
+	CheckedAt   int64  `json:"checked_at"`
+	ChangedAt   int64  `json:"changed_at,omitempty"`
+	NextCheckAt int64  `json:"next_check_at"`
+}
+
+// SourceMonitor fetches the URLs of monitored sources on their interval and
+// records the sources whose content changed in the change log, which notifies
+// the change feed, webhooks and outbox with a sources update.
+type SourceMonitor struct {
+	DBClient *clients.ArangoDBClient
+	// Collection is not watched, as most checks find nothing to notify
+	Collection driver.Collection
+	Websites   driver.Collection
+	HostedOn   driver.Collection
+	Changes    *ChangeLog
+	HTTPClient *http.Client
+
+	limiter *DomainLimiter
+}
+
+// NewSourceMonitor returns a monitor spacing its requests to each domain with
+// limiter, which it shares with the feed ingester.
+func NewSourceMonitor(client *clients.ArangoDBClient, changes *ChangeLog, limiter *DomainLimiter) (*SourceMonitor, error) {
+	ctx := context.Background()
+	collection, err := client.GetCreateCollection(ctx, "sources", driver.CreateVertexCollectionOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get or create sources collection: %v", err)
+	}
+	websites, err := client.GetCreateCollection(ctx, "websites", driver.CreateVertexCollectionOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get or create websites collection: %v", err)
+	}
+	hostedOn, err := client.GetCreateEdgeCollection(ctx, SourceWebsitesCollection, driver.VertexConstraints{
+		From: []string{collection.Name()},
+		To:   []string{websites.Name()},
+	}, driver.CreateEdgeCollectionOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get or create %s collection: %v", SourceWebsitesCollection, err)
+	}
+
+	monitor := &SourceMonitor{
+		DBClient:   client,
+		Collection: collection,
+		Websites:   websites,
+		HostedOn:   hostedOn,
+		Changes:    changes,
+		HTTPClient: &http.Client{Timeout: monitorTimeout},
+		limiter:    limiter,
+	}
+	return monitor, nil
+}
+
+// Run checks the sources that are due every poll interval until ctx is done.
+func (m *SourceMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(monitorPollInterval)
+	defer ticker.Stop()
+
+	for {
+		checked, err := m.CheckDue(ctx)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("failed to check monitored sources")
+		} else if checked > 0 {
+			logrus.Infof("Checked %d monitored sources", checked)
+		}
+
+		// A full batch may leave more sources due, unless checks fail and
+		// keep them due
+		if err == nil && checked == monitorBatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckDue checks the monitored sources whose next check is due and returns
+// how many it checked, with an error if any check failed. Sources of different
+// domains are fetched concurrently.
+func (m *SourceMonitor) CheckDue(ctx context.Context) (int, error) {
+	query := `
+		FOR s IN @@collection
+			FILTER s.monitoring > 0 AND s.url != null AND (s.monitor.next_check_at || 0) <= @now
+			SORT s.monitor.next_check_at
+			LIMIT @limit
+			RETURN KEEP(s, "_id", "_key", "url", "monitoring", "monitor")`
+	sources, err := queryAll[monitoredSource](ctx, m.DBClient.DB, query, map[string]interface{}{
+		"@collection": m.Collection.Name(),
+		"now":         time.Now().Unix(),
+		"limit":       monitorBatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	var failed atomic.Int32
+	slots := make(chan struct{}, monitorConcurrency)
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source *monitoredSource) {
+			defer wg.Done()
+			if _, err := m.check(ctx, source, slots); err != nil {
+				failed.Add(1)
+				logrus.WithFields(logrus.Fields{
+					"error": err,
+					"id":    source.ID,
+				}).Error("failed to check monitored source")
+			}
+		}(source)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return len(sources), err
+	}
+	if n := failed.Load(); n > 0 {
+		return len(sources), fmt.Errorf("failed to check %d of %d sources", n, len(sources))
+	}
+	return len(sources), nil
+}
+
+// CheckSource checks the source with the given key now, whether it is due or
+// not, and returns whether its content changed.
+func (m *SourceMonitor) CheckSource(ctx context.Context, key string) (bool, error) {
+	var source monitoredSource
+	if _, err := m.Collection.ReadDocument(ctx, key, &source); err != nil {
+		return false, err
+	}
+	if source.Url == "" {
+		return false, fmt.Errorf("source %s has no URL", source.ID)
+	}
+	return m.check(ctx, &source, nil)
+}
+
+// check fetches source once its domain allows it and a slot is free, and
+// stores the result. Sources whose content changed are written through the
+// change log; other checks are not recorded as changes.
+func (m *SourceMonitor) check(ctx context.Context, source *monitoredSource, slots chan struct{}) (bool, error) {
+	u, err := url.Parse(source.Url)
+	if err != nil {
+		return false, err
+	}
+	if err := m.limiter.wait(ctx, registrableDomain(u.Hostname())); err != nil {
+		return false, err
+	}
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+
+	result := m.fetch(ctx, source, u)
+	update := map[string]interface{}{"monitor": result}
+	// The previous result is replaced as a whole
+	ctx = driver.WithMergeObjects(ctx, false)
+	if result.Changed {
+		_, err = m.Changes.Watch(m.Collection).UpdateDocument(ctx, source.Key, update)
+	} else {
+		_, err = m.Collection.UpdateDocument(ctx, source.Key, update)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if result.StatusCode != 0 {
+		if err := m.visitWebsites(ctx, source.ID, result.CheckedAt); err != nil {
+			return result.Changed, err
+		}
+	}
+	return result.Changed, nil
+}
+
+// fetch requests the URL of source, conditionally when the previous check
+// returned validators, and returns the result of the check.
+func (m *SourceMonitor) fetch(ctx context.Context, source *monitoredSource, u *url.URL) *sourceCheck {
+	now := time.Now()
+	previous := source.Monitor
+	if previous == nil {
+		previous = &sourceCheck{}
+	}
+	result := &sourceCheck{
+		ETag:         previous.ETag,
+		LastModified: previous.LastModified,
+		ContentHash:  previous.ContentHash,
+		CheckedAt:    now.Unix(),
+		ChangedAt:    previous.ChangedAt,
+		NextCheckAt:  now.Add(time.Duration(max(source.Monitoring, 1)) * time.Minute).Unix(),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("User-Agent", sourceUserAgent)
+	if previous.ETag != "" {
+		req.Header.Set("If-None-Match", previous.ETag)
+	}
+	if previous.LastModified != "" {
+		req.Header.Set("If-Modified-Since", previous.LastModified)
+	}
+
+	resp, err := m.HTTPClient.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return result
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		// The domain asked to slow down
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			m.limiter.holdOff(registrableDomain(u.Hostname()), min(time.Duration(seconds)*time.Second, maxRetryAfter))
+		}
+		result.Error = resp.Status
+		return result
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		result.Error = resp.Status
+		return result
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.LimitReader(resp.Body, maxMonitoredContent)); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.ContentHash = hex.EncodeToString(hash.Sum(nil))
+	result.ETag = resp.Header.Get("ETag")
+	result.LastModified = resp.Header.Get("Last-Modified")
+	// The first check has nothing to compare with
+	if previous.ContentHash != "" && previous.ContentHash != result.ContentHash {
+		result.Changed = true
+		result.ChangedAt = result.CheckedAt
+	}
+	return result
+}
+
+// visitWebsites sets the time the websites hosting a source were last visited.
+func (m *SourceMonitor) visitWebsites(ctx context.Context, sourceID string, visitedAt int64) error {
+	query := `
+		FOR w IN OUTBOUND @source @@edges
+			UPDATE w WITH { last_visited: @visitedAt } IN @@collection`
+	cursor, err := m.DBClient.DB.Query(ctx, query, map[string]interface{}{
+		"source":      sourceID,
+		"visitedAt":   visitedAt,
+		"@edges":      m.HostedOn.Name(),
+		"@collection": m.Websites.Name(),
+	})
+	if err != nil {
+		return err
+	}
+	cursor.Close()
+	return nil
+}
+
+// DomainLimiter spaces the requests to each domain by an interval.
+type DomainLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     map[string]time.Time
+}
+
+func newDomainLimiter(interval time.Duration) *DomainLimiter {
+	return &DomainLimiter{interval: interval, next: map[string]time.Time{}}
+}
+
+// NewSourceDomainLimiter returns a limiter of the requests fetching sources
+// and their feeds.
+func NewSourceDomainLimiter() (*DomainLimiter, error) {
+	interval := defaultDomainInterval
+	if value := os.Getenv(SourceMonitorDomainInterval); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %v", SourceMonitorDomainInterval, value, err)
+		}
+		interval = parsed
+	}
+	return newDomainLimiter(interval), nil
+}
+
+// reserve returns how long to wait before the next request to domain, and
+// reserves the time after it for the request.
+func (l *DomainLimiter) reserve(domain string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	at := now
+	if next, ok := l.next[domain]; ok && next.After(now) {
+		at = next
+	}
+	l.next[domain] = at.Add(l.interval)
+
+	// Forget the domains that are no longer limited
+	for name, next := range l.next {
+		if next.Before(now) {
+			delete(l.next, name)
+		}
+	}
+	return at.Sub(now)
+}
+
+// wait blocks until a request to domain is allowed or ctx is done.
+func (l *DomainLimiter) wait(ctx context.Context, domain string) error {
+	delay := l.reserve(domain)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// holdOff holds off the requests to domain for delay.
+func (l *DomainLimiter) holdOff(domain string, delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if at := time.Now().Add(delay); at.After(l.next[domain]) {
+		l.next[domain] = at
+	}
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+)
+
+func TestSourceMonitor(t *testing.T) {
+	// Skip test if ArangoDB is not available
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	// Create ArangoDB client
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
+	sourceService, err := NewSourceService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create SourceService: %v", err)
+	}
+	t.Setenv(SourceMonitorDomainInterval, "1ms")
+	limiter, err := NewSourceDomainLimiter()
+	if err != nil {
+		t.Fatalf("Failed to create DomainLimiter: %v", err)
+	}
+	monitor, err := NewSourceMonitor(client, changes, limiter)
+	if err != nil {
+		t.Fatalf("Failed to create SourceMonitor: %v", err)
+	}
+
+	// A local site serving content with an ETag
+	var mu sync.Mutex
+	content, requests, conditional := "first version", 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		etag := `"` + content + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	created, err := sourceService.CreateSource(ctx, &base.CreateSourceRequest{
+		Source: &model.Source{Name: "Monitored Source", Url: server.URL + "/feed", Monitoring: 60},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create source: %v", err)
+	}
+	defer sourceService.DeleteSource(ctx, &base.DeleteSourceRequest{Key: created.Source.Key})
+
+	websiteIDs, err := queryAll[string](ctx, client.DB, "FOR w IN OUTBOUND @source @@edges RETURN w._id", map[string]interface{}{
+		"source": created.Source.Id,
+		"@edges": SourceWebsitesCollection,
+	})
+	if err != nil || len(websiteIDs) != 1 {
+		t.Fatalf("Expected the source to be linked to its website, got %v, %v", websiteIDs, err)
+	}
+	websiteKey := strings.TrimPrefix(*websiteIDs[0], "websites/")
+	defer monitor.Websites.RemoveDocument(ctx, websiteKey)
+
+	readCheck := func() *sourceCheck {
+		var source monitoredSource
+		if _, err := monitor.Collection.ReadDocument(ctx, created.Source.Key, &source); err != nil {
+			t.Fatalf("Failed to read source: %v", err)
+		}
+		if source.Monitor == nil {
+			t.Fatal("Expected the source to have a monitor result")
+		}
+		return source.Monitor
+	}
+	updates := func() int {
+		changes, err := queryAll[changeRecord](ctx, client.DB, "FOR c IN @@collection FILTER c.document_id == @id AND c.operation == @update RETURN c", map[string]interface{}{
+			"@collection": ChangesCollection,
+			"id":          created.Source.Id,
+			"update":      ChangeUpdate,
+		})
+		if err != nil {
+			t.Fatalf("Failed to read changes: %v", err)
+		}
+		return len(changes)
+	}
+
+	t.Run("FirstCheck", func(t *testing.T) {
+		checked, err := monitor.CheckDue(ctx)
+		if err != nil {
+			t.Fatalf("Failed to check due sources: %v", err)
+		}
+		if checked < 1 {
+			t.Fatalf("Expected the new source to be due, checked %d", checked)
+		}
+
+		check := readCheck()
+		if check.ContentHash == "" || check.ETag != `"first version"` || check.Changed {
+			t.Errorf("Expected the content to be hashed without a change, got %+v", check)
+		}
+		if check.NextCheckAt-check.CheckedAt != 3600 {
+			t.Errorf("Expected the next check in 60 minutes, got %d seconds", check.NextCheckAt-check.CheckedAt)
+		}
+
+		var website model.Website
+		if _, err := monitor.Websites.ReadDocument(ctx, websiteKey, &website); err != nil {
+			t.Fatalf("Failed to read website: %v", err)
+		}
+		if website.LastVisited != check.CheckedAt {
+			t.Errorf("Expected website last_visited %d, got %d", check.CheckedAt, website.LastVisited)
+		}
+
+		// The source is not due again before its interval
+		before := requests
+		if _, err := monitor.CheckDue(ctx); err != nil {
+			t.Fatalf("Failed to check due sources: %v", err)
+		}
+		if requests != before {
+			t.Error("Expected the source not to be checked before its interval")
+		}
+	})
+
+	t.Run("NotModified", func(t *testing.T) {
+		before, hash := updates(), readCheck().ContentHash
+		changed, err := monitor.CheckSource(ctx, created.Source.Key)
+		if err != nil {
+			t.Fatalf("Failed to check source: %v", err)
+		}
+		if changed || conditional != 1 {
+			t.Errorf("Expected a conditional request without a change, got changed %v after %d conditional requests", changed, conditional)
+		}
+		if check := readCheck(); check.ContentHash != hash || check.StatusCode != http.StatusNotModified {
+			t.Errorf("Expected the hash to be kept, got %+v", check)
+		}
+		if updates() != before {
+			t.Error("Expected no change notification when the content did not change")
+		}
+	})
+
+	t.Run("Changed", func(t *testing.T) {
+		before, hash := updates(), readCheck().ContentHash
+		mu.Lock()
+		content = "second version"
+		mu.Unlock()
+
+		changed, err := monitor.CheckSource(ctx, created.Source.Key)
+		if err != nil {
+			t.Fatalf("Failed to check source: %v", err)
+		}
+		if !changed {
+			t.Error("Expected the content to have changed")
+		}
+		check := readCheck()
+		if !check.Changed || check.ContentHash == hash || check.ChangedAt != check.CheckedAt {
+			t.Errorf("Expected a new hash and the change flag, got %+v", check)
+		}
+		if updates() != before+1 {
+			t.Error("Expected a change notification for the changed source")
+		}
+	})
+}
+
+func TestDomainLimiter(t *testing.T) {
+	limiter := newDomainLimiter(time.Minute)
+
+	if delay := limiter.reserve("example.com"); delay != 0 {
+		t.Errorf("Expected the first request to go immediately, got %v", delay)
+	}
+	if delay := limiter.reserve("example.com"); delay < 59*time.Second {
+		t.Errorf("Expected the second request to the domain to wait an interval, got %v", delay)
+	}
+	if delay := limiter.reserve("example.com"); delay < 119*time.Second {
+		t.Errorf("Expected the third request to the domain to wait two intervals, got %v", delay)
+	}
+	if delay := limiter.reserve("example.org"); delay != 0 {
+		t.Errorf("Expected other domains not to wait, got %v", delay)
+	}
+
+	limiter.holdOff("example.org", time.Hour)
+	if delay := limiter.reserve("example.org"); delay < 59*time.Minute {
+		t.Errorf("Expected the domain to be held off, got %v", delay)
+	}
+}
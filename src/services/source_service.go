@@ -17,11 +17,15 @@ import (
 type SourceService struct {
 	base.UnimplementedSourceServiceServer
 
-	DBClient   *clients.ArangoDBClient
-	Collection driver.Collection
+	DBClient    *clients.ArangoDBClient
+	Collection  driver.Collection
+	Websites    driver.Collection
+	HostedOn    driver.Collection
+	Idempotency *IdempotencyStore
+	Changes     *ChangeLog
 }
 
-func NewSourceService(client *clients.ArangoDBClient) (*SourceService, error) {
+func NewSourceService(client *clients.ArangoDBClient, idempotency *IdempotencyStore, changes *ChangeLog) (*SourceService, error) {
 	// Create sources collection
 	ctx := context.Background()
 	collection, err := client.GetCreateCollection(ctx, "sources", driver.CreateVertexCollectionOptions{})
@@ -30,9 +34,40 @@ func NewSourceService(client *clients.ArangoDBClient) (*SourceService, error) {
 	}
 	logrus.Infof("✅ Initialized collection %s", collection.Name())
 
+	if err := EnsureIndexes(ctx, collection); err != nil {
+		return nil, err
+	}
+
+	// Sources are linked to the websites hosting them
+	websites, err := client.GetCreateCollection(ctx, "websites", driver.CreateVertexCollectionOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get or create websites collection: %v", err)
+	}
+	if err := EnsureIndexes(ctx, websites); err != nil {
+		return nil, err
+	}
+
+	hostedOn, err := client.GetCreateEdgeCollection(ctx, SourceWebsitesCollection, driver.VertexConstraints{
+		From: []string{collection.Name()},
+		To:   []string{websites.Name()},
+	}, driver.CreateEdgeCollectionOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get or create %s collection: %v", SourceWebsitesCollection, err)
+	}
+	client.OsintGraph.CreateVertexCollectionWithOptions(ctx, hostedOn.Name(), driver.CreateVertexCollectionOptions{})
+
+	// Deletes remove the citations of the deleted documents
+	if _, err := getCreateProvenanceCollection(ctx, client); err != nil {
+		return nil, fmt.Errorf("failed to get or create %s collection: %v", ProvenanceCollection, err)
+	}
+
 	service := &SourceService{
-		DBClient:   client,
-		Collection: collection,
+		DBClient:    client,
+		Collection:  changes.Watch(collection),
+		Websites:    changes.Watch(websites),
+		HostedOn:    changes.Watch(hostedOn),
+		Idempotency: idempotency,
+		Changes:     changes,
 	}
 	return service, nil
 }
@@ -62,18 +97,53 @@ func (s *SourceService) GetSource(ctx context.Context, req *base.GetSourceReques
 	source.Id = meta.ID.String()
 	source.Key = meta.Key
 	source.Rev = meta.Rev
-	return &base.GetSourceResponse{Source: &source}, nil
+	response := &base.GetSourceResponse{Source: &source}
+	if req.GetIncludeCitations() {
+		citations, err := listCitations(ctx, s.DBClient.DB, source.Id)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"key":   req.GetKey(),
+			}).Error("failed to list source citations")
+			return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		response.Citations = citations
+	}
+	return response, nil
 }
 
 func (s *SourceService) CreateSource(ctx context.Context, req *base.CreateSourceRequest) (*base.CreateSourceResponse, error) {
+	return WithIdempotency(ctx, s.Idempotency, "CreateSource", req, func(resp *base.CreateSourceResponse) string {
+		return resp.GetSource().GetId()
+	}, func() (*base.CreateSourceResponse, error) {
+		return s.createSource(ctx, req)
+	})
+}
+
+func (s *SourceService) createSource(ctx context.Context, req *base.CreateSourceRequest) (*base.CreateSourceResponse, error) {
 	logger := logging.GetLogger(ctx)
 	logger.Infof("Creating source with name: %s", req.GetSource().GetName())
 
+	doc, err := newSourceDocument(req.GetSource(), "source")
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"url": req.GetSource().GetUrl(),
+		}).Info("source url is malformed")
+		return nil, err
+	}
+
 	// Create document in collection
 	var source model.Source
 	ctxWithReturnNew := driver.WithReturnNew(ctx, &source)
-	meta, err := s.Collection.CreateDocument(ctxWithReturnNew, req.GetSource())
+	meta, err := s.Collection.CreateDocument(ctxWithReturnNew, doc)
 	if err != nil {
+		if driver.IsConflict(err) {
+			logger.WithFields(logrus.Fields{
+				"url": doc.Url,
+			}).Info("source with the same url already exists")
+			return nil, status.Errorf(codes.AlreadyExists, "Source already exists")
+		}
+
 		logger.WithFields(logrus.Fields{
 			"error": err,
 		}).Error("failed to create source document")
@@ -83,6 +153,7 @@ func (s *SourceService) CreateSource(ctx context.Context, req *base.CreateSource
 	source.Id = meta.ID.String()
 	source.Key = meta.Key
 	source.Rev = meta.Rev
+	s.linkWebsites(ctx, &source)
 	return &base.CreateSourceResponse{Source: &source}, nil
 }
 
@@ -90,10 +161,18 @@ func (s *SourceService) UpdateSource(ctx context.Context, req *base.UpdateSource
 	logger := logging.GetLogger(ctx)
 	logger.Infof("Updating source with Key: %s", req.GetSource().GetKey())
 
+	doc, err := newSourceDocument(req.GetSource(), "source")
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"url": req.GetSource().GetUrl(),
+		}).Info("source url is malformed")
+		return nil, err
+	}
+
 	// Update document in collection
 	var source model.Source
 	ctxWithReturnNew := driver.WithReturnNew(ctx, &source)
-	meta, err := s.Collection.UpdateDocument(ctxWithReturnNew, req.GetSource().GetKey(), req.GetSource())
+	meta, err := s.Collection.UpdateDocument(ctxWithReturnNew, req.GetSource().GetKey(), doc)
 	if err != nil {
 		if driver.IsNotFoundGeneral(err) {
 			logger.WithFields(logrus.Fields{
@@ -102,6 +181,13 @@ func (s *SourceService) UpdateSource(ctx context.Context, req *base.UpdateSource
 			return nil, status.Errorf(codes.NotFound, "Source not found")
 		}
 
+		if driver.IsConflict(err) {
+			logger.WithFields(logrus.Fields{
+				"url": req.GetSource().GetUrl(),
+			}).Info("source with the same url already exists")
+			return nil, status.Errorf(codes.AlreadyExists, "Source already exists")
+		}
+
 		logger.WithFields(logrus.Fields{
 			"error": err,
 			"key":   req.GetSource().GetKey(),
@@ -112,6 +198,9 @@ func (s *SourceService) UpdateSource(ctx context.Context, req *base.UpdateSource
 	source.Id = meta.ID.String()
 	source.Key = meta.Key
 	source.Rev = meta.Rev
+	if doc.Url != "" || doc.RootUrl != "" {
+		s.linkWebsites(ctx, &source)
+	}
 	return &base.UpdateSourceResponse{Source: &source}, nil
 }
 
@@ -119,8 +208,14 @@ func (s *SourceService) DeleteSource(ctx context.Context, req *base.DeleteSource
 	logger := logging.GetLogger(ctx)
 	logger.Infof("Deleting source with Key: %s", req.GetKey())
 
-	// Remove document from collection
-	_, err := s.Collection.RemoveDocument(ctx, req.GetKey())
+	// Remove document from collection with its citations
+	err := s.Changes.transact(ctx, driver.TransactionCollections{Write: []string{s.Collection.Name(), ProvenanceCollection}}, func(ctx context.Context) error {
+		meta, err := s.Collection.RemoveDocument(ctx, req.GetKey())
+		if err != nil {
+			return err
+		}
+		return removeCitations(ctx, s.DBClient.DB, s.Changes, []string{meta.ID.String()})
+	})
 	if err != nil {
 		if driver.IsNotFoundGeneral(err) {
 			logger.WithFields(logrus.Fields{
@@ -138,3 +233,285 @@ func (s *SourceService) DeleteSource(ctx context.Context, req *base.DeleteSource
 
 	return &base.DeleteSourceResponse{}, nil
 }
+
+func (s *SourceService) UpsertSource(ctx context.Context, req *base.UpsertSourceRequest) (*base.UpsertSourceResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Upserting source with URL: %s", req.GetSource().GetUrl())
+
+	if req.GetSource().GetUrl() == "" {
+		logger.Error("source url is empty")
+		return nil, status.Errorf(codes.InvalidArgument, "Bad parameter")
+	}
+	doc, err := newSourceDocument(req.GetSource(), "source")
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"url": req.GetSource().GetUrl(),
+		}).Info("source url is malformed")
+		return nil, err
+	}
+
+	// Using AQL query to insert or merge the document matched by its natural key
+	query := `
+		LET doc = UNSET(@doc, "_id", "_key", "_rev")
+		UPSERT { url: doc.url }
+		INSERT doc
+		UPDATE doc
+		IN @@collection OPTIONS { exclusive: true }
+		RETURN { doc: NEW, created: OLD == null }
+	`
+
+	var result struct {
+		Doc     model.Source `json:"doc"`
+		Created bool         `json:"created"`
+	}
+	err = s.Changes.transact(ctx, driver.TransactionCollections{Exclusive: []string{s.Collection.Name()}}, func(ctx context.Context) error {
+		cursor, err := s.DBClient.DB.Query(ctx, query, map[string]interface{}{
+			"doc":         doc,
+			"@collection": s.Collection.Name(),
+		})
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"data":  req.GetSource(),
+			}).Error("failed to execute AQL query for upserting source")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		defer cursor.Close()
+
+		if _, err := cursor.ReadDocument(ctx, &result); err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"url":   doc.Url,
+			}).Error("failed to read upserted source document")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+
+		operation := ChangeUpdate
+		if result.Created {
+			operation = ChangeCreate
+		}
+		return s.Changes.recordWrite(ctx, s.Collection.Name(), operation, driver.DocumentMeta{
+			Key: result.Doc.Key,
+			ID:  driver.DocumentID(result.Doc.Id),
+			Rev: result.Doc.Rev,
+		}, nil)
+	})
+	if err != nil {
+		return nil, changeError(ctx, err, "failed to upsert source")
+	}
+	s.linkWebsites(ctx, &result.Doc)
+
+	return &base.UpsertSourceResponse{Source: &result.Doc, Created: result.Created}, nil
+}
+
+func (s *SourceService) BatchCreateSources(ctx context.Context, req *base.BatchCreateSourcesRequest) (*base.BatchCreateSourcesResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch creating %d sources", len(req.GetSources()))
+
+	if err := checkBatchSize(len(req.GetSources())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetSources()))
+		return nil, err
+	}
+
+	// Items with a malformed URL never reach the database
+	errs := make([]error, len(req.GetSources()))
+	var docs []*sourceDocument
+	var positions []int
+	for i, source := range req.GetSources() {
+		doc, err := newSourceDocument(source, fmt.Sprintf("sources[%d]", i))
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		docs = append(docs, doc)
+		positions = append(positions, i)
+	}
+
+	// Create documents in collection
+	created := make([]model.Source, len(docs))
+	err := runBatch(ctx, s.DBClient.DB, []string{s.Collection.Name()}, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		if len(docs) == 0 {
+			return nil
+		}
+
+		metas, itemErrs, err := s.Collection.CreateDocuments(driver.WithReturnNew(ctx, created), docs)
+		if err != nil {
+			return err
+		}
+
+		for j, position := range positions {
+			errs[position] = itemErrs[j]
+			if itemErrs[j] == nil {
+				created[j].Id = metas[j].ID.String()
+				created[j].Key = metas[j].Key
+				created[j].Rev = metas[j].Rev
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to create source documents")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	sources := make([]*model.Source, len(req.GetSources()))
+	for j, position := range positions {
+		if errs[position] == nil {
+			sources[position] = &created[j]
+		}
+	}
+	s.linkWebsites(ctx, sources...)
+
+	response := &base.BatchCreateSourcesResponse{}
+	for i := range sources {
+		result := &base.BatchSourceResult{Error: batchError(errs[i])}
+		if errs[i] == nil {
+			result.Source = sources[i]
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+func (s *SourceService) BatchUpdateSources(ctx context.Context, req *base.BatchUpdateSourcesRequest) (*base.BatchUpdateSourcesResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch updating %d sources", len(req.GetSources()))
+
+	if err := checkBatchSize(len(req.GetSources())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetSources()))
+		return nil, err
+	}
+
+	// Items without a key or with a malformed URL never reach the database
+	errs := make([]error, len(req.GetSources()))
+	var keys []string
+	var patches []*sourceDocument
+	var positions []int
+	for i, source := range req.GetSources() {
+		if source.GetKey() == "" {
+			errs[i] = errMissingKey
+			continue
+		}
+		patch, err := newSourceDocument(source, fmt.Sprintf("sources[%d]", i))
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		keys = append(keys, source.GetKey())
+		patches = append(patches, patch)
+		positions = append(positions, i)
+	}
+
+	// Update documents in collection
+	updated := make([]model.Source, len(keys))
+	err := runBatch(ctx, s.DBClient.DB, []string{s.Collection.Name()}, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		if len(keys) == 0 {
+			return nil
+		}
+
+		metas, itemErrs, err := s.Collection.UpdateDocuments(driver.WithReturnNew(ctx, updated), keys, patches)
+		if err != nil {
+			return err
+		}
+
+		for j, position := range positions {
+			errs[position] = itemErrs[j]
+			if itemErrs[j] == nil {
+				updated[j].Id = metas[j].ID.String()
+				updated[j].Key = metas[j].Key
+				updated[j].Rev = metas[j].Rev
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to update source documents")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	sources := make([]*model.Source, len(req.GetSources()))
+	var moved []*model.Source
+	for j, position := range positions {
+		sources[position] = &updated[j]
+		if errs[position] == nil && (patches[j].Url != "" || patches[j].RootUrl != "") {
+			moved = append(moved, &updated[j])
+		}
+	}
+	s.linkWebsites(ctx, moved...)
+
+	response := &base.BatchUpdateSourcesResponse{}
+	for i := range sources {
+		result := &base.BatchSourceResult{Error: batchError(errs[i])}
+		if errs[i] == nil {
+			result.Source = sources[i]
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+func (s *SourceService) BatchDeleteSources(ctx context.Context, req *base.BatchDeleteSourcesRequest) (*base.BatchDeleteSourcesResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch deleting %d sources", len(req.GetKeys()))
+
+	if err := checkBatchSize(len(req.GetKeys())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetKeys()))
+		return nil, err
+	}
+
+	// Items without a key never reach the database
+	errs := make([]error, len(req.GetKeys()))
+	var keys []string
+	var positions []int
+	for i, key := range req.GetKeys() {
+		if key == "" {
+			errs[i] = errMissingKey
+			continue
+		}
+		keys = append(keys, key)
+		positions = append(positions, i)
+	}
+
+	// Remove documents from collection with their citations
+	collections := []string{s.Collection.Name(), ProvenanceCollection}
+	err := runBatch(ctx, s.DBClient.DB, collections, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		if len(keys) == 0 {
+			return nil
+		}
+
+		return s.Changes.transact(ctx, driver.TransactionCollections{Write: collections}, func(ctx context.Context) error {
+			metas, itemErrs, err := s.Collection.RemoveDocuments(ctx, keys)
+			if err != nil {
+				return err
+			}
+
+			var ids []string
+			for j, position := range positions {
+				errs[position] = itemErrs[j]
+				if itemErrs[j] == nil {
+					ids = append(ids, metas[j].ID.String())
+				}
+			}
+			return removeCitations(ctx, s.DBClient.DB, s.Changes, ids)
+		})
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to delete source documents")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	response := &base.BatchDeleteSourcesResponse{}
+	for i, key := range req.GetKeys() {
+		response.Results = append(response.Results, &base.BatchDeleteResult{
+			Key:   key,
+			Error: batchError(errs[i]),
+		})
+	}
+	return response, nil
+}
@@ -2,6 +2,7 @@ package services
 
 import (
     "context"
+    "strings"
     "testing"
 
     "github.com/omnsight/omnibasement/gen/base/v1"
@@ -21,8 +22,18 @@ func TestSourceService(t *testing.T) {
 		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
 	}
 
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
 	// Create SourceService
-	service, err := NewSourceService(client)
+	service, err := NewSourceService(client, idempotency, changes)
 	if err != nil {
 		t.Fatalf("Failed to create SourceService: %v", err)
 	}
@@ -124,3 +135,102 @@ func TestSourceService(t *testing.T) {
 		}
 	})
 }
+
+func TestSourceWebsites(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
+	service, err := NewSourceService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create SourceService: %v", err)
+	}
+
+	ctx := context.Background()
+	hostingWebsites := func(sourceID string) []string {
+		websites, err := queryAll[string](ctx, client.DB, `FOR e IN @@collection FILTER e._from == @from RETURN e._to`, map[string]interface{}{
+			"@collection": SourceWebsitesCollection,
+			"from":        sourceID,
+		})
+		if err != nil {
+			t.Fatalf("Failed to query hosting websites: %v", err)
+		}
+		var ids []string
+		for _, id := range websites {
+			ids = append(ids, *id)
+		}
+		return ids
+	}
+
+	feed, err := service.CreateSource(ctx, &base.CreateSourceRequest{
+		Source: &model.Source{Name: "Link Test Feed", Url: "https://feeds.linktest-example.org/rss"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create source: %v", err)
+	}
+	defer service.DeleteSource(ctx, &base.DeleteSourceRequest{Key: feed.Source.Key})
+
+	websites := hostingWebsites(feed.Source.Id)
+	if len(websites) != 1 {
+		t.Fatalf("Expected source to be hosted on 1 website, got %v", websites)
+	}
+	var website model.Website
+	if _, err := service.Websites.ReadDocument(ctx, strings.TrimPrefix(websites[0], "websites/"), &website); err != nil {
+		t.Fatalf("Failed to read website: %v", err)
+	}
+	defer service.Websites.RemoveDocument(ctx, website.Key)
+	if website.Url != "https://feeds.linktest-example.org" {
+		t.Errorf("Expected website 'https://feeds.linktest-example.org', got '%s'", website.Url)
+	}
+
+	// Sources of the same registrable domain share the website
+	article, err := service.CreateSource(ctx, &base.CreateSourceRequest{
+		Source: &model.Source{Name: "Link Test Article", Url: "https://www.linktest-example.org/articles/1"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create source: %v", err)
+	}
+	defer service.DeleteSource(ctx, &base.DeleteSourceRequest{Key: article.Source.Key})
+
+	if got := hostingWebsites(article.Source.Id); len(got) != 1 || got[0] != websites[0] {
+		t.Errorf("Expected source to be hosted on %s, got %v", websites[0], got)
+	}
+
+	// The backfill does not link sources twice
+	if _, err := service.LinkWebsites(ctx); err != nil {
+		t.Fatalf("Failed to link websites: %v", err)
+	}
+	if got := hostingWebsites(feed.Source.Id); len(got) != 1 {
+		t.Errorf("Expected source to stay hosted on 1 website, got %v", got)
+	}
+
+	// Sources losing their URL are unlinked
+	if _, err := service.linkWebsite(ctx, &hostedSource{ID: article.Source.Id, Key: article.Source.Key}); err != nil {
+		t.Fatalf("Failed to link website: %v", err)
+	}
+	if got := hostingWebsites(article.Source.Id); len(got) != 0 {
+		t.Errorf("Expected source without URL to be unlinked, got %v", got)
+	}
+
+	for _, id := range []string{feed.Source.Id, article.Source.Id} {
+		client.DB.Query(ctx, `FOR e IN @@collection FILTER e._from == @from REMOVE e IN @@collection`, map[string]interface{}{
+			"@collection": SourceWebsitesCollection,
+			"from":        id,
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SourceWebsitesCollection holds the edges from sources to the websites hosting them
+	SourceWebsitesCollection = "sources_hosted_on_websites"
+	sourceWebsiteRelation    = "hosted on"
+)
+
+// hostedSource holds the fields of a source that its website is found by.
+type hostedSource struct {
+	ID      string `json:"_id"`
+	Key     string `json:"_key"`
+	Url     string `json:"url"`
+	RootUrl string `json:"root_url"`
+}
+
+// linkWebsites links each written source to the website hosting it. Linking is
+// an enrichment: failures are logged and left to LinkWebsites.
+func (s *SourceService) linkWebsites(ctx context.Context, sources ...*model.Source) {
+	logger := logging.GetLogger(ctx)
+	for _, source := range sources {
+		if source == nil {
+			continue
+		}
+		hosted := &hostedSource{ID: source.GetId(), Key: source.GetKey(), Url: source.GetUrl(), RootUrl: source.GetRootUrl()}
+		if _, err := s.linkWebsite(ctx, hosted); err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"id":    source.GetId(),
+			}).Error("failed to link source to its website")
+		}
+	}
+}
+
+// linkWebsite connects source to the website of its root URL, or of its
+// registrable domain, creating the website if there is none, and removes the
+// edges to other websites, or every edge when the source has no usable URL.
+// The website and the edges are written in one transaction. It returns
+// whether an edge was created.
+func (s *SourceService) linkWebsite(ctx context.Context, source *hostedSource) (bool, error) {
+	rootURL := source.RootUrl
+	if rootURL == "" {
+		rootURL = source.Url
+	}
+	var root *url.URL
+	if rootURL != "" {
+		// Sources stored before URLs were validated are left without website
+		if parsed, err := canonicalURL(rootURL); err == nil {
+			root = parsed
+			root.Path, root.RawPath, root.RawQuery = "", "", ""
+		}
+	}
+
+	var linked bool
+	collections := driver.TransactionCollections{Write: []string{s.Websites.Name(), s.HostedOn.Name()}}
+	link := func(ctx context.Context) (err error) {
+		linked, err = s.linkRoot(ctx, source, root)
+		return err
+	}
+	err := s.Changes.transact(ctx, collections, link)
+	if driver.IsConflict(err) {
+		// The website was created by a concurrent write since the lookup
+		err = s.Changes.transact(ctx, collections, link)
+	}
+	return linked, err
+}
+
+// linkRoot connects source to the website hosting root, or removes its edges
+// when root is nil.
+func (s *SourceService) linkRoot(ctx context.Context, source *hostedSource, root *url.URL) (bool, error) {
+	websiteID := ""
+	if root != nil {
+		var err error
+		websiteID, err = s.hostingWebsite(ctx, root.String(), root.Hostname())
+		if err != nil {
+			return false, err
+		}
+	}
+
+	query := `
+		FOR e IN @@collection
+			FILTER e._from == @from
+			RETURN e`
+	edges, err := queryAll[model.Relation](ctx, s.DBClient.DB, query, map[string]interface{}{
+		"@collection": SourceWebsitesCollection,
+		"from":        source.ID,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	linked := false
+	for _, edge := range edges {
+		if edge.To == websiteID {
+			linked = true
+			continue
+		}
+		// The source moved to another site or lost its URL
+		if _, err := s.HostedOn.RemoveDocument(ctx, edge.Key); err != nil && !driver.IsNotFoundGeneral(err) {
+			return false, err
+		}
+	}
+	if linked || websiteID == "" {
+		return false, nil
+	}
+
+	edge := &model.Relation{From: source.ID, To: websiteID, Name: sourceWebsiteRelation}
+	if _, err := s.HostedOn.CreateDocument(ctx, edge); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// hostingWebsite returns the ID of the website with rootURL, or else of the
+// website closest to host among those of its registrable domain, creating a
+// website for rootURL if there is none.
+func (s *SourceService) hostingWebsite(ctx context.Context, rootURL, host string) (string, error) {
+	domain := registrableDomain(host)
+	query := `
+		FOR w IN @@collection
+			FILTER w.url == @url OR w.registrable_domain == @domain OR w.domain IN @hosts
+			SORT w.url == @url DESC, w.domain == @host DESC, w.domain == @domain DESC, LENGTH(w.url), w._key
+			LIMIT 1
+			RETURN w._id`
+	ids, err := queryAll[string](ctx, s.DBClient.DB, query, map[string]interface{}{
+		"@collection": s.Websites.Name(),
+		"url":         rootURL,
+		"domain":      domain,
+		"host":        host,
+		"hosts":       []string{host, "www." + host},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(ids) > 0 {
+		return *ids[0], nil
+	}
+
+	doc, err := newWebsiteDocument(&model.Website{Url: rootURL}, "website")
+	if err != nil {
+		return "", err
+	}
+	meta, err := s.Websites.CreateDocument(ctx, doc)
+	if err != nil {
+		return "", err
+	}
+	return meta.ID.String(), nil
+}
+
+// LinkWebsites links the sources written before websites were linked on write
+// to the websites hosting them and returns the number of edges created.
+func (s *SourceService) LinkWebsites(ctx context.Context) (int, error) {
+	query := `
+		FOR s IN @@collection
+			FILTER s._key > @after AND (s.root_url != null OR s.url != null)
+			SORT s._key
+			LIMIT @limit
+			RETURN KEEP(s, "_id", "_key", "url", "root_url")`
+
+	total := 0
+	after := ""
+	for {
+		sources, err := queryAll[hostedSource](ctx, s.DBClient.DB, query, map[string]interface{}{
+			"@collection": s.Collection.Name(),
+			"after":       after,
+			"limit":       MaxBatchSize,
+		})
+		if err != nil {
+			return total, err
+		}
+		if len(sources) == 0 {
+			break
+		}
+
+		for _, source := range sources {
+			linked, err := s.linkWebsite(ctx, source)
+			if err != nil {
+				return total, fmt.Errorf("failed to link source %s: %v", source.ID, err)
+			}
+			if linked {
+				total++
+			}
+		}
+		after = sources[len(sources)-1].Key
+	}
+
+	if total > 0 {
+		logrus.Infof("✅ Linked %d sources to their websites", total)
+	}
+	return total, nil
+}
@@ -0,0 +1,620 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// STIX 2.1 mapping
+//
+//	persons        identity (individual)
+//	organizations  identity (organization)
+//	events         observed-data, read back from observed-data or sighting
+//	websites       url, or domain-name when the website has no URL
+//	sources        external references of the objects they are related to
+//	relationships  relationship
+//
+// Observed data must refer to at least one observable, so events related to no
+// website refer to an x-omnibasement-event observable of their own, which is
+// skipped on import. Relationship types only allow lowercase letters, digits
+// and hyphens, so relationships keep their name in x_omnibasement_name.
+//
+// Objects keep their document ID in x_omnibasement_id and the fields without
+// a STIX property in x_omnibasement_properties, so a bundle imports back into
+// the same documents. Objects whose key is a UUID use it as their STIX ID,
+// which keeps the IDs of imported objects stable across round trips.
+const (
+	stixSpecVersion = "2.1"
+	stixContentType = "application/stix+json;version=2.1"
+	stixTimeLayout  = "2006-01-02T15:04:05.000Z"
+
+	// stixReferenceRelation names the relationships between imported objects
+	// and the sources of their external references.
+	stixReferenceRelation = "references"
+
+	// stixEventObservable is the type of the observables of events related to
+	// no website.
+	stixEventObservable = "x-omnibasement-event"
+)
+
+const (
+	// stixNamespace derives the STIX IDs of documents whose key is not a UUID.
+	stixNamespace = "8c6e1f2a-3d4b-5e6f-9a7b-0c1d2e3f4a5b"
+	// stixObservableNamespace is the namespace STIX 2.1 defines for the
+	// deterministic IDs of cyber observables.
+	stixObservableNamespace = "00abedb4-aa42-466c-9c01-fed23315a9b7"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// stixTypeSeparators matches the characters relationship types do not allow.
+var stixTypeSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+type stixBundle struct {
+	Type    string            `json:"type"`
+	ID      string            `json:"id"`
+	Objects []json.RawMessage `json:"objects"`
+}
+
+type stixExternalReference struct {
+	SourceName  string `json:"source_name"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url,omitempty"`
+	ExternalID  string `json:"external_id,omitempty"`
+}
+
+// stixObject holds the properties of the STIX objects the graph maps to.
+type stixObject struct {
+	Type        string `json:"type"`
+	SpecVersion string `json:"spec_version,omitempty"`
+	ID          string `json:"id"`
+	Created     string `json:"created,omitempty"`
+	Modified    string `json:"modified,omitempty"`
+
+	// identity
+	Name          string   `json:"name,omitempty"`
+	Description   string   `json:"description,omitempty"`
+	IdentityClass string   `json:"identity_class,omitempty"`
+	Roles         []string `json:"roles,omitempty"`
+
+	// observed-data
+	FirstObserved  string   `json:"first_observed,omitempty"`
+	LastObserved   string   `json:"last_observed,omitempty"`
+	NumberObserved int      `json:"number_observed,omitempty"`
+	ObjectRefs     []string `json:"object_refs,omitempty"`
+
+	// sighting
+	FirstSeen     string `json:"first_seen,omitempty"`
+	LastSeen      string `json:"last_seen,omitempty"`
+	SightingOfRef string `json:"sighting_of_ref,omitempty"`
+
+	// url and domain-name
+	Value string `json:"value,omitempty"`
+
+	// relationship
+	RelationshipType string `json:"relationship_type,omitempty"`
+	SourceRef        string `json:"source_ref,omitempty"`
+	TargetRef        string `json:"target_ref,omitempty"`
+
+	Labels             []string                `json:"labels,omitempty"`
+	Confidence         *int32                  `json:"confidence,omitempty"`
+	ExternalReferences []stixExternalReference `json:"external_references,omitempty"`
+
+	OmnibasementID         string                 `json:"x_omnibasement_id,omitempty"`
+	OmnibasementName       string                 `json:"x_omnibasement_name,omitempty"`
+	OmnibasementProperties map[string]interface{} `json:"x_omnibasement_properties,omitempty"`
+}
+
+func (s *ExportService) ExportStixBundle(req *base.ExportRequest, stream base.ExportService_ExportStixBundleServer) error {
+	ctx := stream.Context()
+	logger := logging.GetLogger(ctx)
+
+	stream.SetHeader(downloadHeader("bundle.json"))
+	writer := bufio.NewWriterSize(&exportStreamWriter{stream: stream, contentType: stixContentType}, exportChunkSize)
+	if err := s.ExportStixTo(ctx, req, writer); err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to send STIX bundle")
+		return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	return nil
+}
+
+// ExportStixTo writes the entities and relationships matching the request to w
+// as a STIX 2.1 bundle.
+func (s *ExportService) ExportStixTo(ctx context.Context, req *base.ExportRequest, w io.Writer) error {
+	logger := logging.GetLogger(ctx)
+
+	builder := &stixBundleBuilder{
+		now:     time.Now().UTC().Format(stixTimeLayout),
+		objects: map[string]*stixObject{},
+		sources: map[string]stixExternalReference{},
+	}
+	if err := s.walk(ctx, req, builder.add); err != nil {
+		return err
+	}
+
+	if err := builder.write(w); err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to write STIX bundle")
+		return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	return nil
+}
+
+// stixBundleBuilder collects the objects of a bundle, as relationships to
+// sources become external references of objects written before them.
+type stixBundleBuilder struct {
+	now     string
+	order   []*stixObject
+	objects map[string]*stixObject
+	sources map[string]stixExternalReference
+}
+
+func (b *stixBundleBuilder) add(kind string, doc map[string]interface{}) error {
+	id, _ := takeField(doc, "_id").(string)
+	key, _ := takeField(doc, "_key").(string)
+	delete(doc, "_rev")
+
+	switch kind {
+	case "sources":
+		url, _ := doc["url"].(string)
+		name, _ := doc["name"].(string)
+		if name == "" {
+			name = url
+		}
+		b.sources[id] = stixExternalReference{SourceName: name, URL: url}
+		return nil
+	case RelationshipsType:
+		b.addRelationship(id, key, doc)
+		return nil
+	}
+
+	object := &stixObject{SpecVersion: stixSpecVersion, OmnibasementID: id}
+	created := stixTime(doc[exportTimeFields[kind]], b.now)
+	switch kind {
+	case "events":
+		happened := stixTime(takeField(doc, "happened_at"), b.now)
+		object.Type = "observed-data"
+		object.FirstObserved = happened
+		object.LastObserved = happened
+		object.NumberObserved = 1
+		object.Labels = stringList(takeField(doc, "tags"))
+	case "persons":
+		object.Type = "identity"
+		object.IdentityClass = "individual"
+		object.Name, _ = takeField(doc, "name").(string)
+		if role, _ := takeField(doc, "role").(string); role != "" {
+			object.Roles = []string{role}
+		}
+		object.Labels = stringList(takeField(doc, "tags"))
+	case "organizations":
+		object.Type = "identity"
+		object.IdentityClass = "organization"
+		object.Name, _ = takeField(doc, "name").(string)
+		object.Labels = stringList(takeField(doc, "tags"))
+	case "websites":
+		// Observables have no labels, created or modified properties
+		object.Type = "url"
+		object.Value, _ = takeField(doc, "url").(string)
+		if object.Value == "" {
+			object.Type = "domain-name"
+			object.Value, _ = takeField(doc, "domain").(string)
+		}
+		created = ""
+	default:
+		return fmt.Errorf("unsupported type %s", kind)
+	}
+
+	object.Created = created
+	object.Modified = created
+	object.ID = stixID(object, id, key)
+	if len(doc) > 0 {
+		object.OmnibasementProperties = doc
+	}
+
+	b.order = append(b.order, object)
+	b.objects[id] = object
+	return nil
+}
+
+func (b *stixBundleBuilder) addRelationship(id, key string, doc map[string]interface{}) {
+	from, _ := takeField(doc, "_from").(string)
+	to, _ := takeField(doc, "_to").(string)
+
+	// Relationships with sources become references of the other end
+	if reference, ok := b.sources[from]; ok {
+		b.addReference(b.objects[to], reference)
+		return
+	}
+	if reference, ok := b.sources[to]; ok {
+		b.addReference(b.objects[from], reference)
+		return
+	}
+
+	source, ok := b.objects[from]
+	if !ok {
+		return
+	}
+	target, ok := b.objects[to]
+	if !ok {
+		return
+	}
+
+	// Observed data refers to the observables it relates to
+	if source.Type == "observed-data" && isStixObservable(target.Type) {
+		source.ObjectRefs = append(source.ObjectRefs, target.ID)
+	} else if target.Type == "observed-data" && isStixObservable(source.Type) {
+		target.ObjectRefs = append(target.ObjectRefs, source.ID)
+	}
+
+	name, _ := takeField(doc, "name").(string)
+	created := stixTime(doc["created_at"], b.now)
+	object := &stixObject{
+		Type:             "relationship",
+		SpecVersion:      stixSpecVersion,
+		Created:          created,
+		Modified:         stixTime(doc["updated_at"], created),
+		RelationshipType: stixRelationshipType(name),
+		SourceRef:        source.ID,
+		TargetRef:        target.ID,
+		OmnibasementID:   id,
+		OmnibasementName: name,
+	}
+	if confidence, ok := takeField(doc, "confidence").(float64); ok {
+		value := int32(confidence)
+		object.Confidence = &value
+	}
+	object.ID = stixID(object, id, key)
+	if len(doc) > 0 {
+		object.OmnibasementProperties = doc
+	}
+
+	b.order = append(b.order, object)
+}
+
+func (b *stixBundleBuilder) addReference(object *stixObject, reference stixExternalReference) {
+	if object == nil {
+		return
+	}
+	for _, existing := range object.ExternalReferences {
+		if existing == reference {
+			return
+		}
+	}
+	object.ExternalReferences = append(object.ExternalReferences, reference)
+}
+
+// write writes the bundle one object at a time, preceding the observed data
+// that refers to no observable by an observable of its own.
+func (b *stixBundleBuilder) write(w io.Writer) error {
+	header := fmt.Sprintf(`{"type":"bundle","id":"bundle--%s","objects":[`, randomUUID())
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+
+	count := 0
+	writeObject := func(object *stixObject) error {
+		data, err := json.Marshal(object)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			data = append([]byte{','}, data...)
+		}
+		count++
+		_, err = w.Write(data)
+		return err
+	}
+
+	for _, object := range b.order {
+		if object.Type == "observed-data" && len(object.ObjectRefs) == 0 {
+			observable := &stixObject{
+				Type:           stixEventObservable,
+				SpecVersion:    stixSpecVersion,
+				ID:             stixEventObservable + "--" + uuidV5(stixNamespace, object.ID),
+				OmnibasementID: object.OmnibasementID,
+			}
+			object.ObjectRefs = []string{observable.ID}
+			if err := writeObject(observable); err != nil {
+				return err
+			}
+		}
+		if err := writeObject(object); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "]}\n")
+	return err
+}
+
+func (s *ImportService) ImportStixBundle(stream base.ImportService_ImportStixBundleServer) error {
+	ctx := stream.Context()
+	logger := logging.GetLogger(ctx)
+
+	first, err := stream.Recv()
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to receive STIX bundle")
+		return status.Errorf(codes.InvalidArgument, "Bad parameter")
+	}
+
+	reader := &importStreamReader{buf: first.GetData(), recv: func() ([]byte, error) {
+		req, err := stream.Recv()
+		return req.GetData(), err
+	}}
+	response, err := s.ImportStixReader(ctx, first.GetDryRun(), reader)
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(response)
+}
+
+// ImportStixReader imports the objects of a STIX 2.1 bundle. Row numbers in
+// the report are positions of objects in the bundle.
+func (s *ImportService) ImportStixReader(ctx context.Context, dryRun bool, r io.Reader) (*base.ImportResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Info("Importing STIX bundle")
+
+	var bundle stixBundle
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil || bundle.Type != "bundle" {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Info("failed to read STIX bundle")
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid STIX bundle")
+	}
+
+	response := &base.ImportResponse{DryRun: dryRun}
+	var rows []*importRow
+	references := map[string]bool{}
+	for i, raw := range bundle.Objects {
+		position := int64(i + 1)
+		response.Rows++
+
+		var object stixObject
+		if err := json.Unmarshal(raw, &object); err != nil {
+			rejectImportRow(response, position, fmt.Sprintf("invalid STIX object: %v", err))
+			continue
+		}
+
+		objectRows, err := stixRows(&object, position)
+		if err != nil {
+			rejectImportRow(response, position, err.Error())
+			continue
+		}
+
+		for _, row := range objectRows {
+			// Objects citing the same reference share its source
+			if row.kind == "sources" {
+				if references[row.tempID] {
+					continue
+				}
+				references[row.tempID] = true
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	if err := s.importRows(ctx, rows, dryRun, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// stixRows maps a STIX object to the rows of its document, and of the sources
+// and relationships of its external references. Event observables have none.
+func stixRows(object *stixObject, position int64) ([]*importRow, error) {
+	if object.Type == stixEventObservable {
+		return nil, nil
+	}
+
+	fields := map[string]interface{}{}
+	for name, value := range object.OmnibasementProperties {
+		fields[name] = value
+	}
+	fields[ImportTempIDField] = object.ID
+
+	var kind string
+	switch object.Type {
+	case "identity":
+		kind = "organizations"
+		if object.IdentityClass == "individual" {
+			kind = "persons"
+			if len(object.Roles) > 0 {
+				fields["role"] = object.Roles[0]
+			}
+		}
+		fields["name"] = object.Name
+	case "observed-data":
+		kind = "events"
+		if err := setStixTime(fields, "happened_at", object.FirstObserved); err != nil {
+			return nil, err
+		}
+	case "sighting":
+		kind = "events"
+		if err := setStixTime(fields, "happened_at", object.FirstSeen); err != nil {
+			return nil, err
+		}
+		if object.Description != "" {
+			fields["description"] = object.Description
+		}
+	case "url":
+		kind = "websites"
+		fields["url"] = object.Value
+	case "domain-name":
+		kind = "websites"
+		fields["domain"] = object.Value
+	case "relationship":
+		kind = RelationshipsType
+		fields["_from"] = object.SourceRef
+		fields["_to"] = object.TargetRef
+		if object.OmnibasementName != "" {
+			fields["name"] = object.OmnibasementName
+		} else if _, ok := fields["name"]; !ok {
+			fields["name"] = strings.ReplaceAll(object.RelationshipType, "-", "_")
+		}
+		if object.Confidence != nil {
+			fields["confidence"] = *object.Confidence
+		}
+	default:
+		return nil, fmt.Errorf("unsupported STIX object type %q", object.Type)
+	}
+
+	if len(object.Labels) > 0 && kind != "websites" {
+		fields["tags"] = object.Labels
+	}
+
+	// Keep the key of exported documents, or the UUID of foreign objects.
+	// Websites without a key are matched by their URL instead.
+	if _, key, ok := strings.Cut(object.OmnibasementID, "/"); ok {
+		fields["_key"] = key
+	} else if _, id, ok := strings.Cut(object.ID, "--"); ok && kind != "websites" && uuidPattern.MatchString(id) {
+		fields["_key"] = id
+	}
+
+	row, err := newImportRow(position, fields, kind)
+	if err != nil {
+		return nil, err
+	}
+	rows := []*importRow{row}
+	if kind == RelationshipsType {
+		return rows, nil
+	}
+
+	for _, reference := range object.ExternalReferences {
+		if reference.URL == "" {
+			continue
+		}
+
+		name := reference.SourceName
+		if name == "" {
+			name = reference.URL
+		}
+		tempID := "external-reference--" + uuidV5(stixNamespace, reference.URL)
+		rows = append(rows,
+			&importRow{line: position, kind: "sources", tempID: tempID, doc: &model.Source{Name: name, Url: reference.URL}},
+			&importRow{line: position, kind: RelationshipsType, doc: &model.Relation{From: object.ID, To: tempID, Name: stixReferenceRelation}},
+		)
+	}
+	return rows, nil
+}
+
+func takeField(doc map[string]interface{}, name string) interface{} {
+	value := doc[name]
+	delete(doc, name)
+	return value
+}
+
+func stringList(value interface{}) []string {
+	items, _ := value.([]interface{})
+	var list []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// stixTime formats a timestamp in seconds, or returns fallback when it is unset.
+func stixTime(value interface{}, fallback string) string {
+	seconds, ok := value.(float64)
+	if !ok || seconds == 0 {
+		return fallback
+	}
+	return time.Unix(int64(seconds), 0).UTC().Format(stixTimeLayout)
+}
+
+func setStixTime(fields map[string]interface{}, name, value string) error {
+	if value == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", value)
+	}
+	fields[name] = t.Unix()
+	return nil
+}
+
+// stixRelationshipType returns the relationship type of a relationship name,
+// in lowercase letters and digits separated by hyphens.
+func stixRelationshipType(name string) string {
+	relationshipType := strings.Trim(stixTypeSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if relationshipType == "" {
+		return "related-to"
+	}
+	return relationshipType
+}
+
+func isStixObservable(stixType string) bool {
+	return stixType == "url" || stixType == "domain-name"
+}
+
+// stixID returns the STIX ID of a document. Keys that are UUIDs are kept, and
+// other IDs are derived from the value of observables as STIX 2.1 recommends
+// or from the document ID.
+func stixID(object *stixObject, id, key string) string {
+	if uuidPattern.MatchString(key) {
+		return object.Type + "--" + key
+	}
+
+	if isStixObservable(object.Type) {
+		// The ID contributing property of both observables is their value
+		var value strings.Builder
+		encoder := json.NewEncoder(&value)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(map[string]string{"value": object.Value})
+		return object.Type + "--" + uuidV5(stixObservableNamespace, strings.TrimSuffix(value.String(), "\n"))
+	}
+	return object.Type + "--" + uuidV5(stixNamespace, id)
+}
+
+// uuidV5 returns the name based UUID of name in namespace (RFC 4122).
+func uuidV5(namespace, name string) string {
+	ns, _ := hex.DecodeString(strings.ReplaceAll(namespace, "-", ""))
+	hash := sha1.New()
+	hash.Write(ns)
+	hash.Write([]byte(name))
+	sum := hash.Sum(nil)[:16]
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return formatUUID(sum)
+}
+
+func randomUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return formatUUID(b)
+}
+
+func formatUUID(b []byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
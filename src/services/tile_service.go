@@ -0,0 +1,291 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// TileCacheTTL is the environment variable overriding how long tiles are cached.
+	TileCacheTTL = "TILE_CACHE_TTL"
+
+	// MaxTileZoom is the deepest zoom level tiles are served for.
+	MaxTileZoom = 22
+	// ClusterMaxZoom is the first zoom level at which events are not clustered.
+	ClusterMaxZoom = 14
+
+	mvtContentType  = "application/vnd.mapbox-vector-tile"
+	defaultTileTTL  = time.Minute
+	tileCacheSize   = 4096
+	clusterGridSize = 32
+)
+
+type TileService struct {
+	base.UnimplementedTileServiceServer
+
+	DBClient   *clients.ArangoDBClient
+	Collection driver.Collection
+	Cache      *TileCache
+}
+
+func NewTileService(client *clients.ArangoDBClient) (*TileService, error) {
+	ttl := defaultTileTTL
+	if value := os.Getenv(TileCacheTTL); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %v", TileCacheTTL, value, err)
+		}
+		ttl = parsed
+	}
+
+	ctx := context.Background()
+	collection, err := client.GetCreateCollection(ctx, "events", driver.CreateVertexCollectionOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get or create events collection: %v", err)
+	}
+
+	service := &TileService{
+		DBClient:   client,
+		Collection: collection,
+		Cache:      NewTileCache(tileCacheSize, ttl),
+	}
+	return service, nil
+}
+
+// tileCluster is a cell of a tile with the events located in it.
+type tileCluster struct {
+	Count      int64   `json:"count"`
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	Key        string  `json:"key"`
+	Title      string  `json:"title"`
+	HappenedAt int64   `json:"happened_at"`
+}
+
+func (s *TileService) GetEventTile(ctx context.Context, req *base.GetEventTileRequest) (*httpbody.HttpBody, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Getting event tile %d/%d/%s", req.GetZ(), req.GetX(), req.GetY())
+
+	z, x := int(req.GetZ()), int(req.GetX())
+	y, err := strconv.Atoi(strings.TrimSuffix(req.GetY(), ".mvt"))
+	if err != nil || z < 0 || z > MaxTileZoom || x < 0 || x >= 1<<z || y < 0 || y >= 1<<z {
+		logger.WithFields(logrus.Fields{
+			"z": req.GetZ(),
+			"x": req.GetX(),
+			"y": req.GetY(),
+		}).Info("invalid tile")
+		return nil, status.Errorf(codes.InvalidArgument, "Bad parameter")
+	}
+	if req.GetEndTime() != 0 && req.GetStartTime() > req.GetEndTime() {
+		return nil, status.Errorf(codes.InvalidArgument, "Start time must not be after end time")
+	}
+
+	grpc.SetHeader(ctx, metadata.Pairs("cache-control", fmt.Sprintf("public, max-age=%d", int(s.Cache.TTL.Seconds()))))
+
+	key := tileCacheKey(z, x, y, req)
+	if data, ok := s.Cache.Get(key); ok {
+		return &httpbody.HttpBody{ContentType: mvtContentType, Data: data}, nil
+	}
+
+	clusters, err := s.queryClusters(ctx, z, x, y, req)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"tile":  key,
+		}).Error("failed to query event tile")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	layer := newMVTLayer("events")
+	for _, cluster := range clusters {
+		px := min(max(int64(cluster.X*TileExtent), 0), TileExtent-1)
+		py := min(max(int64(cluster.Y*TileExtent), 0), TileExtent-1)
+		if cluster.Count == 1 {
+			layer.addPoint(px, py, map[string]interface{}{
+				"key":         cluster.Key,
+				"title":       cluster.Title,
+				"happened_at": cluster.HappenedAt,
+			})
+		} else {
+			layer.addPoint(px, py, map[string]interface{}{
+				"cluster":     true,
+				"point_count": cluster.Count,
+			})
+		}
+	}
+
+	data := encodeMVTTile(layer)
+	s.Cache.Put(key, data)
+	return &httpbody.HttpBody{ContentType: mvtContentType, Data: data}, nil
+}
+
+// queryClusters groups the events of a tile by cells of the cluster grid, or
+// by tile unit from the cluster zoom level on. Positions are fractions of the
+// tile in Web Mercator.
+func (s *TileService) queryClusters(ctx context.Context, z, x, y int, req *base.GetEventTileRequest) ([]*tileCluster, error) {
+	n := math.Exp2(float64(z))
+	cells := clusterGridSize
+	if z >= ClusterMaxZoom {
+		cells = TileExtent
+	}
+
+	filters := []string{
+		eventLocatedFilter,
+		"lat >= @minLatitude AND lat <= @maxLatitude AND lon >= @minLongitude AND lon <= @maxLongitude",
+	}
+	bindVars := map[string]interface{}{
+		"@collection":  s.Collection.Name(),
+		"n":            n,
+		"x":            x,
+		"y":            y,
+		"cells":        cells,
+		"minLongitude": float64(x)/n*360 - 180,
+		"maxLongitude": float64(x+1)/n*360 - 180,
+		"minLatitude":  tileLatitude(float64(y+1), n),
+		"maxLatitude":  tileLatitude(float64(y), n),
+	}
+
+	if req.GetStartTime() != 0 {
+		filters = append(filters, "doc.happened_at >= @startTime")
+		bindVars["startTime"] = req.GetStartTime()
+	}
+	if req.GetEndTime() != 0 {
+		filters = append(filters, "doc.happened_at <= @endTime")
+		bindVars["endTime"] = req.GetEndTime()
+	}
+	if len(req.GetTags()) > 0 {
+		filters = append(filters, "@tags ANY IN doc.tags")
+		bindVars["tags"] = req.GetTags()
+	}
+
+	query := "FOR doc IN @@collection\n"
+	query += "\tLET lat = doc.location.latitude || 0\n"
+	query += "\tLET lon = doc.location.longitude || 0\n"
+	for _, filter := range filters {
+		query += "\tFILTER " + filter + "\n"
+	}
+	query += `
+		LET tx = (lon + 180) / 360 * @n - @x
+		LET ty = (1 - LOG(TAN(PI() / 4 + RADIANS(lat) / 2)) / PI()) / 2 * @n - @y
+		FILTER tx >= 0 AND tx < 1 AND ty >= 0 AND ty < 1
+		COLLECT cx = FLOOR(tx * @cells), cy = FLOOR(ty * @cells)
+		AGGREGATE count = LENGTH(1), avgX = AVG(tx), avgY = AVG(ty),
+			key = MAX(doc._key), title = MAX(doc.title), happenedAt = MAX(doc.happened_at)
+		RETURN { count, x: avgX, y: avgY, key, title, happened_at: happenedAt }
+	`
+
+	cursor, err := s.DBClient.DB.Query(ctx, query, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	var clusters []*tileCluster
+	for {
+		cluster := &tileCluster{}
+		if _, err := cursor.ReadDocument(ctx, cluster); driver.IsNoMoreDocuments(err) {
+			return clusters, nil
+		} else if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, cluster)
+	}
+}
+
+// tileLatitude returns the latitude of the northern edge of tile row y.
+func tileLatitude(y, n float64) float64 {
+	return math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi
+}
+
+func tileCacheKey(z, x, y int, req *base.GetEventTileRequest) string {
+	tags := append([]string(nil), req.GetTags()...)
+	sort.Strings(tags)
+	return fmt.Sprintf("%d/%d/%d?start=%d&end=%d&tags=%q", z, x, y, req.GetStartTime(), req.GetEndTime(), tags)
+}
+
+// TileCache keeps the most recently used tiles for a limited time.
+type TileCache struct {
+	TTL time.Duration
+
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type tileCacheEntry struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+func NewTileCache(size int, ttl time.Duration) *TileCache {
+	return &TileCache{
+		TTL:     ttl,
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (c *TileCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*tileCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.data, true
+}
+
+func (c *TileCache) Put(key string, data []byte) {
+	if c.TTL <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &tileCacheEntry{key: key, data: data, expires: time.Now().Add(c.TTL)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*tileCacheEntry).key)
+	}
+}
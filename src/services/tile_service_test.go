@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+)
+
+func TestTileService(t *testing.T) {
+	// Skip test if ArangoDB is not available
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	// Create ArangoDB client
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	// Create TileService
+	service, err := NewTileService(client)
+	if err != nil {
+		t.Fatalf("Failed to create TileService: %v", err)
+	}
+
+	importService, err := NewImportService(client, changes)
+	if err != nil {
+		t.Fatalf("Failed to create ImportService: %v", err)
+	}
+
+	// Two events close to each other in Berlin
+	tag := fmt.Sprintf("tile-%d", time.Now().UnixNano())
+	jsonl := strings.Join([]string{
+		fmt.Sprintf(`{"_type": "events", "title": "Tile Event 1", "tags": [%q], "location": {"latitude": 52.52, "longitude": 13.40}}`, tag),
+		fmt.Sprintf(`{"_type": "events", "title": "Tile Event 2", "tags": [%q], "location": {"latitude": 52.53, "longitude": 13.41}}`, tag),
+	}, "\n")
+	if _, err := importService.ImportReader(context.Background(), &base.ImportOptions{
+		Format: base.ImportFormat_IMPORT_FORMAT_JSONL,
+	}, strings.NewReader(jsonl)); err != nil {
+		t.Fatalf("Failed to import events: %v", err)
+	}
+
+	t.Run("Clustered Tile", func(t *testing.T) {
+		resp, err := service.GetEventTile(context.Background(), &base.GetEventTileRequest{
+			Z: 0, X: 0, Y: "0.mvt", Tags: []string{tag},
+		})
+		if err != nil {
+			t.Fatalf("Failed to get tile: %v", err)
+		}
+
+		if resp.ContentType != mvtContentType {
+			t.Errorf("Expected content type %s, got %s", mvtContentType, resp.ContentType)
+		}
+		if !strings.Contains(string(resp.Data), "point_count") {
+			t.Errorf("Expected the events to be clustered at zoom 0")
+		}
+	})
+
+	t.Run("Empty Tile", func(t *testing.T) {
+		resp, err := service.GetEventTile(context.Background(), &base.GetEventTileRequest{
+			Z: 1, X: 0, Y: "1.mvt", Tags: []string{tag},
+		})
+		if err != nil {
+			t.Fatalf("Failed to get tile: %v", err)
+		}
+
+		if len(resp.Data) != 0 {
+			t.Errorf("Expected an empty tile in the south west, got %d bytes", len(resp.Data))
+		}
+	})
+
+	t.Run("Invalid Tile", func(t *testing.T) {
+		_, err := service.GetEventTile(context.Background(), &base.GetEventTileRequest{
+			Z: 1, X: 2, Y: "0.mvt",
+		})
+		if err == nil {
+			t.Error("Expected an error for a tile outside the zoom level")
+		}
+	})
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	_ "embed"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Latin spellings of Cyrillic, Greek, Hebrew and Arabic letters, following
+// the common romanizations of names. Letters without a sound are dropped.
+var latinLetters = map[rune]string{
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g", 'ў': "u", 'ђ': "dj", 'ј': "j",
+	'љ': "lj", 'њ': "nj", 'ћ': "c", 'џ': "dz", 'ѓ': "gj", 'ќ': "kj", 'ѕ': "dz",
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th",
+	'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p",
+	'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps",
+	'ω': "o",
+	// Hebrew
+	'א': "", 'ב': "b", 'ג': "g", 'ד': "d", 'ה': "h", 'ו': "v", 'ז': "z", 'ח': "ch",
+	'ט': "t", 'י': "y", 'כ': "k", 'ך': "k", 'ל': "l", 'מ': "m", 'ם': "m", 'נ': "n",
+	'ן': "n", 'ס': "s", 'ע': "", 'פ': "p", 'ף': "f", 'צ': "ts", 'ץ': "ts", 'ק': "k",
+	'ר': "r", 'ש': "sh", 'ת': "t",
+	// Arabic and Persian, whose short vowels are not written
+	'ا': "a", 'أ': "a", 'إ': "i", 'آ': "a", 'ء': "", 'ؤ': "", 'ئ': "", 'ب': "b",
+	'ت': "t", 'ث': "th", 'ج': "j", 'ح': "h", 'خ': "kh", 'د': "d", 'ذ': "dh", 'ر': "r",
+	'ز': "z", 'س': "s", 'ش': "sh", 'ص': "s", 'ض': "d", 'ط': "t", 'ظ': "z", 'ع': "",
+	'غ': "gh", 'ف': "f", 'ق': "q", 'ك': "k", 'ل': "l", 'م': "m", 'ن': "n", 'ه': "h",
+	'ة': "a", 'و': "w", 'ي': "y", 'ى': "a", 'پ': "p", 'چ': "ch", 'ژ': "zh", 'گ': "g",
+	'ک': "k", 'ی': "y",
+}
+
+// Greek vowels forming a digraph with a following υ, and the consonants
+// after which αυ and ευ sound as af and ef.
+var greekDiphthongs = map[rune]string{'α': "a", 'ε': "e", 'η': "i", 'ο': "ou"}
+
+const greekVoiceless = "θκξπστφχψ"
+
+// Romaji of the hiragana syllables; katakana map to the same syllables.
+var kanaSyllables = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o", 'ゔ': "vu",
+}
+
+// Small kana combining with the preceding syllable, as in "きょ" (kyo).
+var kanaGlides = map[rune]string{'ゃ': "a", 'ゅ': "u", 'ょ': "o"}
+
+// Revised Romanization of the initial, medial and final jamo of Hangul syllables.
+var (
+	hangulInitials = []string{"g", "kk", "n", "d", "tt", "r", "m", "b", "pp", "s", "ss", "", "j", "jj", "ch", "k", "t", "p", "h"}
+	hangulMedials  = []string{"a", "ae", "ya", "yae", "eo", "e", "yeo", "ye", "o", "wa", "wae", "oe", "yo", "u", "wo", "we", "wi", "yu", "eu", "ui", "i"}
+	hangulFinals   = []string{"", "k", "k", "k", "n", "n", "n", "t", "l", "k", "m", "l", "l", "l", "p", "l", "m", "p", "p", "t", "t", "ng", "t", "t", "k", "t", "p", "t"}
+)
+
+//go:embed han_readings.tsv
+var hanReadingsTable string
+
+// hanReadings holds the pinyin of the ideographs of hanReadingsTable, and
+// hanSurnames those read as a surname at the start of a name.
+var hanReadings, hanSurnames = parseHanReadings(hanReadingsTable)
+
+const (
+	hangulFirst = 0xAC00
+	hangulLast  = 0xD7A3
+	// Katakana are hiragana shifted by this offset
+	katakanaOffset = 0x60
+)
+
+// transliterate returns name with the letters of Cyrillic, Greek, Hebrew,
+// Arabic, kana and Hangul in Latin script, in lower case. Han ideographs are
+// read in pinyin where hanReadings has them; kanji are read as Chinese too,
+// since their Japanese reading depends on the word. Other letters are kept.
+func transliterate(name string) string {
+	runes := []rune(strings.ToLower(norm.NFKC.String(name)))
+
+	var b strings.Builder
+	double := false
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r >= 'ァ' && r <= 'ヶ' {
+			r -= katakanaOffset
+		}
+
+		var latin string
+		switch {
+		case r == 'っ':
+			// Small tsu doubles the consonant that follows
+			double = true
+			continue
+		case r == 'ー':
+			continue
+		case kanaSyllables[r] != "":
+			latin = kanaSyllables[r]
+			if i+1 < len(runes) {
+				next := runes[i+1]
+				if next >= 'ァ' && next <= 'ヶ' {
+					next -= katakanaOffset
+				}
+				if vowel, ok := kanaGlides[next]; ok && strings.HasSuffix(latin, "i") {
+					latin = kanaGlide(latin, vowel)
+					i++
+				}
+			}
+		case i+1 < len(runes) && greekDiphthongs[baseLetter(r)] != "" && baseLetter(runes[i+1]) == 'υ':
+			latin = greekDiphthongs[baseLetter(r)]
+			if latin != "ou" {
+				// αυ, ευ and ηυ sound as f before voiceless consonants and v otherwise
+				if i+2 < len(runes) && strings.ContainsRune(greekVoiceless, baseLetter(runes[i+2])) {
+					latin += "f"
+				} else {
+					latin += "v"
+				}
+			}
+			i++
+		case hanReadings[r] != "":
+			end := i + 1
+			for end < len(runes) && unicode.Is(unicode.Han, runes[end]) {
+				end++
+			}
+			latin = hanReading(runes[i:end])
+			i = end - 1
+		case r >= hangulFirst && r <= hangulLast:
+			syllable := int(r - hangulFirst)
+			latin = hangulInitials[syllable/588] + hangulMedials[syllable%588/28] + hangulFinals[syllable%28]
+		default:
+			if letter, ok := latinLetters[r]; ok {
+				latin = letter
+			} else if base := baseLetter(r); base != r && latinLetters[base] != "" {
+				// Accented Greek and Cyrillic letters
+				latin = latinLetters[base]
+			} else if vowel, ok := kanaGlides[r]; ok {
+				latin = vowel
+			} else {
+				latin = string(r)
+			}
+		}
+
+		if double && latin != "" {
+			if consonant := latin[0]; consonant != 'a' && consonant != 'i' && consonant != 'u' && consonant != 'e' && consonant != 'o' && unicode.IsLetter(rune(consonant)) {
+				if strings.HasPrefix(latin, "ch") {
+					b.WriteByte('t')
+				} else {
+					b.WriteByte(consonant)
+				}
+			}
+			double = false
+		}
+		b.WriteString(latin)
+	}
+	return b.String()
+}
+
+// baseLetter returns r without its accents.
+func baseLetter(r rune) rune {
+	return []rune(norm.NFD.String(string(r)))[0]
+}
+
+// kanaGlide combines a syllable ending in "i" with a small ya, yu or yo.
+func kanaGlide(syllable, vowel string) string {
+	consonant := strings.TrimSuffix(syllable, "i")
+	switch consonant {
+	case "sh", "ch", "j":
+		return consonant + vowel
+	case "":
+		return "y" + vowel
+	}
+	return consonant + "y" + vowel
+}
+
+// hanReading returns the pinyin of a run of Han ideographs, keeping those
+// without a reading. A run of two to four ideographs starting with a surname
+// is read as a Chinese name, with the given name apart, as in "li xiaolong".
+func hanReading(run []rune) string {
+	var b strings.Builder
+	for i, r := range run {
+		if i == 1 && len(run) <= 4 && hanSurnames[run[0]] {
+			b.WriteByte(' ')
+		}
+		if reading, ok := hanReadings[r]; ok {
+			b.WriteString(reading)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func parseHanReadings(table string) (map[rune]string, map[rune]bool) {
+	readings := map[rune]string{}
+	surnames := map[rune]bool{}
+	for _, line := range strings.Split(table, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		columns := strings.Split(line, "\t")
+		if len(columns) < 2 {
+			continue
+		}
+		for _, r := range columns[1] {
+			readings[r] = columns[0]
+		}
+		if len(columns) > 2 {
+			for _, r := range columns[2] {
+				surnames[r] = true
+			}
+		}
+	}
+	return readings, surnames
+}
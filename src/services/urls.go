@@ -0,0 +1,243 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// trackingParameters are query parameters identifying a campaign or a click
+// rather than a resource. Parameters starting with "utm_" are dropped as well.
+var trackingParameters = []string{
+	"fbclid", "gclid", "dclid", "gbraid", "wbraid", "msclkid", "yclid", "igshid",
+	"mc_cid", "mc_eid", "_ga", "_gl", "_hsenc", "_hsmi", "mkt_tok", "ref_src", "spm",
+}
+
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// websiteDocument is a website stored with its canonical URL, the domain
+// derived from it and its registrable domain.
+type websiteDocument struct {
+	*model.Website
+	// Shadow the fields of the website when encoded
+	Url               string `json:"url,omitempty"`
+	Domain            string `json:"domain,omitempty"`
+	RegistrableDomain string `json:"registrable_domain,omitempty"`
+}
+
+// sourceDocument is a source stored with its canonical URL, the root URL
+// derived from it and its registrable domain.
+type sourceDocument struct {
+	*model.Source
+	// Shadow the fields of the source when encoded
+	Url               string `json:"url,omitempty"`
+	RootUrl           string `json:"root_url,omitempty"`
+	RegistrableDomain string `json:"registrable_domain,omitempty"`
+}
+
+// newWebsiteDocument canonicalizes the URL of website and derives its domain,
+// or canonicalizes its domain if it has no URL. field names the website in
+// errors, e.g. "website" or "websites[2]".
+func newWebsiteDocument(website *model.Website, field string) (*websiteDocument, error) {
+	doc := &websiteDocument{Website: website}
+	switch {
+	case website.GetUrl() != "":
+		u, err := canonicalURL(website.GetUrl())
+		if err != nil {
+			return nil, fieldError(field+".url", err)
+		}
+		doc.Url = u.String()
+		doc.Domain = u.Hostname()
+	case website.GetDomain() != "":
+		host, err := canonicalHost(website.GetDomain())
+		if err != nil {
+			return nil, fieldError(field+".domain", err)
+		}
+		doc.Domain = host
+	}
+	if doc.Domain != "" {
+		doc.RegistrableDomain = registrableDomain(doc.Domain)
+	}
+	return doc, nil
+}
+
+// newSourceDocument validates the reliability grade and the monitoring
+// interval of source, canonicalizes its URL and derives its root URL, or
+// canonicalizes its root URL if it has no URL. field names the source in
+// errors, e.g. "source" or "sources[2]".
+func newSourceDocument(source *model.Source, field string) (*sourceDocument, error) {
+	if err := checkReliability(source.GetReliability()); err != nil {
+		return nil, fieldError(field+".reliability", err)
+	}
+	if source.GetMonitoring() < 0 {
+		return nil, fieldError(field+".monitoring", errors.New("must be a number of minutes, or 0 to not monitor"))
+	}
+
+	doc := &sourceDocument{Source: source}
+	var u *url.URL
+	switch {
+	case source.GetUrl() != "":
+		parsed, err := canonicalURL(source.GetUrl())
+		if err != nil {
+			return nil, fieldError(field+".url", err)
+		}
+		doc.Url = parsed.String()
+		u = parsed
+	case source.GetRootUrl() != "":
+		parsed, err := canonicalURL(source.GetRootUrl())
+		if err != nil {
+			return nil, fieldError(field+".root_url", err)
+		}
+		u = parsed
+	}
+	if u != nil {
+		doc.RootUrl = (&url.URL{Scheme: u.Scheme, Host: u.Host}).String()
+		doc.RegistrableDomain = registrableDomain(u.Hostname())
+	}
+	return doc, nil
+}
+
+// canonicalURL parses rawURL, assuming https when it has no scheme, and returns
+// it with a lower case scheme and host, without user, default port, tracking
+// parameters or fragment, and with sorted query parameters.
+func canonicalURL(rawURL string) (*url.URL, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	switch {
+	case strings.HasPrefix(rawURL, "//"):
+		rawURL = "https:" + rawURL
+	case !strings.Contains(rawURL, "://"):
+		rawURL = "https://" + rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.New("malformed URL")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := defaultPorts[u.Scheme]; !ok {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	host, err := canonicalHost(u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid port %q", port)
+		}
+		host += ":" + port
+	}
+
+	canonical := &url.URL{
+		Scheme:   u.Scheme,
+		Host:     host,
+		Path:     u.Path,
+		RawQuery: canonicalQuery(u.RawQuery),
+	}
+	if u.RawPath != "" {
+		canonical.RawPath = u.RawPath
+	}
+	return canonical, nil
+}
+
+// canonicalQuery returns the "&"-separated parameters of rawQuery sorted by
+// name, without tracking parameters and the empty segments of "&&". Parameters
+// are kept as written, values included even when empty, since servers may read
+// ";", "a=" or a parameter without "=" differently once re-encoded.
+func canonicalQuery(rawQuery string) string {
+	type parameter struct {
+		name, raw string
+	}
+	var parameters []parameter
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(raw, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if strings.HasPrefix(strings.ToLower(name), "utm_") || containsFold(trackingParameters, name) {
+			continue
+		}
+		parameters = append(parameters, parameter{name: name, raw: raw})
+	}
+
+	// Repeated parameters keep their order
+	slices.SortStableFunc(parameters, func(a, b parameter) int {
+		return strings.Compare(a.name, b.name)
+	})
+	raws := make([]string, len(parameters))
+	for i, p := range parameters {
+		raws[i] = p.raw
+	}
+	return strings.Join(raws, "&")
+}
+
+// canonicalHost returns host in lower case and ASCII, or the IP address it holds.
+func canonicalHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	if host == "" {
+		return "", errors.New("missing host")
+	}
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return ip.String(), nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid host %q", host)
+	}
+	return ascii, nil
+}
+
+// registrableDomain returns the domain of host that can be registered, e.g.
+// "example.co.uk" for "www.example.co.uk", according to the Public Suffix List.
+func registrableDomain(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		// Hosts that are a public suffix or have a single label
+		return host
+	}
+	return domain
+}
+
+// fieldError returns an InvalidArgument error with the invalid field as
+// details.
+func fieldError(field string, err error) error {
+	st := status.New(codes.InvalidArgument, fmt.Sprintf("Invalid %s: %v", field, err))
+	detailed, detailsErr := st.WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: field, Description: err.Error()}},
+	})
+	if detailsErr == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,814 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/arangodb/go-driver"
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"github.com/omnsight/omniscent-library/src/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// WebhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256, keyed
+	// with the webhook secret, of the timestamp header, a "." and the body.
+	WebhookSignatureHeader = "X-Omnibasement-Signature"
+	WebhookTimestampHeader = "X-Omnibasement-Timestamp"
+	WebhookEventHeader     = "X-Omnibasement-Event"
+	WebhookDeliveryHeader  = "X-Omnibasement-Delivery"
+	// WebhookAllowPrivateTargets is the environment variable allowing webhooks
+	// to target loopback, link-local and private addresses.
+	WebhookAllowPrivateTargets = "WEBHOOK_ALLOW_PRIVATE_TARGETS"
+
+	deliveryPending    = "pending"
+	deliveryInProgress = "delivering"
+	deliveryDelivered  = "delivered"
+	deliveryDead       = "dead"
+
+	// webhookCursorKey names the change cursor of the webhook dispatcher
+	webhookCursorKey     = "webhooks"
+	webhookPollInterval  = time.Second
+	webhookBatchSize     = 100
+	webhookLease         = time.Minute
+	webhookTimeout       = 10 * time.Second
+	maxWebhookResponse   = 64 << 10
+	defaultDeliveryLimit = 100
+	maxDeliveryLimit     = 1000
+
+	defaultMaxAttempts = 8
+	defaultRetryBase   = 10 * time.Second
+	defaultRetryMax    = time.Hour
+)
+
+var deliveryStatuses = map[string]base.DeliveryStatus{
+	deliveryPending:    base.DeliveryStatus_DELIVERY_STATUS_PENDING,
+	deliveryInProgress: base.DeliveryStatus_DELIVERY_STATUS_PENDING,
+	deliveryDelivered:  base.DeliveryStatus_DELIVERY_STATUS_DELIVERED,
+	deliveryDead:       base.DeliveryStatus_DELIVERY_STATUS_DEAD,
+}
+
+type WebhookService struct {
+	base.UnimplementedWebhookServiceServer
+
+	DBClient   *clients.ArangoDBClient
+	Collection driver.Collection
+	Deliveries driver.Collection
+	Cursors    driver.Collection
+	Changes    *ChangeLog
+	HTTPClient *http.Client
+
+	// MaxAttempts is the number of failed attempts after which a delivery is dead
+	MaxAttempts int
+	// RetryBase is the delay of the first retry, doubling with every attempt up to RetryMax
+	RetryBase time.Duration
+	RetryMax  time.Duration
+	// AllowPrivateTargets lets webhooks reach the network of the deployment
+	AllowPrivateTargets bool
+
+	// dispatchMu guards window, the position of the dispatcher in the change log
+	dispatchMu sync.Mutex
+	window     *changeWindow
+}
+
+type webhookRecord struct {
+	Key         string   `json:"_key,omitempty"`
+	Url         string   `json:"url"`
+	EventTypes  []string `json:"event_types"`
+	Description string   `json:"description"`
+	Disabled    bool     `json:"disabled"`
+	Secret      string   `json:"secret"`
+	CreatedAt   int64    `json:"created_at"`
+	UpdatedAt   int64    `json:"updated_at"`
+}
+
+type deliveryRecord struct {
+	Key            string `json:"_key,omitempty"`
+	WebhookKey     string `json:"webhook_key"`
+	EventType      string `json:"event_type"`
+	Status         string `json:"status"`
+	Attempts       int32  `json:"attempts"`
+	LastStatusCode int32  `json:"last_status_code"`
+	LastError      string `json:"last_error"`
+	CreatedAt      int64  `json:"created_at"`
+	NextAttemptAt  int64  `json:"next_attempt_at"`
+	LeaseUntil     int64  `json:"lease_until"`
+	DeliveredAt    int64  `json:"delivered_at"`
+	Payload        string `json:"payload"`
+}
+
+// changeCursor is the position of a consumer of the change log.
+type changeCursor struct {
+	Key    string `json:"_key"`
+	Cursor string `json:"cursor"`
+}
+
+// webhookPayload is the body of a delivery.
+type webhookPayload struct {
+	ID        string             `json:"id"`
+	Type      string             `json:"type"`
+	CreatedAt int64              `json:"created_at"`
+	Data      webhookPayloadData `json:"data"`
+}
+
+type webhookPayloadData struct {
+	Cursor     string                 `json:"cursor"`
+	Collection string                 `json:"collection"`
+	Key        string                 `json:"key"`
+	ID         string                 `json:"id"`
+	Rev        string                 `json:"rev,omitempty"`
+	Document   map[string]interface{} `json:"document,omitempty"`
+}
+
+func NewWebhookService(client *clients.ArangoDBClient, changes *ChangeLog) (*WebhookService, error) {
+	allowPrivate := false
+	if value := os.Getenv(WebhookAllowPrivateTargets); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %v", WebhookAllowPrivateTargets, value, err)
+		}
+		allowPrivate = parsed
+	}
+
+	ctx := context.Background()
+	collections := map[string]driver.Collection{}
+	for _, name := range []string{"webhooks", "webhook_deliveries", "change_cursors"} {
+		collection, err := GetCreateDocumentCollection(ctx, client, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get or create %s collection: %v", name, err)
+		}
+		if err := EnsureIndexes(ctx, collection); err != nil {
+			return nil, err
+		}
+		collections[name] = collection
+	}
+
+	service := &WebhookService{
+		DBClient:    client,
+		Collection:  collections["webhooks"],
+		Deliveries:  collections["webhook_deliveries"],
+		Cursors:     collections["change_cursors"],
+		Changes:     changes,
+		HTTPClient:  webhookHTTPClient(allowPrivate),
+		MaxAttempts: defaultMaxAttempts,
+		RetryBase:   defaultRetryBase,
+		RetryMax:    defaultRetryMax,
+
+		AllowPrivateTargets: allowPrivate,
+	}
+	return service, nil
+}
+
+func (s *WebhookService) CreateWebhook(ctx context.Context, req *base.CreateWebhookRequest) (*base.CreateWebhookResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Creating webhook for %s", req.GetWebhook().GetUrl())
+
+	if err := validateWebhook(req.GetWebhook(), s.AllowPrivateTargets); err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Info("invalid webhook")
+		return nil, err
+	}
+
+	secret := req.GetSecret()
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("failed to generate webhook secret")
+			return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		secret = hex.EncodeToString(b)
+	}
+
+	now := time.Now().Unix()
+	record := &webhookRecord{
+		Url:         req.GetWebhook().GetUrl(),
+		EventTypes:  req.GetWebhook().GetEventTypes(),
+		Description: req.GetWebhook().GetDescription(),
+		Disabled:    req.GetWebhook().GetDisabled(),
+		Secret:      secret,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	meta, err := s.Collection.CreateDocument(ctx, record)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to create webhook document")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	record.Key = meta.Key
+	return &base.CreateWebhookResponse{Webhook: record.toWebhook(), Secret: secret}, nil
+}
+
+func (s *WebhookService) GetWebhook(ctx context.Context, req *base.GetWebhookRequest) (*base.GetWebhookResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Getting webhook with key: %s", req.GetKey())
+
+	var record webhookRecord
+	if _, err := s.Collection.ReadDocument(ctx, req.GetKey(), &record); err != nil {
+		if driver.IsNotFoundGeneral(err) {
+			logger.WithFields(logrus.Fields{
+				"key": req.GetKey(),
+			}).Info("webhook not found")
+			return nil, status.Errorf(codes.NotFound, "Webhook not found")
+		}
+
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"key":   req.GetKey(),
+		}).Error("failed to read webhook document")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	return &base.GetWebhookResponse{Webhook: record.toWebhook()}, nil
+}
+
+func (s *WebhookService) ListWebhooks(ctx context.Context, req *base.ListWebhooksRequest) (*base.ListWebhooksResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Listing webhooks")
+
+	records, err := queryAll[webhookRecord](ctx, s.DBClient.DB, "FOR w IN @@collection SORT w.created_at, w._key RETURN w", map[string]interface{}{
+		"@collection": s.Collection.Name(),
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to list webhooks")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	response := &base.ListWebhooksResponse{}
+	for _, record := range records {
+		response.Webhooks = append(response.Webhooks, record.toWebhook())
+	}
+	return response, nil
+}
+
+func (s *WebhookService) UpdateWebhook(ctx context.Context, req *base.UpdateWebhookRequest) (*base.UpdateWebhookResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Updating webhook with key: %s", req.GetKey())
+
+	if err := validateWebhook(req.GetWebhook(), s.AllowPrivateTargets); err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Info("invalid webhook")
+		return nil, err
+	}
+
+	patch := map[string]interface{}{
+		"url":         req.GetWebhook().GetUrl(),
+		"event_types": req.GetWebhook().GetEventTypes(),
+		"description": req.GetWebhook().GetDescription(),
+		"disabled":    req.GetWebhook().GetDisabled(),
+		"updated_at":  time.Now().Unix(),
+	}
+	if req.GetSecret() != "" {
+		patch["secret"] = req.GetSecret()
+	}
+
+	var record webhookRecord
+	if _, err := s.Collection.UpdateDocument(driver.WithReturnNew(ctx, &record), req.GetKey(), patch); err != nil {
+		if driver.IsNotFoundGeneral(err) {
+			logger.WithFields(logrus.Fields{
+				"key": req.GetKey(),
+			}).Info("webhook not found for update")
+			return nil, status.Errorf(codes.NotFound, "Webhook not found")
+		}
+
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"key":   req.GetKey(),
+		}).Error("failed to update webhook document")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	return &base.UpdateWebhookResponse{Webhook: record.toWebhook()}, nil
+}
+
+func (s *WebhookService) DeleteWebhook(ctx context.Context, req *base.DeleteWebhookRequest) (*base.DeleteWebhookResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Deleting webhook with key: %s", req.GetKey())
+
+	if _, err := s.Collection.RemoveDocument(ctx, req.GetKey()); err != nil {
+		if driver.IsNotFoundGeneral(err) {
+			logger.WithFields(logrus.Fields{
+				"key": req.GetKey(),
+			}).Info("webhook not found for deletion")
+			return nil, status.Errorf(codes.NotFound, "Webhook not found")
+		}
+
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"key":   req.GetKey(),
+		}).Error("failed to delete webhook document")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	query := `
+		FOR d IN @@collection
+			FILTER d.webhook_key == @webhook AND d.status != @delivered
+			REMOVE d IN @@collection
+	`
+	cursor, err := s.DBClient.DB.Query(ctx, query, map[string]interface{}{
+		"webhook":     req.GetKey(),
+		"delivered":   deliveryDelivered,
+		"@collection": s.Deliveries.Name(),
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+			"key":   req.GetKey(),
+		}).Error("failed to delete webhook deliveries")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+	cursor.Close()
+
+	return &base.DeleteWebhookResponse{}, nil
+}
+
+func (s *WebhookService) ListWebhookDeliveries(ctx context.Context, req *base.ListWebhookDeliveriesRequest) (*base.ListWebhookDeliveriesResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Listing deliveries of webhook %s", req.GetWebhookKey())
+
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = defaultDeliveryLimit
+	}
+	if req.GetWebhookKey() == "" || limit < 0 || limit > maxDeliveryLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "Bad parameter")
+	}
+
+	query := "FOR d IN @@collection\n\tFILTER d.webhook_key == @webhook\n"
+	bindVars := map[string]interface{}{
+		"webhook":     req.GetWebhookKey(),
+		"limit":       limit,
+		"@collection": s.Deliveries.Name(),
+	}
+	if req.GetStatus() != base.DeliveryStatus_DELIVERY_STATUS_UNSPECIFIED {
+		var statuses []string
+		for name, value := range deliveryStatuses {
+			if value == req.GetStatus() {
+				statuses = append(statuses, name)
+			}
+		}
+		query += "\tFILTER d.status IN @statuses\n"
+		bindVars["statuses"] = statuses
+	}
+	query += "\tSORT d.created_at DESC, d._key DESC\n\tLIMIT @limit\n\tRETURN d"
+
+	records, err := queryAll[deliveryRecord](ctx, s.DBClient.DB, query, bindVars)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to list webhook deliveries")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	response := &base.ListWebhookDeliveriesResponse{}
+	for _, record := range records {
+		response.Deliveries = append(response.Deliveries, record.toDelivery())
+	}
+	return response, nil
+}
+
+func (s *WebhookService) ReplayWebhookDeliveries(ctx context.Context, req *base.ReplayWebhookDeliveriesRequest) (*base.ReplayWebhookDeliveriesResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Replaying deliveries of webhook %s", req.GetWebhookKey())
+
+	if req.GetWebhookKey() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Bad parameter")
+	}
+
+	// Deliveries in progress are left alone, they are retried anyway if they fail
+	query := `
+		LET replayed = (
+			FOR d IN @@collection
+				FILTER d.webhook_key == @webhook AND d.status != @inProgress
+				FILTER LENGTH(@keys) > 0 ? d._key IN @keys : d.status == @dead
+				UPDATE d WITH { status: @pending, attempts: 0, next_attempt_at: @now } IN @@collection
+				RETURN 1
+		)
+		RETURN LENGTH(replayed)
+	`
+	keys := req.GetDeliveryKeys()
+	if keys == nil {
+		keys = []string{}
+	}
+	replayed, err := queryAll[int32](ctx, s.DBClient.DB, query, map[string]interface{}{
+		"webhook":     req.GetWebhookKey(),
+		"keys":        keys,
+		"inProgress":  deliveryInProgress,
+		"dead":        deliveryDead,
+		"pending":     deliveryPending,
+		"now":         time.Now().Unix(),
+		"@collection": s.Deliveries.Name(),
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to replay webhook deliveries")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	response := &base.ReplayWebhookDeliveriesResponse{}
+	if len(replayed) > 0 {
+		response.Replayed = *replayed[0]
+	}
+	return response, nil
+}
+
+// Run dispatches the recorded changes to the webhooks and delivers them until
+// ctx is done.
+func (s *WebhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		wake := changeSignal.wait()
+
+		dispatched, err := s.DispatchOnce(ctx)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("failed to dispatch webhook deliveries")
+		}
+		delivered, err := s.DeliverOnce(ctx)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("failed to deliver webhooks")
+		}
+
+		if dispatched == webhookBatchSize || delivered == webhookBatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce adds a delivery to the outbox for every webhook matching the
+// next changes of the change log, and returns the number of changes read.
+// The dispatcher starts from the end of the log the first time it runs.
+func (s *WebhookService) DispatchOnce(ctx context.Context) (int, error) {
+	s.dispatchMu.Lock()
+	defer s.dispatchMu.Unlock()
+
+	var position changeCursor
+	if _, err := s.Cursors.ReadDocument(ctx, webhookCursorKey, &position); driver.IsNotFoundGeneral(err) {
+		latest, err := queryAll[string](ctx, s.DBClient.DB, "FOR c IN @@collection SORT c._key DESC LIMIT 1 RETURN c._key", map[string]interface{}{
+			"@collection": s.Changes.Collection.Name(),
+		})
+		if err != nil {
+			return 0, err
+		}
+		position = changeCursor{Key: webhookCursorKey}
+		if len(latest) > 0 {
+			position.Cursor = *latest[0]
+		}
+		_, err = s.Cursors.CreateDocument(driver.WithOverwriteMode(ctx, driver.OverwriteModeIgnore), position)
+		return 0, err
+	} else if err != nil {
+		return 0, err
+	}
+
+	// The window is opened again when another dispatcher moved the cursor
+	if s.window == nil || s.window.cursor != position.Cursor {
+		window, err := s.Changes.newChangeWindow(ctx, position.Cursor)
+		if err != nil {
+			return 0, err
+		}
+		s.window = window
+	}
+
+	bindVars := map[string]interface{}{
+		"limit":       webhookBatchSize,
+		"@collection": s.Changes.Collection.Name(),
+	}
+	s.window.bind(bindVars)
+	changes, err := queryAll[changeRecord](ctx, s.DBClient.DB, "FOR c IN @@collection FILTER "+changeWindowFilter+" SORT c._key LIMIT @limit RETURN c", bindVars)
+	if err != nil || len(changes) == 0 {
+		return 0, err
+	}
+
+	webhooks, err := queryAll[webhookRecord](ctx, s.DBClient.DB, "FOR w IN @@collection FILTER !w.disabled RETURN w", map[string]interface{}{
+		"@collection": s.Collection.Name(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix()
+	var deliveries []*deliveryRecord
+	for _, change := range changes {
+		eventType := changeEventType(change)
+		for _, webhook := range webhooks {
+			if !webhook.matches(eventType) {
+				continue
+			}
+
+			// Keys are derived from the change so dispatching twice is harmless
+			key := webhook.Key + "-" + change.Key
+			payload, err := json.Marshal(webhookPayload{
+				ID:        key,
+				Type:      eventType,
+				CreatedAt: change.ChangedAt,
+				Data: webhookPayloadData{
+					Cursor:     change.Key,
+					Collection: change.Collection,
+					Key:        change.DocumentKey,
+					ID:         change.DocumentID,
+					Rev:        change.Rev,
+					Document:   change.Document,
+				},
+			})
+			if err != nil {
+				return 0, err
+			}
+
+			deliveries = append(deliveries, &deliveryRecord{
+				Key:           key,
+				WebhookKey:    webhook.Key,
+				EventType:     eventType,
+				Status:        deliveryPending,
+				CreatedAt:     now,
+				NextAttemptAt: now,
+				Payload:       string(payload),
+			})
+		}
+	}
+
+	if len(deliveries) > 0 {
+		_, errs, err := s.Deliveries.CreateDocuments(driver.WithOverwriteMode(ctx, driver.OverwriteModeIgnore), deliveries)
+		if err != nil {
+			return 0, err
+		}
+		if err := errs.FirstNonNil(); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, change := range changes {
+		s.window.read(change)
+	}
+	position.Cursor = s.window.cursor
+	if _, err := s.Cursors.ReplaceDocument(ctx, webhookCursorKey, position); err != nil {
+		s.window = nil
+		return 0, err
+	}
+	return len(changes), nil
+}
+
+// DeliverOnce sends the deliveries that are due and returns how many it sent.
+// Deliveries are leased while in progress so that they are retried if the
+// process dies before recording the outcome.
+func (s *WebhookService) DeliverOnce(ctx context.Context) (int, error) {
+	now := time.Now()
+	query := `
+		FOR d IN @@collection
+			FILTER (d.status == @pending AND d.next_attempt_at <= @now) OR (d.status == @inProgress AND d.lease_until <= @now)
+			LET webhook = DOCUMENT(@@webhooks, d.webhook_key)
+			FILTER webhook == null OR !webhook.disabled
+			SORT d.next_attempt_at
+			LIMIT @limit
+			UPDATE d WITH { status: @inProgress, lease_until: @leaseUntil } IN @@collection
+			RETURN { delivery: NEW, webhook }
+	`
+	type claim struct {
+		Delivery *deliveryRecord `json:"delivery"`
+		Webhook  *webhookRecord  `json:"webhook"`
+	}
+	claims, err := queryAll[claim](ctx, s.DBClient.DB, query, map[string]interface{}{
+		"pending":     deliveryPending,
+		"inProgress":  deliveryInProgress,
+		"now":         now.Unix(),
+		"leaseUntil":  now.Add(webhookLease).Unix(),
+		"limit":       webhookBatchSize,
+		"@collection": s.Deliveries.Name(),
+		"@webhooks":   s.Collection.Name(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(claims))
+	for i, c := range claims {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.deliver(ctx, c.Delivery, c.Webhook)
+		}()
+	}
+	wg.Wait()
+
+	return len(claims), driver.ErrorSlice(errs).FirstNonNil()
+}
+
+// deliver sends a delivery and records the outcome.
+func (s *WebhookService) deliver(ctx context.Context, delivery *deliveryRecord, webhook *webhookRecord) error {
+	delivery.Attempts++
+	delivery.LeaseUntil = 0
+	delivery.LastStatusCode = 0
+	delivery.LastError = ""
+
+	if webhook == nil {
+		delivery.LastError = "webhook deleted"
+	} else if err := s.post(ctx, delivery, webhook); err != nil {
+		delivery.LastError = err.Error()
+	}
+
+	now := time.Now()
+	switch {
+	case webhook != nil && delivery.LastError == "":
+		delivery.Status = deliveryDelivered
+		delivery.DeliveredAt = now.Unix()
+	case webhook == nil || int(delivery.Attempts) >= s.MaxAttempts:
+		delivery.Status = deliveryDead
+	default:
+		delivery.Status = deliveryPending
+		delivery.NextAttemptAt = now.Add(s.backoff(delivery.Attempts)).Unix()
+	}
+
+	if delivery.Status != deliveryDelivered {
+		logrus.WithFields(logrus.Fields{
+			"delivery": delivery.Key,
+			"attempts": delivery.Attempts,
+			"status":   delivery.Status,
+			"error":    delivery.LastError,
+		}).Warn("webhook delivery failed")
+	}
+
+	_, err := s.Deliveries.ReplaceDocument(ctx, delivery.Key, delivery)
+	return err
+}
+
+// post sends the payload of a delivery to the webhook and fails unless the
+// response status is 2xx.
+func (s *WebhookService) post(ctx context.Context, delivery *deliveryRecord, webhook *webhookRecord) error {
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, delivery.Key)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, timestamp, []byte(delivery.Payload)))
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookResponse))
+
+	delivery.LastStatusCode = int32(resp.StatusCode)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+// backoff returns the delay after the given number of failed attempts.
+func (s *WebhookService) backoff(attempts int32) time.Duration {
+	delay := s.RetryBase
+	for i := int32(1); i < attempts && delay < s.RetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, s.RetryMax)
+}
+
+// SignWebhookPayload returns the value of the signature header of a delivery
+// body sent at timestamp.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *webhookRecord) matches(eventType string) bool {
+	if len(w.EventTypes) == 0 {
+		return true
+	}
+	for _, pattern := range w.EventTypes {
+		if ok, _ := path.Match(pattern, eventType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *webhookRecord) toWebhook() *base.Webhook {
+	return &base.Webhook{
+		Key:         w.Key,
+		Url:         w.Url,
+		EventTypes:  w.EventTypes,
+		Description: w.Description,
+		Disabled:    w.Disabled,
+		CreatedAt:   w.CreatedAt,
+		UpdatedAt:   w.UpdatedAt,
+	}
+}
+
+func (d *deliveryRecord) toDelivery() *base.WebhookDelivery {
+	return &base.WebhookDelivery{
+		Key:            d.Key,
+		WebhookKey:     d.WebhookKey,
+		EventType:      d.EventType,
+		Status:         deliveryStatuses[d.Status],
+		Attempts:       d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		CreatedAt:      d.CreatedAt,
+		NextAttemptAt:  d.NextAttemptAt,
+		DeliveredAt:    d.DeliveredAt,
+		Payload:        d.Payload,
+	}
+}
+
+func validateWebhook(webhook *base.Webhook, allowPrivate bool) error {
+	target, err := url.Parse(webhook.GetUrl())
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return status.Errorf(codes.InvalidArgument, "Webhook URL must be an http or https URL")
+	}
+
+	// Host names are checked again by the dialer once they are resolved
+	if !allowPrivate {
+		host := strings.ToLower(strings.TrimSuffix(target.Hostname(), "."))
+		ip := net.ParseIP(host)
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") || (ip != nil && !publicAddress(ip)) {
+			return status.Errorf(codes.InvalidArgument, "Webhook URL must not target a private address")
+		}
+	}
+
+	for _, pattern := range webhook.GetEventTypes() {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return status.Errorf(codes.InvalidArgument, "Invalid event type %q", pattern)
+		}
+	}
+	return nil
+}
+
+// publicAddress reports whether ip is outside the loopback, private,
+// link-local, multicast and unspecified ranges a deployment lives on.
+func publicAddress(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// webhookHTTPClient returns the client delivering webhooks. Unless private
+// targets are allowed, it refuses to connect to non-public addresses, which
+// also covers host names resolving to them and redirects, and connects
+// directly, as a proxy would otherwise connect to the addresses on its behalf.
+func webhookHTTPClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicAddress(ip) {
+				return fmt.Errorf("webhook target %s is not a public address", host)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	if !allowPrivate {
+		transport.Proxy = nil
+	}
+	return &http.Client{Timeout: webhookTimeout, Transport: transport}
+}
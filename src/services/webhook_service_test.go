@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/omnsight/omnibasement/gen/base/v1"
+	"github.com/omnsight/omniscent-library/gen/model/v1"
+	"github.com/omnsight/omniscent-library/src/clients"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWebhookService(t *testing.T) {
+	// Skip test if ArangoDB is not available
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	// Create ArangoDB client
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
+	// Create WebhookService
+	service, err := NewWebhookService(client, changes)
+	if err != nil {
+		t.Fatalf("Failed to create WebhookService: %v", err)
+	}
+	service.HTTPClient = &http.Client{Timeout: time.Second}
+	service.MaxAttempts = 2
+	service.RetryBase = 0
+	// The receiver listens on the loopback address
+	service.AllowPrivateTargets = true
+
+	personService, err := NewPersonService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create PersonService: %v", err)
+	}
+
+	// Record the requests received and fail on /failing while failing is set
+	var failing atomic.Bool
+	var mu sync.Mutex
+	received := map[string]*http.Request{}
+	bodies := map[string][]byte{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/failing" && failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		received[r.Header.Get(WebhookDeliveryHeader)] = r
+		bodies[r.Header.Get(WebhookDeliveryHeader)] = body
+	}))
+	defer receiver.Close()
+
+	ctx := context.Background()
+	created, err := service.CreateWebhook(ctx, &base.CreateWebhookRequest{
+		Webhook: &base.Webhook{Url: receiver.URL + "/ok", EventTypes: []string{"persons.create"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+	defer service.DeleteWebhook(ctx, &base.DeleteWebhookRequest{Key: created.Webhook.Key})
+
+	failingHook, err := service.CreateWebhook(ctx, &base.CreateWebhookRequest{
+		Webhook: &base.Webhook{Url: receiver.URL + "/failing", EventTypes: []string{"persons.*"}},
+		Secret:  "failing-secret",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+	defer service.DeleteWebhook(ctx, &base.DeleteWebhookRequest{Key: failingHook.Webhook.Key})
+
+	dispatch := func() {
+		for {
+			n, err := service.DispatchOnce(ctx)
+			if err != nil {
+				t.Fatalf("Failed to dispatch changes: %v", err)
+			}
+			if n < webhookBatchSize {
+				return
+			}
+		}
+	}
+	deliver := func() {
+		if _, err := service.DeliverOnce(ctx); err != nil {
+			t.Fatalf("Failed to deliver webhooks: %v", err)
+		}
+	}
+
+	// Start from the end of the change log
+	dispatch()
+	dispatch()
+
+	failing.Store(true)
+	person, err := personService.CreatePerson(ctx, &base.CreatePersonRequest{
+		Person: &model.Person{Name: "Webhook Person"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create person: %v", err)
+	}
+	defer personService.DeletePerson(ctx, &base.DeletePersonRequest{Key: person.Person.Key})
+	dispatch()
+
+	t.Run("Signed Delivery", func(t *testing.T) {
+		deliver()
+
+		mu.Lock()
+		defer mu.Unlock()
+		var req *http.Request
+		var body []byte
+		for key, r := range received {
+			if strings.HasPrefix(key, created.Webhook.Key+"-") {
+				req, body = r, bodies[key]
+			}
+		}
+		if req == nil {
+			t.Fatalf("Expected a delivery to the webhook")
+		}
+
+		if req.Header.Get(WebhookEventHeader) != "persons.create" {
+			t.Errorf("Expected event persons.create, got %s", req.Header.Get(WebhookEventHeader))
+		}
+		timestamp, err := strconv.ParseInt(req.Header.Get(WebhookTimestampHeader), 10, 64)
+		if err != nil {
+			t.Fatalf("Invalid timestamp header: %v", err)
+		}
+		if signature := SignWebhookPayload(created.Secret, timestamp, body); req.Header.Get(WebhookSignatureHeader) != signature {
+			t.Errorf("Expected signature %s, got %s", signature, req.Header.Get(WebhookSignatureHeader))
+		}
+
+		var payload webhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatalf("Failed to decode payload: %v", err)
+		}
+		if payload.Type != "persons.create" || payload.Data.Key != person.Person.Key {
+			t.Errorf("Unexpected payload %+v", payload)
+		}
+		if payload.Data.Document["name"] != "Webhook Person" {
+			t.Errorf("Expected the person document in the payload, got %v", payload.Data.Document)
+		}
+	})
+
+	t.Run("Retry And Replay", func(t *testing.T) {
+		// The first attempt was made with the signed delivery
+		deliver()
+
+		dead, err := service.ListWebhookDeliveries(ctx, &base.ListWebhookDeliveriesRequest{
+			WebhookKey: failingHook.Webhook.Key,
+			Status:     base.DeliveryStatus_DELIVERY_STATUS_DEAD,
+		})
+		if err != nil {
+			t.Fatalf("Failed to list deliveries: %v", err)
+		}
+		if len(dead.Deliveries) != 1 {
+			t.Fatalf("Expected 1 dead delivery, got %d", len(dead.Deliveries))
+		}
+		if dead.Deliveries[0].Attempts != 2 || dead.Deliveries[0].LastStatusCode != http.StatusInternalServerError {
+			t.Errorf("Unexpected dead delivery %v", dead.Deliveries[0])
+		}
+
+		failing.Store(false)
+		replayed, err := service.ReplayWebhookDeliveries(ctx, &base.ReplayWebhookDeliveriesRequest{
+			WebhookKey: failingHook.Webhook.Key,
+		})
+		if err != nil {
+			t.Fatalf("Failed to replay deliveries: %v", err)
+		}
+		if replayed.Replayed != 1 {
+			t.Errorf("Expected 1 replayed delivery, got %d", replayed.Replayed)
+		}
+		deliver()
+
+		delivered, err := service.ListWebhookDeliveries(ctx, &base.ListWebhookDeliveriesRequest{
+			WebhookKey: failingHook.Webhook.Key,
+			Status:     base.DeliveryStatus_DELIVERY_STATUS_DELIVERED,
+		})
+		if err != nil {
+			t.Fatalf("Failed to list deliveries: %v", err)
+		}
+		if len(delivered.Deliveries) != 1 {
+			t.Errorf("Expected 1 delivered delivery, got %d", len(delivered.Deliveries))
+		}
+	})
+
+	t.Run("Private Targets", func(t *testing.T) {
+		service.AllowPrivateTargets = false
+		defer func() { service.AllowPrivateTargets = true }()
+
+		for _, target := range []string{receiver.URL, "http://localhost:8080", "http://169.254.169.254/latest", "https://10.0.0.1", "http://[::1]/"} {
+			_, err := service.CreateWebhook(ctx, &base.CreateWebhookRequest{
+				Webhook: &base.Webhook{Url: target, EventTypes: []string{"persons.create"}},
+			})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("Expected webhook to %s to be rejected, got %v", target, err)
+			}
+		}
+
+		// Host names resolving to private addresses are refused when connecting
+		_, err := webhookHTTPClient(false).Get("http://localhost:1/")
+		if err == nil || !strings.Contains(err.Error(), "not a public address") {
+			t.Errorf("Expected the connection to be refused, got %v", err)
+		}
+
+		// A proxy would connect to private addresses for the client
+		t.Setenv("HTTP_PROXY", "http://proxy.example.com:3128")
+		t.Setenv("HTTPS_PROXY", "http://proxy.example.com:3128")
+		client := webhookHTTPClient(false)
+		if client.Transport.(*http.Transport).Proxy != nil {
+			t.Error("Expected webhooks to be delivered without a proxy")
+		}
+		_, err = client.Get("http://10.0.0.1:1/")
+		if err == nil || !strings.Contains(err.Error(), "not a public address") {
+			t.Errorf("Expected the connection to be refused behind a proxy, got %v", err)
+		}
+	})
+}
@@ -17,11 +17,13 @@ import (
 type WebsiteService struct {
 	base.UnimplementedWebsiteServiceServer
 
-	DBClient   *clients.ArangoDBClient
-	Collection driver.Collection
+	DBClient    *clients.ArangoDBClient
+	Collection  driver.Collection
+	Idempotency *IdempotencyStore
+	Changes     *ChangeLog
 }
 
-func NewWebsiteService(client *clients.ArangoDBClient) (*WebsiteService, error) {
+func NewWebsiteService(client *clients.ArangoDBClient, idempotency *IdempotencyStore, changes *ChangeLog) (*WebsiteService, error) {
 	// Create websites collection
 	ctx := context.Background()
 	collection, err := client.GetCreateCollection(ctx, "websites", driver.CreateVertexCollectionOptions{})
@@ -30,9 +32,20 @@ func NewWebsiteService(client *clients.ArangoDBClient) (*WebsiteService, error)
 	}
 	logrus.Infof("✅ Initialized collection %s", collection.Name())
 
+	if err := EnsureIndexes(ctx, collection); err != nil {
+		return nil, err
+	}
+
+	// Deletes remove the citations of the deleted documents
+	if _, err := getCreateProvenanceCollection(ctx, client); err != nil {
+		return nil, fmt.Errorf("failed to get or create %s collection: %v", ProvenanceCollection, err)
+	}
+
 	service := &WebsiteService{
-		DBClient:   client,
-		Collection: collection,
+		DBClient:    client,
+		Collection:  changes.Watch(collection),
+		Idempotency: idempotency,
+		Changes:     changes,
 	}
 	return service, nil
 }
@@ -62,38 +75,104 @@ func (s *WebsiteService) GetWebsite(ctx context.Context, req *base.GetWebsiteReq
 	website.Id = meta.ID.String()
 	website.Key = meta.Key
 	website.Rev = meta.Rev
-	return &base.GetWebsiteResponse{Website: &website}, nil
+	response := &base.GetWebsiteResponse{Website: &website}
+	if req.GetIncludeCitations() {
+		citations, err := listCitations(ctx, s.DBClient.DB, website.Id)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"key":   req.GetKey(),
+			}).Error("failed to list website citations")
+			return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		response.Citations = citations
+	}
+	return response, nil
 }
 
 func (s *WebsiteService) CreateWebsite(ctx context.Context, req *base.CreateWebsiteRequest) (*base.CreateWebsiteResponse, error) {
+	return WithIdempotency(ctx, s.Idempotency, "CreateWebsite", req, func(resp *base.CreateWebsiteResponse) string {
+		return resp.GetWebsite().GetId()
+	}, func() (*base.CreateWebsiteResponse, error) {
+		return s.createWebsite(ctx, req)
+	})
+}
+
+func (s *WebsiteService) createWebsite(ctx context.Context, req *base.CreateWebsiteRequest) (*base.CreateWebsiteResponse, error) {
 	logger := logging.GetLogger(ctx)
 	logger.Infof("Creating website with URL: %s", req.GetWebsite().GetUrl())
 
-	// Create document in collection
-	var website model.Website
-	ctxWithReturnNew := driver.WithReturnNew(ctx, &website)
-	meta, err := s.Collection.CreateDocument(ctxWithReturnNew, req.GetWebsite())
+	doc, err := newWebsiteDocument(req.GetWebsite(), "website")
 	if err != nil {
 		logger.WithFields(logrus.Fields{
-			"error": err,
-		}).Error("failed to create website document")
-		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+			"url": req.GetWebsite().GetUrl(),
+		}).Info("website url is malformed")
+		return nil, err
 	}
 
-	website.Id = meta.ID.String()
-	website.Key = meta.Key
-	website.Rev = meta.Rev
-	return &base.CreateWebsiteResponse{Website: &website}, nil
+	var response *base.CreateWebsiteResponse
+	err = s.Changes.transact(ctx, duplicateCheckCollections(s.Collection.Name(), req.GetFailOnDuplicate()), func(ctx context.Context) error {
+		// Look up existing websites resembling the new one
+		duplicates, err := findWebsiteDuplicates(ctx, s.DBClient, s.Collection.Name(), doc.Url, doc.Domain)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("failed to look up possible duplicate websites")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		if req.GetFailOnDuplicate() && len(duplicates) > 0 {
+			logger.WithFields(logrus.Fields{
+				"duplicates": len(duplicates),
+			}).Info("website has possible duplicates")
+			return duplicateError(duplicates)
+		}
+
+		// Create document in collection
+		var website model.Website
+		ctxWithReturnNew := driver.WithReturnNew(ctx, &website)
+		meta, err := s.Collection.CreateDocument(ctxWithReturnNew, doc)
+		if err != nil {
+			if driver.IsConflict(err) {
+				logger.WithFields(logrus.Fields{
+					"url": doc.Url,
+				}).Info("website with the same url already exists")
+				return status.Errorf(codes.AlreadyExists, "Website already exists")
+			}
+
+			logger.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("failed to create website document")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+
+		website.Id = meta.ID.String()
+		website.Key = meta.Key
+		website.Rev = meta.Rev
+		response = &base.CreateWebsiteResponse{Website: &website, PossibleDuplicates: duplicates}
+		return nil
+	})
+	if err != nil {
+		return nil, changeError(ctx, err, "failed to create website")
+	}
+	return response, nil
 }
 
 func (s *WebsiteService) UpdateWebsite(ctx context.Context, req *base.UpdateWebsiteRequest) (*base.UpdateWebsiteResponse, error) {
 	logger := logging.GetLogger(ctx)
 	logger.Infof("Updating website with Key: %s", req.GetWebsite().GetKey())
 
+	doc, err := newWebsiteDocument(req.GetWebsite(), "website")
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"url": req.GetWebsite().GetUrl(),
+		}).Info("website url is malformed")
+		return nil, err
+	}
+
 	// Update document in collection
 	var website model.Website
 	ctxWithReturnNew := driver.WithReturnNew(ctx, &website)
-	meta, err := s.Collection.UpdateDocument(ctxWithReturnNew, req.GetWebsite().GetKey(), req.GetWebsite())
+	meta, err := s.Collection.UpdateDocument(ctxWithReturnNew, req.GetWebsite().GetKey(), doc)
 	if err != nil {
 		if driver.IsNotFoundGeneral(err) {
 			logger.WithFields(logrus.Fields{
@@ -102,6 +181,13 @@ func (s *WebsiteService) UpdateWebsite(ctx context.Context, req *base.UpdateWebs
 			return nil, status.Errorf(codes.NotFound, "Website not found")
 		}
 
+		if driver.IsConflict(err) {
+			logger.WithFields(logrus.Fields{
+				"url": req.GetWebsite().GetUrl(),
+			}).Info("website with the same url already exists")
+			return nil, status.Errorf(codes.AlreadyExists, "Website already exists")
+		}
+
 		logger.WithFields(logrus.Fields{
 			"error": err,
 			"key":   req.GetWebsite().GetKey(),
@@ -119,8 +205,14 @@ func (s *WebsiteService) DeleteWebsite(ctx context.Context, req *base.DeleteWebs
 	logger := logging.GetLogger(ctx)
 	logger.Infof("Deleting website with Key: %s", req.GetKey())
 
-	// Remove document from collection
-	_, err := s.Collection.RemoveDocument(ctx, req.GetKey())
+	// Remove document from collection with its citations
+	err := s.Changes.transact(ctx, driver.TransactionCollections{Write: []string{s.Collection.Name(), ProvenanceCollection}}, func(ctx context.Context) error {
+		meta, err := s.Collection.RemoveDocument(ctx, req.GetKey())
+		if err != nil {
+			return err
+		}
+		return removeCitations(ctx, s.DBClient.DB, s.Changes, []string{meta.ID.String()})
+	})
 	if err != nil {
 		if driver.IsNotFoundGeneral(err) {
 			logger.WithFields(logrus.Fields{
@@ -138,3 +230,276 @@ func (s *WebsiteService) DeleteWebsite(ctx context.Context, req *base.DeleteWebs
 
 	return &base.DeleteWebsiteResponse{}, nil
 }
+
+func (s *WebsiteService) UpsertWebsite(ctx context.Context, req *base.UpsertWebsiteRequest) (*base.UpsertWebsiteResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Upserting website with URL: %s", req.GetWebsite().GetUrl())
+
+	if req.GetWebsite().GetUrl() == "" {
+		logger.Error("website url is empty")
+		return nil, status.Errorf(codes.InvalidArgument, "Bad parameter")
+	}
+	doc, err := newWebsiteDocument(req.GetWebsite(), "website")
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"url": req.GetWebsite().GetUrl(),
+		}).Info("website url is malformed")
+		return nil, err
+	}
+
+	// Using AQL query to insert or merge the document matched by its natural key
+	query := `
+		LET doc = UNSET(@doc, "_id", "_key", "_rev")
+		UPSERT { url: doc.url }
+		INSERT doc
+		UPDATE doc
+		IN @@collection OPTIONS { exclusive: true }
+		RETURN { doc: NEW, created: OLD == null }
+	`
+
+	var result struct {
+		Doc     model.Website `json:"doc"`
+		Created bool          `json:"created"`
+	}
+	err = s.Changes.transact(ctx, driver.TransactionCollections{Exclusive: []string{s.Collection.Name()}}, func(ctx context.Context) error {
+		cursor, err := s.DBClient.DB.Query(ctx, query, map[string]interface{}{
+			"doc":         doc,
+			"@collection": s.Collection.Name(),
+		})
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"data":  req.GetWebsite(),
+			}).Error("failed to execute AQL query for upserting website")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+		defer cursor.Close()
+
+		if _, err := cursor.ReadDocument(ctx, &result); err != nil {
+			logger.WithFields(logrus.Fields{
+				"error": err,
+				"url":   doc.Url,
+			}).Error("failed to read upserted website document")
+			return status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+		}
+
+		operation := ChangeUpdate
+		if result.Created {
+			operation = ChangeCreate
+		}
+		return s.Changes.recordWrite(ctx, s.Collection.Name(), operation, driver.DocumentMeta{
+			Key: result.Doc.Key,
+			ID:  driver.DocumentID(result.Doc.Id),
+			Rev: result.Doc.Rev,
+		}, nil)
+	})
+	if err != nil {
+		return nil, changeError(ctx, err, "failed to upsert website")
+	}
+
+	return &base.UpsertWebsiteResponse{Website: &result.Doc, Created: result.Created}, nil
+}
+
+func (s *WebsiteService) BatchCreateWebsites(ctx context.Context, req *base.BatchCreateWebsitesRequest) (*base.BatchCreateWebsitesResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch creating %d websites", len(req.GetWebsites()))
+
+	if err := checkBatchSize(len(req.GetWebsites())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetWebsites()))
+		return nil, err
+	}
+
+	// Items with a malformed URL never reach the database
+	errs := make([]error, len(req.GetWebsites()))
+	var docs []*websiteDocument
+	var positions []int
+	for i, website := range req.GetWebsites() {
+		doc, err := newWebsiteDocument(website, fmt.Sprintf("websites[%d]", i))
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		docs = append(docs, doc)
+		positions = append(positions, i)
+	}
+
+	// Create documents in collection
+	created := make([]model.Website, len(docs))
+	err := runBatch(ctx, s.DBClient.DB, []string{s.Collection.Name()}, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		if len(docs) == 0 {
+			return nil
+		}
+
+		metas, itemErrs, err := s.Collection.CreateDocuments(driver.WithReturnNew(ctx, created), docs)
+		if err != nil {
+			return err
+		}
+
+		for j, position := range positions {
+			errs[position] = itemErrs[j]
+			if itemErrs[j] == nil {
+				created[j].Id = metas[j].ID.String()
+				created[j].Key = metas[j].Key
+				created[j].Rev = metas[j].Rev
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to create website documents")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	websites := make([]*model.Website, len(req.GetWebsites()))
+	for j, position := range positions {
+		websites[position] = &created[j]
+	}
+
+	response := &base.BatchCreateWebsitesResponse{}
+	for i := range websites {
+		result := &base.BatchWebsiteResult{Error: batchError(errs[i])}
+		if errs[i] == nil {
+			result.Website = websites[i]
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+func (s *WebsiteService) BatchUpdateWebsites(ctx context.Context, req *base.BatchUpdateWebsitesRequest) (*base.BatchUpdateWebsitesResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch updating %d websites", len(req.GetWebsites()))
+
+	if err := checkBatchSize(len(req.GetWebsites())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetWebsites()))
+		return nil, err
+	}
+
+	// Items without a key or with a malformed URL never reach the database
+	errs := make([]error, len(req.GetWebsites()))
+	var keys []string
+	var patches []*websiteDocument
+	var positions []int
+	for i, website := range req.GetWebsites() {
+		if website.GetKey() == "" {
+			errs[i] = errMissingKey
+			continue
+		}
+		patch, err := newWebsiteDocument(website, fmt.Sprintf("websites[%d]", i))
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		keys = append(keys, website.GetKey())
+		patches = append(patches, patch)
+		positions = append(positions, i)
+	}
+
+	// Update documents in collection
+	updated := make([]model.Website, len(keys))
+	err := runBatch(ctx, s.DBClient.DB, []string{s.Collection.Name()}, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		if len(keys) == 0 {
+			return nil
+		}
+
+		metas, itemErrs, err := s.Collection.UpdateDocuments(driver.WithReturnNew(ctx, updated), keys, patches)
+		if err != nil {
+			return err
+		}
+
+		for j, position := range positions {
+			errs[position] = itemErrs[j]
+			if itemErrs[j] == nil {
+				updated[j].Id = metas[j].ID.String()
+				updated[j].Key = metas[j].Key
+				updated[j].Rev = metas[j].Rev
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to update website documents")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	websites := make([]*model.Website, len(req.GetWebsites()))
+	for j, position := range positions {
+		websites[position] = &updated[j]
+	}
+
+	response := &base.BatchUpdateWebsitesResponse{}
+	for i := range websites {
+		result := &base.BatchWebsiteResult{Error: batchError(errs[i])}
+		if errs[i] == nil {
+			result.Website = websites[i]
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+func (s *WebsiteService) BatchDeleteWebsites(ctx context.Context, req *base.BatchDeleteWebsitesRequest) (*base.BatchDeleteWebsitesResponse, error) {
+	logger := logging.GetLogger(ctx)
+	logger.Infof("Batch deleting %d websites", len(req.GetKeys()))
+
+	if err := checkBatchSize(len(req.GetKeys())); err != nil {
+		logger.Infof("invalid batch size %d", len(req.GetKeys()))
+		return nil, err
+	}
+
+	// Items without a key never reach the database
+	errs := make([]error, len(req.GetKeys()))
+	var keys []string
+	var positions []int
+	for i, key := range req.GetKeys() {
+		if key == "" {
+			errs[i] = errMissingKey
+			continue
+		}
+		keys = append(keys, key)
+		positions = append(positions, i)
+	}
+
+	// Remove documents from collection with their citations
+	collections := []string{s.Collection.Name(), ProvenanceCollection}
+	err := runBatch(ctx, s.DBClient.DB, collections, req.GetAllOrNothing(), errs, func(ctx context.Context) error {
+		if len(keys) == 0 {
+			return nil
+		}
+
+		return s.Changes.transact(ctx, driver.TransactionCollections{Write: collections}, func(ctx context.Context) error {
+			metas, itemErrs, err := s.Collection.RemoveDocuments(ctx, keys)
+			if err != nil {
+				return err
+			}
+
+			var ids []string
+			for j, position := range positions {
+				errs[position] = itemErrs[j]
+				if itemErrs[j] == nil {
+					ids = append(ids, metas[j].ID.String())
+				}
+			}
+			return removeCitations(ctx, s.DBClient.DB, s.Changes, ids)
+		})
+	})
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("failed to delete website documents")
+		return nil, status.Errorf(codes.Internal, "Internal service error. Please try again later.")
+	}
+
+	response := &base.BatchDeleteWebsitesResponse{}
+	for i, key := range req.GetKeys() {
+		response.Results = append(response.Results, &base.BatchDeleteResult{
+			Key:   key,
+			Error: batchError(errs[i]),
+		})
+	}
+	return response, nil
+}
@@ -8,6 +8,7 @@ import (
     "github.com/omnsight/omnibasement/gen/base/v1"
     "github.com/omnsight/omniscent-library/gen/model/v1"
     "github.com/omnsight/omniscent-library/src/clients"
+    "google.golang.org/genproto/googleapis/rpc/errdetails"
     "google.golang.org/grpc/codes"
     "google.golang.org/grpc/status"
 )
@@ -39,8 +40,18 @@ func TestWebsiteService(t *testing.T) {
 		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
 	}
 
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
 	// Create WebsiteService
-	service, err := NewWebsiteService(client)
+	service, err := NewWebsiteService(client, idempotency, changes)
 	if err != nil {
 		t.Fatalf("Failed to create WebsiteService: %v", err)
 	}
@@ -146,4 +157,195 @@ func TestWebsiteService(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("Upsert", func(t *testing.T) {
+		// Upsert a new website
+		upsertReq := &base.UpsertWebsiteRequest{
+			Website: &model.Website{
+				Url:   "https://upsert-example.com",
+				Title: "Example",
+			},
+		}
+
+		firstResp, err := service.UpsertWebsite(context.Background(), upsertReq)
+		if err != nil {
+			t.Fatalf("Failed to upsert website: %v", err)
+		}
+
+		if !firstResp.Created {
+			t.Error("Expected first upsert to create the website")
+		}
+
+		// Upsert the same URL again
+		upsertReq.Website.Title = "Updated Example"
+		secondResp, err := service.UpsertWebsite(context.Background(), upsertReq)
+		if err != nil {
+			t.Fatalf("Failed to upsert website again: %v", err)
+		}
+
+		if secondResp.Created {
+			t.Error("Expected second upsert to update the website")
+		}
+
+		if secondResp.Website.Key != firstResp.Website.Key {
+			t.Errorf("Expected key to be '%s', got '%s'", firstResp.Website.Key, secondResp.Website.Key)
+		}
+
+		if secondResp.Website.Title != "Updated Example" {
+			t.Errorf("Expected title to be 'Updated Example', got '%s'", secondResp.Website.Title)
+		}
+
+		// Creating a website with the same URL should fail
+		_, err = service.CreateWebsite(context.Background(), &base.CreateWebsiteRequest{
+			Website: &model.Website{
+				Url: "https://upsert-example.com",
+			},
+		})
+		if err == nil {
+			t.Error("Expected error when creating a website with a duplicate URL")
+		} else {
+			if status.Code(err) != codes.AlreadyExists {
+				t.Errorf("Expected AlreadyExists error, got: %v", err)
+			}
+		}
+
+		// Delete the website
+		_, err = service.DeleteWebsite(context.Background(), &base.DeleteWebsiteRequest{
+			Key: firstResp.Website.Key,
+		})
+		if err != nil {
+			t.Fatalf("Failed to delete website: %v", err)
+		}
+	})
+}
+
+func TestWebsiteURLs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+
+	client, err := clients.NewArangoDBClient()
+	if err != nil {
+		t.Skipf("Skipping test: failed to create ArangoDB client: %v", err)
+	}
+
+	changes, err := NewChangeLog(client)
+	if err != nil {
+		t.Fatalf("Failed to create ChangeLog: %v", err)
+	}
+
+	idempotency, err := NewIdempotencyStore(client)
+	if err != nil {
+		t.Fatalf("Failed to create IdempotencyStore: %v", err)
+	}
+
+	service, err := NewWebsiteService(client, idempotency, changes)
+	if err != nil {
+		t.Fatalf("Failed to create WebsiteService: %v", err)
+	}
+
+	t.Run("Canonical", func(t *testing.T) {
+		resp, err := service.CreateWebsite(context.Background(), &base.CreateWebsiteRequest{
+			Website: &model.Website{Url: "HTTPS://News.Canonical-Example.co.uk:443/Story?utm_source=feed&b=2&a=1&fbclid=x#comments"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create website: %v", err)
+		}
+		defer service.DeleteWebsite(context.Background(), &base.DeleteWebsiteRequest{Key: resp.Website.Key})
+
+		if resp.Website.Url != "https://news.canonical-example.co.uk/Story?a=1&b=2" {
+			t.Errorf("Expected canonical URL, got '%s'", resp.Website.Url)
+		}
+		if resp.Website.Domain != "news.canonical-example.co.uk" {
+			t.Errorf("Expected domain 'news.canonical-example.co.uk', got '%s'", resp.Website.Domain)
+		}
+
+		var stored map[string]interface{}
+		if _, err := service.Collection.ReadDocument(context.Background(), resp.Website.Key, &stored); err != nil {
+			t.Fatalf("Failed to read website: %v", err)
+		}
+		if stored["registrable_domain"] != "canonical-example.co.uk" {
+			t.Errorf("Expected registrable domain 'canonical-example.co.uk', got '%v'", stored["registrable_domain"])
+		}
+
+		// The same URL spelled differently is the same website
+		upsertResp, err := service.UpsertWebsite(context.Background(), &base.UpsertWebsiteRequest{
+			Website: &model.Website{Url: "https://NEWS.canonical-example.co.uk/Story?a=1&b=2&utm_medium=email"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to upsert website: %v", err)
+		}
+		if upsertResp.Created || upsertResp.Website.Key != resp.Website.Key {
+			t.Errorf("Expected upsert to match website %s", resp.Website.Key)
+		}
+	})
+
+	t.Run("Raw Query", func(t *testing.T) {
+		resp, err := service.CreateWebsite(context.Background(), &base.CreateWebsiteRequest{
+			Website: &model.Website{Url: "https://canonical-example.org/search?q=a;b&flag&utm_source=x"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create website: %v", err)
+		}
+		defer service.DeleteWebsite(context.Background(), &base.DeleteWebsiteRequest{Key: resp.Website.Key})
+
+		if resp.Website.Url != "https://canonical-example.org/search?flag&q=a;b" {
+			t.Errorf("Expected the parameters sorted as written, got '%s'", resp.Website.Url)
+		}
+	})
+
+	t.Run("Backfill", func(t *testing.T) {
+		// Websites stored before URLs were canonicalized
+		meta, err := service.Collection.CreateDocument(context.Background(), map[string]interface{}{
+			"url": "HTTPS://Backfill.Canonical-Example.org:443/Page?b=2&a=1&gclid=x",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create website: %v", err)
+		}
+		defer service.DeleteWebsite(context.Background(), &base.DeleteWebsiteRequest{Key: meta.Key})
+
+		if _, err := service.CanonicalizeURLs(context.Background()); err != nil {
+			t.Fatalf("Failed to canonicalize URLs: %v", err)
+		}
+
+		resp, err := service.GetWebsite(context.Background(), &base.GetWebsiteRequest{Key: meta.Key})
+		if err != nil {
+			t.Fatalf("Failed to get website: %v", err)
+		}
+		if resp.Website.Url != "https://backfill.canonical-example.org/Page?a=1&b=2" || resp.Website.Domain != "backfill.canonical-example.org" {
+			t.Errorf("Expected canonical URL and domain, got %v", resp.Website)
+		}
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		_, err := service.CreateWebsite(context.Background(), &base.CreateWebsiteRequest{
+			Website: &model.Website{Url: "ftp://files.canonical-example.com"},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("Expected InvalidArgument, got %v", err)
+		}
+
+		var field string
+		for _, detail := range status.Convert(err).Details() {
+			if badRequest, ok := detail.(*errdetails.BadRequest); ok && len(badRequest.FieldViolations) > 0 {
+				field = badRequest.FieldViolations[0].Field
+			}
+		}
+		if field != "website.url" {
+			t.Errorf("Expected violation of 'website.url', got '%s'", field)
+		}
+
+		batchResp, err := service.BatchCreateWebsites(context.Background(), &base.BatchCreateWebsitesRequest{
+			Websites: []*model.Website{{Url: "https://batch.canonical-example.com"}, {Url: "https://exa mple.com"}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to batch create websites: %v", err)
+		}
+		if batchResp.Results[0].Error != nil || batchResp.Results[1].Error.GetCode() != int32(codes.InvalidArgument) {
+			t.Errorf("Expected only the malformed website to fail, got %v", batchResp.Results)
+		}
+		if website := batchResp.Results[0].Website; website != nil {
+			service.DeleteWebsite(context.Background(), &base.DeleteWebsiteRequest{Key: website.Key})
+		}
+	})
 }